@@ -0,0 +1,206 @@
+package shapefile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// AttributeIndex is an index over the values of a DBF column, e.g. a
+// .ndx file or a tag of a .mdx or .cdx file.
+type AttributeIndex interface {
+	// Lookup returns the 1 based numbers of the records with the given
+	// key. Keys are strings for character fields, and int, int64,
+	// float64 or time.Time for numeric and date fields.
+	Lookup(key interface{}) ([]uint32, error)
+	// Close closes the underlying file, if it is an io.Closer.
+	Close() error
+}
+
+func closeReader(r io.ReaderAt) error {
+	if c, ok := r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// btreePage is a page of one of the on-disk B-trees. In branch pages
+// ptrs holds the child pages, each key is the largest key of the
+// corresponding child and there may be one more child than keys. In leaf
+// pages ptrs holds the record numbers.
+type btreePage struct {
+	leaf bool
+	keys [][]byte
+	ptrs []int64
+}
+
+// btreeLookup collects the record numbers of all keys for which cmp
+// returns 0. cmp compares a key of the tree to the one looked for.
+func btreeLookup(read func(ptr int64) (*btreePage, error), root int64, cmp func(key []byte) int) (recs []uint32, err error) {
+	var visit func(ptr int64, depth int) error
+	visit = func(ptr int64, depth int) error {
+		if depth > 64 {
+			return fmt.Errorf("index too deep, corrupted?")
+		}
+		p, err := read(ptr)
+		if err != nil {
+			return err
+		}
+		if p.leaf {
+			for i, k := range p.keys {
+				if cmp(k) == 0 {
+					recs = append(recs, uint32(p.ptrs[i]))
+				}
+			}
+			return nil
+		}
+		for i, child := range p.ptrs {
+			if i > 0 && cmp(p.keys[i-1]) > 0 {
+				// the previous child already contains keys larger than the key
+				break
+			}
+			if i < len(p.keys) && cmp(p.keys[i]) < 0 {
+				continue
+			}
+			if err = visit(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err = visit(root, 0)
+	return
+}
+
+// keyNumber converts numeric and date keys to float64, dates are
+// represented as julian day numbers as in dBase indexes.
+func keyNumber(key interface{}) (f float64, ok bool) {
+	switch k := key.(type) {
+	case int:
+		return float64(k), true
+	case int32:
+		return float64(k), true
+	case int64:
+		return float64(k), true
+	case float64:
+		return k, true
+	case time.Time:
+		y, m, d := k.Date()
+		return float64(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix()/86400 + 2440588), true
+	}
+	return 0, false
+}
+
+// compareChar compares a space padded character key to s.
+func compareChar(key []byte, s string) int {
+	return strings.Compare(strings.TrimRight(string(key), " \x00"), strings.TrimRight(s, " "))
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Lookup returns the 1 based record numbers of all rows whose field
+// equals key. If idx is nil, all entries are scanned.
+func (dbf *DBFFile) Lookup(field string, key interface{}, idx AttributeIndex) (recs []uint32, err error) {
+	if idx != nil {
+		return idx.Lookup(key)
+	}
+	col := dbf.fieldIndex(field)
+	if col == -1 {
+		return nil, fmt.Errorf("no such field: %s", field)
+	}
+	for i, entry := range dbf.Entries {
+		if !dbf.isDeleted(i) && valuesEqual(entry[col], key) {
+			recs = append(recs, uint32(i+1))
+		}
+	}
+	return
+}
+
+func (dbf *DBFFile) fieldIndex(field string) int {
+	for i := range dbf.FieldDescriptors {
+		if strings.EqualFold(dbf.FieldDescriptors[i].FieldName(), field) {
+			return i
+		}
+	}
+	return -1
+}
+
+func valuesEqual(v, key interface{}) bool {
+	if s, ok := v.(string); ok {
+		k, ok := key.(string)
+		return ok && strings.TrimRight(s, " ") == strings.TrimRight(k, " ")
+	}
+	var a, b float64
+	var ok bool
+	if a, ok = keyNumber(v); !ok {
+		return false
+	}
+	if b, ok = keyNumber(key); !ok {
+		return false
+	}
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+// FindIndex looks for an index over field next to the .dbf file fn: a
+// tag of the production .mdx or of the structural .cdx file, or a .ndx
+// file named after the field. It returns nil if there is none.
+func FindIndex(fn string, dbf *DBFFile, field string) (idx AttributeIndex, err error) {
+	base := strings.TrimSuffix(fn, ".dbf")
+	base = strings.TrimSuffix(base, ".DBF")
+	if dbf.fieldIndex(field) == -1 {
+		return nil, fmt.Errorf("no such field: %s", field)
+	}
+
+	var file *os.File
+	if dbf.DBFFileHeader.MDXFlag != 0 {
+		if file, err = openSibling(base, ".mdx"); err == nil {
+			var mdx *MDXFile
+			if mdx, err = NewMDXFile(file); err != nil {
+				file.Close()
+				return
+			}
+			if tag := mdx.Tag(field); tag != nil {
+				return tag, nil
+			}
+			file.Close()
+		} else if !os.IsNotExist(err) {
+			return
+		}
+	}
+	if file, err = openSibling(base, ".cdx"); err == nil {
+		var cdx *CDXFile
+		if cdx, err = NewCDXFile(file); err != nil {
+			file.Close()
+			return
+		}
+		if tag := cdx.Tag(field); tag != nil {
+			return tag, nil
+		}
+		file.Close()
+	} else if !os.IsNotExist(err) {
+		return
+	}
+	dir := base[:strings.LastIndexAny(base, "/\\")+1]
+	if file, err = openSibling(dir+field, ".ndx"); err == nil {
+		var ndx *NDXFile
+		if ndx, err = NewNDXFile(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return ndx, nil
+	} else if !os.IsNotExist(err) {
+		return
+	}
+	return nil, nil
+}
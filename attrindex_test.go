@@ -0,0 +1,309 @@
+package shapefile
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type indexEntry struct {
+	key []byte
+	rec uint32
+}
+
+// wahlkreisKeys returns the sorted (key, record number) pairs of a column
+// of the test .dbf, encoded by enc.
+func wahlkreisKeys(t *testing.T, field string, enc func(v interface{}) []byte) (dbf *DBFFile, entries []indexEntry) {
+	file, _ := os.Open(dbf_test_fn)
+	defer file.Close()
+	dbf, err := NewDBFFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	col := dbf.fieldIndex(field)
+	for i, e := range dbf.Entries {
+		entries = append(entries, indexEntry{enc(e[col]), uint32(i + 1)})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+	return
+}
+
+func padded(v interface{}, l int) []byte {
+	s := strings.TrimRight(v.(string), " ")
+	return []byte(s + strings.Repeat(" ", l-len(s)))
+}
+
+// leaves splits entries into chunks of n.
+func leaves(entries []indexEntry, n int) (chunks [][]indexEntry) {
+	for i := 0; i < len(entries); i += n {
+		chunks = append(chunks, entries[i:min(i+n, len(entries))])
+	}
+	return
+}
+
+func checkLookup(t *testing.T, dbf *DBFFile, field string, idx AttributeIndex, key interface{}) {
+	expected, err := dbf.Lookup(field, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, err := dbf.Lookup(field, key, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i] < found[j] })
+	if fmt.Sprint(found) != fmt.Sprint(expected) {
+		t.Errorf("%s = %v: expected %v, found %v", field, key, expected, found)
+	}
+}
+
+func TestNDX(t *testing.T) {
+	const keyLen, recSize = 8, 16
+	dbf, entries := wahlkreisKeys(t, "WKR_NR", func(v interface{}) []byte {
+		k := make([]byte, 8)
+		L.PutUint64(k, math.Float64bits(float64(v.(int64))))
+		return k
+	})
+	// float keys don't sort bytewise
+	sort.SliceStable(entries, func(i, j int) bool {
+		return math.Float64frombits(L.Uint64(entries[i].key)) < math.Float64frombits(L.Uint64(entries[j].key))
+	})
+	var buf bytes.Buffer
+	hdr := make([]byte, ndxPageSize)
+	chunks := leaves(entries, 30)
+	L.PutUint32(hdr, 1) // root
+	L.PutUint32(hdr[4:], uint32(len(chunks)+2))
+	L.PutUint16(hdr[12:], keyLen)
+	L.PutUint16(hdr[14:], 31)
+	L.PutUint16(hdr[16:], 1)
+	L.PutUint32(hdr[18:], recSize)
+	copy(hdr[24:], "WKR_NR")
+	buf.Write(hdr)
+
+	root := make([]byte, ndxPageSize)
+	L.PutUint32(root, uint32(len(chunks)-1))
+	for i, c := range chunks {
+		L.PutUint32(root[4+i*recSize:], uint32(i+2))
+		if i != len(chunks)-1 {
+			copy(root[4+i*recSize+8:], c[len(c)-1].key)
+		}
+	}
+	buf.Write(root)
+	for _, c := range chunks {
+		page := make([]byte, ndxPageSize)
+		L.PutUint32(page, uint32(len(c)))
+		for i, e := range c {
+			L.PutUint32(page[4+i*recSize+4:], e.rec)
+			copy(page[4+i*recSize+8:], e.key)
+		}
+		buf.Write(page)
+	}
+
+	ndx, err := NewNDXFile(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ndx.Header.Expression != "WKR_NR" {
+		t.Errorf("unexpected expression: %s", ndx.Header.Expression)
+	}
+	for _, key := range []interface{}{1, int64(30), 31.0, 150, 299, 0, 1000} {
+		checkLookup(t, dbf, "WKR_NR", ndx, key)
+	}
+	if _, err := ndx.Lookup("42"); err == nil {
+		t.Errorf("expected error looking up a string in a numeric index")
+	}
+}
+
+// bcdKey encodes positive integers as dBase IV numeric keys.
+func bcdKey(n int64) []byte {
+	k := make([]byte, 12)
+	digits := fmt.Sprint(n)
+	k[0] = byte(0x34 + len(digits))
+	k[1] = byte(len(digits) << 2)
+	for i, d := range digits {
+		k[2+i/2] |= byte(d-'0') << (4 * uint(1-i%2))
+	}
+	return k
+}
+
+func TestMDX(t *testing.T) {
+	const blockSize = 1024
+	type tag struct {
+		name    string
+		typ     byte
+		keyLen  int
+		entries []indexEntry
+	}
+	dbf, numbers := wahlkreisKeys(t, "WKR_NR", func(v interface{}) []byte { return bcdKey(v.(int64)) })
+	// BCD keys sort bytewise for positive numbers with the same number of digits only
+	sort.SliceStable(numbers, func(i, j int) bool { return bcdFloat(numbers[i].key) < bcdFloat(numbers[j].key) })
+	_, names := wahlkreisKeys(t, "LAND_NAME", func(v interface{}) []byte { return padded(v, 24) })
+	tags := []tag{{"WKR_NR", 'N', 12, numbers}, {"LAND_NAME", 'C', 24, names}}
+
+	file := make([]byte, 4*512) // header, tag table and tag headers
+	L.PutUint16(file[22:], blockSize)
+	file[24] = 1
+	file[25] = 48
+	file[26] = 32
+	L.PutUint16(file[28:], uint16(len(tags)))
+	for i, tg := range tags {
+		entry := file[544+i*32:]
+		L.PutUint32(entry, uint32(2+i))
+		copy(entry[4:], tg.name)
+		entry[20] = tg.typ
+
+		itemLen := (tg.keyLen + 4 + 3) / 4 * 4
+		chunks := leaves(tg.entries, 20)
+		page := func() []byte { return make([]byte, blockSize) }
+		rootNo := len(file) / 512
+		root := page()
+		L.PutUint32(root, uint32(len(chunks)-1))
+		for j, c := range chunks {
+			L.PutUint32(root[8+j*itemLen:], uint32(rootNo+2*(j+1)))
+			if j != len(chunks)-1 {
+				copy(root[8+j*itemLen+4:], c[len(c)-1].key)
+			}
+		}
+		file = append(file, root...)
+		for _, c := range chunks {
+			leaf := page()
+			L.PutUint32(leaf, uint32(len(c)))
+			for k, e := range c {
+				L.PutUint32(leaf[8+k*itemLen:], e.rec)
+				copy(leaf[8+k*itemLen+4:], e.key)
+			}
+			file = append(file, leaf...)
+		}
+
+		hdr := file[(2+i)*512:]
+		L.PutUint32(hdr, uint32(rootNo))
+		hdr[8] = 0x10
+		hdr[9] = tg.typ
+		L.PutUint16(hdr[12:], uint16(tg.keyLen))
+		L.PutUint16(hdr[18:], uint16(itemLen))
+		copy(hdr[24:], tg.name)
+	}
+
+	mdx, err := NewMDXFile(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mdx.Tags) != 2 || mdx.Tag("wkr_nr") == nil || mdx.Tag("nope") != nil {
+		t.Fatalf("unexpected tags")
+	}
+	for _, key := range []interface{}{int64(1), 42, 99.0, int64(299), 300} {
+		checkLookup(t, dbf, "WKR_NR", mdx.Tag("WKR_NR"), key)
+	}
+	for _, key := range []string{"Bayern", "Hamburg", "Th\xfcringen"} {
+		checkLookup(t, dbf, "LAND_NAME", mdx.Tag("LAND_NAME"), key)
+	}
+}
+
+// cdxLeaf writes a compressed leaf node, trailing fill bytes and bytes
+// shared with the previous key are omitted.
+func cdxLeaf(entries []indexEntry, keyLen int, fill byte) []byte {
+	node := make([]byte, cdxNodeSize)
+	L.PutUint16(node, 2)
+	L.PutUint16(node[2:], uint16(len(entries)))
+	L.PutUint32(node[14:], 0xffff)
+	node[18], node[19] = 0xff, 0xff
+	node[20], node[21], node[22], node[23] = 16, 8, 8, 4
+	pos := cdxNodeSize
+	var prev []byte
+	for i, e := range entries {
+		trail := 0
+		for trail < keyLen && e.key[keyLen-1-trail] == fill {
+			trail++
+		}
+		dup := 0
+		for prev != nil && dup < keyLen-trail && prev[dup] == e.key[dup] {
+			dup++
+		}
+		data := e.key[dup : keyLen-trail]
+		pos -= len(data)
+		copy(node[pos:], data)
+		L.PutUint32(node[24+i*4:], e.rec|uint32(dup)<<16|uint32(trail)<<24)
+		prev = e.key
+	}
+	return node
+}
+
+// cdxTree writes an interior root node and leaves for entries at off,
+// returning the nodes.
+func cdxTree(entries []indexEntry, keyLen int, fill byte, off int) []byte {
+	chunks := leaves(entries, 20)
+	root := make([]byte, cdxNodeSize)
+	L.PutUint16(root, 1)
+	L.PutUint16(root[2:], uint16(len(chunks)))
+	var nodes []byte
+	for i, c := range chunks {
+		e := root[12+i*(keyLen+8):]
+		copy(e, c[len(c)-1].key)
+		B.PutUint32(e[keyLen:], c[len(c)-1].rec)
+		B.PutUint32(e[keyLen+4:], uint32(off+(i+1)*cdxNodeSize))
+		nodes = append(nodes, cdxLeaf(c, keyLen, fill)...)
+	}
+	return append(root, nodes...)
+}
+
+func cdxHeader(root, keyLen int, expr string) []byte {
+	hdr := make([]byte, 1024)
+	L.PutUint32(hdr, uint32(root))
+	L.PutUint16(hdr[12:], uint16(keyLen))
+	hdr[14] = 0x20 | 0x40
+	copy(hdr[512:], expr)
+	return hdr
+}
+
+func TestCDX(t *testing.T) {
+	dbf, numbers := wahlkreisKeys(t, "WKR_NR", func(v interface{}) []byte { return cdxFloatKey(float64(v.(int64))) })
+	_, names := wahlkreisKeys(t, "LAND_NAME", func(v interface{}) []byte { return padded(v, 24) })
+
+	// directory header at 0, directory leaf at 1024, tag headers at 1536
+	// and 2560, followed by the trees.
+	var file bytes.Buffer
+	dir := []indexEntry{{padded("LAND_NAME", 10), 2560}, {padded("WKR_NR", 10), 1536}}
+	file.Write(cdxHeader(1024, 10, ""))
+	file.Write(cdxLeaf(dir, 10, ' '))
+	numOff := 3584
+	nameOff := numOff + (len(leaves(numbers, 20))+1)*cdxNodeSize
+	file.Write(cdxHeader(numOff, 8, "WKR_NR"))
+	file.Write(cdxHeader(nameOff, 24, "LAND_NAME"))
+	file.Write(cdxTree(numbers, 8, 0, numOff))
+	file.Write(cdxTree(names, 24, ' ', nameOff))
+
+	cdx, err := NewCDXFile(bytes.NewReader(file.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cdx.Tags) != 2 || cdx.Tag("WKR_NR").Expression != "WKR_NR" {
+		t.Fatalf("unexpected tags: %v", cdx.Tags)
+	}
+	for _, key := range []interface{}{int64(1), 42, 256.0, int64(299), -1} {
+		checkLookup(t, dbf, "WKR_NR", cdx.Tag("WKR_NR"), key)
+	}
+	for _, key := range []string{"Bayern", "Berlin", "Th\xfcringen", ""} {
+		checkLookup(t, dbf, "LAND_NAME", cdx.Tag("LAND_NAME"), key)
+	}
+}
+
+func TestDatasetLookup(t *testing.T) {
+	// no index files exist for the test data, rows are scanned
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	features, err := ds.Lookup("WKR_NR", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 1 || features[0].Attributes[0].(int64) != 42 {
+		t.Errorf("unexpected result: %v", features)
+	}
+	if _, err = ds.Lookup("NOPE", 1); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+}
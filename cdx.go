@@ -0,0 +1,216 @@
+package shapefile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// FoxPro .cdx compound index files, see:
+// http://www.clicketyclick.dk/databases/xbase/format/cdx.html
+//
+// The file starts with a 1024 byte header whose B-tree maps the tag names
+// to the offsets of the tag headers, which have the same layout. All
+// nodes are 512 bytes, pointers are byte offsets. Interior nodes contain
+// (key, record number, child) entries with big endian numbers. Leaf
+// nodes are compressed: a table of bit packed (record number, duplicate
+// bytes, trailing bytes) values at the start, and the remainder of each
+// key stored backwards from the end of the node. Numeric and date keys
+// are big endian float64 with the sign bit flipped (all bits if
+// negative), so keys sort bytewise.
+
+const cdxNodeSize = 512
+
+type CDXFile struct {
+	Tags []*CDXTag
+	r    io.ReaderAt
+}
+
+type CDXTag struct {
+	Name       string
+	Root       uint32
+	KeyLength  uint16
+	Unique     bool
+	Descending bool
+	Expression string
+	cdx        *CDXFile
+}
+
+func NewCDXFile(r io.ReaderAt) (cdx *CDXFile, err error) {
+	cdx = &CDXFile{r: r}
+	var dir *CDXTag
+	if dir, err = cdx.readTag(0); err != nil {
+		return nil, err
+	}
+	err = cdx.walk(dir, int64(dir.Root), 0, ' ', func(key []byte, rec int64) error {
+		tag, err := cdx.readTag(rec)
+		if err != nil {
+			return err
+		}
+		tag.Name = cString(key)
+		cdx.Tags = append(cdx.Tags, tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+func (cdx *CDXFile) readTag(off int64) (tag *CDXTag, err error) {
+	raw := make([]byte, 1024)
+	if _, err = cdx.r.ReadAt(raw, off); err != nil {
+		return
+	}
+	tag = &CDXTag{
+		Root:       L.Uint32(raw),
+		KeyLength:  L.Uint16(raw[12:]),
+		Unique:     raw[14]&0x01 != 0,
+		Descending: L.Uint16(raw[502:]) != 0,
+		Expression: cString(raw[512:]),
+		cdx:        cdx,
+	}
+	if raw[14]&0x20 == 0 {
+		return nil, fmt.Errorf("only compact indexes are supported")
+	}
+	if tag.KeyLength == 0 || tag.KeyLength > 240 {
+		return nil, fmt.Errorf("invalid key length: %d", tag.KeyLength)
+	}
+	return
+}
+
+// Tag returns the tag with the given name, nil if there is none.
+func (cdx *CDXFile) Tag(name string) *CDXTag {
+	for _, t := range cdx.Tags {
+		if strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (cdx *CDXFile) Close() error {
+	return closeReader(cdx.r)
+}
+
+// readNode reads the node at off, trailing bytes removed by the leaf
+// compression are restored as fill.
+func (cdx *CDXFile) readNode(tag *CDXTag, off int64, fill byte) (p *btreePage, err error) {
+	raw := make([]byte, cdxNodeSize)
+	if _, err = cdx.r.ReadAt(raw, off); err != nil {
+		return
+	}
+	n := int(L.Uint16(raw[2:]))
+	keyLen := int(tag.KeyLength)
+	p = &btreePage{leaf: L.Uint16(raw)&0x02 != 0}
+
+	if !p.leaf {
+		if 12+n*(keyLen+8) > cdxNodeSize {
+			return nil, fmt.Errorf("invalid number of keys in node %d: %d", off, n)
+		}
+		for i := 0; i != n; i++ {
+			e := raw[12+i*(keyLen+8):]
+			p.keys = append(p.keys, e[:keyLen])
+			p.ptrs = append(p.ptrs, int64(B.Uint32(e[keyLen+4:])))
+		}
+		return
+	}
+
+	recMask := uint64(L.Uint32(raw[14:]))
+	dupMask, trailMask := uint64(raw[18]), uint64(raw[19])
+	recBits, dupBits := uint(raw[20]), uint(raw[21])
+	infoLen := int(raw[23])
+	if infoLen < 1 || infoLen > 8 || 24+n*infoLen > cdxNodeSize {
+		return nil, fmt.Errorf("invalid leaf node %d", off)
+	}
+	prev := bytes.Repeat([]byte{fill}, keyLen)
+	pos := cdxNodeSize
+	for i := 0; i != n; i++ {
+		var v uint64
+		for j := infoLen - 1; j >= 0; j-- {
+			v = v<<8 | uint64(raw[24+i*infoLen+j])
+		}
+		rec := v & recMask
+		dup := int((v >> recBits) & dupMask)
+		trail := int((v >> (recBits + dupBits)) & trailMask)
+		l := keyLen - dup - trail
+		if l < 0 || pos-l < 24+n*infoLen {
+			return nil, fmt.Errorf("invalid key %d in node %d", i, off)
+		}
+		pos -= l
+		key := make([]byte, 0, keyLen)
+		key = append(key, prev[:dup]...)
+		key = append(key, raw[pos:pos+l]...)
+		key = append(key, bytes.Repeat([]byte{fill}, trail)...)
+		p.keys = append(p.keys, key)
+		p.ptrs = append(p.ptrs, int64(rec))
+		prev = key
+	}
+	return
+}
+
+// walk calls f for every key in the leaves below the node at off.
+func (cdx *CDXFile) walk(tag *CDXTag, off int64, depth int, fill byte, f func(key []byte, rec int64) error) error {
+	if depth > 64 {
+		return fmt.Errorf("index too deep, corrupted?")
+	}
+	p, err := cdx.readNode(tag, off, fill)
+	if err != nil {
+		return err
+	}
+	for i, ptr := range p.ptrs {
+		if p.leaf {
+			err = f(p.keys[i], ptr)
+		} else {
+			err = cdx.walk(tag, ptr, depth+1, fill, f)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *CDXTag) Lookup(key interface{}) ([]uint32, error) {
+	if t.Descending {
+		return nil, fmt.Errorf("tag %s: descending indexes are not supported", t.Name)
+	}
+	var target []byte
+	fill := byte(0)
+	if s, ok := key.(string); ok {
+		fill = ' '
+		target = []byte(s)
+		for len(target) < int(t.KeyLength) {
+			target = append(target, ' ')
+		}
+	} else if f, ok := keyNumber(key); ok {
+		if t.KeyLength != 8 {
+			return nil, fmt.Errorf("tag %s: not a numeric index", t.Name)
+		}
+		target = cdxFloatKey(f)
+	} else {
+		return nil, fmt.Errorf("can't look up: %v", key)
+	}
+	read := func(ptr int64) (*btreePage, error) { return t.cdx.readNode(t, ptr, fill) }
+	return btreeLookup(read, int64(t.Root), func(k []byte) int { return bytes.Compare(k, target) })
+}
+
+func (t *CDXTag) Close() error {
+	return t.cdx.Close()
+}
+
+// cdxFloatKey encodes f so that keys sort bytewise.
+func cdxFloatKey(f float64) []byte {
+	k := make([]byte, 8)
+	B.PutUint64(k, math.Float64bits(f))
+	if k[0]&0x80 == 0 {
+		k[0] |= 0x80
+	} else {
+		for i := range k {
+			k[i] = ^k[i]
+		}
+	}
+	return k
+}
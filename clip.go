@@ -0,0 +1,423 @@
+package shapefile
+
+import (
+	"math"
+	"sort"
+)
+
+// vertex is a point along with its Z and M values, which are
+// interpolated linearly where edges are cut.
+type vertex struct {
+	X, Y, Z, M float64
+}
+
+func (v vertex) point() Point {
+	return Point{v.X, v.Y}
+}
+
+func lerp(a, b vertex, t float64) vertex {
+	return vertex{a.X + t*(b.X-a.X), a.Y + t*(b.Y-a.Y), a.Z + t*(b.Z-a.Z), a.M + t*(b.M-a.M)}
+}
+
+// verticesOf returns the vertices of the shape grouped by parts as
+// partsOf does, along with their Z and M values if present.
+func verticesOf(content RecordContent) (parts [][]vertex, areal bool) {
+	var points []Point
+	var z, m []float64
+	var starts []int32
+	switch s := content.(type) {
+	case *PointM:
+		return [][]vertex{{{s.X, s.Y, 0, s.M}}}, false
+	case *PointZ:
+		return [][]vertex{{{s.X, s.Y, s.Z, s.M}}}, false
+	case *MultiPointM:
+		points, m = s.Points, s.MArray
+	case *MultiPointZ:
+		points, z, m = s.Points, s.ZArray, s.MArray
+	case *PolyLineM:
+		points, m, starts = s.Points, s.MArray, s.Parts
+	case *PolygonM:
+		points, m, starts, areal = s.Points, s.MArray, s.Parts, true
+	case *PolyLineZ:
+		points, z, m, starts = s.Points, s.ZArray, s.MArray, s.Parts
+	case *PolygonZ:
+		points, z, m, starts, areal = s.Points, s.ZArray, s.MArray, s.Parts, true
+	case *MultiPatch:
+		points, z, m, starts = s.Points, s.ZArray, s.MArray, s.Parts
+	default:
+		pts, areal := partsOf(content)
+		for _, part := range pts {
+			var vs []vertex
+			for _, p := range part {
+				vs = append(vs, vertex{X: p.X, Y: p.Y})
+			}
+			parts = append(parts, vs)
+		}
+		return parts, areal
+	}
+	vs := make([]vertex, len(points))
+	for i, p := range points {
+		vs[i] = vertex{X: p.X, Y: p.Y}
+		if len(z) == len(points) {
+			vs[i].Z = z[i]
+		}
+		if len(m) == len(points) {
+			vs[i].M = m[i]
+		}
+	}
+	if starts == nil {
+		for i := range vs {
+			parts = append(parts, vs[i:i+1])
+		}
+		return
+	}
+	for i, start := range starts {
+		end := int32(len(vs))
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		if start >= 0 && start <= end && end <= int32(len(vs)) {
+			parts = append(parts, vs[start:end])
+		}
+	}
+	return
+}
+
+// withVertices returns a shape of the same type as content made up of
+// the given parts, or nil if there are none. Z and M values are only kept
+// by types which have them.
+func withVertices(content RecordContent, parts [][]vertex) RecordContent {
+	var points []Point
+	var z, m []float64
+	var starts []int32
+	for _, part := range parts {
+		if len(part) == 0 {
+			continue
+		}
+		starts = append(starts, int32(len(points)))
+		for _, v := range part {
+			points = append(points, v.point())
+			z = append(z, v.Z)
+			m = append(m, v.M)
+		}
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	var zr ZRange
+	var mr MRange
+	zr.Zmin, zr.Zmax = rangeOf(z, 0, 0)
+	mr.Mmin, mr.Mmax = rangeOf(m, 0, 0)
+	var out RecordContent
+	switch content.(type) {
+	case *Point:
+		out = &points[0]
+	case *PointM:
+		out = &PointM{points[0].X, points[0].Y, m[0]}
+	case *PointZ:
+		out = &PointZ{points[0].X, points[0].Y, z[0], m[0]}
+	case *MultiPoint:
+		out = &MultiPoint{NumPoints: int32(len(points)), Points: points}
+	case *MultiPointM:
+		out = &MultiPointM{Points: points, MRange: mr, MArray: m}
+	case *MultiPointZ:
+		out = &MultiPointZ{Points: points, ZRange: zr, ZArray: z, MRange: mr, MArray: m}
+	case *PolyLine:
+		out = &PolyLine{Parts: starts, Points: points}
+	case *Polygon:
+		out = &Polygon{PolyLine{Parts: starts, Points: points}}
+	case *PolyLineM:
+		out = &PolyLineM{Parts: starts, Points: points, MRange: mr, MArray: m}
+	case *PolygonM:
+		out = &PolygonM{PolyLineM{Parts: starts, Points: points, MRange: mr, MArray: m}}
+	case *PolyLineZ:
+		out = &PolyLineZ{NumParts: int32(len(starts)), NumPoints: int32(len(points)), Parts: starts, Points: points, ZRange: zr, ZArray: z, MRange: mr, MArray: m}
+	case *PolygonZ:
+		out = &PolygonZ{PolyLineZ{NumParts: int32(len(starts)), NumPoints: int32(len(points)), Parts: starts, Points: points, ZRange: zr, ZArray: z, MRange: mr, MArray: m}}
+	default:
+		return nil
+	}
+	updateBox(out)
+	return out
+}
+
+// ClipToBox returns the part of the shape within b, or nil if nothing of
+// it lies within b. Polygon rings are clipped using Sutherland-Hodgman,
+// which may leave edges running along the border of b where a concave
+// polygon leaves and reenters it. Lines are clipped using Liang-Barsky.
+// Z and M values are interpolated at the cuts. MultiPatch shapes are
+// kept whole if their bounding box intersects b.
+func ClipToBox(content RecordContent, b Box) RecordContent {
+	sb, ok := boxOf(content)
+	if !ok || !sb.Intersects(b) {
+		return nil
+	}
+	if boxContains(b, sb) {
+		return content
+	}
+	if _, ok := content.(*MultiPatch); ok {
+		return content
+	}
+	parts, areal := verticesOf(content)
+	var clipped [][]vertex
+	for _, part := range parts {
+		switch {
+		case areal:
+			if ring := clipRing(part, b); ring != nil {
+				clipped = append(clipped, ring)
+			}
+		case len(part) == 1:
+			p := part[0]
+			if p.X >= b.Xmin && p.X <= b.Xmax && p.Y >= b.Ymin && p.Y <= b.Ymax {
+				clipped = append(clipped, part)
+			}
+		default:
+			clipped = append(clipped, clipLine(part, b)...)
+		}
+	}
+	return withVertices(content, clipped)
+}
+
+// clipRing clips a ring against each side of b in turn.
+func clipRing(ring []vertex, b Box) []vertex {
+	if len(ring) > 1 && ring[0] == ring[len(ring)-1] {
+		ring = ring[:len(ring)-1]
+	}
+	sides := []struct {
+		inside func(v vertex) bool
+		cut    func(a, b vertex) float64
+	}{
+		{func(v vertex) bool { return v.X >= b.Xmin }, func(p, q vertex) float64 { return (b.Xmin - p.X) / (q.X - p.X) }},
+		{func(v vertex) bool { return v.X <= b.Xmax }, func(p, q vertex) float64 { return (b.Xmax - p.X) / (q.X - p.X) }},
+		{func(v vertex) bool { return v.Y >= b.Ymin }, func(p, q vertex) float64 { return (b.Ymin - p.Y) / (q.Y - p.Y) }},
+		{func(v vertex) bool { return v.Y <= b.Ymax }, func(p, q vertex) float64 { return (b.Ymax - p.Y) / (q.Y - p.Y) }},
+	}
+	for _, side := range sides {
+		var out []vertex
+		for i, cur := range ring {
+			prev := ring[(i+len(ring)-1)%len(ring)]
+			switch {
+			case side.inside(cur):
+				if !side.inside(prev) {
+					out = append(out, lerp(prev, cur, side.cut(prev, cur)))
+				}
+				out = append(out, cur)
+			case side.inside(prev):
+				out = append(out, lerp(prev, cur, side.cut(prev, cur)))
+			}
+		}
+		ring = out
+		if len(ring) == 0 {
+			return nil
+		}
+	}
+	if len(ring) < 3 {
+		return nil
+	}
+	return append(ring, ring[0])
+}
+
+// clipLine clips every segment of the line using Liang-Barsky, joining
+// consecutive pieces.
+func clipLine(line []vertex, b Box) (parts [][]vertex) {
+	var cur []vertex
+	for i := 1; i < len(line); i++ {
+		p, q := line[i-1], line[i]
+		t0, t1 := 0.0, 1.0
+		dx, dy := q.X-p.X, q.Y-p.Y
+		visible := true
+		for _, c := range [][2]float64{{-dx, p.X - b.Xmin}, {dx, b.Xmax - p.X}, {-dy, p.Y - b.Ymin}, {dy, b.Ymax - p.Y}} {
+			pk, qk := c[0], c[1]
+			if pk == 0 {
+				if qk < 0 {
+					visible = false
+				}
+				continue
+			}
+			t := qk / pk
+			if pk < 0 {
+				t0 = math.Max(t0, t)
+			} else {
+				t1 = math.Min(t1, t)
+			}
+		}
+		if !visible || t0 > t1 {
+			if cur != nil {
+				parts = append(parts, cur)
+				cur = nil
+			}
+			continue
+		}
+		start, end := p, q
+		if t0 > 0 {
+			start = lerp(p, q, t0)
+		}
+		if t1 < 1 {
+			end = lerp(p, q, t1)
+		}
+		if cur == nil || t0 > 0 {
+			if cur != nil {
+				parts = append(parts, cur)
+			}
+			cur = []vertex{start}
+		}
+		cur = append(cur, end)
+		if t1 < 1 {
+			parts = append(parts, cur)
+			cur = nil
+		}
+	}
+	if cur != nil {
+		parts = append(parts, cur)
+	}
+	return
+}
+
+// Clip returns the part of the shape within the polygon mask, or nil if
+// nothing of it lies within the mask. Z and M values are interpolated
+// where edges are cut; vertices of the result contributed by the mask
+// get values interpolated between their neighbours along the ring.
+// MultiPatch shapes are kept whole if they intersect the mask.
+func Clip(content, mask RecordContent) RecordContent {
+	rings, areal := partsOf(mask)
+	if !areal {
+		return nil
+	}
+	m := geomOf(mask)
+	sb, ok := boxOf(content)
+	if !ok || m.empty || !sb.Intersects(m.box) {
+		return nil
+	}
+	if _, ok := content.(*MultiPatch); ok {
+		if Intersects(content, mask) {
+			return content
+		}
+		return nil
+	}
+	maskEdges := ringEdges(rings)
+	tree := edgeTree(maskEdges)
+	// crossings returns where the segment from p to q meets the mask's
+	// boundary as fractions of its length.
+	crossings := func(p, q Point) (ts []float64) {
+		l := math.Hypot(q.X-p.X, q.Y-p.Y)
+		if l == 0 {
+			return
+		}
+		for i := range tree.Search(edgeBox(edge{p, q})) {
+			for _, x := range segmentIntersections(p, q, maskEdges[i].from, maskEdges[i].to) {
+				ts = append(ts, math.Hypot(x.X-p.X, x.Y-p.Y)/l)
+			}
+		}
+		return
+	}
+
+	parts, subjectAreal := verticesOf(content)
+	var clipped [][]vertex
+	if subjectAreal {
+		// remember the Z and M values along the subject's edges
+		values := map[Point]vertex{}
+		var subject [][]Point
+		for _, ring := range parts {
+			var pts []Point
+			for i, v := range ring {
+				values[v.point()] = v
+				pts = append(pts, v.point())
+				if i == 0 {
+					continue
+				}
+				p, q := ring[i-1], v
+				for _, t := range crossings(p.point(), q.point()) {
+					x := lerp(p, q, t)
+					if _, ok := values[x.point()]; !ok {
+						values[x.point()] = x
+					}
+				}
+			}
+			subject = append(subject, pts)
+		}
+		for _, ring := range overlay(subject, rings, opIntersection) {
+			clipped = append(clipped, interpolateRing(ring, values))
+		}
+		return withVertices(content, clipped)
+	}
+	for _, part := range parts {
+		if len(part) == 1 {
+			if m.locate(part[0].point()) != exterior {
+				clipped = append(clipped, part)
+			}
+			continue
+		}
+		// split the segments where they cross the mask's boundary and
+		// keep the pieces inside.
+		var cur []vertex
+		for i := 1; i < len(part); i++ {
+			p, q := part[i-1], part[i]
+			ts := append([]float64{0, 1}, crossings(p.point(), q.point())...)
+			sort.Float64s(ts)
+			for k := 1; k < len(ts); k++ {
+				if ts[k] == ts[k-1] {
+					continue
+				}
+				if m.locate(lerp(p, q, (ts[k-1]+ts[k])/2).point()) == exterior {
+					if cur != nil {
+						clipped = append(clipped, cur)
+						cur = nil
+					}
+					continue
+				}
+				if cur == nil {
+					cur = []vertex{lerp(p, q, ts[k-1])}
+				}
+				cur = append(cur, lerp(p, q, ts[k]))
+			}
+		}
+		if cur != nil {
+			clipped = append(clipped, cur)
+		}
+	}
+	return withVertices(content, clipped)
+}
+
+// interpolateRing attaches the Z and M values to the vertices of ring,
+// interpolating those missing from values along the ring.
+func interpolateRing(ring []Point, values map[Point]vertex) []vertex {
+	out := make([]vertex, len(ring))
+	known := make([]bool, len(ring))
+	found := false
+	for i, p := range ring {
+		out[i] = vertex{X: p.X, Y: p.Y}
+		if v, ok := values[p]; ok {
+			out[i], known[i], found = v, true, true
+		}
+	}
+	if !found {
+		return out
+	}
+	n := len(ring) - 1 // the ring is closed
+	dist := func(i, j int) (d float64) {
+		for k := i; k != j; k = (k + 1) % n {
+			d += math.Hypot(ring[(k+1)%n].X-ring[k].X, ring[(k+1)%n].Y-ring[k].Y)
+		}
+		return
+	}
+	for i := 0; i < n; i++ {
+		if known[i] {
+			continue
+		}
+		prev, next := i, i
+		for !known[prev] {
+			prev = (prev + n - 1) % n
+		}
+		for !known[next] {
+			next = (next + 1) % n
+		}
+		t := 0.0
+		if total := dist(prev, next); total != 0 && prev != next {
+			t = dist(prev, i) / total
+		}
+		v := lerp(out[prev], out[next], t)
+		out[i].Z, out[i].M = v.Z, v.M
+	}
+	out[n] = out[0]
+	return out
+}
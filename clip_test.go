@@ -0,0 +1,121 @@
+package shapefile
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClipToBox(t *testing.T) {
+	pg := polygon(square(0, 0, 10, 10), square(2, 2, 4, 4))
+	clipped := ClipToBox(pg, Box{3, 3, 15, 15}).(*Polygon)
+	if a := clipped.Area(); a != 49-1 {
+		t.Errorf("unexpected area: %v", a)
+	}
+	if clipped.Box != (Box{3, 3, 10, 10}) {
+		t.Errorf("unexpected box: %v", clipped.Box)
+	}
+	if ClipToBox(pg, Box{20, 20, 30, 30}) != nil {
+		t.Errorf("expected nothing to remain")
+	}
+	if ClipToBox(pg, Box{-1, -1, 11, 11}) != pg {
+		t.Errorf("expected shape within box to be returned as is")
+	}
+
+	// leaves the box and comes back
+	line := &PolyLineZ{
+		Parts:  []int32{0},
+		Points: []Point{{0, 0}, {10, 0}, {10, 10}, {0, 10}},
+		ZArray: []float64{0, 10, 20, 30},
+		MArray: []float64{0, 1, 2, 3},
+	}
+	cl := ClipToBox(line, Box{2, -1, 8, 11}).(*PolyLineZ)
+	if len(cl.Parts) != 2 || len(cl.Points) != 4 {
+		t.Fatalf("unexpected parts: %v %v", cl.Parts, cl.Points)
+	}
+	want := []vertex{{2, 0, 2, 0.2}, {8, 0, 8, 0.8}, {8, 10, 22, 2.2}, {2, 10, 28, 2.8}}
+	for i, w := range want {
+		got := vertex{cl.Points[i].X, cl.Points[i].Y, cl.ZArray[i], cl.MArray[i]}
+		if math.Abs(got.Z-w.Z) > 1e-12 || math.Abs(got.M-w.M) > 1e-12 || got.point() != w.point() {
+			t.Errorf("vertex %d: expected %v, got %v", i, w, got)
+		}
+	}
+	if cl.ZRange != (ZRange{2, 28}) {
+		t.Errorf("unexpected z range: %v", cl.ZRange)
+	}
+
+	mp := &MultiPoint{Points: []Point{{0, 0}, {5, 5}, {10, 10}}}
+	if c := ClipToBox(mp, Box{1, 1, 9, 9}).(*MultiPoint); len(c.Points) != 1 || c.Points[0] != (Point{5, 5}) {
+		t.Errorf("unexpected points: %v", c.Points)
+	}
+}
+
+func TestClip(t *testing.T) {
+	// diamond within the square touching its sides
+	mask := polygon([]Point{{5, 0}, {0, 5}, {5, 10}, {10, 5}, {5, 0}})
+	pg := polygon(square(0, 0, 10, 10))
+	if a := Clip(pg, mask).(*Polygon).Area(); a != 50 {
+		t.Errorf("unexpected area: %v", a)
+	}
+	// the hole cuts into the diamond
+	holed := polygon(square(0, 0, 10, 10), square(4, 4, 6, 6))
+	if a := Clip(holed, mask).(*Polygon).Area(); a != 46 {
+		t.Errorf("unexpected area with hole: %v", a)
+	}
+	if Clip(pg, polygon(square(20, 20, 30, 30))) != nil {
+		t.Errorf("expected nothing to remain")
+	}
+
+	// Z is taken along the subject's edges, where Z = X
+	pz := &PolygonZ{PolyLineZ{Parts: []int32{0}, Points: square(0, 0, 10, 10), ZArray: []float64{0, 0, 10, 10, 0}}}
+	cz := Clip(pz, polygon(square(5, -5, 15, 15))).(*PolygonZ)
+	if a := cz.Area(); a != 50 {
+		t.Errorf("unexpected area: %v", a)
+	}
+	for i, p := range cz.Points {
+		if cz.ZArray[i] != p.X {
+			t.Errorf("unexpected Z %v at %v", cz.ZArray[i], p)
+		}
+	}
+
+	// the line crosses the diamond and runs along its boundary
+	line := &PolyLineM{Parts: []int32{0}, Points: []Point{{-5, 5}, {15, 5}, {15, 0}, {5, 0}, {10, 5}}, MArray: []float64{0, 20, 25, 35, 40}}
+	cl := Clip(line, mask).(*PolyLineM)
+	if len(cl.Parts) != 2 {
+		t.Fatalf("unexpected parts: %v %v", cl.Parts, cl.Points)
+	}
+	if cl.Points[0] != (Point{0, 5}) || cl.MArray[0] != 5 || cl.Points[1] != (Point{10, 5}) || cl.MArray[1] != 15 {
+		t.Errorf("unexpected first part: %v %v", cl.Points[:2], cl.MArray[:2])
+	}
+	if l := cl.Length(); math.Abs(l-10-5*math.Sqrt2) > 1e-9 {
+		t.Errorf("unexpected length: %v", l)
+	}
+}
+
+func TestClipWahlkreise(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 20 km square in the middle of Germany
+	b := Box{550000, 5640000, 570000, 5660000}
+	mask := polygon(square(b.Xmin, b.Ymin, b.Xmax, b.Ymax))
+	var boxArea, maskArea float64
+	n := 0
+	for f := range ds.Query(b) {
+		if c := ClipToBox(f.Record.Content, b); c != nil {
+			boxArea += c.(*Polygon).Area()
+			n++
+		}
+		if c := Clip(f.Record.Content, mask); c != nil {
+			maskArea += c.(*Polygon).Area()
+		}
+	}
+	if n < 2 {
+		t.Errorf("expected the box to cover several districts, got %d", n)
+	}
+	for _, a := range []float64{boxArea, maskArea} {
+		if math.Abs(a/4e8-1) > 1e-9 {
+			t.Errorf("unexpected area: %v", a)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// shp2sql writes a shapefile as an SQL script to stdout that loads it
+// into a PostGIS table, like shp2pgsql. The table is named after the
+// file unless given, the SRID is taken from the .prj file. A given table
+// name may be qualified by the schema.
+//
+//	shp2sql -I in.shp public.wahlkreise | psql -d gis
+//	shp2sql -D -batch 10000 -where "LAND_NAME = 'Bayern'" in.shp > bayern.sql
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/a2800276/shapefile"
+)
+
+func main() {
+	srid := flag.Int("s", 0, "`SRID` of the geometries, from the .prj file if 0")
+	geometry := flag.String("g", "geom", "`name` of the geometry column")
+	appendRows := flag.Bool("a", false, "append the rows to an existing table")
+	drop := flag.Bool("d", false, "drop the table before creating it")
+	prepare := flag.Bool("p", false, "only create the table")
+	copyRows := flag.Bool("D", false, "load the rows using COPY instead of INSERT statements")
+	index := flag.Bool("I", false, "create a GiST index on the geometry column")
+	batch := flag.Int("batch", 0, "commit every so many `rows`, all at once if 0")
+	noTx := flag.Bool("e", false, "execute each statement on its own, without a transaction")
+	where := flag.String("where", "", "only load features matching this `filter`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] in.shp [[schema.]table]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	modes := 0
+	for _, m := range []bool{*appendRows, *drop, *prepare} {
+		if m {
+			modes++
+		}
+	}
+	if flag.NArg() < 1 || flag.NArg() > 2 || modes > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts := shapefile.SQLOptions{
+		Table:          flag.Arg(1),
+		GeometryColumn: *geometry,
+		SRID:           *srid,
+		Copy:           *copyRows,
+		Index:          *index,
+		BatchSize:      *batch,
+		NoTransaction:  *noTx,
+	}
+	switch {
+	case *appendRows:
+		opts.Mode = shapefile.SQLAppend
+	case *drop:
+		opts.Mode = shapefile.SQLReplace
+	case *prepare:
+		opts.Mode = shapefile.SQLPrepare
+	}
+	if err := run(flag.Arg(0), *where, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "shp2sql: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, where string, opts shapefile.SQLOptions) (err error) {
+	base := strings.TrimSuffix(in, filepath.Ext(in))
+	if opts.Table == "" {
+		// quoted, so dots in the file name don't name a schema
+		opts.Table = `"` + strings.ReplaceAll(strings.ToLower(filepath.Base(base)), `"`, `""`) + `"`
+	}
+	if opts.SRID == 0 {
+		var crs *shapefile.CRS
+		if crs, err = readCRS(base + ".prj"); err != nil {
+			return
+		}
+		if crs != nil && crs.EPSG == 0 {
+			fmt.Fprintf(os.Stderr, "shp2sql: unknown coordinate system %s, use -s to set the SRID\n", crs.Name)
+		} else if crs != nil {
+			opts.SRID = crs.EPSG
+		}
+	}
+
+	shp, err := os.Open(in)
+	if err != nil {
+		return
+	}
+	defer shp.Close()
+	var dbfReader io.Reader
+	if dbf, err := os.Open(base + ".dbf"); err == nil {
+		defer dbf.Close()
+		dbfReader = bufio.NewReader(dbf)
+	}
+	r, err := shapefile.NewReader(bufio.NewReader(shp), dbfReader)
+	if err != nil {
+		return
+	}
+	if where != "" {
+		if r.Fields == nil {
+			return fmt.Errorf("can't filter %s: no .dbf file", in)
+		}
+		if r.Filter, err = shapefile.ParseFilter(where, r.Fields); err != nil {
+			return
+		}
+	}
+	return shapefile.WriteSQL(os.Stdout, r, opts)
+}
+
+func readCRS(fn string) (crs *shapefile.CRS, err error) {
+	file, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	defer file.Close()
+	return shapefile.NewCRSFromReader(file)
+}
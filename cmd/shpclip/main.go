@@ -0,0 +1,178 @@
+// shpclip clips all shapes of a shapefile to a bounding box or to the
+// polygons of another shapefile and writes the result to a new shapefile,
+// carrying over the attributes and the .prj file. Shapes falling
+// completely outside are dropped.
+//
+//	shpclip -box 280000,5600000,320000,5650000 in.shp out.shp
+//	shpclip -mask states.shp -mask-where "LAND_NAME = 'Hessen'" in.shp out.shp
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/a2800276/shapefile"
+)
+
+func main() {
+	box := flag.String("box", "", "clip to `xmin,ymin,xmax,ymax`")
+	mask := flag.String("mask", "", "clip to the polygons in this shapefile")
+	where := flag.String("mask-where", "", "only use mask polygons matching this `filter`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s (-box xmin,ymin,xmax,ymax | -mask mask.shp) in.shp out.shp\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 || (*box == "") == (*mask == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0), flag.Arg(1), *box, *mask, *where); err != nil {
+		fmt.Fprintf(os.Stderr, "shpclip: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out, box, mask, where string) (err error) {
+	inBase := strings.TrimSuffix(in, filepath.Ext(in))
+	crs, err := readCRS(inBase + ".prj")
+	if err != nil {
+		return
+	}
+
+	var clip func(shapefile.RecordContent) shapefile.RecordContent
+	if box != "" {
+		var b shapefile.Box
+		if b, err = parseBox(box); err != nil {
+			return
+		}
+		clip = func(c shapefile.RecordContent) shapefile.RecordContent { return shapefile.ClipToBox(c, b) }
+	} else {
+		var m *shapefile.Polygon
+		if m, err = readMask(mask, where, crs); err != nil {
+			return
+		}
+		clip = func(c shapefile.RecordContent) shapefile.RecordContent { return shapefile.Clip(c, m) }
+	}
+
+	shp, err := os.Open(in)
+	if err != nil {
+		return
+	}
+	defer shp.Close()
+	var dbfReader io.Reader
+	if dbf, err := os.Open(inBase + ".dbf"); err == nil {
+		defer dbf.Close()
+		dbfReader = dbf
+	}
+	r, err := shapefile.NewReader(shp, dbfReader)
+	if err != nil {
+		return
+	}
+
+	w, err := shapefile.CreateShapefile(out, r.Header.ShapeType, r.Fields)
+	if err != nil {
+		return
+	}
+	written, dropped := 0, 0
+	for {
+		var f *shapefile.Feature
+		if f, err = r.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			w.Close()
+			return
+		}
+		content := clip(f.Record.Content)
+		if content == nil {
+			dropped++
+			continue
+		}
+		if err = w.Write(content, f.Attributes); err != nil {
+			w.Close()
+			return
+		}
+		written++
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	if crs != nil {
+		var prj *os.File
+		if prj, err = os.Create(strings.TrimSuffix(out, filepath.Ext(out)) + ".prj"); err != nil {
+			return
+		}
+		defer prj.Close()
+		if err = crs.Write(prj); err != nil {
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d shapes written, %d outside dropped\n", written, dropped)
+	return nil
+}
+
+func readCRS(fn string) (crs *shapefile.CRS, err error) {
+	file, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	defer file.Close()
+	return shapefile.NewCRSFromReader(file)
+}
+
+func parseBox(str string) (b shapefile.Box, err error) {
+	fields := strings.Split(str, ",")
+	if len(fields) != 4 {
+		return b, fmt.Errorf("invalid box: %s", str)
+	}
+	var v [4]float64
+	for i, f := range fields {
+		if v[i], err = strconv.ParseFloat(strings.TrimSpace(f), 64); err != nil {
+			return b, fmt.Errorf("invalid box: %s", str)
+		}
+	}
+	return shapefile.Box{Xmin: v[0], Ymin: v[1], Xmax: v[2], Ymax: v[3]}, nil
+}
+
+// readMask merges the selected polygons of the mask shapefile into a
+// single polygon, reprojected into crs if both files have a .prj.
+func readMask(fn, where string, crs *shapefile.CRS) (mask *shapefile.Polygon, err error) {
+	maskCRS, err := readCRS(strings.TrimSuffix(fn, filepath.Ext(fn)) + ".prj")
+	if err != nil {
+		return
+	}
+	if maskCRS == nil {
+		crs = nil
+	}
+	ds, err := shapefile.OpenDatasetIn(fn, crs)
+	if err != nil {
+		return
+	}
+	var filter *shapefile.Filter
+	if where != "" {
+		if ds.DBF == nil {
+			return nil, fmt.Errorf("can't filter %s: no .dbf file", fn)
+		}
+		if filter, err = shapefile.ParseFilter(where, ds.DBF.FieldDescriptors); err != nil {
+			return
+		}
+	}
+	var polygons []shapefile.RecordContent
+	for _, f := range ds.Features() {
+		if f.Deleted || filter != nil && !filter.Match(f.Attributes) {
+			continue
+		}
+		polygons = append(polygons, f.Record.Content)
+	}
+	if mask = shapefile.UnionAll(polygons); mask == nil {
+		return nil, fmt.Errorf("no mask polygons in %s", fn)
+	}
+	return
+}
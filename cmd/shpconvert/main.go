@@ -0,0 +1,184 @@
+// shpconvert converts between shapefiles and other formats, picked by
+// the file extensions: KML, GPX, CSV and FlatGeobuf files are written
+// from and read into shapefiles. Reading a file with several kinds of
+// shapes writes a shapefile for each, named after the shape type. CSV
+// files are read into points from their longitude and latitude columns.
+//
+//	shpconvert -name-field WKR_NAME in.shp out.kml
+//	shpconvert -name-field NAME -time-field START tracks.shp out.gpx
+//	shpconvert in.gpx out.shp
+//	shpconvert -geometry wkt in.shp out.csv
+//	shpconvert -comma ';' -x RW -y HW -epsg 31467 stations.csv out.shp
+//	shpconvert in.shp out.fgb
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/a2800276/shapefile"
+)
+
+func main() {
+	nameField := flag.String("name-field", "", "`field` naming placemarks, waypoints and tracks")
+	descField := flag.String("desc-field", "", "`field` describing waypoints and tracks")
+	timeField := flag.String("time-field", "", "`field` holding the time of waypoints and the start of tracks")
+	epsg := flag.Int("epsg", 0, "EPSG `code` of the coordinates if there is no .prj file, or of CSV coordinates")
+	geometry := flag.String("geometry", "none", "geometry columns written to CSV: none, wkt, xy (the centroid) or bbox")
+	xField := flag.String("x", "", "CSV `column` of the longitude or x, guessed if empty")
+	yField := flag.String("y", "", "CSV `column` of the latitude or y, guessed if empty")
+	comma := flag.String("comma", ",", "CSV field delimiter, a single `character` or tab")
+	noIndex := flag.Bool("no-index", false, "write FlatGeobuf without a spatial index, keeping the record order")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] in out\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	opts := options{
+		epsg:    *epsg,
+		kml:     shapefile.KMLOptions{NameField: *nameField},
+		gpx:     shapefile.GPXOptions{NameField: *nameField, DescField: *descField, TimeField: *timeField},
+		csvRead: shapefile.CSVReadOptions{XField: *xField, YField: *yField},
+		fgb:     shapefile.FlatGeobufOptions{NoIndex: *noIndex},
+	}
+	err := opts.parseCSV(*geometry, *comma)
+	if err == nil {
+		err = run(flag.Arg(0), flag.Arg(1), opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "shpconvert: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+type options struct {
+	epsg    int
+	kml     shapefile.KMLOptions
+	gpx     shapefile.GPXOptions
+	csv     shapefile.CSVOptions
+	csvRead shapefile.CSVReadOptions
+	fgb     shapefile.FlatGeobufOptions
+}
+
+// parseCSV sets the CSV geometry columns and delimiter from their flags.
+func (opts *options) parseCSV(geometry, comma string) error {
+	columns := map[string]shapefile.GeometryColumns{
+		"none": shapefile.GeometryNone,
+		"wkt":  shapefile.GeometryWKT,
+		"xy":   shapefile.GeometryCentroid,
+		"bbox": shapefile.GeometryBox,
+	}
+	var ok bool
+	if opts.csv.Geometry, ok = columns[geometry]; !ok {
+		return fmt.Errorf("unknown geometry columns: %s", geometry)
+	}
+	if comma == "tab" || comma == `\t` {
+		comma = "\t"
+	}
+	if r := []rune(comma); len(r) == 1 {
+		opts.csv.Comma, opts.csvRead.Comma = r[0], r[0]
+		return nil
+	}
+	return fmt.Errorf("invalid delimiter: %q", comma)
+}
+
+func run(in, out string, opts options) (err error) {
+	from, to := strings.ToLower(filepath.Ext(in)), strings.ToLower(filepath.Ext(out))
+	switch {
+	case from == ".shp" && (to == ".kml" || to == ".gpx" || to == ".csv" || to == ".fgb"):
+		var ds *shapefile.Dataset
+		if ds, err = shapefile.OpenDataset(in); err != nil {
+			return
+		}
+		if opts.epsg != 0 {
+			if ds.CRS, err = shapefile.CRSFromEPSG(opts.epsg); err != nil {
+				return
+			}
+		}
+		return create(out, func(w io.Writer) error {
+			switch to {
+			case ".kml":
+				opts.kml.Name = strings.TrimSuffix(filepath.Base(in), filepath.Ext(in))
+				return shapefile.WriteKML(w, ds, opts.kml)
+			case ".gpx":
+				return shapefile.WriteGPX(w, ds, opts.gpx)
+			case ".fgb":
+				return shapefile.WriteFlatGeobuf(w, ds, opts.fgb)
+			}
+			return shapefile.WriteCSV(w, ds, opts.csv)
+		})
+	case (from == ".kml" || from == ".gpx" || from == ".csv" || from == ".fgb") && to == ".shp":
+		var file *os.File
+		if file, err = os.Open(in); err != nil {
+			return
+		}
+		defer file.Close()
+		var datasets []*shapefile.Dataset
+		switch from {
+		case ".kml":
+			datasets, err = shapefile.ReadKML(file)
+		case ".gpx":
+			datasets, err = shapefile.ReadGPX(file)
+		case ".fgb":
+			var ds *shapefile.Dataset
+			if ds, err = shapefile.ReadFlatGeobuf(file); err == nil {
+				datasets = []*shapefile.Dataset{ds}
+			}
+		default:
+			if opts.epsg != 0 {
+				if opts.csvRead.CRS, err = shapefile.CRSFromEPSG(opts.epsg); err != nil {
+					return
+				}
+			}
+			var ds *shapefile.Dataset
+			if ds, err = shapefile.ReadCSV(file, opts.csvRead); err == nil {
+				datasets = []*shapefile.Dataset{ds}
+			}
+		}
+		if err != nil {
+			return
+		}
+		return save(datasets, out)
+	}
+	return fmt.Errorf("can't convert %s to %s", from, to)
+}
+
+// create writes the file fn using write.
+func create(fn string, write func(w io.Writer) error) (err error) {
+	file, err := os.Create(fn)
+	if err != nil {
+		return
+	}
+	if err = write(file); err != nil {
+		file.Close()
+		return
+	}
+	return file.Close()
+}
+
+// save writes datasets to fn, adding the shape type to the name if
+// there are several.
+func save(datasets []*shapefile.Dataset, fn string) (err error) {
+	if len(datasets) == 0 {
+		return fmt.Errorf("no shapes found")
+	}
+	for _, ds := range datasets {
+		name := fn
+		if len(datasets) > 1 {
+			typ := strings.ToLower(strings.ReplaceAll(ds.Shapefile.Header.ShapeType.String(), "_", ""))
+			name = strings.TrimSuffix(fn, filepath.Ext(fn)) + "_" + typ + ".shp"
+		}
+		if err = ds.Save(name); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,142 @@
+// shprender draws a shapefile into a PNG image, e.g. as a thumbnail for
+// a quick look at the data. Features can be colored by an attribute,
+// by distinct values or in classes of a numeric range.
+//
+//	shprender -width 512 in.shp out.png
+//	shprender -category LAND_NAME -stroke '#ffffff' in.shp out.png
+//	shprender -graduated WKR_NR -from '#ffffcc' -to '#800026' in.shp out.png
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/color"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/a2800276/shapefile"
+)
+
+func main() {
+	width := flag.Int("width", 256, "image width in pixels")
+	height := flag.Int("height", 0, "image height in pixels, 0 to keep the aspect ratio")
+	box := flag.String("box", "", "render the extent `xmin,ymin,xmax,ymax` instead of the whole file")
+	background := flag.String("background", "#ffffff", "background `color`, none for transparent")
+	fill := flag.String("fill", "#c0c0c0", "fill `color` of polygons and points, none for no fill")
+	stroke := flag.String("stroke", "#404040", "`color` of lines and outlines, none for no outlines")
+	strokeWidth := flag.Float64("stroke-width", 1, "line width in pixels")
+	category := flag.String("category", "", "fill by the distinct values of this `field`")
+	graduated := flag.String("graduated", "", "fill by the numeric value of this `field`")
+	from := flag.String("from", "#ffffcc", "`color` of the lowest class with -graduated")
+	to := flag.String("to", "#800026", "`color` of the highest class with -graduated")
+	classes := flag.Int("classes", 5, "number of classes with -graduated")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] in.shp out.png\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 || (*category != "" && *graduated != "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := shapefile.RenderOptions{Width: *width, Height: *height, StrokeWidth: *strokeWidth}
+	var err error
+	if *box != "" {
+		if opts.Extent, err = parseBox(*box); err != nil {
+			fail(err)
+		}
+	}
+	colors := []struct {
+		flag string
+		c    *color.Color
+	}{
+		{*background, &opts.Background}, {*fill, &opts.Style.Fill}, {*stroke, &opts.Style.Stroke},
+	}
+	for _, c := range colors {
+		if *c.c, err = parseColor(c.flag); err != nil {
+			fail(err)
+		}
+	}
+	if err = run(flag.Arg(0), flag.Arg(1), opts, *category, *graduated, *from, *to, *classes); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "shprender: %v\n", err)
+	os.Exit(1)
+}
+
+func run(in, out string, opts shapefile.RenderOptions, category, graduated, from, to string, classes int) (err error) {
+	ds, err := shapefile.OpenDataset(in)
+	if err != nil {
+		return
+	}
+	switch {
+	case category != "":
+		if opts.StyleFunc, err = shapefile.CategoryStyle(ds, category, opts.Style, nil); err != nil {
+			return
+		}
+	case graduated != "":
+		var lo, hi color.Color
+		if lo, err = parseColor(from); err != nil {
+			return
+		}
+		if hi, err = parseColor(to); err != nil {
+			return
+		}
+		if opts.StyleFunc, err = shapefile.GraduatedStyle(ds, graduated, opts.Style, lo, hi, classes); err != nil {
+			return
+		}
+	}
+	img, err := shapefile.Render(ds, opts)
+	if err != nil {
+		return
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return
+	}
+	if err = png.Encode(file, img); err != nil {
+		file.Close()
+		return
+	}
+	return file.Close()
+}
+
+// parseColor parses #rgb, #rrggbb or #rrggbbaa colors, none is nil.
+func parseColor(str string) (c color.Color, err error) {
+	if str == "none" || str == "" {
+		return nil, nil
+	}
+	hex := strings.TrimPrefix(str, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, perr := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || perr != nil {
+		return nil, fmt.Errorf("invalid color: %s", str)
+	}
+	// color.RGBA is alpha premultiplied
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+func parseBox(str string) (b shapefile.Box, err error) {
+	fields := strings.Split(str, ",")
+	if len(fields) != 4 {
+		return b, fmt.Errorf("invalid box: %s", str)
+	}
+	var v [4]float64
+	for i, f := range fields {
+		if v[i], err = strconv.ParseFloat(strings.TrimSpace(f), 64); err != nil {
+			return b, fmt.Errorf("invalid box: %s", str)
+		}
+	}
+	return shapefile.Box{Xmin: v[0], Ymin: v[1], Xmax: v[2], Ymax: v[3]}, nil
+}
@@ -0,0 +1,65 @@
+// shptiles cuts a shapefile into Mapbox Vector Tiles, written as
+// dir/z/x/y.pbf along with a metadata.json as MBTiles has it.
+//
+//	shptiles -min 0 -max 10 in.shp tiles
+//	shptiles -epsg 25832 -fields WKR_NR,WKR_NAME -tms -gzip in.shp tiles
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/a2800276/shapefile"
+)
+
+func main() {
+	min := flag.Int("min", 0, "lowest zoom level")
+	max := flag.Int("max", 8, "highest zoom level")
+	layer := flag.String("layer", "", "layer `name`, the base name of the file if empty")
+	fields := flag.String("fields", "", "comma separated `fields` to include, all if empty")
+	epsg := flag.Int("epsg", 0, "EPSG `code` of the coordinates if there is no .prj file")
+	extent := flag.Int("extent", 4096, "tile units per side")
+	buffer := flag.Int("buffer", 64, "tile units kept around each tile")
+	tolerance := flag.Float64("tolerance", 1, "simplify to this many tile units, 0 to keep all vertices")
+	tms := flag.Bool("tms", false, "number rows from the south as MBTiles does")
+	gzip := flag.Bool("gzip", false, "compress the tiles")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] in.shp dir\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	opts := shapefile.TileOptions{
+		MinZoom: *min, MaxZoom: *max, Layer: *layer, Extent: *extent,
+		Buffer: *buffer, Tolerance: *tolerance, TMS: *tms, Gzip: *gzip,
+	}
+	if *buffer == 0 {
+		opts.Buffer = -1
+	}
+	if *fields != "" {
+		opts.Fields = strings.Split(*fields, ",")
+	}
+	if err := run(flag.Arg(0), flag.Arg(1), *epsg, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "shptiles: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(in, dir string, epsg int, opts shapefile.TileOptions) (err error) {
+	ds, err := shapefile.OpenDataset(in)
+	if err != nil {
+		return
+	}
+	if epsg != 0 {
+		if ds.CRS, err = shapefile.CRSFromEPSG(epsg); err != nil {
+			return
+		}
+	}
+	return shapefile.WriteTiles(ds, dir, opts)
+}
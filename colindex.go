@@ -0,0 +1,246 @@
+package shapefile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ColumnIndex is a sorted in-memory index over a DBF column, for files
+// that don't come with an attribute index. It can be persisted as .ndx
+// file, which FindIndex picks up if named after the field.
+type ColumnIndex struct {
+	Field   string
+	numeric bool
+	keyLen  int
+	strs    []string // sorted keys of character columns, trailing spaces removed
+	nums    []float64
+	recs    []uint32 // record number of each key
+}
+
+// BuildIndex creates an index over field, which must be a character or
+// numeric column. Deleted records and blank numbers are not indexed.
+func BuildIndex(dbf *DBFFile, field string) (idx *ColumnIndex, err error) {
+	col := dbf.fieldIndex(field)
+	if col == -1 {
+		return nil, fmt.Errorf("no such field: %s", field)
+	}
+	fd := dbf.FieldDescriptors[col]
+	idx = &ColumnIndex{Field: fd.FieldName(), keyLen: int(fd.FieldLength)}
+	switch fd.FieldType {
+	case Character:
+	case Number, Float:
+		idx.numeric = true
+		idx.keyLen = 8
+	default:
+		return nil, fmt.Errorf("can't index field type: %c", fd.FieldType)
+	}
+
+	for i, entry := range dbf.Entries {
+		if dbf.isDeleted(i) {
+			continue
+		}
+		if idx.numeric {
+			f, ok := keyNumber(entry[col])
+			if !ok {
+				continue
+			}
+			idx.nums = append(idx.nums, f)
+		} else {
+			idx.strs = append(idx.strs, strings.TrimRight(entry[col].(string), " "))
+		}
+		idx.recs = append(idx.recs, uint32(i+1))
+	}
+	sort.Stable(columnSorter{idx})
+	return
+}
+
+type columnSorter struct {
+	idx *ColumnIndex
+}
+
+func (c columnSorter) Len() int { return len(c.idx.recs) }
+
+func (c columnSorter) Less(i, j int) bool {
+	if c.idx.numeric {
+		return c.idx.nums[i] < c.idx.nums[j]
+	}
+	return c.idx.strs[i] < c.idx.strs[j]
+}
+
+func (c columnSorter) Swap(i, j int) {
+	idx := c.idx
+	idx.recs[i], idx.recs[j] = idx.recs[j], idx.recs[i]
+	if idx.numeric {
+		idx.nums[i], idx.nums[j] = idx.nums[j], idx.nums[i]
+	} else {
+		idx.strs[i], idx.strs[j] = idx.strs[j], idx.strs[i]
+	}
+}
+
+// search returns the position of the first key not less than key, or if
+// after is set, greater than key.
+func (idx *ColumnIndex) search(key interface{}, after bool) (int, error) {
+	if idx.numeric {
+		f, ok := keyNumber(key)
+		if !ok {
+			return 0, fmt.Errorf("numeric index, can't look up: %v", key)
+		}
+		return sort.Search(len(idx.nums), func(i int) bool {
+			return idx.nums[i] > f || (!after && idx.nums[i] == f)
+		}), nil
+	}
+	s, ok := key.(string)
+	if !ok {
+		return 0, fmt.Errorf("character index, can't look up: %v", key)
+	}
+	s = strings.TrimRight(s, " ")
+	return sort.Search(len(idx.strs), func(i int) bool {
+		return idx.strs[i] > s || (!after && idx.strs[i] == s)
+	}), nil
+}
+
+func (idx *ColumnIndex) Lookup(key interface{}) ([]uint32, error) {
+	return idx.Range(key, key)
+}
+
+// Range returns the record numbers of all keys between lo and hi
+// (inclusive), in key order. A nil bound is open.
+func (idx *ColumnIndex) Range(lo, hi interface{}) (recs []uint32, err error) {
+	start, end := 0, len(idx.recs)
+	if lo != nil {
+		if start, err = idx.search(lo, false); err != nil {
+			return
+		}
+	}
+	if hi != nil {
+		if end, err = idx.search(hi, true); err != nil {
+			return
+		}
+	}
+	if start < end {
+		recs = append(recs, idx.recs[start:end]...)
+	}
+	return
+}
+
+// Prefix returns the record numbers of all keys starting with prefix, in
+// key order. Only supported for character columns.
+func (idx *ColumnIndex) Prefix(prefix string) (recs []uint32, err error) {
+	if idx.numeric {
+		return nil, fmt.Errorf("prefix lookup on numeric index %s", idx.Field)
+	}
+	start, _ := idx.search(prefix, false)
+	end := start
+	for end < len(idx.strs) && strings.HasPrefix(idx.strs[end], prefix) {
+		end++
+	}
+	return append(recs, idx.recs[start:end]...), nil
+}
+
+func (idx *ColumnIndex) Close() error {
+	return nil
+}
+
+// WriteNDX persists the index as dBase III .ndx file. Character keys
+// longer than 100 bytes are truncated, as the format doesn't allow for
+// longer keys.
+func (idx *ColumnIndex) WriteNDX(w io.Writer) (err error) {
+	keyLen := min(max(idx.keyLen, 1), 100)
+	recSize := (keyLen + 8 + 3) / 4 * 4
+	perLeaf := (ndxPageSize - 4) / recSize
+	perBranch := (ndxPageSize - 8) / recSize // plus one pointer
+
+	key := func(i int) []byte {
+		k := make([]byte, keyLen)
+		if idx.numeric {
+			L.PutUint64(k, math.Float64bits(idx.nums[i]))
+		} else {
+			n := copy(k, idx.strs[i])
+			for ; n < keyLen; n++ {
+				k[n] = ' '
+			}
+		}
+		return k
+	}
+
+	// pages are created bottom up, each level remembers the page number
+	// and largest key of its pages.
+	type ref struct {
+		page   uint32
+		maxKey []byte
+	}
+	var pages [][]byte
+	var level []ref
+	for start := 0; ; start += perLeaf {
+		page := make([]byte, ndxPageSize)
+		end := min(start+perLeaf, len(idx.recs))
+		L.PutUint32(page, uint32(end-start))
+		var k []byte
+		for i := start; i < end; i++ {
+			k = key(i)
+			L.PutUint32(page[4+(i-start)*recSize+4:], idx.recs[i])
+			copy(page[4+(i-start)*recSize+8:], k)
+		}
+		pages = append(pages, page)
+		level = append(level, ref{uint32(len(pages)), k})
+		if end == len(idx.recs) {
+			break
+		}
+	}
+	for len(level) > 1 {
+		var parents []ref
+		for start := 0; start < len(level); start += perBranch + 1 {
+			children := level[start:min(start+perBranch+1, len(level))]
+			page := make([]byte, ndxPageSize)
+			L.PutUint32(page, uint32(len(children)-1))
+			for i, c := range children {
+				L.PutUint32(page[4+i*recSize:], c.page)
+				if i != len(children)-1 {
+					copy(page[4+i*recSize+8:], c.maxKey)
+				}
+			}
+			pages = append(pages, page)
+			parents = append(parents, ref{uint32(len(pages)), children[len(children)-1].maxKey})
+		}
+		level = parents
+	}
+
+	hdr := make([]byte, ndxPageSize)
+	L.PutUint32(hdr, level[0].page)
+	L.PutUint32(hdr[4:], uint32(len(pages)+1))
+	L.PutUint16(hdr[12:], uint16(keyLen))
+	L.PutUint16(hdr[14:], uint16(perLeaf))
+	if idx.numeric {
+		L.PutUint16(hdr[16:], 1)
+	}
+	L.PutUint32(hdr[18:], uint32(recSize))
+	copy(hdr[24:], idx.Field)
+
+	bw := bufio.NewWriter(w)
+	if _, err = bw.Write(hdr); err != nil {
+		return
+	}
+	for _, p := range pages {
+		if _, err = bw.Write(p); err != nil {
+			return
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadRecords reads the shapes with the given 1 based record numbers,
+// e.g. as returned by an attribute index, using the .shx index.
+func (shx *ShxFile) ReadRecords(shp io.ReaderAt, recs []uint32) (records []*Record, err error) {
+	var rec *Record
+	for _, r := range recs {
+		if rec, err = shx.ReadRecord(shp, int(r)-1); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return
+}
@@ -0,0 +1,118 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestBuildIndex(t *testing.T) {
+	file, _ := os.Open(dbf_test_fn)
+	defer file.Close()
+	dbf, err := NewDBFFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nr, err := BuildIndex(dbf, "WKR_NR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs, _ := nr.Lookup(42); fmt.Sprint(recs) != "[42]" {
+		t.Errorf("unexpected lookup result: %v", recs)
+	}
+	if recs, _ := nr.Range(200, 250); len(recs) != 51 || recs[0] != 200 || recs[50] != 250 {
+		t.Errorf("unexpected range result: %v", recs)
+	}
+	if recs, _ := nr.Range(nil, 3.5); fmt.Sprint(recs) != "[1 2 3]" {
+		t.Errorf("unexpected open range result: %v", recs)
+	}
+	if _, err := nr.Prefix("4"); err == nil {
+		t.Errorf("expected error for prefix lookup on numeric index")
+	}
+
+	land, err := BuildIndex(dbf, "LAND_NAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bayern, _ := land.Lookup("Bayern")
+	scan, _ := dbf.Lookup("LAND_NAME", "Bayern", nil)
+	if len(bayern) == 0 || fmt.Sprint(bayern) != fmt.Sprint(scan) {
+		t.Errorf("index and scan differ: %v %v", bayern, scan)
+	}
+	expected := 0
+	for _, l := range []string{"Baden-W\xfcrttemberg", "Bayern", "Berlin", "Brandenburg", "Bremen"} {
+		expected += len(mustLookup(t, dbf, l))
+	}
+	if recs, _ := land.Prefix("B"); len(recs) != expected {
+		t.Errorf("unexpected prefix result: %d, expected %d", len(recs), expected)
+	}
+	if _, err := BuildIndex(dbf, "NOPE"); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+
+	// persisted indexes are read back by the .ndx reader
+	for _, idx := range []*ColumnIndex{nr, land} {
+		var buf bytes.Buffer
+		if err = idx.WriteNDX(&buf); err != nil {
+			t.Fatal(err)
+		}
+		ndx, err := NewNDXFile(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []interface{}{1, 150, 299, 300, "Bayern", "Bremen", "Th\xfcringen"} {
+			if _, isStr := key.(string); isStr == idx.numeric {
+				continue
+			}
+			checkLookup(t, dbf, idx.Field, ndx, key)
+		}
+	}
+}
+
+func TestBuildIndexBlank(t *testing.T) {
+	var buf bytes.Buffer
+	hdr := DBFFileHeader{Version: 3, NumRecords: 3, LenHeader: 32 + 32 + 1, LenRecord: 1 + 4}
+	binary.Write(&buf, L, &hdr)
+	fd := FieldDescriptor{FieldType: Number, FieldLength: 4}
+	copy(fd.FieldName_[:], "NR")
+	binary.Write(&buf, L, &fd)
+	buf.WriteString("\r    0         2\x1a")
+	dbf, err := NewDBFFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := BuildIndex(dbf, "NR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recs, _ := idx.Lookup(0); fmt.Sprint(recs) != "[1]" {
+		t.Errorf("unexpected lookup result: %v", recs)
+	}
+	if recs, _ := idx.Range(nil, nil); fmt.Sprint(recs) != "[1 3]" {
+		t.Errorf("unexpected range result: %v", recs)
+	}
+}
+
+func mustLookup(t *testing.T, dbf *DBFFile, land string) []uint32 {
+	recs, err := dbf.Lookup("LAND_NAME", land, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+func TestShxReadRecords(t *testing.T) {
+	shx := shxFor(t, testfile)
+	file, _ := os.Open(testfile)
+	defer file.Close()
+	recs, err := shx.ReadRecords(file, []uint32{3, 1, 299})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 || recs[0].Header.RecordNumber != 3 || recs[2].Header.RecordNumber != 299 {
+		t.Errorf("unexpected records")
+	}
+}
@@ -0,0 +1,179 @@
+package shapefile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// GeometryColumns selects how WriteCSV describes the shapes.
+type GeometryColumns int
+
+const (
+	GeometryNone     GeometryColumns = iota // attributes only
+	GeometryWKT                             // a WKT column
+	GeometryCentroid                        // X and Y columns holding the centroid
+	GeometryBox                             // XMIN, YMIN, XMAX and YMAX columns
+)
+
+// CSVOptions control WriteCSV.
+type CSVOptions struct {
+	Geometry GeometryColumns
+	Comma    rune // field delimiter, ',' if 0
+}
+
+// WriteCSV writes the attributes of ds as CSV with a header of the field
+// names, preceded by the geometry columns. Coordinates are in the CRS of
+// the dataset, geometry columns of null shapes are empty. Text is written
+// as UTF-8.
+func WriteCSV(w io.Writer, ds *Dataset, opts CSVOptions) (err error) {
+	cw := csv.NewWriter(w)
+	if opts.Comma != 0 {
+		cw.Comma = opts.Comma
+	}
+	var header []string
+	switch opts.Geometry {
+	case GeometryWKT:
+		header = []string{"WKT"}
+	case GeometryCentroid:
+		header = []string{"X", "Y"}
+	case GeometryBox:
+		header = []string{"XMIN", "YMIN", "XMAX", "YMAX"}
+	}
+	if ds.DBF != nil {
+		for _, fd := range ds.DBF.FieldDescriptors {
+			header = append(header, fd.FieldName())
+		}
+	}
+	if err = cw.Write(header); err != nil {
+		return
+	}
+	format := func(f float64) string {
+		if math.IsNaN(f) {
+			return ""
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	for _, f := range ds.Features() {
+		if f.Deleted {
+			continue
+		}
+		var row []string
+		switch opts.Geometry {
+		case GeometryWKT:
+			row = append(row, WKT(f.Record.Content))
+		case GeometryCentroid:
+			c := Point{math.NaN(), math.NaN()}
+			if parts, areal := partsOf(f.Record.Content); len(parts) > 0 {
+				c = centroid(parts, areal)
+			}
+			row = append(row, format(c.X), format(c.Y))
+		case GeometryBox:
+			if b, ok := boxOf(f.Record.Content); ok {
+				row = append(row, format(b.Xmin), format(b.Ymin), format(b.Xmax), format(b.Ymax))
+			} else {
+				row = append(row, "", "", "", "")
+			}
+		}
+		for _, v := range f.Attributes {
+			row = append(row, formatValue(v))
+		}
+		if err = cw.Write(row); err != nil {
+			return
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// CSVReadOptions control ReadCSV.
+type CSVReadOptions struct {
+	// XField and YField name the columns of the longitude and latitude,
+	// or x and y. If empty, columns named lon, lng, long, longitude or x
+	// and lat, latitude or y are looked for, ignoring case.
+	XField, YField string
+	CRS            *CRS // of the coordinates, WGS84 if nil
+	Comma          rune // field delimiter, ',' if 0
+}
+
+// ReadCSV reads a CSV file with a header row into a dataset of points.
+// All columns, the coordinates included, become attributes with types
+// inferred from the values and names shortened to fit .dbf files. Rows
+// without coordinates get null shapes. Coordinates may use a decimal
+// comma if the delimiter isn't a comma.
+func ReadCSV(r io.Reader, opts CSVReadOptions) (ds *Dataset, err error) {
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	var rows [][]string
+	if rows, err = cr.ReadAll(); err != nil {
+		return
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no header")
+	}
+	names, rows := rows[0], rows[1:]
+	names[0] = strings.TrimPrefix(names[0], "\ufeff") // byte order mark of spreadsheet exports
+	column := func(field string, guesses ...string) (int, error) {
+		for i, name := range names {
+			if field != "" && name == field {
+				return i, nil
+			}
+			for _, g := range guesses {
+				if field == "" && strings.EqualFold(strings.TrimSpace(name), g) {
+					return i, nil
+				}
+			}
+		}
+		if field != "" {
+			return -1, fmt.Errorf("no such column: %s", field)
+		}
+		return -1, fmt.Errorf("no %s column", guesses[len(guesses)-1])
+	}
+	var xCol, yCol int
+	if xCol, err = column(opts.XField, "lon", "lng", "long", "x", "longitude"); err != nil {
+		return
+	}
+	if yCol, err = column(opts.YField, "lat", "y", "latitude"); err != nil {
+		return
+	}
+	crs := opts.CRS
+	if crs == nil {
+		if crs, err = CRSFromEPSG(4326); err != nil {
+			return
+		}
+	}
+	coordinate := func(s string) (float64, error) {
+		s = strings.TrimSpace(s)
+		if cr.Comma != ',' {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+		return strconv.ParseFloat(s, 64)
+	}
+	shapes := make([]RecordContent, len(rows))
+	for i, row := range rows {
+		if strings.TrimSpace(row[xCol]) == "" && strings.TrimSpace(row[yCol]) == "" {
+			continue
+		}
+		var x, y float64
+		if x, err = coordinate(row[xCol]); err == nil {
+			y, err = coordinate(row[yCol])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid coordinates %q, %q", i+1, row[xCol], row[yCol])
+		}
+		shapes[i] = &Point{x, y}
+	}
+	fields, values := inferFields(names, rows)
+	ds = NewDataset(POINT, fields, crs)
+	for i, shape := range shapes {
+		if err = ds.Add(shape, values[i]); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
@@ -0,0 +1,95 @@
+package shapefile
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("NAME", Character, 10, 0), NewFieldDescriptor("POP", Number, 6, 0)}
+	ds := NewDataset(POLYGON, fields, nil)
+	ds.Add(polygon(square(0, 0, 2, 2)), []interface{}{"Say \"A\", B", int64(42)})
+	ds.Add(nil, []interface{}{"C      ", nil})
+	tests := []struct {
+		opts     CSVOptions
+		expected string
+	}{
+		{CSVOptions{}, "NAME,POP\n\"Say \"\"A\"\", B\",42\nC,\n"},
+		{CSVOptions{Geometry: GeometryWKT, Comma: ';'}, "WKT;NAME;POP\nPOLYGON ((0 0, 0 2, 2 2, 2 0, 0 0));\"Say \"\"A\"\", B\";42\n;C;\n"},
+		{CSVOptions{Geometry: GeometryCentroid}, "X,Y,NAME,POP\n1,1,\"Say \"\"A\"\", B\",42\n,,C,\n"},
+		{CSVOptions{Geometry: GeometryBox}, "XMIN,YMIN,XMAX,YMAX,NAME,POP\n0,0,2,2,\"Say \"\"A\"\", B\",42\n,,,,C,\n"},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := WriteCSV(&buf, ds, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != test.expected {
+			t.Errorf("expected\n%s\ngot\n%s", test.expected, buf.String())
+		}
+	}
+}
+
+func TestWriteCSVDeleted(t *testing.T) {
+	ds := NewDataset(POINT, []FieldDescriptor{NewFieldDescriptor("NAME", Character, 10, 0)}, nil)
+	for i, name := range []string{"Kiel", "Ulm", "Jena"} {
+		ds.Add(&Point{float64(i), 0}, []interface{}{name})
+	}
+	ds.DBF.Deleted[1] = true
+	// the .dbf file ends before the last record
+	ds.DBF.Entries = ds.DBF.Entries[:2]
+	features := ds.Features()
+	if features[0].Deleted || !features[1].Deleted || features[2].Deleted || !reflect.DeepEqual(features[2].Attributes, []interface{}{nil}) {
+		t.Fatalf("unexpected features %v %v %v", features[0], features[1], features[2])
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, ds, CSVOptions{Geometry: GeometryCentroid}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "X,Y,NAME\n0,0,Kiel\n2,0,\n"; buf.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	csv := "\ufeffName;Latitude;Longitude;Postal code;Population density\n" +
+		"\"Berlin; Mitte\";52,52;13,405;01067;4000.5\n" +
+		"Nowhere;;;;\n"
+	ds, err := ReadCSV(strings.NewReader(csv), CSVReadOptions{Comma: ';'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.CRS.EPSG != 4326 || ds.Shapefile.Header.ShapeType != POINT {
+		t.Fatalf("expected WGS84 points")
+	}
+	var names []string
+	for _, fd := range ds.DBF.FieldDescriptors {
+		names = append(names, fd.FieldName())
+	}
+	if !reflect.DeepEqual(names, []string{"Name", "Latitude", "Longitude", "Postal_cod", "Population"}) {
+		t.Errorf("unexpected fields %v", names)
+	}
+	features := ds.Features()
+	if p, ok := features[0].Record.Content.(*Point); !ok || p.X != 13.405 || p.Y != 52.52 {
+		t.Errorf("unexpected point %v", features[0].Record.Content)
+	}
+	if !reflect.DeepEqual(features[0].Attributes, []interface{}{"Berlin; Mitte", "52,52", "13,405", "01067", 4000.5}) {
+		t.Errorf("unexpected attributes %v", features[0].Attributes)
+	}
+	if _, ok := features[1].Record.Content.(*Null); !ok {
+		t.Errorf("expected a null shape without coordinates")
+	}
+
+	if _, err = ReadCSV(strings.NewReader("a,b\n1,2\n"), CSVReadOptions{}); err == nil {
+		t.Errorf("expected missing coordinate columns to fail")
+	}
+	if _, err = ReadCSV(strings.NewReader("x,y\n1,north\n"), CSVReadOptions{}); err == nil {
+		t.Errorf("expected invalid coordinates to fail")
+	}
+	ds, err = ReadCSV(strings.NewReader("E,N\n500000,5500000\n"), CSVReadOptions{XField: "E", YField: "N", CRS: mustEPSG(t, 25832)})
+	if err != nil || ds.CRS.EPSG != 25832 || ds.Features()[0].Record.Content.(*Point).X != 500000 {
+		t.Errorf("expected projected coordinates, got %v", err)
+	}
+}
@@ -0,0 +1,367 @@
+package shapefile
+
+import (
+	"fmt"
+	"iter"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Dataset bundles a .shp file with the .dbf and .prj files sharing its
+// base name.
+type Dataset struct {
+	Shapefile *Shapefile
+	DBF       *DBFFile // nil if there is no .dbf file
+	CRS       *CRS     // nil if there is no .prj file
+
+	base      string // file name without extension
+	indexOnce sync.Once
+	index     *RTree
+	features  []*Feature
+}
+
+// Feature is a shape record along with its attributes.
+type Feature struct {
+	Record *Record
+	// Attributes are nil if the dataset has no .dbf file or the record is
+	// deleted, blank if the .dbf file has fewer records than the .shp file.
+	Attributes []interface{}
+	Deleted    bool // marked deleted in the .dbf file
+}
+
+// OpenDataset reads the .shp file fn along with the accompanying .dbf and
+// .prj files, if present.
+func OpenDataset(fn string) (ds *Dataset, err error) {
+	return OpenDatasetIn(fn, nil)
+}
+
+// OpenDatasetIn is like OpenDataset, but reprojects every record into crs
+// while it is read. If crs is nil, the coordinates are left untouched.
+func OpenDatasetIn(fn string, crs *CRS) (ds *Dataset, err error) {
+	base := strings.TrimSuffix(fn, filepath.Ext(fn))
+	ds = &Dataset{base: base}
+
+	var file *os.File
+	if file, err = openSibling(base, ".prj"); err == nil {
+		ds.CRS, err = NewCRSFromReader(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var each func(*Record) error
+	if crs != nil {
+		if ds.CRS == nil {
+			return nil, fmt.Errorf("can't reproject %s: no .prj file", fn)
+		}
+		var t *Transformer
+		if t, err = NewTransformer(ds.CRS, crs); err != nil {
+			return nil, err
+		}
+		each = func(r *Record) error { return t.Transform(r.Content) }
+	}
+
+	if file, err = os.Open(fn); err != nil {
+		return nil, err
+	}
+	ds.Shapefile, err = readShapefile(file, each)
+	file.Close()
+	if err != nil {
+		return nil, err
+	}
+	if each != nil {
+		ds.CRS = crs
+		ds.Shapefile.updateHeaderBox()
+	}
+
+	if file, err = openSibling(base, ".dbf"); err == nil {
+		ds.DBF, err = NewDBFFile(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// NewDataset creates an empty dataset in memory, to be filled using Add
+// and written using Save. fields may be nil for a dataset without
+// attributes.
+func NewDataset(shapeType ShapeType, fields []FieldDescriptor, crs *CRS) *Dataset {
+	ds := &Dataset{CRS: crs}
+	ds.Shapefile = &Shapefile{Header: &MainFileHeader{FileLength: 50, Version: 1000, ShapeType: shapeType}}
+	if fields != nil {
+		hdr := newDBFFileHeader(fields, 0)
+		ds.DBF = &DBFFile{DBFFileHeader: &hdr, FieldDescriptors: fields}
+	}
+	return ds
+}
+
+// Add appends a feature to the dataset. The shape must be of the
+// dataset's type or nil.
+func (d *Dataset) Add(content RecordContent, attributes []interface{}) (err error) {
+	if content == nil {
+		content = &Null{}
+	}
+	h := d.Shapefile.Header
+	if typ := shapeTypeOf(content); typ != NULL_SHAPE && typ != h.ShapeType {
+		return fmt.Errorf("can't add %s to a %s dataset", typ, h.ShapeType)
+	}
+	var raw []byte
+	if raw, err = encodeContent(content); err != nil {
+		return
+	}
+	if d.DBF != nil {
+		if len(attributes) != len(d.DBF.FieldDescriptors) {
+			return fmt.Errorf("expected %d attributes, got %d", len(d.DBF.FieldDescriptors), len(attributes))
+		}
+		d.DBF.Entries = append(d.DBF.Entries, attributes)
+		d.DBF.Deleted = append(d.DBF.Deleted, false)
+		d.DBF.DBFFileHeader.NumRecords++
+	}
+	if b, ok := boxOf(content); ok {
+		// the header box is unset until a record has one, usually the
+		// previous record has
+		unset := true
+		for i := len(d.Shapefile.Records) - 1; i >= 0 && unset; i-- {
+			_, has := boxOf(d.Shapefile.Records[i].Content)
+			unset = !has
+		}
+		if unset {
+			h.Xmin, h.Ymin, h.Xmax, h.Ymax = b.Xmin, b.Ymin, b.Xmax, b.Ymax
+		} else {
+			h.Xmin, h.Ymin = math.Min(h.Xmin, b.Xmin), math.Min(h.Ymin, b.Ymin)
+			h.Xmax, h.Ymax = math.Max(h.Xmax, b.Xmax), math.Max(h.Ymax, b.Ymax)
+		}
+	}
+	rh := &MainFileRecordHeader{int32(len(d.Shapefile.Records) + 1), int32(len(raw) / 2)}
+	d.Shapefile.Records = append(d.Shapefile.Records, &Record{rh, content})
+	h.FileLength += 4 + rh.ContentLength
+
+	// the features and index are rebuilt on demand
+	d.indexOnce = sync.Once{}
+	d.features, d.index = nil, nil
+	return
+}
+
+// importedFeature is a shape read from another format along with its
+// attributes as text.
+type importedFeature struct {
+	content    RecordContent
+	attributes map[string]string
+}
+
+// importDatasets returns a dataset for each type of shape among features,
+// in the order they first appear. Each gets the columns of names, in that
+// order, that any of its features has a value for, typed by inferFields.
+func importDatasets(features []importedFeature, names []string, crs *CRS) (datasets []*Dataset, err error) {
+	var types []ShapeType
+	byType := map[ShapeType][]importedFeature{}
+	for _, f := range features {
+		typ := shapeTypeOf(f.content)
+		if byType[typ] == nil {
+			types = append(types, typ)
+		}
+		byType[typ] = append(byType[typ], f)
+	}
+	for _, typ := range types {
+		features := byType[typ]
+		var columns []string
+		for _, name := range names {
+			for _, f := range features {
+				if f.attributes[name] != "" {
+					columns = append(columns, name)
+					break
+				}
+			}
+		}
+		rows := make([][]string, len(features))
+		for i, f := range features {
+			rows[i] = make([]string, len(columns))
+			for j, name := range columns {
+				rows[i][j] = f.attributes[name]
+			}
+		}
+		var fields []FieldDescriptor
+		var values [][]interface{}
+		if len(columns) > 0 {
+			fields, values = inferFields(columns, rows)
+		}
+		ds := NewDataset(typ, fields, crs)
+		for i, f := range features {
+			var attributes []interface{}
+			if fields != nil {
+				attributes = values[i]
+			}
+			if err = ds.Add(f.content, attributes); err != nil {
+				return nil, err
+			}
+		}
+		datasets = append(datasets, ds)
+	}
+	return
+}
+
+// Save writes the dataset to the .shp file fn along with the .shx, .dbf
+// and, if the CRS is known, .prj files. Deleted records are left out, so
+// the records following them are renumbered.
+func (d *Dataset) Save(fn string) (err error) {
+	var fields []FieldDescriptor
+	if d.DBF != nil {
+		fields = d.DBF.FieldDescriptors
+	}
+	var w *Writer
+	if w, err = CreateShapefile(fn, d.Shapefile.Header.ShapeType, fields); err != nil {
+		return
+	}
+	for i, r := range d.Shapefile.Records {
+		var attributes []interface{}
+		if d.DBF != nil && d.DBF.isDeleted(i) {
+			continue
+		}
+		if d.DBF != nil && i < len(d.DBF.Entries) {
+			attributes = d.DBF.Entries[i]
+		}
+		if attributes == nil && fields != nil {
+			attributes = make([]interface{}, len(fields))
+		}
+		if err = w.Write(r.Content, attributes); err != nil {
+			w.Close()
+			return
+		}
+	}
+	if err = w.Close(); err != nil {
+		return
+	}
+	if d.CRS != nil {
+		var file *os.File
+		if file, err = os.Create(strings.TrimSuffix(fn, filepath.Ext(fn)) + ".prj"); err != nil {
+			return
+		}
+		defer file.Close()
+		err = d.CRS.Write(file)
+	}
+	return
+}
+
+// openSibling opens base+ext, trying the upper case extension as well.
+func openSibling(base, ext string) (file *os.File, err error) {
+	if file, err = os.Open(base + ext); os.IsNotExist(err) {
+		return os.Open(base + strings.ToUpper(ext))
+	}
+	return
+}
+
+// updateHeaderBox recalculates the X/Y extent of the file header from the
+// records.
+func (s *Shapefile) updateHeaderBox() {
+	b := Box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, r := range s.Records {
+		if rb, ok := boxOf(r.Content); ok {
+			b.Xmin = math.Min(b.Xmin, rb.Xmin)
+			b.Ymin = math.Min(b.Ymin, rb.Ymin)
+			b.Xmax = math.Max(b.Xmax, rb.Xmax)
+			b.Ymax = math.Max(b.Ymax, rb.Ymax)
+		}
+	}
+	if b.Xmin <= b.Xmax {
+		s.Header.Xmin, s.Header.Ymin, s.Header.Xmax, s.Header.Ymax = b.Xmin, b.Ymin, b.Xmax, b.Ymax
+	}
+}
+
+// Features returns all records of the dataset paired with their
+// attributes.
+func (d *Dataset) Features() []*Feature {
+	d.buildIndex()
+	return d.features
+}
+
+// buildIndex creates the features and the spatial index over their
+// bounding boxes the first time it's called.
+func (d *Dataset) buildIndex() {
+	d.indexOnce.Do(func() {
+		boxes := make([]Box, 0, len(d.Shapefile.Records))
+		d.features = make([]*Feature, 0, len(d.Shapefile.Records))
+		for i, r := range d.Shapefile.Records {
+			f := &Feature{Record: r}
+			switch {
+			case d.DBF == nil:
+			case d.DBF.isDeleted(i):
+				f.Deleted = true
+			case i < len(d.DBF.Entries):
+				f.Attributes = d.DBF.Entries[i]
+			default:
+				f.Attributes = make([]interface{}, len(d.DBF.FieldDescriptors))
+			}
+			b, ok := boxOf(r.Content)
+			if !ok {
+				// null shapes are never found
+				b = Box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+			}
+			boxes = append(boxes, b)
+			d.features = append(d.features, f)
+		}
+		d.index = NewRTree(boxes)
+	})
+}
+
+// Query returns the features whose bounding box intersects b. The
+// spatial index is built on the first call.
+func (d *Dataset) Query(b Box) iter.Seq[*Feature] {
+	d.buildIndex()
+	return func(yield func(*Feature) bool) {
+		for id := range d.index.Search(b) {
+			if !yield(d.features[id]) {
+				return
+			}
+		}
+	}
+}
+
+// Nearest returns up to n features closest to p, closest first. Points
+// inside a polygon have a distance of 0 to it.
+func (d *Dataset) Nearest(p Point, n int) (features []*Feature) {
+	d.buildIndex()
+	ids := d.index.Nearest(p.X, p.Y, n, func(id int) float64 {
+		return pointDistance(p.X, p.Y, d.features[id].Record.Content)
+	})
+	for _, id := range ids {
+		features = append(features, d.features[id])
+	}
+	return
+}
+
+// Lookup returns the features whose attribute field equals key. An
+// attribute index (.mdx, .cdx or .ndx) is used if available, otherwise
+// all rows are scanned.
+func (d *Dataset) Lookup(field string, key interface{}) (features []*Feature, err error) {
+	if d.DBF == nil {
+		return nil, fmt.Errorf("dataset has no attributes")
+	}
+	var idx AttributeIndex
+	if idx, err = FindIndex(d.base+".dbf", d.DBF, field); err != nil {
+		return
+	}
+	if idx != nil {
+		defer idx.Close()
+	}
+	var recs []uint32
+	if recs, err = d.DBF.Lookup(field, key, idx); err != nil {
+		return
+	}
+	all := d.Features()
+	for _, r := range recs {
+		if r >= 1 && int(r) <= len(all) {
+			features = append(features, all[r-1])
+		}
+	}
+	return
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // DBF is documented here: http://www.clicketyclick.dk/databases/xbase/format/dbf.html
@@ -13,11 +14,27 @@ import (
 type DBFFile struct {
 	DBFFileHeader    *DBFFileHeader
 	FieldDescriptors []FieldDescriptor
-	Entries          [][]interface{}
+	Entries          [][]interface{} // indexed by record number - 1
+	Deleted          []bool          // whether the entries are marked deleted
+}
+
+// isDeleted reports whether the entry i is marked deleted.
+func (dbf *DBFFile) isDeleted(i int) bool {
+	return i < len(dbf.Deleted) && dbf.Deleted[i]
 }
 
 func NewDBFFile(r io.Reader) (dbf *DBFFile, err error) {
 	dbf = &DBFFile{}
+	if err = dbf.readHead(r); err != nil {
+		return
+	}
+	err = dbf.readEntries(r)
+	return
+}
+
+// readHead reads the header and field descriptors, leaving r positioned
+// at the first record.
+func (dbf *DBFFile) readHead(r io.Reader) (err error) {
 	if dbf.DBFFileHeader, err = NewDBFFileHeader(r); err != nil {
 		return
 	}
@@ -39,7 +56,6 @@ func NewDBFFile(r io.Reader) (dbf *DBFFile, err error) {
 		}
 		return
 	}
-	err = dbf.readEntries(r)
 	return
 }
 
@@ -48,57 +64,124 @@ func (dbf *DBFFile) readEntries(r io.Reader) (err error) {
 
 	rawEntry := make([]byte, dbf.DBFFileHeader.LenRecord)
 	var n int
-	for {
+	for countRead != dbf.DBFFileHeader.NumRecords {
 		if n, err = r.Read(rawEntry); (err != nil) || n != (int)(dbf.DBFFileHeader.LenRecord) {
 			if err == nil {
 				err = fmt.Errorf("expected %d bytes, read: %d", dbf.DBFFileHeader.LenRecord, n)
 			}
 			return
 		}
-		if 0x2a == rawEntry[0] { // record deleted
-			continue
+		countRead++
+
+		var entry []interface{}
+		if entry, err = dbf.parseEntry(rawEntry); err != nil {
+			return
 		}
+		dbf.Entries = append(dbf.Entries, entry)
+		dbf.Deleted = append(dbf.Deleted, 0x2a == rawEntry[0])
+	} // for
+	return
+}
+
+// parseEntry decodes the fields of a raw record. Character
+// fields are strings as stored, padding included, Number
+// fields int64 without decimals and float64 otherwise,
+// Float fields float64, Date fields YYYYMMDD strings and
+// Logical fields bools. Blank numbers and dates as well as
+// unknown logicals, ? or blank, are nil.
+func (dbf *DBFFile) parseEntry(rawEntry []byte) (entry []interface{}, err error) {
+	entry = make([]interface{}, len(dbf.FieldDescriptors))
+	var offset = 1
 
-		entry := make([]interface{}, len(dbf.FieldDescriptors))
-		var offset = 1
-
-		for i, desc := range dbf.FieldDescriptors {
-			rawField := rawEntry[offset : offset+(int)(desc.FieldLength)]
-			offset += (int)(desc.FieldLength)
-
-			switch desc.FieldType {
-			case Character:
-				entry[i] = (string)(rawField)
-			case Number:
-				if desc.DecimalCount == 0 {
-					numberStr := strings.TrimLeft((string)(rawField), " ")
-					if entry[i], err = strconv.ParseInt(numberStr, 10, 64); err != nil {
-						return
-					}
+	for i, desc := range dbf.FieldDescriptors {
+		rawField := rawEntry[offset : offset+(int)(desc.FieldLength)]
+		offset += (int)(desc.FieldLength)
+
+		switch desc.FieldType {
+		case Character:
+			entry[i] = (string)(rawField)
+		case Number:
+			if desc.DecimalCount == 0 {
+				numberStr := strings.Trim((string)(rawField), " ")
+				if numberStr == "" {
 					break
 				}
-				// handle it like a float ...
-				fallthrough
-			case Float:
-				numberStr := strings.TrimLeft((string)(rawField), " ")
-				if entry[i], err = strconv.ParseFloat(numberStr, 64); err != nil {
+				if entry[i], err = strconv.ParseInt(numberStr, 10, 64); err != nil {
 					return
 				}
-
-			default:
-				err = fmt.Errorf("unsupported type: %c", desc.FieldType)
+				break
+			}
+			// handle it like a float ...
+			fallthrough
+		case Float:
+			numberStr := strings.Trim((string)(rawField), " ")
+			if numberStr == "" {
+				break
+			}
+			if entry[i], err = strconv.ParseFloat(numberStr, 64); err != nil {
+				return
+			}
+		case Date:
+			if dateStr := strings.Trim((string)(rawField), " "); dateStr != "" {
+				entry[i] = dateStr
+			}
+		case Logical:
+			if len(rawField) == 0 {
+				break
+			}
+			switch rawField[0] {
+			case 'T', 't', 'Y', 'y':
+				entry[i] = true
+			case 'F', 'f', 'N', 'n':
+				entry[i] = false
 			}
-		}
-		dbf.Entries = append(dbf.Entries, entry)
 
-		countRead++
-		if countRead == dbf.DBFFileHeader.NumRecords {
-			break
+		default:
+			err = fmt.Errorf("unsupported type: %c", desc.FieldType)
 		}
-	} // for
+	}
 	return
 }
 
+// formatValue formats an entry value as text, without the padding of
+// character fields, logicals as T or F. Missing values are empty. Text that isn't valid
+// UTF-8 is taken as Windows-1252, the Latin-1 superset older .dbf files
+// usually are in.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		v = strings.TrimRight(v, " ")
+		if utf8.ValidString(v) {
+			return v
+		}
+		runes := make([]rune, len(v))
+		for i := 0; i < len(v); i++ {
+			runes[i] = rune(v[i])
+			if v[i] >= 0x80 && v[i] < 0xa0 {
+				runes[i] = cp1252[v[i]-0x80]
+			}
+		}
+		return string(runes)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		if v {
+			return "T"
+		}
+		return "F"
+	}
+	return fmt.Sprint(v)
+}
+
+// cp1252 are the characters Windows-1252 has in place of the C1 controls
+// of Latin-1, unused codes are kept.
+var cp1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
 // http://www.clicketyclick.dk/databases/xbase/format/dbf.html#DBF_STRUCT
 
 type DBFFileHeader struct {
@@ -1,7 +1,10 @@
 package shapefile
 
 import (
+	"bytes"
+	"encoding/binary"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -78,3 +81,63 @@ func TestDBFSimple(t *testing.T) {
 	//	}
 
 }
+
+func TestDBFDeleted(t *testing.T) {
+	var buf bytes.Buffer
+	hdr := DBFFileHeader{Version: 3, NumRecords: 3, LenHeader: 32 + 32 + 1, LenRecord: 1 + 4}
+	binary.Write(&buf, L, &hdr)
+	fd := FieldDescriptor{FieldType: Number, FieldLength: 4}
+	copy(fd.FieldName_[:], "NR")
+	binary.Write(&buf, L, &fd)
+	buf.WriteString("\r    1*   2    3\x1a")
+
+	f, err := NewDBFFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Entries) != 3 || f.Entries[1][0].(int64) != 2 || f.Entries[2][0].(int64) != 3 {
+		t.Errorf("unexpected entries: %v", f.Entries)
+	}
+	if len(f.Deleted) != 3 || f.Deleted[0] || !f.Deleted[1] || f.Deleted[2] {
+		t.Errorf("unexpected deleted: %v", f.Deleted)
+	}
+}
+
+func TestDBFDateLogical(t *testing.T) {
+	var buf bytes.Buffer
+	hdr := DBFFileHeader{Version: 3, NumRecords: 4, LenHeader: 32 + 2*32 + 1, LenRecord: 1 + 8 + 1}
+	binary.Write(&buf, L, &hdr)
+	binary.Write(&buf, L, []FieldDescriptor{NewFieldDescriptor("BUILT", Date, 8, 0), NewFieldDescriptor("LISTED", Logical, 1, 0)})
+	buf.WriteString("\r 19840229T 20200101n         ?         y\x1a")
+
+	f, err := NewDBFFile(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]interface{}{{"19840229", true}, {"20200101", false}, {nil, nil}, {nil, true}}
+	if !reflect.DeepEqual(f.Entries, expected) {
+		t.Errorf("expected %v, got %v", expected, f.Entries)
+	}
+	if formatValue(true) != "T" || formatValue(false) != "F" {
+		t.Errorf("expected logicals as T and F")
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		v        interface{}
+		expected string
+	}{
+		{nil, ""},
+		{"Köln   ", "Köln"},
+		{"K\xf6ln", "Köln"}, // Latin-1
+		{"Flensburg \x96 Schleswig", "Flensburg – Schleswig"},
+		{int64(-3), "-3"},
+		{2.50, "2.5"},
+	}
+	for _, test := range tests {
+		if got := formatValue(test.v); got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.v, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package shapefile
+
+import (
+	"fmt"
+	"strings"
+)
+
+type AggregateFunc int
+
+const (
+	AggregateFirst AggregateFunc = iota // value of the first feature in the group
+	AggregateSum
+	AggregateMin
+	AggregateMax
+	AggregateCount // number of features in the group
+)
+
+// Aggregation describes a column of the dissolved dataset computed from
+// the column Field of the features in a group. Name defaults to Field,
+// or COUNT for AggregateCount.
+type Aggregation struct {
+	Field string
+	Func  AggregateFunc
+	Name  string
+}
+
+// Dissolve groups the polygons of ds by the value of field and merges
+// each group into a single polygon. The resulting dataset has the field
+// as its first column followed by one column per aggregation, blank
+// values are ignored by all aggregations but AggregateFirst.
+func Dissolve(ds *Dataset, field string, aggregations []Aggregation) (out *Dataset, err error) {
+	switch ds.Shapefile.Header.ShapeType {
+	case POLYGON, POLYGON_M, POLYGON_Z:
+	default:
+		return nil, fmt.Errorf("can't dissolve %s shapes", ds.Shapefile.Header.ShapeType)
+	}
+	if ds.DBF == nil {
+		return nil, fmt.Errorf("dataset has no attributes")
+	}
+	key := ds.DBF.fieldIndex(field)
+	if key == -1 {
+		return nil, fmt.Errorf("no such field: %s", field)
+	}
+
+	src := ds.DBF.FieldDescriptors
+	fields := []FieldDescriptor{src[key]}
+	cols := make([]int, len(aggregations))
+	for i, a := range aggregations {
+		var fd FieldDescriptor
+		if fd, cols[i], err = aggregateField(ds.DBF, a); err != nil {
+			return nil, err
+		}
+		fields = append(fields, fd)
+	}
+
+	type group struct {
+		shapes []RecordContent
+		values []interface{}
+	}
+	var groups []*group
+	byKey := map[interface{}]*group{}
+	for _, f := range ds.Features() {
+		if f.Deleted {
+			continue
+		}
+		k := groupKey(f.Attributes[key])
+		g := byKey[k]
+		if g == nil {
+			g = &group{values: make([]interface{}, len(fields))}
+			g.values[0] = f.Attributes[key]
+			for i, a := range aggregations {
+				switch a.Func {
+				case AggregateFirst:
+					g.values[i+1] = f.Attributes[cols[i]]
+				case AggregateCount:
+					g.values[i+1] = int64(0)
+				}
+			}
+			byKey[k] = g
+			groups = append(groups, g)
+		}
+		g.shapes = append(g.shapes, f.Record.Content)
+		for i, a := range aggregations {
+			var v interface{}
+			if cols[i] != -1 {
+				v = f.Attributes[cols[i]]
+			}
+			g.values[i+1] = aggregate(a.Func, g.values[i+1], v)
+		}
+	}
+
+	out = NewDataset(POLYGON, fields, ds.CRS)
+	for _, g := range groups {
+		var pg RecordContent
+		if union := UnionAll(g.shapes); union != nil {
+			pg = union
+		}
+		if err = out.Add(pg, g.values); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// aggregateField returns the descriptor of the column computed by a and
+// the index of the column it's computed from.
+func aggregateField(dbf *DBFFile, a Aggregation) (fd FieldDescriptor, col int, err error) {
+	name := a.Name
+	if a.Func == AggregateCount {
+		if name == "" {
+			name = "COUNT"
+		}
+		return NewFieldDescriptor(name, Number, 10, 0), -1, nil
+	}
+	if col = dbf.fieldIndex(a.Field); col == -1 {
+		return fd, -1, fmt.Errorf("no such field: %s", a.Field)
+	}
+	if name == "" {
+		name = a.Field
+	}
+	src := dbf.FieldDescriptors[col]
+	fd = NewFieldDescriptor(name, src.FieldType, src.FieldLength, src.DecimalCount)
+	if a.Func == AggregateSum {
+		if src.FieldType != Number && src.FieldType != Float {
+			return fd, -1, fmt.Errorf("can't sum field %s of type %c", a.Field, src.FieldType)
+		}
+		fd.FieldLength = 19 // room for the sum
+	}
+	return
+}
+
+// groupKey makes values comparable that are considered equal: character
+// values regardless of padding, numbers regardless of their type.
+func groupKey(v interface{}) interface{} {
+	if s, ok := v.(string); ok {
+		return strings.TrimRight(s, " ")
+	}
+	if f, ok := keyNumber(v); ok {
+		return f
+	}
+	return v
+}
+
+func aggregate(fn AggregateFunc, acc, v interface{}) interface{} {
+	if fn == AggregateCount {
+		return acc.(int64) + 1
+	}
+	if v == nil || fn == AggregateFirst {
+		return acc
+	}
+	if acc == nil {
+		return v
+	}
+	switch fn {
+	case AggregateSum:
+		if a, ok := acc.(int64); ok {
+			if b, ok := v.(int64); ok {
+				return a + b
+			}
+		}
+		a, _ := keyNumber(acc)
+		b, _ := keyNumber(v)
+		return a + b
+	case AggregateMin, AggregateMax:
+		var c int
+		if a, ok := acc.(string); ok {
+			b, _ := v.(string)
+			c = strings.Compare(strings.TrimRight(b, " "), strings.TrimRight(a, " "))
+		} else {
+			a, _ := keyNumber(acc)
+			b, _ := keyNumber(v)
+			c = compareFloat(b, a)
+		}
+		if (fn == AggregateMin && c < 0) || (fn == AggregateMax && c > 0) {
+			return v
+		}
+	}
+	return acc
+}
@@ -0,0 +1,85 @@
+package shapefile
+
+import (
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDissolve(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	areas := map[string]float64{}
+	for _, f := range ds.Features() {
+		areas[strings.TrimSpace(f.Attributes[3].(string))] += f.Record.Content.(*Polygon).Area()
+	}
+
+	states, err := Dissolve(ds, "LAND_NAME", []Aggregation{
+		{Func: AggregateCount, Name: "WAHLKREISE"},
+		{Field: "WKR_NR", Func: AggregateMin, Name: "FIRST_NR"},
+		{Field: "WKR_NR", Func: AggregateMax, Name: "LAST_NR"},
+		{Field: "WKR_NR", Func: AggregateSum},
+		{Field: "WKR_NAME", Func: AggregateFirst},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(t.TempDir(), "states.shp")
+	if err = states.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	if states, err = OpenDataset(fn); err != nil {
+		t.Fatal(err)
+	}
+	features := states.Features()
+	if len(features) != 16 {
+		t.Fatalf("expected 16 states, got %d", len(features))
+	}
+	var names []string
+	for _, fd := range states.DBF.FieldDescriptors {
+		names = append(names, fd.FieldName())
+	}
+	if got := strings.Join(names, ","); got != "LAND_NAME,WAHLKREISE,FIRST_NR,LAST_NR,WKR_NR,WKR_NAME" {
+		t.Errorf("unexpected fields: %s", got)
+	}
+
+	count := int64(0)
+	for _, f := range features {
+		name := strings.TrimSpace(f.Attributes[0].(string))
+		n := f.Attributes[1].(int64)
+		first, last, sum := f.Attributes[2].(int64), f.Attributes[3].(int64), f.Attributes[4].(int64)
+		count += n
+		// the districts of a state are numbered consecutively
+		if last-first+1 != n || sum != (first+last)*n/2 {
+			t.Errorf("%s: unexpected aggregates %v", name, f.Attributes[1:5])
+		}
+		pg := f.Record.Content.(*Polygon)
+		if a := pg.Area(); math.Abs(a-areas[name]) > 1 {
+			t.Errorf("%s: area %v, expected %v", name, a, areas[name])
+		}
+		switch name {
+		case "Bayern":
+			if n != 45 || len(pg.Parts) != 1 {
+				t.Errorf("Bayern: %d districts, %d rings", n, len(pg.Parts))
+			}
+		case "Brandenburg":
+			// surrounds Berlin
+			if len(pg.Parts) != 2 {
+				t.Errorf("Brandenburg: %d rings", len(pg.Parts))
+			}
+		}
+	}
+	if count != 299 {
+		t.Errorf("expected 299 districts, got %d", count)
+	}
+
+	if _, err = Dissolve(ds, "NOPE", nil); err == nil {
+		t.Errorf("expected error for unknown field")
+	}
+	if _, err = Dissolve(ds, "LAND_NAME", []Aggregation{{Field: "LAND_NR", Func: AggregateSum}}); err == nil {
+		t.Errorf("expected error summing a character field")
+	}
+}
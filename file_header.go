@@ -6,6 +6,10 @@ import (
 	"io"
 )
 
+// MainFileHeader is the header of .shp and .shx files. Unlike the M
+// ranges of records, Mmin and Mmax can't be recomputed from the values
+// without reading every record, so either is NaN if it is stored as no
+// data, even if the records have measures.
 type MainFileHeader struct {
 	//	FileCode   int32
 	//	Unused     [20]byte
@@ -156,6 +160,7 @@ func NewMainFileHeaderFromReader(r io.Reader) (hdr *MainFileHeader, err error) {
 	if err = binary.Read(r, binary.LittleEndian, &hdr.Mmax); err != nil {
 		return
 	}
+	hdr.Mmin, hdr.Mmax = fromNoData(hdr.Mmin), fromNoData(hdr.Mmax)
 
 	return
 }
@@ -1,7 +1,9 @@
 package shapefile
 
 import (
+	"bytes"
 	"encoding/binary"
+	"math"
 	"os"
 	"testing"
 )
@@ -82,3 +84,28 @@ func TestLoadShapefile(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestReadMNoData(t *testing.T) {
+	record := func(m ...float64) RecordContent {
+		var buf bytes.Buffer
+		binary.Write(&buf, L, POLY_LINE_M)
+		binary.Write(&buf, L, Box{0, 0, 2, 0})
+		binary.Write(&buf, L, []int32{1, 3, 0})
+		binary.Write(&buf, L, []Point{{0, 0}, {1, 0}, {2, 0}})
+		binary.Write(&buf, L, MRange{NoData, 7})
+		binary.Write(&buf, L, m)
+		content, err := RecordRecordContent(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return content
+	}
+	pl := record(NoData, 5, 7).(*PolyLineM)
+	if pl.MRange != (MRange{5, 7}) || !math.IsNaN(pl.MArray[0]) || pl.MArray[1] != 5 {
+		t.Errorf("expected the range of the measures, got %v %v", pl.MRange, pl.MArray)
+	}
+	pl = record(NoData, NoData, -2e38).(*PolyLineM)
+	if !math.IsNaN(pl.MRange.Mmin) || !math.IsNaN(pl.MRange.Mmax) {
+		t.Errorf("expected no range, got %v", pl.MRange)
+	}
+}
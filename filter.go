@@ -0,0 +1,618 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Filter is a compiled attribute filter expression in a subset of SQL:
+//
+//	LAND_NAME = 'Bayern' AND WKR_NR BETWEEN 200 AND 250
+//	NAME LIKE 'Berlin%' OR POP / AREA > 1000
+//	CODE IN ('A', 'B') AND NOT REMARK IS NULL
+//
+// Supported are AND, OR, NOT, the comparisons = <> != < <= > >=,
+// [NOT] BETWEEN, [NOT] LIKE with % and _ wildcards, [NOT] IN, IS [NOT]
+// NULL, + - * / % on numbers, parentheses, 'quoted' strings and field
+// names, which may be "double quoted". Keywords and field names are case
+// insensitive.
+//
+// Blank numeric fields are NULL and comparisons involving NULL are
+// neither true nor false, as in SQL. Trailing spaces of character fields
+// are ignored.
+type Filter struct {
+	expr string
+	root exprNode
+}
+
+type exprKind int
+
+const (
+	kindNumber exprKind = iota
+	kindString
+	kindBool
+)
+
+func (k exprKind) String() string {
+	return [...]string{"number", "string", "boolean"}[k]
+}
+
+// exprNode is a type checked node of the expression. eval returns nil
+// for NULL, float64, string or bool depending on kind.
+type exprNode struct {
+	kind     exprKind
+	eval     func(row []interface{}) interface{}
+	constant bool
+}
+
+// ParseFilter compiles expr, resolving field names against fields.
+func ParseFilter(expr string, fields []FieldDescriptor) (f *Filter, err error) {
+	p := &filterParser{fields: fields}
+	if p.tokens, err = lexFilter(expr); err != nil {
+		return
+	}
+	var n exprNode
+	if n, err = p.or(); err != nil {
+		return
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", p.peek(), p.peek().pos)
+	}
+	if n.kind != kindBool {
+		return nil, fmt.Errorf("filter is a %s, not a condition", n.kind)
+	}
+	return &Filter{expr: expr, root: n}, nil
+}
+
+// Match reports whether the DBF row satisfies the filter. Rows for which
+// the filter is NULL don't match.
+func (f *Filter) Match(row []interface{}) bool {
+	b, _ := f.root.eval(row).(bool)
+	return b
+}
+
+func (f *Filter) String() string {
+	return f.expr
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokKeyword
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string // upper case for keywords
+	num  float64
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+var filterKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "BETWEEN": true, "LIKE": true,
+	"IN": true, "IS": true, "NULL": true,
+}
+
+func lexFilter(expr string) (tokens []token, err error) {
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '\'' || c == '"':
+			// quotes are escaped by doubling them
+			var s strings.Builder
+			j := i + 1
+			for ; ; j++ {
+				if j == len(expr) {
+					return nil, fmt.Errorf("unterminated string at %d", i)
+				}
+				if expr[j] == c {
+					if j+1 < len(expr) && expr[j+1] == c {
+						j++
+					} else {
+						break
+					}
+				}
+				s.WriteByte(expr[j])
+			}
+			kind := tokString
+			if c == '"' {
+				kind = tokIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: s.String(), pos: i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(expr) && (expr[j] >= '0' && expr[j] <= '9' || expr[j] == '.' || expr[j] == 'e' || expr[j] == 'E' ||
+				(expr[j] == '-' || expr[j] == '+') && (expr[j-1] == 'e' || expr[j-1] == 'E')) {
+				j++
+			}
+			var f float64
+			if f, err = strconv.ParseFloat(expr[i:j], 64); err != nil {
+				return nil, fmt.Errorf("invalid number at %d: %s", i, expr[i:j])
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: expr[i:j], num: f, pos: i})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(expr) && (expr[j] == '_' || unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j]))) {
+				j++
+			}
+			word := expr[i:j]
+			if filterKeywords[strings.ToUpper(word)] {
+				tokens = append(tokens, token{kind: tokKeyword, text: strings.ToUpper(word), pos: i})
+			} else {
+				tokens = append(tokens, token{kind: tokIdent, text: word, pos: i})
+			}
+			i = j
+		default:
+			op := string(c)
+			if i+1 < len(expr) {
+				switch two := expr[i : i+2]; two {
+				case "<=", ">=", "<>", "!=":
+					op = two
+				}
+			}
+			if len(op) == 1 && !strings.Contains("=<>+-*/%(),", op) {
+				return nil, fmt.Errorf("unexpected character at %d: %q", i, c)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(expr)}), nil
+}
+
+type filterParser struct {
+	fields []FieldDescriptor
+	tokens []token
+	pos    int
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// accept consumes the next token if it's the keyword or operator text.
+func (p *filterParser) accept(text string) bool {
+	t := p.tokens[p.pos]
+	if (t.kind == tokKeyword || t.kind == tokOp) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("expected '%s' at %d, got %s", text, p.peek().pos, p.peek())
+	}
+	return nil
+}
+
+func (p *filterParser) or() (n exprNode, err error) {
+	if n, err = p.and(); err != nil {
+		return
+	}
+	for p.accept("OR") {
+		var r exprNode
+		if r, err = p.and(); err != nil {
+			return
+		}
+		if err = checkKinds("OR", kindBool, n, r); err != nil {
+			return
+		}
+		n = logical(n, r, true)
+	}
+	return
+}
+
+func (p *filterParser) and() (n exprNode, err error) {
+	if n, err = p.not(); err != nil {
+		return
+	}
+	for p.accept("AND") {
+		var r exprNode
+		if r, err = p.not(); err != nil {
+			return
+		}
+		if err = checkKinds("AND", kindBool, n, r); err != nil {
+			return
+		}
+		n = logical(n, r, false)
+	}
+	return
+}
+
+// logical combines l and r with OR if or is set, AND otherwise, using
+// SQL's three valued logic.
+func logical(l, r exprNode, or bool) exprNode {
+	return exprNode{kind: kindBool, eval: func(row []interface{}) interface{} {
+		a := l.eval(row)
+		if a == or {
+			return or
+		}
+		b := r.eval(row)
+		if b == or {
+			return or
+		}
+		if a == nil || b == nil {
+			return nil
+		}
+		return !or
+	}}
+}
+
+func (p *filterParser) not() (n exprNode, err error) {
+	if !p.accept("NOT") {
+		return p.predicate()
+	}
+	if n, err = p.not(); err != nil {
+		return
+	}
+	if err = checkKinds("NOT", kindBool, n); err != nil {
+		return
+	}
+	return negate(n), nil
+}
+
+func negate(n exprNode) exprNode {
+	return exprNode{kind: kindBool, eval: func(row []interface{}) interface{} {
+		if b, ok := n.eval(row).(bool); ok {
+			return !b
+		}
+		return nil
+	}}
+}
+
+func (p *filterParser) predicate() (n exprNode, err error) {
+	if n, err = p.sum(); err != nil {
+		return
+	}
+	t := p.peek()
+	if t.kind == tokOp {
+		switch t.text {
+		case "=", "<>", "!=", "<", "<=", ">", ">=":
+			p.pos++
+			var r exprNode
+			if r, err = p.sum(); err != nil {
+				return
+			}
+			return comparison(t.text, n, r)
+		}
+		return
+	}
+	if t.kind != tokKeyword {
+		return
+	}
+	if p.accept("IS") {
+		not := p.accept("NOT")
+		if err = p.expect("NULL"); err != nil {
+			return
+		}
+		arg := n
+		return exprNode{kind: kindBool, eval: func(row []interface{}) interface{} {
+			return (arg.eval(row) == nil) != not
+		}}, nil
+	}
+	not := false
+	if t.text == "NOT" {
+		switch p.tokens[p.pos+1].text {
+		case "BETWEEN", "LIKE", "IN":
+			p.pos++
+			not = true
+		default:
+			return
+		}
+	}
+	switch p.peek().text {
+	case "BETWEEN":
+		p.pos++
+		var lo, hi, ge, le exprNode
+		if lo, err = p.sum(); err != nil {
+			return
+		}
+		if err = p.expect("AND"); err != nil {
+			return
+		}
+		if hi, err = p.sum(); err != nil {
+			return
+		}
+		if ge, err = comparison(">=", n, lo); err != nil {
+			return
+		}
+		if le, err = comparison("<=", n, hi); err != nil {
+			return
+		}
+		n = logical(ge, le, false)
+	case "LIKE":
+		p.pos++
+		var pattern exprNode
+		if pattern, err = p.sum(); err != nil {
+			return
+		}
+		if n, err = like(n, pattern); err != nil {
+			return
+		}
+	case "IN":
+		p.pos++
+		if n, err = p.in(n); err != nil {
+			return
+		}
+	default:
+		return
+	}
+	if not {
+		n = negate(n)
+	}
+	return
+}
+
+func (p *filterParser) in(arg exprNode) (n exprNode, err error) {
+	if err = p.expect("("); err != nil {
+		return
+	}
+	var eqs []exprNode
+	for {
+		var v, eq exprNode
+		if v, err = p.sum(); err != nil {
+			return
+		}
+		if eq, err = comparison("=", arg, v); err != nil {
+			return
+		}
+		eqs = append(eqs, eq)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err = p.expect(")"); err != nil {
+		return
+	}
+	n = eqs[0]
+	for _, eq := range eqs[1:] {
+		n = logical(n, eq, true)
+	}
+	return
+}
+
+func comparison(op string, l, r exprNode) (n exprNode, err error) {
+	if l.kind != r.kind || l.kind == kindBool {
+		return n, fmt.Errorf("can't compare %s %s %s", l.kind, op, r.kind)
+	}
+	test := map[string]func(c int) bool{
+		"=":  func(c int) bool { return c == 0 },
+		"<>": func(c int) bool { return c != 0 },
+		"!=": func(c int) bool { return c != 0 },
+		"<":  func(c int) bool { return c < 0 },
+		"<=": func(c int) bool { return c <= 0 },
+		">":  func(c int) bool { return c > 0 },
+		">=": func(c int) bool { return c >= 0 },
+	}[op]
+	return exprNode{kind: kindBool, eval: func(row []interface{}) interface{} {
+		a, b := l.eval(row), r.eval(row)
+		if a == nil || b == nil {
+			return nil
+		}
+		if s, ok := a.(string); ok {
+			return test(strings.Compare(s, b.(string)))
+		}
+		x, y := a.(float64), b.(float64)
+		if math.IsNaN(x) || math.IsNaN(y) {
+			return nil
+		}
+		return test(compareFloat(x, y))
+	}}, nil
+}
+
+func like(arg, pattern exprNode) (n exprNode, err error) {
+	if err = checkKinds("LIKE", kindString, arg, pattern); err != nil {
+		return
+	}
+	compile := func(pattern string) *regexp.Regexp {
+		var re strings.Builder
+		re.WriteString("(?s)^")
+		for _, c := range pattern {
+			switch c {
+			case '%':
+				re.WriteString(".*")
+			case '_':
+				re.WriteString(".")
+			default:
+				re.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		re.WriteString("$")
+		return regexp.MustCompile(re.String())
+	}
+	var fixed *regexp.Regexp
+	if pattern.constant {
+		if s, ok := pattern.eval(nil).(string); ok {
+			fixed = compile(s)
+		}
+	}
+	return exprNode{kind: kindBool, eval: func(row []interface{}) interface{} {
+		a := arg.eval(row)
+		if a == nil {
+			return nil
+		}
+		re := fixed
+		if re == nil {
+			b, ok := pattern.eval(row).(string)
+			if !ok {
+				return nil
+			}
+			re = compile(b)
+		}
+		return re.MatchString(a.(string))
+	}}, nil
+}
+
+func (p *filterParser) sum() (n exprNode, err error) {
+	if n, err = p.product(); err != nil {
+		return
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokOp || op != "+" && op != "-" {
+			return
+		}
+		p.pos++
+		var r exprNode
+		if r, err = p.product(); err != nil {
+			return
+		}
+		if n, err = arithmetic(op, n, r); err != nil {
+			return
+		}
+	}
+}
+
+func (p *filterParser) product() (n exprNode, err error) {
+	if n, err = p.unary(); err != nil {
+		return
+	}
+	for {
+		op := p.peek().text
+		if p.peek().kind != tokOp || op != "*" && op != "/" && op != "%" {
+			return
+		}
+		p.pos++
+		var r exprNode
+		if r, err = p.unary(); err != nil {
+			return
+		}
+		if n, err = arithmetic(op, n, r); err != nil {
+			return
+		}
+	}
+}
+
+// arithmetic combines two numbers, the result is NULL if either is NULL
+// or when dividing by zero.
+func arithmetic(op string, l, r exprNode) (n exprNode, err error) {
+	if err = checkKinds(op, kindNumber, l, r); err != nil {
+		return
+	}
+	return exprNode{kind: kindNumber, constant: l.constant && r.constant, eval: func(row []interface{}) interface{} {
+		a, b := l.eval(row), r.eval(row)
+		if a == nil || b == nil {
+			return nil
+		}
+		x, y := a.(float64), b.(float64)
+		switch op {
+		case "+":
+			return x + y
+		case "-":
+			return x - y
+		case "*":
+			return x * y
+		}
+		if y == 0 {
+			return nil
+		}
+		if op == "/" {
+			return x / y
+		}
+		return math.Mod(x, y)
+	}}, nil
+}
+
+func (p *filterParser) unary() (n exprNode, err error) {
+	if p.accept("-") {
+		if n, err = p.unary(); err != nil {
+			return
+		}
+		return arithmetic("-", constant(0.0), n)
+	}
+	return p.primary()
+}
+
+func constant(v interface{}) exprNode {
+	kind := kindNumber
+	if _, ok := v.(string); ok {
+		kind = kindString
+	}
+	return exprNode{kind: kind, constant: true, eval: func([]interface{}) interface{} { return v }}
+}
+
+func (p *filterParser) primary() (n exprNode, err error) {
+	t := p.peek()
+	p.pos++
+	switch t.kind {
+	case tokNumber:
+		return constant(t.num), nil
+	case tokString:
+		return constant(t.text), nil
+	case tokIdent:
+		return p.field(t)
+	case tokOp:
+		if t.text == "(" {
+			if n, err = p.or(); err != nil {
+				return
+			}
+			err = p.expect(")")
+			return
+		}
+	}
+	return n, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
+
+func (p *filterParser) field(t token) (n exprNode, err error) {
+	col := -1
+	for i := range p.fields {
+		if strings.EqualFold(p.fields[i].FieldName(), t.text) {
+			col = i
+			break
+		}
+	}
+	if col == -1 {
+		return n, fmt.Errorf("no such field: %s", t.text)
+	}
+	switch p.fields[col].FieldType {
+	case Character:
+		return exprNode{kind: kindString, eval: func(row []interface{}) interface{} {
+			if s, ok := row[col].(string); ok {
+				return strings.TrimRight(s, " ")
+			}
+			return nil
+		}}, nil
+	case Number, Float:
+		return exprNode{kind: kindNumber, eval: func(row []interface{}) interface{} {
+			if f, ok := keyNumber(row[col]); ok {
+				return f
+			}
+			return nil
+		}}, nil
+	}
+	return n, fmt.Errorf("can't filter on field type %c: %s", p.fields[col].FieldType, t.text)
+}
+
+func checkKinds(op string, kind exprKind, nodes ...exprNode) error {
+	for _, n := range nodes {
+		if n.kind != kind {
+			return fmt.Errorf("%s expects %s operands, got %s", op, kind, n.kind)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package shapefile
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	fields := []FieldDescriptor{
+		{FieldName_: [11]byte{'N', 'A', 'M', 'E'}, FieldType: Character, FieldLength: 10},
+		{FieldName_: [11]byte{'P', 'O', 'P'}, FieldType: Number, FieldLength: 8},
+		{FieldName_: [11]byte{'A', 'R', 'E', 'A'}, FieldType: Number, FieldLength: 8, DecimalCount: 2},
+	}
+	row := []interface{}{"Berlin    ", int64(3500000), 891.75}
+	blank := []interface{}{"          ", nil, 0.0}
+
+	tests := []struct {
+		expr       string
+		row, blank bool
+	}{
+		{"NAME = 'Berlin'", true, false},
+		{"name <> 'Bonn' AND pop > 1e6", true, false},
+		{"POP / AREA BETWEEN 3900 AND 4000", true, false},
+		{"POP / AREA NOT BETWEEN 3900 AND 4000", false, false},
+		{"\"NAME\" LIKE 'B_r%'", true, false},
+		{"NAME NOT LIKE '%n'", false, true},
+		{"NAME IN ('Bonn', 'Berlin')", true, false},
+		{"POP IS NULL", false, true},
+		{"NOT POP IS NOT NULL", false, true},
+		{"POP > 0 OR AREA = 0", true, true},
+		{"NOT (POP > 0)", false, false},
+		{"POP % 7 = 0 AND -AREA < 0", true, false},
+		{"POP / AREA / AREA > 0 OR NAME = ''", true, true},
+		{"NAME = 'it''s'", false, false},
+	}
+	for _, test := range tests {
+		f, err := ParseFilter(test.expr, fields)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if m := f.Match(row); m != test.row {
+			t.Errorf("%s: expected %v for row, got %v", test.expr, test.row, m)
+		}
+		if m := f.Match(blank); m != test.blank {
+			t.Errorf("%s: expected %v for blank row, got %v", test.expr, test.blank, m)
+		}
+	}
+
+	for _, expr := range []string{
+		"",
+		"NAME",
+		"NAME = 1",
+		"POP + NAME > 0",
+		"FOO = 1",
+		"NAME LIKE 1",
+		"NAME = 'Berlin",
+		"POP > 1 AND",
+		"(POP > 1",
+		"POP > 1 POP",
+		"POP BETWEEN 1 OR 2",
+		"POP = 1 = 2",
+		"POP # 1",
+	} {
+		if _, err := ParseFilter(expr, fields); err == nil {
+			t.Errorf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestReaderFilter(t *testing.T) {
+	file, _ := os.Open(dbf_test_fn)
+	dbf, err := NewDBFFile(file)
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	land, nr := dbf.fieldIndex("LAND_NAME"), dbf.fieldIndex("WKR_NR")
+	expected := 0
+	for _, e := range dbf.Entries {
+		n := e[nr].(int64)
+		if strings.TrimRight(e[land].(string), " ") == "Bayern" && n >= 200 && n <= 250 {
+			expected++
+		}
+	}
+	if expected == 0 {
+		t.Fatal("no test data")
+	}
+
+	shp, _ := os.Open(testfile)
+	defer shp.Close()
+	dbfFile, _ := os.Open(dbf_test_fn)
+	defer dbfFile.Close()
+	r, err := NewReader(shp, dbfFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Filter, err = ParseFilter("LAND_NAME = 'Bayern' AND WKR_NR BETWEEN 200 AND 250", r.Fields); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := f.Record.Content.(*Polygon); !ok {
+			t.Errorf("unexpected content: %T", f.Record.Content)
+		}
+		if n := f.Attributes[nr].(int64); n < 200 || n > 250 {
+			t.Errorf("unexpected WKR_NR: %d", n)
+		}
+		count++
+	}
+	if count != expected {
+		t.Errorf("expected %d features, got %d", expected, count)
+	}
+}
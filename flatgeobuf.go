@@ -0,0 +1,1292 @@
+package shapefile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FlatGeobuf is documented here: https://flatgeobuf.org, the schemas are
+// header.fbs and feature.fbs in https://github.com/flatgeobuf/flatgeobuf
+
+var fgbMagic = []byte{'f', 'g', 'b', 3, 'f', 'g', 'b', 0}
+
+// FlatGeobuf geometry types
+const (
+	fgbUnknown           = 0
+	fgbPoint             = 1
+	fgbLineString        = 2
+	fgbPolygon           = 3
+	fgbMultiPoint        = 4
+	fgbMultiLineString   = 5
+	fgbMultiPolygon      = 6
+	fgbPolyhedralSurface = 15
+	fgbTIN               = 16
+	fgbTriangle          = 17
+)
+
+// FlatGeobuf column types
+const (
+	fgbByte = iota
+	fgbUByte
+	fgbBool
+	fgbShort
+	fgbUShort
+	fgbInt
+	fgbUInt
+	fgbLong
+	fgbULong
+	fgbFloat
+	fgbDouble
+	fgbString
+	fgbJSON
+	fgbDateTime
+	fgbBinary
+)
+
+// FlatGeobufOptions control WriteFlatGeobuf.
+type FlatGeobufOptions struct {
+	Name          string // of the layer, the file name of the dataset if empty
+	IndexNodeSize int    // of the packed Hilbert R-tree, 16 if 0
+	NoIndex       bool   // keeps the features in record order
+}
+
+// WriteFlatGeobuf writes ds as FlatGeobuf, along with a packed Hilbert
+// R-tree unless opts.NoIndex is set. The index requires the features to
+// be written in the order of the Hilbert curve through the centers of
+// their bounding boxes. Polylines become MultiLineStrings, polygons
+// MultiPolygons of the outer rings and their holes, keeping the
+// orientation of the rings, and MultiPatches PolyhedralSurfaces of
+// polygons: each outer or first ring with the rings following it, and
+// each triangle of the strips and fans. ReadFlatGeobuf reads them back
+// as outer and inner rings, the triangles as rings of their own.
+// Shapes with Z values and MultiPatches keep their M values. Character
+// fields become strings, Number fields without decimals integers and
+// other numbers doubles, all keeping their width and decimal count, Date
+// fields dates and Logical fields booleans.
+func WriteFlatGeobuf(w io.Writer, ds *Dataset, opts FlatGeobufOptions) (err error) {
+	nodeSize := opts.IndexNodeSize
+	if nodeSize == 0 {
+		nodeSize = 16
+	}
+	if opts.NoIndex {
+		nodeSize = 0
+	} else if nodeSize < 2 || nodeSize > math.MaxUint16 {
+		return fmt.Errorf("invalid index node size %d", nodeSize)
+	}
+	typ := ds.Shapefile.Header.ShapeType
+	var geometryType byte
+	switch typ {
+	case POINT, POINT_M, POINT_Z:
+		geometryType = fgbPoint
+	case MULTI_POINT, MULTI_POINT_M, MULTI_POINT_Z:
+		geometryType = fgbMultiPoint
+	case POLY_LINE, POLY_LINE_M, POLY_LINE_Z:
+		geometryType = fgbMultiLineString
+	case POLYGON, POLYGON_M, POLYGON_Z:
+		geometryType = fgbMultiPolygon
+	case MULTI_PATCH:
+		geometryType = fgbPolyhedralSurface
+	}
+	hasZ := typ/10 == 1 || typ == MULTI_PATCH
+	hasM := typ/10 == 1 || typ/10 == 2
+	if typ == MULTI_PATCH {
+		for _, f := range ds.Features() {
+			if mp, ok := f.Record.Content.(*MultiPatch); ok && len(mp.MArray) > 0 {
+				hasM = true
+			}
+		}
+	}
+
+	var columns []fgbColumn
+	if ds.DBF != nil {
+		for _, fd := range ds.DBF.FieldDescriptors {
+			c := fgbColumn{name: fd.FieldName(), typ: fgbString, width: int(fd.FieldLength), scale: -1}
+			switch {
+			case fd.FieldType == Number && fd.DecimalCount == 0 && fd.FieldLength < 10:
+				c.typ = fgbInt
+			case fd.FieldType == Number && fd.DecimalCount == 0:
+				c.typ = fgbLong
+			case fd.FieldType == Number || fd.FieldType == Float:
+				c.typ, c.scale = fgbDouble, int(fd.DecimalCount)
+			case fd.FieldType == Date:
+				c.typ = fgbDateTime
+			case fd.FieldType == Logical:
+				c.typ = fgbBool
+			}
+			columns = append(columns, c)
+		}
+	}
+
+	type item struct {
+		box     Box
+		hilbert uint32
+		feature []byte
+	}
+	var items []item
+	extent := Box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, f := range ds.Features() {
+		if f.Deleted {
+			continue
+		}
+		var properties []byte
+		if properties, err = fgbProperties(columns, f.Attributes); err != nil {
+			return
+		}
+		feature := []fbField{fgbGeometry(f.Record.Content, hasZ, hasM), fbBytes(properties)}
+		b, ok := boxOf(f.Record.Content)
+		if ok {
+			extent = extent.union(b)
+		} else {
+			b = Box{math.NaN(), math.NaN(), math.NaN(), math.NaN()}
+		}
+		items = append(items, item{box: b, feature: fbFinish(feature)})
+	}
+	empty := math.IsInf(extent.Xmin, 1)
+	if empty {
+		extent = Box{}
+	}
+	if nodeSize > 0 {
+		hilbertMax := float64(1<<16 - 1)
+		width, height := extent.Xmax-extent.Xmin, extent.Ymax-extent.Ymin
+		for i := range items {
+			b := &items[i].box
+			if math.IsNaN(b.Xmin) {
+				// null shapes are indexed at a corner of the extent
+				*b = Box{extent.Xmin, extent.Ymin, extent.Xmin, extent.Ymin}
+			}
+			var x, y uint32
+			if width > 0 {
+				x = uint32(math.Floor(hilbertMax * ((b.Xmin+b.Xmax)/2 - extent.Xmin) / width))
+			}
+			if height > 0 {
+				y = uint32(math.Floor(hilbertMax * ((b.Ymin+b.Ymax)/2 - extent.Ymin) / height))
+			}
+			items[i].hilbert = hilbert(x, y)
+		}
+		sort.SliceStable(items, func(i, j int) bool { return items[i].hilbert > items[j].hilbert })
+	}
+
+	header := make([]fbField, 14)
+	name := opts.Name
+	if name == "" && ds.base != "" {
+		name = filepath.Base(ds.base)
+	}
+	if name != "" {
+		header[0] = fbString(name)
+	}
+	if !empty {
+		header[1] = fbDoubles([]float64{extent.Xmin, extent.Ymin, extent.Xmax, extent.Ymax})
+	}
+	header[2] = fbScalar(geometryType)
+	header[3] = fbScalar(hasZ)
+	header[4] = fbScalar(hasM)
+	if len(columns) > 0 {
+		var tables [][]fbField
+		for _, c := range columns {
+			tables = append(tables, c.fields())
+		}
+		header[7] = fbTables(tables)
+	}
+	header[8] = fbScalar(uint64(len(items)))
+	header[9] = fbScalar(uint16(nodeSize))
+	if crs := ds.CRS; crs != nil {
+		fields := make([]fbField, 5)
+		if crs.EPSG != 0 {
+			fields[0], fields[1] = fbString("EPSG"), fbScalar(int32(crs.EPSG))
+		}
+		fields[2], fields[4] = fbString(crs.Name), fbString(crs.WKT())
+		header[10] = fbSubtable(fields)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(fgbMagic)
+	buf.Write(fbFinish(header))
+	if nodeSize > 0 && len(items) > 0 {
+		nodes := make([]fgbNode, len(items))
+		var offset uint64
+		for i, it := range items {
+			nodes[i] = fgbNode{it.box, offset}
+			offset += uint64(len(it.feature))
+		}
+		if err = binary.Write(&buf, L, packedRTree(nodes, nodeSize)); err != nil {
+			return
+		}
+	}
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		return
+	}
+	for _, it := range items {
+		if _, err = w.Write(it.feature); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// fgbColumn describes an attribute column, width and scale are -1 if
+// unknown.
+type fgbColumn struct {
+	name         string
+	typ          byte
+	width, scale int
+}
+
+func (c fgbColumn) fields() []fbField {
+	fields := make([]fbField, 7)
+	fields[0], fields[1] = fbString(c.name), fbScalar(c.typ)
+	if c.width >= 0 {
+		fields[4] = fbScalar(int32(c.width))
+	}
+	if c.scale >= 0 {
+		fields[6] = fbScalar(int32(c.scale))
+	}
+	return fields
+}
+
+// fgbProperties encodes the non nil attributes as pairs of the column
+// index and the value. Dates are written as ISO 8601, unknown logicals
+// are left out.
+func fgbProperties(columns []fgbColumn, attributes []interface{}) (properties []byte, err error) {
+	for i, c := range columns {
+		v := attributes[i]
+		switch c.typ {
+		case fgbDateTime:
+			if v, err = fgbDate(v); err != nil {
+				return nil, fmt.Errorf("field %s: %v", c.name, err)
+			}
+		case fgbBool:
+			v = fgbLogical(v)
+		}
+		if v == nil {
+			continue
+		}
+		properties = L.AppendUint16(properties, uint16(i))
+		switch c.typ {
+		case fgbBool:
+			if v.(bool) {
+				properties = append(properties, 1)
+			} else {
+				properties = append(properties, 0)
+			}
+		case fgbInt, fgbLong, fgbDouble:
+			var f float64
+			switch v := v.(type) {
+			case int64:
+				f = float64(v)
+			case int:
+				f = float64(v)
+			case float64:
+				f = v
+			default:
+				if f, err = strconv.ParseFloat(strings.TrimSpace(formatValue(v)), 64); err != nil {
+					return nil, fmt.Errorf("field %s: %v isn't a number", c.name, v)
+				}
+			}
+			switch c.typ {
+			case fgbInt:
+				properties = L.AppendUint32(properties, uint32(int32(f)))
+			case fgbLong:
+				n, ok := v.(int64)
+				if !ok {
+					n = int64(f)
+				}
+				properties = L.AppendUint64(properties, uint64(n))
+			default:
+				properties = L.AppendUint64(properties, math.Float64bits(f))
+			}
+		default:
+			s := formatValue(v)
+			properties = L.AppendUint32(properties, uint32(len(s)))
+			properties = append(properties, s...)
+		}
+	}
+	return
+}
+
+// fgbDate returns the value of a Date field as ISO 8601 date, nil if
+// it's blank.
+func fgbDate(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case time.Time:
+		return v.Format("2006-01-02"), nil
+	}
+	s := strings.TrimSpace(formatValue(v))
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("20060102", s)
+	if err != nil {
+		return nil, fmt.Errorf("%v isn't a date", v)
+	}
+	return t.Format("2006-01-02"), nil
+}
+
+// fgbLogical returns the value of a Logical field as bool, nil if it's
+// unknown.
+func fgbLogical(v interface{}) interface{} {
+	if b, ok := v.(bool); ok {
+		return b
+	}
+	switch s := strings.TrimSpace(formatValue(v)); {
+	case s == "":
+	case strings.ContainsAny(s[:1], "TtYy"):
+		return true
+	case strings.ContainsAny(s[:1], "FfNn"):
+		return false
+	}
+	return nil
+}
+
+// fgbGeometry returns the geometry table of a shape, or an absent field
+// for null shapes.
+func fgbGeometry(content RecordContent, hasZ, hasM bool) fbField {
+	parts, areal := verticesOf(content)
+	if len(parts) == 0 {
+		return fbField{}
+	}
+	if _, m := zmOf(content); m == nil {
+		hasM = false
+	}
+	geometry := func(parts [][]vertex, ends bool, typ byte) []fbField {
+		var xy, z, m []float64
+		var end []uint32
+		for _, part := range parts {
+			for _, v := range part {
+				xy = append(xy, v.X, v.Y)
+				z = append(z, v.Z)
+				m = append(m, v.M)
+			}
+			end = append(end, uint32(len(xy)/2))
+		}
+		fields := make([]fbField, 8)
+		if ends && len(parts) > 1 {
+			fields[0] = fbUint32s(end)
+		}
+		fields[1] = fbDoubles(xy)
+		if hasZ {
+			fields[2] = fbDoubles(z)
+		}
+		if hasM {
+			fields[3] = fbDoubles(m)
+		}
+		if typ != fgbUnknown {
+			fields[6] = fbScalar(typ)
+		}
+		return fields
+	}
+	switch {
+	case areal:
+		rings := make([][]Point, len(parts))
+		for i, part := range parts {
+			for _, v := range part {
+				rings[i] = append(rings[i], v.point())
+			}
+		}
+		var polygons [][]fbField
+		for _, polygon := range groupRings(rings) {
+			var rs [][]vertex
+			for _, i := range polygon {
+				rs = append(rs, parts[i])
+			}
+			polygons = append(polygons, geometry(rs, true, fgbPolygon))
+		}
+		fields := make([]fbField, 8)
+		fields[7] = fbTables(polygons)
+		return fbSubtable(fields)
+	case shapeTypeOf(content) == MULTI_PATCH:
+		mp := content.(*MultiPatch)
+		partType := func(i int) PartType {
+			if i < len(mp.PartTypes) {
+				return mp.PartTypes[i]
+			}
+			return RING
+		}
+		closed := func(r []vertex) []vertex {
+			if len(r) > 0 && r[0].point() != r[len(r)-1].point() {
+				r = append(r[:len(r):len(r)], r[0])
+			}
+			return r
+		}
+		var polygons [][]fbField
+		for i := 0; i < len(parts); i++ {
+			part := parts[i]
+			switch typ := partType(i); typ {
+			case TRIANGLE_STRIP, TRIANGLE_FAN:
+				// ordered as Triangulate does, then reversed since rings
+				// face the side they appear clockwise from
+				for j := 0; j+2 < len(part); j++ {
+					a, b, c := part[j], part[j+1], part[j+2]
+					switch {
+					case typ == TRIANGLE_FAN:
+						a = part[0]
+					case j%2 == 1:
+						a, b = b, a
+					}
+					if a.point() == b.point() && a.Z == b.Z || b.point() == c.point() && b.Z == c.Z || a.point() == c.point() && a.Z == c.Z {
+						continue
+					}
+					polygons = append(polygons, geometry([][]vertex{{a, c, b, a}}, true, fgbPolygon))
+				}
+			default:
+				rings := [][]vertex{closed(part)}
+				follower := map[PartType]PartType{OUTER_RING: INNER_RING, FIRST_RING: RING}
+				for next, ok := follower[typ]; ok && i+1 < len(parts) && partType(i+1) == next; i++ {
+					rings = append(rings, closed(parts[i+1]))
+				}
+				polygons = append(polygons, geometry(rings, true, fgbPolygon))
+			}
+		}
+		fields := make([]fbField, 8)
+		fields[7] = fbTables(polygons)
+		return fbSubtable(fields)
+	}
+	switch shapeTypeOf(content) {
+	case POINT, POINT_M, POINT_Z, MULTI_POINT, MULTI_POINT_M, MULTI_POINT_Z:
+		return fbSubtable(geometry(parts, false, fgbUnknown))
+	}
+	return fbSubtable(geometry(parts, true, fgbUnknown))
+}
+
+// hilbert returns the position of (x, y), both below 2^16, along a
+// Hilbert curve, computed as FlatGeobuf does.
+func hilbert(x, y uint32) uint32 {
+	a := x ^ y
+	b := 0xFFFF ^ a
+	c := 0xFFFF ^ (x | y)
+	d := x & (y ^ 0xFFFF)
+
+	A := a | (b >> 1)
+	B := (a >> 1) ^ a
+	C := ((c >> 1) ^ (b & (d >> 1))) ^ c
+	D := ((a & (c >> 1)) ^ (d >> 1)) ^ d
+
+	a, b, c, d = A, B, C, D
+	A = (a & (a >> 2)) ^ (b & (b >> 2))
+	B = (a & (b >> 2)) ^ (b & ((a ^ b) >> 2))
+	C ^= (a & (c >> 2)) ^ (b & (d >> 2))
+	D ^= (b & (c >> 2)) ^ ((a ^ b) & (d >> 2))
+
+	a, b, c, d = A, B, C, D
+	A = (a & (a >> 4)) ^ (b & (b >> 4))
+	B = (a & (b >> 4)) ^ (b & ((a ^ b) >> 4))
+	C ^= (a & (c >> 4)) ^ (b & (d >> 4))
+	D ^= (b & (c >> 4)) ^ ((a ^ b) & (d >> 4))
+
+	a, b, c, d = A, B, C, D
+	C ^= (a & (c >> 8)) ^ (b & (d >> 8))
+	D ^= (b & (c >> 8)) ^ ((a ^ b) & (d >> 8))
+
+	a = C ^ (C >> 1)
+	b = D ^ (D >> 1)
+
+	i0 := x ^ y
+	i1 := b | (0xFFFF ^ (i0 | a))
+	interleave := func(i uint32) uint32 {
+		i = (i | (i << 8)) & 0x00FF00FF
+		i = (i | (i << 4)) & 0x0F0F0F0F
+		i = (i | (i << 2)) & 0x33333333
+		return (i | (i << 1)) & 0x55555555
+	}
+	return (interleave(i1) << 1) | interleave(i0)
+}
+
+// fgbNode is a node of the packed R-tree: the box of its children and
+// the index of the first of them, or of a feature the byte offset of
+// its data.
+type fgbNode struct {
+	Box    Box
+	Offset uint64
+}
+
+// levelBounds returns the first and last+1 node of each level of a
+// packed R-tree over n items, from the leaves up to the root. The nodes
+// are stored root first.
+func levelBounds(n, nodeSize int) (bounds [][2]int) {
+	counts := []int{n}
+	total := n
+	for {
+		n = (n + nodeSize - 1) / nodeSize
+		counts = append(counts, n)
+		total += n
+		if n == 1 {
+			break
+		}
+	}
+	for _, count := range counts {
+		bounds = append(bounds, [2]int{total - count, total})
+		total -= count
+	}
+	return
+}
+
+// packedRTree returns the nodes of the R-tree over the leaves, which
+// have to be in Hilbert order.
+func packedRTree(leaves []fgbNode, nodeSize int) []fgbNode {
+	bounds := levelBounds(len(leaves), nodeSize)
+	nodes := make([]fgbNode, bounds[0][1])
+	copy(nodes[bounds[0][0]:], leaves)
+	for i := 0; i < len(bounds)-1; i++ {
+		parent := bounds[i+1][0]
+		for pos := bounds[i][0]; pos < bounds[i][1]; parent++ {
+			node := fgbNode{nodes[pos].Box, uint64(pos)}
+			for end := min(pos+nodeSize, bounds[i][1]); pos < end; pos++ {
+				node.Box = node.Box.union(nodes[pos].Box)
+			}
+			nodes[parent] = node
+		}
+	}
+	return nodes
+}
+
+// fgbHeader is the decoded header of a FlatGeobuf file.
+type fgbHeader struct {
+	geometryType byte
+	hasZ, hasM   bool
+	columns      []fgbColumn
+	count        int
+	nodeSize     int
+	crs          *CRS
+}
+
+// shapeType returns the type of the shapes of a geometry type, NULL_SHAPE
+// for types that can't be read.
+func (h *fgbHeader) shapeType(geometryType byte) (typ ShapeType) {
+	switch geometryType {
+	case fgbPoint:
+		typ = POINT
+	case fgbMultiPoint:
+		typ = MULTI_POINT
+	case fgbLineString, fgbMultiLineString:
+		typ = POLY_LINE
+	case fgbPolygon, fgbMultiPolygon:
+		typ = POLYGON
+	case fgbPolyhedralSurface, fgbTIN, fgbTriangle:
+		return MULTI_PATCH
+	default:
+		return NULL_SHAPE
+	}
+	switch {
+	case h.hasZ:
+		typ += 10
+	case h.hasM:
+		typ += 20
+	}
+	return
+}
+
+// indexSize returns the length of the packed R-tree in bytes.
+func (h *fgbHeader) indexSize() int {
+	if h.nodeSize == 0 || h.count == 0 {
+		return 0
+	}
+	bounds := levelBounds(h.count, h.nodeSize)
+	return bounds[0][1] * 40
+}
+
+func parseFGBHeader(buf []byte) (h *fgbHeader, err error) {
+	r := &fbReader{buf: buf}
+	t := r.root()
+	h = &fgbHeader{
+		geometryType: t.uint8(2, fgbUnknown),
+		hasZ:         t.uint8(3, 0) != 0,
+		hasM:         t.uint8(4, 0) != 0,
+		count:        int(t.uint64(8, 0)),
+		nodeSize:     int(t.uint16(9, 16)),
+	}
+	for _, c := range t.tables(7) {
+		h.columns = append(h.columns, fgbColumn{c.str(0), c.uint8(1, 0), int(c.int32(4, -1)), int(c.int32(6, -1))})
+	}
+	if crs, ok := t.table(10); ok {
+		if wkt := crs.str(4); wkt != "" {
+			h.crs, _ = ParseWKT(wkt)
+		}
+		org, code := crs.str(0), int(crs.int32(1, 0))
+		if h.crs == nil && code != 0 && (org == "" || strings.EqualFold(org, "EPSG")) {
+			h.crs, _ = CRSFromEPSG(code)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if h.count < 0 || h.nodeSize == 1 {
+		return nil, fmt.Errorf("invalid header")
+	}
+	return
+}
+
+// fgbSizes are the sizes of fixed size values by column type.
+var fgbSizes = map[byte]int{fgbByte: 1, fgbUByte: 1, fgbBool: 1, fgbShort: 2, fgbUShort: 2, fgbInt: 4, fgbUInt: 4, fgbFloat: 4, fgbLong: 8, fgbULong: 8, fgbDouble: 8}
+
+// fgbFeature is a decoded feature along with its attributes, typed by
+// the column and not yet fitted to .dbf fields.
+type fgbFeature struct {
+	content    RecordContent
+	attributes []interface{}
+}
+
+func (h *fgbHeader) parseFeature(buf []byte) (f fgbFeature, err error) {
+	r := &fbReader{buf: buf}
+	t := r.root()
+	if g, ok := t.table(0); ok {
+		if f.content, err = h.shape(g); err != nil {
+			return
+		}
+	}
+	f.attributes = make([]interface{}, len(h.columns))
+	props := t.bytes(1)
+	for len(props) >= 2 && r.err == nil {
+		i := int(L.Uint16(props))
+		props = props[2:]
+		if i >= len(h.columns) {
+			return f, fmt.Errorf("invalid column %d", i)
+		}
+		size := fgbSizes[h.columns[i].typ]
+		if size == 0 {
+			if len(props) < 4 {
+				break
+			}
+			size = 4 + int(L.Uint32(props))
+		}
+		if size > len(props) || size < 0 {
+			return f, fmt.Errorf("truncated properties")
+		}
+		v := props[:size]
+		props = props[size:]
+		switch h.columns[i].typ {
+		case fgbByte:
+			f.attributes[i] = int64(int8(v[0]))
+		case fgbUByte:
+			f.attributes[i] = int64(v[0])
+		case fgbBool:
+			f.attributes[i] = v[0] != 0
+		case fgbShort:
+			f.attributes[i] = int64(int16(L.Uint16(v)))
+		case fgbUShort:
+			f.attributes[i] = int64(L.Uint16(v))
+		case fgbInt:
+			f.attributes[i] = int64(int32(L.Uint32(v)))
+		case fgbUInt:
+			f.attributes[i] = int64(L.Uint32(v))
+		case fgbLong, fgbULong:
+			f.attributes[i] = int64(L.Uint64(v))
+		case fgbFloat:
+			f.attributes[i] = float64(math.Float32frombits(L.Uint32(v)))
+		case fgbDouble:
+			f.attributes[i] = math.Float64frombits(L.Uint64(v))
+		default:
+			f.attributes[i] = string(v[4:])
+		}
+	}
+	if len(props) != 0 && err == nil {
+		err = fmt.Errorf("truncated properties")
+	}
+	if r.err != nil {
+		err = r.err
+	}
+	return
+}
+
+// shape converts a geometry table into a shape, the Z and M values
+// depending on the header. Polygon rings are oriented as shapefiles want
+// them, outer rings clockwise.
+func (h *fgbHeader) shape(g fbTable) (content RecordContent, err error) {
+	typ := h.geometryType
+	if typ == fgbUnknown {
+		typ = g.uint8(6, fgbUnknown)
+	}
+	vertices := func(g fbTable) (parts [][]vertex) {
+		xy, z, m := g.doubles(1), g.doubles(2), g.doubles(3)
+		vs := make([]vertex, len(xy)/2)
+		for i := range vs {
+			vs[i] = vertex{X: xy[2*i], Y: xy[2*i+1], M: math.NaN()}
+			if i < len(z) {
+				vs[i].Z = z[i]
+			}
+			if i < len(m) {
+				vs[i].M = m[i]
+			}
+		}
+		start := 0
+		for _, end := range g.uint32s(0) {
+			if int(end) < start || int(end) > len(vs) {
+				err = fmt.Errorf("invalid part end %d", end)
+				return nil
+			}
+			parts = append(parts, vs[start:end])
+			start = int(end)
+		}
+		if start < len(vs) {
+			parts = append(parts, vs[start:])
+		}
+		return
+	}
+	oriented := func(rings [][]vertex) [][]vertex {
+		for i, ring := range rings {
+			pts := make([]Point, len(ring))
+			for j, v := range ring {
+				pts[j] = v.point()
+			}
+			if a, _ := ringArea(pts); (a > 0) == (i == 0) {
+				reversed := make([]vertex, len(ring))
+				for j, v := range ring {
+					reversed[len(ring)-1-j] = v
+				}
+				rings[i] = reversed
+			}
+		}
+		return rings
+	}
+	var parts [][]vertex
+	var partTypes []PartType
+	switch typ {
+	case fgbPoint, fgbMultiPoint, fgbLineString, fgbMultiLineString:
+		parts = vertices(g)
+	case fgbPolygon:
+		parts = oriented(vertices(g))
+	case fgbMultiPolygon:
+		for _, p := range g.tables(7) {
+			parts = append(parts, oriented(vertices(p))...)
+		}
+	case fgbTIN, fgbTriangle:
+		for _, ring := range vertices(g) {
+			if len(ring) == 4 && ring[0].point() == ring[3].point() {
+				parts, partTypes = append(parts, ring[:3]), append(partTypes, TRIANGLE_FAN)
+			} else {
+				parts, partTypes = append(parts, ring), append(partTypes, OUTER_RING)
+			}
+		}
+	case fgbPolyhedralSurface:
+		for _, p := range g.tables(7) {
+			for i, ring := range vertices(p) {
+				parts = append(parts, ring)
+				partTypes = append(partTypes, map[bool]PartType{true: OUTER_RING, false: INNER_RING}[i == 0])
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %d", typ)
+	}
+	if err != nil || len(parts) == 0 {
+		return
+	}
+	shapeType := h.shapeType(typ)
+	if shapeType == MULTI_PATCH {
+		mp := &MultiPatch{PartTypes: partTypes}
+		hasM := false
+		for _, part := range parts {
+			mp.Parts = append(mp.Parts, int32(len(mp.Points)))
+			for _, v := range part {
+				mp.Points = append(mp.Points, v.point())
+				mp.ZArray = append(mp.ZArray, v.Z)
+				mp.MArray = append(mp.MArray, v.M)
+				hasM = hasM || !math.IsNaN(v.M)
+			}
+		}
+		mp.ZRange.Zmin, mp.ZRange.Zmax = rangeOf(mp.ZArray, 0, 0)
+		if hasM {
+			mp.MRange.Mmin, mp.MRange.Mmax = rangeOf(mp.MArray, 0, 0)
+		} else {
+			mp.MArray = nil
+		}
+		updateBox(mp)
+		return mp, nil
+	}
+	template := map[ShapeType]RecordContent{
+		POINT: &Point{}, POINT_M: &PointM{}, POINT_Z: &PointZ{},
+		MULTI_POINT: &MultiPoint{}, MULTI_POINT_M: &MultiPointM{}, MULTI_POINT_Z: &MultiPointZ{},
+		POLY_LINE: &PolyLine{}, POLY_LINE_M: &PolyLineM{}, POLY_LINE_Z: &PolyLineZ{},
+		POLYGON: &Polygon{}, POLYGON_M: &PolygonM{}, POLYGON_Z: &PolygonZ{},
+	}[shapeType]
+	return withVertices(template, parts), nil
+}
+
+// ReadFlatGeobuf reads a FlatGeobuf file into a dataset, skipping the
+// index. Shapes are read as WriteFlatGeobuf writes them, LineStrings as
+// polylines, Polygons as polygons, and PolyhedralSurfaces as MultiPatches
+// of rings. Attributes become Number fields for numeric columns, Logical
+// fields for booleans, Date fields for date times without a time of day
+// and Character fields for any other, wide enough for the values and at
+// least as wide as the column says. The CRS is nil if it isn't
+// recognized.
+func ReadFlatGeobuf(r io.Reader) (ds *Dataset, err error) {
+	r = bufio.NewReader(r)
+	var h *fgbHeader
+	if h, err = readFGBHeader(r); err != nil {
+		return
+	}
+	if _, err = io.CopyN(io.Discard, r, int64(h.indexSize())); err != nil {
+		return
+	}
+	var features []fgbFeature
+	size := make([]byte, 4)
+	for {
+		if _, err = io.ReadFull(r, size); err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+		buf := make([]byte, L.Uint32(size))
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return
+		}
+		var f fgbFeature
+		if f, err = h.parseFeature(buf); err != nil {
+			return
+		}
+		features = append(features, f)
+	}
+	return h.dataset(features)
+}
+
+// QueryFlatGeobuf reads the features of a FlatGeobuf file whose bounding
+// boxes intersect b into a dataset, as ReadFlatGeobuf does, reading only
+// the index and the matching features. The file must have an index.
+func QueryFlatGeobuf(r io.ReaderAt, b Box) (ds *Dataset, err error) {
+	sr := io.NewSectionReader(r, 0, math.MaxInt64)
+	var h *fgbHeader
+	if h, err = readFGBHeader(sr); err != nil {
+		return
+	}
+	if h.nodeSize == 0 {
+		return nil, fmt.Errorf("no spatial index")
+	}
+	indexStart, _ := sr.Seek(0, io.SeekCurrent)
+	var offsets []int64
+	if h.count > 0 {
+		nodes := make([]fgbNode, h.indexSize()/40)
+		if err = binary.Read(sr, L, nodes); err != nil {
+			return
+		}
+		bounds := levelBounds(h.count, h.nodeSize)
+		leaves := bounds[0][0]
+		type entry struct{ node, level int }
+		queue := []entry{{0, len(bounds) - 1}}
+		for len(queue) > 0 {
+			e := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			for pos := e.node; pos < min(e.node+h.nodeSize, bounds[e.level][1]); pos++ {
+				if !nodes[pos].Box.Intersects(b) {
+					continue
+				}
+				if pos >= leaves {
+					offsets = append(offsets, int64(nodes[pos].Offset))
+				} else if next := int(nodes[pos].Offset); e.level > 0 && next < len(nodes) {
+					queue = append(queue, entry{next, e.level - 1})
+				}
+			}
+		}
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	}
+	featuresStart := indexStart + int64(h.indexSize())
+	var features []fgbFeature
+	size := make([]byte, 4)
+	for _, offset := range offsets {
+		if _, err = r.ReadAt(size, featuresStart+offset); err != nil {
+			return
+		}
+		buf := make([]byte, L.Uint32(size))
+		if _, err = r.ReadAt(buf, featuresStart+offset+4); err != nil {
+			return
+		}
+		var f fgbFeature
+		if f, err = h.parseFeature(buf); err != nil {
+			return
+		}
+		features = append(features, f)
+	}
+	return h.dataset(features)
+}
+
+func readFGBHeader(r io.Reader) (h *fgbHeader, err error) {
+	magic := make([]byte, 12)
+	if _, err = io.ReadFull(r, magic); err != nil {
+		return
+	}
+	if !bytes.Equal(magic[:4], fgbMagic[:4]) || !bytes.Equal(magic[4:7], fgbMagic[4:7]) {
+		return nil, fmt.Errorf("not a FlatGeobuf file")
+	}
+	buf := make([]byte, L.Uint32(magic[8:]))
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return
+	}
+	return parseFGBHeader(buf)
+}
+
+// dataset builds a dataset of the features, fitting the columns to .dbf
+// fields.
+func (h *fgbHeader) dataset(features []fgbFeature) (ds *Dataset, err error) {
+	shapeType := h.shapeType(h.geometryType)
+	for _, f := range features {
+		if f.content != nil && h.geometryType == fgbUnknown {
+			shapeType = shapeTypeOf(f.content)
+			break
+		}
+	}
+	var names []string
+	for _, c := range h.columns {
+		names = append(names, c.name)
+	}
+	var fields []FieldDescriptor
+	for i, name := range fieldNames(names) {
+		c := h.columns[i]
+		typ, width, decimals := FieldType(Character), max(c.width, 1), 0 // of the field
+		switch c.typ {
+		case fgbBool:
+			typ, width = Logical, 1
+		case fgbDateTime:
+			if dates := fgbDates(features, i); dates != nil {
+				for j, d := range dates {
+					features[j].attributes[i] = d
+				}
+				typ, width = Date, 8
+			}
+		case fgbByte, fgbUByte, fgbShort, fgbUShort, fgbInt, fgbUInt, fgbLong, fgbULong:
+			typ = Number
+		case fgbFloat, fgbDouble:
+			typ, decimals = Number, c.scale
+			if decimals < 0 {
+				decimals = 0
+				for _, f := range features {
+					if v, ok := f.attributes[i].(float64); ok {
+						s := strconv.FormatFloat(v, 'f', -1, 64)
+						if dot := strings.IndexByte(s, '.'); dot != -1 {
+							decimals = max(decimals, len(s)-dot-1)
+						}
+					}
+				}
+				decimals = min(decimals, 15)
+			}
+		}
+		for _, f := range features {
+			switch v := f.attributes[i].(type) {
+			case float64:
+				width = max(width, len(strconv.FormatFloat(v, 'f', decimals, 64)))
+			case int64:
+				width = max(width, len(strconv.FormatInt(v, 10)))
+			case string:
+				width = max(width, len(v))
+			}
+		}
+		fields = append(fields, NewFieldDescriptor(name, typ, uint8(min(width, 254)), uint8(decimals)))
+	}
+	ds = NewDataset(shapeType, fields, h.crs)
+	for _, f := range features {
+		var attributes []interface{}
+		if fields != nil {
+			attributes = f.attributes
+		}
+		if err = ds.Add(f.content, attributes); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// fgbDates returns the values of the date time column i as .dbf dates,
+// nil if any of them has a time of day other than midnight.
+func fgbDates(features []fgbFeature, i int) (dates []interface{}) {
+	dates = make([]interface{}, len(features))
+	for j, f := range features {
+		s, ok := f.attributes[i].(string)
+		if !ok {
+			continue
+		}
+		var t time.Time
+		var err error
+		for _, layout := range []string{"2006-01-02", time.RFC3339Nano, "2006-01-02T15:04:05"} {
+			if t, err = time.Parse(layout, s); err == nil {
+				break
+			}
+		}
+		if err != nil || t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0 || t.Nanosecond() != 0 {
+			return nil
+		}
+		dates[j] = t.Format("20060102")
+	}
+	return
+}
+
+// fbField is a field of a FlatBuffers table, either an inline little
+// endian scalar or a reference to an object written by ref. The zero
+// value is an absent field.
+type fbField struct {
+	scalar []byte
+	ref    func(b *fbBuilder) int
+}
+
+func fbScalar(v interface{}) fbField {
+	var buf bytes.Buffer
+	binary.Write(&buf, L, v)
+	return fbField{scalar: buf.Bytes()}
+}
+
+func fbString(s string) fbField {
+	return fbField{ref: func(b *fbBuilder) int {
+		b.align(4, 0)
+		pos := len(b.buf)
+		b.buf = L.AppendUint32(b.buf, uint32(len(s)))
+		b.buf = append(append(b.buf, s...), 0)
+		return pos
+	}}
+}
+
+func fbBytes(data []byte) fbField {
+	return fbField{ref: func(b *fbBuilder) int { return b.vector(data, 1) }}
+}
+
+func fbDoubles(fs []float64) fbField {
+	data := make([]byte, 0, 8*len(fs))
+	for _, f := range fs {
+		data = L.AppendUint64(data, math.Float64bits(f))
+	}
+	return fbField{ref: func(b *fbBuilder) int { return b.vector(data, 8) }}
+}
+
+func fbUint32s(vs []uint32) fbField {
+	data := make([]byte, 0, 4*len(vs))
+	for _, v := range vs {
+		data = L.AppendUint32(data, v)
+	}
+	return fbField{ref: func(b *fbBuilder) int { return b.vector(data, 4) }}
+}
+
+func fbSubtable(fields []fbField) fbField {
+	return fbField{ref: func(b *fbBuilder) int { return b.table(fields) }}
+}
+
+func fbTables(tables [][]fbField) fbField {
+	return fbField{ref: func(b *fbBuilder) int {
+		pos := b.vector(make([]byte, 4*len(tables)), 4)
+		for i, t := range tables {
+			at := pos + 4 + 4*i
+			p := b.table(t)
+			L.PutUint32(b.buf[at:], uint32(p-at))
+		}
+		return pos
+	}}
+}
+
+// fbBuilder writes a FlatBuffer front to back: each table is preceded by
+// its vtable and followed by the strings, vectors and tables it refers
+// to, so all offsets point forward.
+type fbBuilder struct {
+	buf []byte
+}
+
+// fbFinish returns the size prefixed FlatBuffer with the root table
+// made of fields. Like the FlatBuffers library it aligns the data
+// relative to the start of the size prefix.
+func fbFinish(root []fbField) []byte {
+	b := &fbBuilder{buf: make([]byte, 8)}
+	pos := b.table(root)
+	L.PutUint32(b.buf[4:], uint32(pos-4))
+	b.align(4, 0)
+	L.PutUint32(b.buf, uint32(len(b.buf)-4))
+	return b.buf
+}
+
+// align pads the buffer so that an object of extra bytes written next is
+// followed by a multiple of n.
+func (b *fbBuilder) align(n, extra int) {
+	for (len(b.buf)+extra)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) vector(data []byte, size int) int {
+	b.align(max(size, 4), 4)
+	pos := len(b.buf)
+	b.buf = L.AppendUint32(b.buf, uint32(len(data)/size))
+	b.buf = append(b.buf, data...)
+	return pos
+}
+
+// table writes a table and the objects it refers to, returning its
+// position. The scalars are laid out largest first to align them.
+func (b *fbBuilder) table(fields []fbField) int {
+	n := len(fields)
+	for n > 0 && fields[n-1].scalar == nil && fields[n-1].ref == nil {
+		n--
+	}
+	sizeOf := func(f fbField) int {
+		if f.ref != nil {
+			return 4
+		}
+		return len(f.scalar)
+	}
+	offsets := make([]int, n)
+	size := 4 // the offset to the vtable
+	for _, width := range []int{8, 4, 2, 1} {
+		for i := 0; i < n; i++ {
+			if sizeOf(fields[i]) == width {
+				size = (size + width - 1) / width * width
+				offsets[i] = size
+				size += width
+			}
+		}
+	}
+	b.align(2, 0)
+	vtable := len(b.buf)
+	b.buf = L.AppendUint16(b.buf, uint16(4+2*n))
+	b.buf = L.AppendUint16(b.buf, uint16(size))
+	for _, o := range offsets {
+		b.buf = L.AppendUint16(b.buf, uint16(o))
+	}
+	b.align(8, 0)
+	pos := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	L.PutUint32(b.buf[pos:], uint32(pos-vtable))
+	for i := 0; i < n; i++ {
+		copy(b.buf[pos+offsets[i]:], fields[i].scalar)
+	}
+	for i := 0; i < n; i++ {
+		if fields[i].ref != nil {
+			at := pos + offsets[i]
+			p := fields[i].ref(b)
+			L.PutUint32(b.buf[at:], uint32(p-at))
+		}
+	}
+	return pos
+}
+
+// fbReader reads a FlatBuffer, recording the first access out of bounds
+// in err instead of panicking on malformed input.
+type fbReader struct {
+	buf []byte
+	err error
+}
+
+func (r *fbReader) at(pos, n int) []byte {
+	if pos < 0 || n < 0 || pos > len(r.buf)-n {
+		if r.err == nil {
+			r.err = fmt.Errorf("invalid flatbuffer offset %d", pos)
+		}
+		return make([]byte, 8)
+	}
+	return r.buf[pos : pos+n]
+}
+
+func (r *fbReader) root() fbTable {
+	return fbTable{r, int(L.Uint32(r.at(0, 4)))}
+}
+
+// fbTable is a table of a FlatBuffer, its fields looked up by id.
+type fbTable struct {
+	r   *fbReader
+	pos int
+}
+
+// field returns the position of the field, 0 if it's absent.
+func (t fbTable) field(id int) int {
+	if t.pos == 0 {
+		return 0
+	}
+	vtable := t.pos - int(int32(L.Uint32(t.r.at(t.pos, 4))))
+	if 4+2*id >= int(L.Uint16(t.r.at(vtable, 2))) {
+		return 0
+	}
+	if o := int(L.Uint16(t.r.at(vtable+4+2*id, 2))); o != 0 {
+		return t.pos + o
+	}
+	return 0
+}
+
+func (t fbTable) uint8(id int, def byte) byte {
+	if p := t.field(id); p != 0 {
+		return t.r.at(p, 1)[0]
+	}
+	return def
+}
+
+func (t fbTable) uint16(id int, def uint16) uint16 {
+	if p := t.field(id); p != 0 {
+		return L.Uint16(t.r.at(p, 2))
+	}
+	return def
+}
+
+func (t fbTable) int32(id int, def int32) int32 {
+	if p := t.field(id); p != 0 {
+		return int32(L.Uint32(t.r.at(p, 4)))
+	}
+	return def
+}
+
+func (t fbTable) uint64(id int, def uint64) uint64 {
+	if p := t.field(id); p != 0 {
+		return L.Uint64(t.r.at(p, 8))
+	}
+	return def
+}
+
+// ref returns the position of the object the field refers to, 0 if
+// it's absent.
+func (t fbTable) ref(id int) int {
+	if p := t.field(id); p != 0 {
+		return p + int(L.Uint32(t.r.at(p, 4)))
+	}
+	return 0
+}
+
+func (t fbTable) table(id int) (fbTable, bool) {
+	p := t.ref(id)
+	return fbTable{t.r, p}, p != 0
+}
+
+// vector returns the position of the first element of a vector and
+// their number, checking they're within the buffer.
+func (t fbTable) vector(id, size int) (pos, n int) {
+	if p := t.ref(id); p != 0 {
+		n = int(L.Uint32(t.r.at(p, 4)))
+		if t.r.at(p+4, n*size); t.r.err == nil {
+			return p + 4, n
+		}
+	}
+	return 0, 0
+}
+
+func (t fbTable) bytes(id int) []byte {
+	pos, n := t.vector(id, 1)
+	return t.r.buf[pos : pos+n]
+}
+
+func (t fbTable) str(id int) string {
+	return string(t.bytes(id))
+}
+
+func (t fbTable) doubles(id int) []float64 {
+	pos, n := t.vector(id, 8)
+	fs := make([]float64, n)
+	for i := range fs {
+		fs[i] = math.Float64frombits(L.Uint64(t.r.buf[pos+8*i:]))
+	}
+	return fs
+}
+
+func (t fbTable) uint32s(id int) []uint32 {
+	pos, n := t.vector(id, 4)
+	vs := make([]uint32, n)
+	for i := range vs {
+		vs[i] = L.Uint32(t.r.buf[pos+4*i:])
+	}
+	return vs
+}
+
+func (t fbTable) tables(id int) (tables []fbTable) {
+	pos, n := t.vector(id, 4)
+	for i := 0; i < n; i++ {
+		at := pos + 4*i
+		tables = append(tables, fbTable{t.r, at + int(L.Uint32(t.r.buf[at:]))})
+	}
+	return
+}
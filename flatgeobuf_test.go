@@ -0,0 +1,207 @@
+package shapefile
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFlatGeobufRoundTrip(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.CRS = mustEPSG(t, 25832)
+	var buf bytes.Buffer
+	if err = WriteFlatGeobuf(&buf, ds, FlatGeobufOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadFlatGeobuf(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.CRS == nil || back.CRS.EPSG != 25832 || back.Shapefile.Header.ShapeType != POLYGON {
+		t.Fatalf("expected UTM polygons, got %v", back.CRS)
+	}
+	if !reflect.DeepEqual(back.DBF.FieldDescriptors, ds.DBF.FieldDescriptors) {
+		t.Errorf("expected the fields back, got %v", back.DBF.FieldDescriptors)
+	}
+	// the features come back in Hilbert order
+	features := back.Features()
+	if len(features) != 299 {
+		t.Fatalf("expected 299 features, got %d", len(features))
+	}
+	byNumber := map[int64]*Feature{}
+	for _, f := range ds.Features() {
+		byNumber[f.Attributes[0].(int64)] = f
+	}
+	for _, f := range features {
+		orig := byNumber[f.Attributes[0].(int64)]
+		if !reflect.DeepEqual(f.Attributes, []interface{}{orig.Attributes[0], formatValue(orig.Attributes[1]), formatValue(orig.Attributes[2]), formatValue(orig.Attributes[3])}) {
+			t.Errorf("unexpected attributes %v", f.Attributes)
+		}
+		a, b := orig.Record.Content.(*Polygon), f.Record.Content.(*Polygon)
+		if !reflect.DeepEqual(a.Points, b.Points) || !reflect.DeepEqual(a.Parts, b.Parts) || a.Box != b.Box {
+			t.Errorf("expected the shape of %v back", f.Attributes[1])
+		}
+	}
+
+	query := Box{500000, 5500000, 510000, 5510000}
+	found, err := QueryFlatGeobuf(bytes.NewReader(buf.Bytes()), query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected int
+	for _, f := range ds.Features() {
+		if b, _ := boxOf(f.Record.Content); b.Intersects(query) {
+			expected++
+		}
+	}
+	if expected == 0 || len(found.Features()) != expected {
+		t.Errorf("expected %d features in the box, got %d", expected, len(found.Features()))
+	}
+}
+
+func TestFlatGeobufShapes(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("NAME", Character, 5, 0), NewFieldDescriptor("LENGTH", Number, 8, 2)}
+	lines := NewDataset(POLY_LINE_Z, fields, nil)
+	line := &PolyLineZ{
+		Parts:  []int32{0, 2},
+		Points: []Point{{0, 0}, {1, 1}, {2, 2}, {3, 1}},
+		ZArray: []float64{10, 11, 12, 13},
+		MArray: []float64{0, math.NaN(), 2, 3},
+	}
+	updateBox(line)
+	lines.Add(line, []interface{}{"Weg", 1.25})
+	lines.Add(nil, []interface{}{nil, nil})
+	for _, opts := range []FlatGeobufOptions{{}, {NoIndex: true}} {
+		var buf bytes.Buffer
+		if err := WriteFlatGeobuf(&buf, lines, opts); err != nil {
+			t.Fatal(err)
+		}
+		back, err := ReadFlatGeobuf(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		features := back.Features()
+		if len(features) != 2 {
+			t.Fatalf("expected 2 features, got %d", len(features))
+		}
+		got, ok := features[0].Record.Content.(*PolyLineZ)
+		if !ok || !reflect.DeepEqual(got.Parts, line.Parts) || !reflect.DeepEqual(got.Points, line.Points) || !reflect.DeepEqual(got.ZArray, line.ZArray) {
+			t.Fatalf("expected the line back, got %v", features[0].Record.Content)
+		}
+		if got.MArray[0] != 0 || !math.IsNaN(got.MArray[1]) || got.MArray[3] != 3 {
+			t.Errorf("expected the measures back, got %v", got.MArray)
+		}
+		if !reflect.DeepEqual(features[0].Attributes, []interface{}{"Weg", 1.25}) || !reflect.DeepEqual(features[1].Attributes, []interface{}{nil, nil}) {
+			t.Errorf("unexpected attributes %v %v", features[0].Attributes, features[1].Attributes)
+		}
+		if _, ok := features[1].Record.Content.(*Null); !ok {
+			t.Errorf("expected a null shape")
+		}
+		if !reflect.DeepEqual(back.DBF.FieldDescriptors, fields) {
+			t.Errorf("expected the fields back, got %v", back.DBF.FieldDescriptors)
+		}
+	}
+
+	points := NewDataset(MULTI_POINT, nil, mustEPSG(t, 4326))
+	mp := &MultiPoint{Points: []Point{{8, 50}, {9, 51}}}
+	updateBox(mp)
+	points.Add(mp, nil)
+	var buf bytes.Buffer
+	if err := WriteFlatGeobuf(&buf, points, FlatGeobufOptions{Name: "points"}); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadFlatGeobuf(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := back.Features()[0].Record.Content.(*MultiPoint); !reflect.DeepEqual(got.Points, mp.Points) || back.DBF != nil || back.CRS.EPSG != 4326 {
+		t.Errorf("expected the points back, got %v", got)
+	}
+
+	if _, err = ReadFlatGeobuf(bytes.NewReader([]byte("fgb\x03fgb\x00\xff\xff\x00\x00"))); err == nil {
+		t.Errorf("expected a truncated file to fail")
+	}
+}
+
+func TestPackedRTree(t *testing.T) {
+	if got := levelBounds(1, 16); !reflect.DeepEqual(got, [][2]int{{1, 2}, {0, 1}}) {
+		t.Errorf("unexpected levels %v", got)
+	}
+	if got := levelBounds(40, 4); !reflect.DeepEqual(got, [][2]int{{14, 54}, {4, 14}, {1, 4}, {0, 1}}) {
+		t.Errorf("unexpected levels %v", got)
+	}
+	var leaves []fgbNode
+	for i := 0; i < 5; i++ {
+		leaves = append(leaves, fgbNode{Box{float64(i), 0, float64(i) + 1, 1}, uint64(100 * i)})
+	}
+	nodes := packedRTree(leaves, 2)
+	// root, then 2 and 3 nodes, then the leaves
+	expected := []fgbNode{
+		{Box{0, 0, 5, 1}, 1},
+		{Box{0, 0, 4, 1}, 3}, {Box{4, 0, 5, 1}, 5},
+		{Box{0, 0, 2, 1}, 6}, {Box{2, 0, 4, 1}, 8}, {Box{4, 0, 5, 1}, 10},
+	}
+	if !reflect.DeepEqual(nodes[:6], expected) || !reflect.DeepEqual(nodes[6:], leaves) {
+		t.Errorf("unexpected tree %v", nodes)
+	}
+}
+
+func TestFlatGeobufDatesAndMultiPatch(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("BUILT", Date, 8, 0), NewFieldDescriptor("LISTED", Logical, 1, 0)}
+	ds := NewDataset(MULTI_PATCH, fields, nil)
+	mp := house()
+	for i := range mp.Points {
+		mp.MArray = append(mp.MArray, float64(i))
+	}
+	mp.MRange = MRange{0, float64(len(mp.Points) - 1)}
+	ds.Add(mp, []interface{}{"19840229", true})
+	ds.Add(house(), []interface{}{nil, "?"})
+	var buf bytes.Buffer
+	if err := WriteFlatGeobuf(&buf, ds, FlatGeobufOptions{NoIndex: true}); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadFlatGeobuf(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back.DBF.FieldDescriptors, fields) {
+		t.Errorf("expected the fields back, got %v", back.DBF.FieldDescriptors)
+	}
+	features := back.Features()
+	if !reflect.DeepEqual(features[0].Attributes, []interface{}{"19840229", true}) || !reflect.DeepEqual(features[1].Attributes, []interface{}{nil, nil}) {
+		t.Errorf("unexpected attributes %v %v", features[0].Attributes, features[1].Attributes)
+	}
+
+	// 8 wall and 4 roof triangles, then the floor with its courtyard
+	got := features[0].Record.Content.(*MultiPatch)
+	if len(got.PartTypes) != 14 || got.PartTypes[11] != OUTER_RING || got.PartTypes[12] != OUTER_RING || got.PartTypes[13] != INNER_RING {
+		t.Fatalf("unexpected parts %v", got.PartTypes)
+	}
+	floor := int(got.Parts[12])
+	if !reflect.DeepEqual(got.Points[floor:], mp.Points[16:]) || !reflect.DeepEqual(got.ZArray[floor:], mp.ZArray[16:]) || !reflect.DeepEqual(got.MArray[floor:], mp.MArray[16:]) {
+		t.Errorf("expected the floor back, got %v", got.Points[floor:])
+	}
+	if got.MRange != mp.MRange || got.ZRange != mp.ZRange {
+		t.Errorf("unexpected ranges %v %v", got.ZRange, got.MRange)
+	}
+	// the triangles face the way they did
+	sum := func(m *Mesh) (n [3]float64) {
+		for _, tri := range m.Triangles {
+			for i, c := range m.normal(tri) {
+				n[i] += c
+			}
+		}
+		return
+	}
+	a, b := mp.Triangulate(), got.Triangulate()
+	if len(a.Triangles) != len(b.Triangles) || sum(a) != sum(b) {
+		t.Errorf("expected %d triangles facing %v, got %d facing %v", len(a.Triangles), sum(a), len(b.Triangles), sum(b))
+	}
+	if features[1].Record.Content.(*MultiPatch).MArray != nil {
+		t.Errorf("expected no measures")
+	}
+}
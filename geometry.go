@@ -0,0 +1,191 @@
+package shapefile
+
+import (
+	"math"
+)
+
+// helpers to treat the different shape types uniformly.
+
+// eachXY calls f with pointers to the X and Y coordinates of every vertex
+// of the shape, allowing them to be modified in place. Z and M values
+// are left untouched.
+func eachXY(content RecordContent, f func(x, y *float64)) {
+	points := func(pts []Point) {
+		for i := range pts {
+			f(&pts[i].X, &pts[i].Y)
+		}
+	}
+	switch s := content.(type) {
+	case *Point:
+		f(&s.X, &s.Y)
+	case *PointM:
+		f(&s.X, &s.Y)
+	case *PointZ:
+		f(&s.X, &s.Y)
+	case *MultiPoint:
+		points(s.Points)
+	case *MultiPointM:
+		points(s.Points)
+	case *MultiPointZ:
+		points(s.Points)
+	case *PolyLine:
+		points(s.Points)
+	case *Polygon:
+		points(s.Points)
+	case *PolyLineM:
+		points(s.Points)
+	case *PolygonM:
+		points(s.Points)
+	case *PolyLineZ:
+		points(s.Points)
+	case *PolygonZ:
+		points(s.Points)
+	case *MultiPatch:
+		points(s.Points)
+	}
+}
+
+// boxOf returns the bounding box of any shape, ok is false for shapes
+// without vertices.
+func boxOf(content RecordContent) (b Box, ok bool) {
+	b = Box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	eachXY(content, func(x, y *float64) {
+		b.Xmin = math.Min(b.Xmin, *x)
+		b.Ymin = math.Min(b.Ymin, *y)
+		b.Xmax = math.Max(b.Xmax, *x)
+		b.Ymax = math.Max(b.Ymax, *y)
+		ok = true
+	})
+	return
+}
+
+// updateBox recalculates the bounding box stored in the shape, e.g. after
+// its coordinates were modified.
+func updateBox(content RecordContent) {
+	b, ok := boxOf(content)
+	if !ok {
+		return
+	}
+	switch s := content.(type) {
+	case *MultiPoint:
+		s.Box = b
+	case *MultiPointM:
+		s.Box = b
+	case *MultiPointZ:
+		s.Box = b
+	case *PolyLine:
+		s.Box = b
+	case *Polygon:
+		s.Box = b
+	case *PolyLineM:
+		s.Box = b
+	case *PolygonM:
+		s.Box = b
+	case *PolyLineZ:
+		s.Box = b
+	case *PolygonZ:
+		s.Box = b
+	case *MultiPatch:
+		s.Box = b
+	}
+}
+
+// splitParts splits the points of a multi part shape into its parts.
+func splitParts(parts []int32, points []Point) (split [][]Point) {
+	for i, start := range parts {
+		end := int32(len(points))
+		if i+1 < len(parts) {
+			end = parts[i+1]
+		}
+		if start < 0 || start > end || end > int32(len(points)) {
+			continue
+		}
+		split = append(split, points[start:end])
+	}
+	return
+}
+
+// partsOf returns the vertices of the shape grouped by parts, areal is
+// set for polygons. Each point of a multipoint is returned as a part of
+// its own.
+func partsOf(content RecordContent) (parts [][]Point, areal bool) {
+	single := func(pts []Point) (parts [][]Point) {
+		for i := range pts {
+			parts = append(parts, pts[i:i+1])
+		}
+		return
+	}
+	switch s := content.(type) {
+	case *Point:
+		return [][]Point{{*s}}, false
+	case *PointM:
+		return [][]Point{{{s.X, s.Y}}}, false
+	case *PointZ:
+		return [][]Point{{{s.X, s.Y}}}, false
+	case *MultiPoint:
+		return single(s.Points), false
+	case *MultiPointM:
+		return single(s.Points), false
+	case *MultiPointZ:
+		return single(s.Points), false
+	case *PolyLine:
+		return splitParts(s.Parts, s.Points), false
+	case *PolyLineM:
+		return splitParts(s.Parts, s.Points), false
+	case *PolyLineZ:
+		return splitParts(s.Parts, s.Points), false
+	case *Polygon:
+		return splitParts(s.Parts, s.Points), true
+	case *PolygonM:
+		return splitParts(s.Parts, s.Points), true
+	case *PolygonZ:
+		return splitParts(s.Parts, s.Points), true
+	case *MultiPatch:
+		return splitParts(s.Parts, s.Points), false
+	}
+	return nil, false
+}
+
+// pointInRings tests (x, y) against all rings using the even-odd rule, so
+// holes are respected regardless of ring orientation.
+func pointInRings(x, y float64, rings [][]Point) (inside bool) {
+	for _, ring := range rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			a, b := ring[i], ring[j]
+			if (a.Y > y) != (b.Y > y) && x < (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X {
+				inside = !inside
+			}
+		}
+	}
+	return
+}
+
+// segmentDistance returns the distance of (x, y) to the segment a-b.
+func segmentDistance(x, y float64, a, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	t := 0.0
+	if l := dx*dx + dy*dy; l != 0 {
+		t = math.Max(0, math.Min(1, ((x-a.X)*dx+(y-a.Y)*dy)/l))
+	}
+	return math.Hypot(x-(a.X+t*dx), y-(a.Y+t*dy))
+}
+
+// pointDistance returns the planar distance from (x, y) to the shape, 0
+// if the point lies inside a polygon. It's +Inf for shapes without
+// vertices.
+func pointDistance(x, y float64, content RecordContent) float64 {
+	parts, areal := partsOf(content)
+	if areal && pointInRings(x, y, parts) {
+		return 0
+	}
+	d := math.Inf(1)
+	for _, part := range parts {
+		if len(part) == 1 {
+			d = math.Min(d, math.Hypot(x-part[0].X, y-part[0].Y))
+		}
+		for i := 1; i < len(part); i++ {
+			d = math.Min(d, segmentDistance(x, y, part[i-1], part[i]))
+		}
+	}
+	return d
+}
@@ -0,0 +1,276 @@
+package shapefile
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GPX 1.1: https://www.topografix.com/GPX/1/1/
+// Coordinates are latitude and longitude on WGS84, elevations in meters.
+
+// GPXOptions control WriteGPX.
+type GPXOptions struct {
+	NameField, DescField string // columns for names and descriptions, none if empty
+	// TimeField is the column holding the time of waypoints and the start
+	// of tracks, either as text or seconds since 1970. The M values of
+	// tracks are taken as seconds since the start, giving each track
+	// point its time. Without M values only the first one has it.
+	TimeField string
+}
+
+// WriteGPX writes the points of ds as waypoints or its lines as tracks,
+// with a segment for each part. Z values become elevations. The
+// coordinates are reprojected to WGS84, those of datasets without a CRS
+// are taken as longitude and latitude.
+func WriteGPX(w io.Writer, ds *Dataset, opts GPXOptions) (err error) {
+	waypoints := false
+	switch typ := ds.Shapefile.Header.ShapeType; typ {
+	case POINT, POINT_Z, POINT_M, MULTI_POINT, MULTI_POINT_Z, MULTI_POINT_M:
+		waypoints = true
+	case POLYGON, POLYGON_Z, POLYGON_M, MULTI_PATCH:
+		return fmt.Errorf("can't write %s to GPX", typ)
+	}
+	var lonLat func(x, y float64) (float64, float64, error)
+	if lonLat, err = lonLatOf(ds); err != nil {
+		return
+	}
+	cols := []int{-1, -1, -1}
+	for i, name := range []string{opts.NameField, opts.DescField, opts.TimeField} {
+		if name == "" {
+			continue
+		}
+		if cols[i], err = styleField(ds, name); err != nil {
+			return
+		}
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<gpx version=\"1.1\" creator=\"github.com/a2800276/shapefile\" xmlns=\"http://www.topografix.com/GPX/1/1\">\n")
+	// point writes a wpt or trkpt, with the time if it isn't zero
+	point := func(element string, v vertex, hasZ bool, t time.Time, name, desc string) error {
+		lon, lat, err := lonLat(v.X, v.Y)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(bw, "<%s lat=\"%s\" lon=\"%s\">", element, strconv.FormatFloat(lat, 'f', -1, 64), strconv.FormatFloat(lon, 'f', -1, 64))
+		if hasZ {
+			fmt.Fprintf(bw, "<ele>%s</ele>", strconv.FormatFloat(v.Z, 'f', -1, 64))
+		}
+		if !t.IsZero() {
+			fmt.Fprintf(bw, "<time>%s</time>", t.UTC().Format(time.RFC3339Nano))
+		}
+		if name != "" {
+			fmt.Fprintf(bw, "<name>%s</name>", escapeXML(name))
+		}
+		if desc != "" {
+			fmt.Fprintf(bw, "<desc>%s</desc>", escapeXML(desc))
+		}
+		fmt.Fprintf(bw, "</%s>\n", element)
+		return nil
+	}
+	for _, f := range ds.Features() {
+		if f.Deleted {
+			continue
+		}
+		var name, desc string
+		var start time.Time
+		if cols[0] != -1 {
+			name = formatValue(f.Attributes[cols[0]])
+		}
+		if cols[1] != -1 {
+			desc = formatValue(f.Attributes[cols[1]])
+		}
+		if cols[2] != -1 {
+			start, _ = parseTime(f.Attributes[cols[2]])
+		}
+		z, m := zmOf(f.Record.Content)
+		parts, _ := verticesOf(f.Record.Content)
+		if len(parts) == 0 {
+			continue
+		}
+		if waypoints {
+			for _, part := range parts {
+				if err = point("wpt", part[0], z != nil, start, name, desc); err != nil {
+					return
+				}
+			}
+			continue
+		}
+		bw.WriteString("<trk>")
+		if name != "" {
+			fmt.Fprintf(bw, "<name>%s</name>", escapeXML(name))
+		}
+		if desc != "" {
+			fmt.Fprintf(bw, "<desc>%s</desc>", escapeXML(desc))
+		}
+		bw.WriteString("\n")
+		first := true
+		for _, part := range parts {
+			bw.WriteString("<trkseg>\n")
+			for _, v := range part {
+				var t time.Time
+				switch {
+				case start.IsZero():
+				case m != nil && measured(v.M):
+					t = start.Add(time.Duration(v.M * float64(time.Second)))
+				case first && m == nil:
+					t = start
+				}
+				first = false
+				if err = point("trkpt", v, z != nil, t, "", ""); err != nil {
+					return
+				}
+			}
+			bw.WriteString("</trkseg>\n")
+		}
+		bw.WriteString("</trk>\n")
+	}
+	bw.WriteString("</gpx>\n")
+	return bw.Flush()
+}
+
+// timeLayouts are the formats of times in attributes parseTime knows.
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02", "20060102"}
+
+// parseTime reads a time from an attribute value, times without a zone
+// are taken as UTC.
+func parseTime(v interface{}) (t time.Time, ok bool) {
+	switch v := v.(type) {
+	case string:
+		s := strings.TrimSpace(v)
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, true
+			}
+		}
+	case int64:
+		return time.Unix(v, 0), true
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), true
+	}
+	return
+}
+
+type gpxPoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Ele  *float64 `xml:"ele"`
+	Time string   `xml:"time"`
+	Name string   `xml:"name"`
+	Cmt  string   `xml:"cmt"`
+	Desc string   `xml:"desc"`
+	Sym  string   `xml:"sym"`
+	Type string   `xml:"type"`
+}
+
+type gpxTrack struct {
+	Name     string       `xml:"name"`
+	Cmt      string       `xml:"cmt"`
+	Desc     string       `xml:"desc"`
+	Type     string       `xml:"type"`
+	Segments []gpxSegment `xml:"trkseg"`
+	Points   []gpxPoint   `xml:"rtept"` // of routes
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+// ReadGPX reads the waypoints of a GPX file into a point dataset and its
+// tracks and routes into a line dataset, both in WGS84. Shapes have Z
+// values if any point has an elevation. Lines with times have M values,
+// the seconds since the first time, which is their time attribute. The
+// other attributes are the name, comment, description and type, and the
+// symbol of waypoints.
+func ReadGPX(r io.Reader) (datasets []*Dataset, err error) {
+	var doc struct {
+		Waypoints []gpxPoint `xml:"wpt"`
+		Routes    []gpxTrack `xml:"rte"`
+		Tracks    []gpxTrack `xml:"trk"`
+	}
+	if err = xml.NewDecoder(r).Decode(&doc); err != nil {
+		return
+	}
+	var features []importedFeature
+	hasZ := false
+	for _, p := range doc.Waypoints {
+		hasZ = hasZ || p.Ele != nil
+	}
+	for _, p := range doc.Waypoints {
+		v := vertex{X: p.Lon, Y: p.Lat, M: math.NaN()}
+		var template RecordContent = &Point{}
+		if hasZ {
+			template = &PointZ{}
+			if p.Ele != nil {
+				v.Z = *p.Ele
+			}
+		}
+		attributes := map[string]string{"name": p.Name, "cmt": p.Cmt, "desc": p.Desc, "sym": p.Sym, "type": p.Type, "time": p.Time}
+		features = append(features, importedFeature{withVertices(template, [][]vertex{{v}}), attributes})
+	}
+
+	// routes are tracks of a single segment
+	lines := doc.Tracks
+	for _, rte := range doc.Routes {
+		rte.Segments = []gpxSegment{{rte.Points}}
+		lines = append(lines, rte)
+	}
+	hasZ, hasM := false, false
+	for _, l := range lines {
+		for _, s := range l.Segments {
+			for _, p := range s.Points {
+				hasZ = hasZ || p.Ele != nil
+				hasM = hasM || p.Time != ""
+			}
+		}
+	}
+	for _, l := range lines {
+		var start time.Time
+		var parts [][]vertex
+		for _, s := range l.Segments {
+			var part []vertex
+			for _, p := range s.Points {
+				v := vertex{X: p.Lon, Y: p.Lat, M: math.NaN()}
+				if p.Ele != nil {
+					v.Z = *p.Ele
+				}
+				if t, ok := parseTime(p.Time); ok {
+					if start.IsZero() {
+						start = t
+					}
+					v.M = t.Sub(start).Seconds()
+				}
+				part = append(part, v)
+			}
+			if len(part) > 1 {
+				parts = append(parts, part)
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		var template RecordContent = &PolyLine{}
+		switch {
+		case hasZ:
+			template = &PolyLineZ{}
+		case hasM:
+			template = &PolyLineM{}
+		}
+		attributes := map[string]string{"name": l.Name, "cmt": l.Cmt, "desc": l.Desc, "type": l.Type}
+		if !start.IsZero() {
+			attributes["time"] = start.UTC().Format(time.RFC3339)
+		}
+		features = append(features, importedFeature{withVertices(template, parts), attributes})
+	}
+	var wgs84 *CRS
+	if wgs84, err = CRSFromEPSG(4326); err != nil {
+		return
+	}
+	return importDatasets(features, []string{"name", "cmt", "desc", "sym", "type", "time"}, wgs84)
+}
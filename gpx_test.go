@@ -0,0 +1,86 @@
+package shapefile
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGPXRoundTrip(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("NAME", Character, 10, 0), NewFieldDescriptor("START", Character, 20, 0)}
+	ds := NewDataset(POLY_LINE_Z, fields, nil)
+	track := &PolyLineZ{
+		Parts:  []int32{0, 2},
+		Points: []Point{{8, 50}, {8.001, 50}, {8.002, 50.001}, {8.003, 50.001}},
+		ZArray: []float64{100, 110, 105, 103},
+		MArray: []float64{0, 30, 90.5, 120},
+	}
+	updateBox(track)
+	ds.Add(track, []interface{}{"Run", "2024-05-01 10:00:00"})
+	var buf bytes.Buffer
+	if err := WriteGPX(&buf, ds, GPXOptions{NameField: "NAME", TimeField: "START"}); err != nil {
+		t.Fatal(err)
+	}
+	gpx := buf.String()
+	expected := []string{
+		"<trk><name>Run</name>\n<trkseg>\n",
+		"<trkpt lat=\"50\" lon=\"8\"><ele>100</ele><time>2024-05-01T10:00:00Z</time></trkpt>",
+		"<trkpt lat=\"50.001\" lon=\"8.002\"><ele>105</ele><time>2024-05-01T10:01:30.5Z</time></trkpt>",
+	}
+	for _, e := range expected {
+		if !strings.Contains(gpx, e) {
+			t.Errorf("expected %s in\n%s", e, gpx)
+		}
+	}
+	if strings.Count(gpx, "<trkseg>") != 2 {
+		t.Errorf("expected a segment for each part")
+	}
+
+	datasets, err := ReadGPX(strings.NewReader(gpx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datasets) != 1 {
+		t.Fatalf("expected a dataset, got %d", len(datasets))
+	}
+	f := datasets[0].Features()[0]
+	got := f.Record.Content.(*PolyLineZ)
+	if !reflect.DeepEqual(got.Points, track.Points) || !reflect.DeepEqual(got.ZArray, track.ZArray) || !reflect.DeepEqual(got.MArray, track.MArray) {
+		t.Errorf("expected the track back, got %v", got)
+	}
+	if !reflect.DeepEqual(f.Attributes, []interface{}{"Run", "2024-05-01T10:00:00Z"}) {
+		t.Errorf("unexpected attributes %v", f.Attributes)
+	}
+
+	if err = WriteGPX(&buf, NewDataset(POLYGON, nil, nil), GPXOptions{}); err == nil {
+		t.Errorf("expected polygons to fail")
+	}
+}
+
+func TestReadGPX(t *testing.T) {
+	gpx := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+<wpt lat="47.42" lon="10.98"><ele>2962</ele><name>Zugspitze</name><sym>Summit</sym></wpt>
+<wpt lat="47.5" lon="11.1"><name>Hut</name></wpt>
+<rte><name>Route</name><rtept lat="47.5" lon="11.1"/><rtept lat="47.42" lon="10.98"/></rte>
+</gpx>`
+	datasets, err := ReadGPX(strings.NewReader(gpx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datasets) != 2 {
+		t.Fatalf("expected waypoints and routes, got %d datasets", len(datasets))
+	}
+	points := datasets[0].Features()
+	if p := points[1].Record.Content.(*PointZ); p.X != 11.1 || p.Y != 47.5 || p.Z != 0 || !math.IsNaN(p.M) {
+		t.Errorf("unexpected waypoint %v", p)
+	}
+	if !reflect.DeepEqual(points[0].Attributes, []interface{}{"Zugspitze", "Summit"}) || points[1].Attributes[1] != nil {
+		t.Errorf("unexpected attributes %v %v", points[0].Attributes, points[1].Attributes)
+	}
+	if pl, ok := datasets[1].Features()[0].Record.Content.(*PolyLine); !ok || len(pl.Points) != 2 {
+		t.Errorf("expected the route as a line, got %v", datasets[1].Features()[0].Record.Content)
+	}
+}
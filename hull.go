@@ -0,0 +1,164 @@
+package shapefile
+
+import (
+	"math"
+	"sort"
+)
+
+// ConvexHull returns the smallest convex polygon containing all vertices
+// of the shape, or nil if they are all on a line.
+func ConvexHull(content RecordContent) *Polygon {
+	return polygonOf(ringOrNil(convexHull(verticesOfShape(content))))
+}
+
+// Envelope returns the bounding box of the shape as a polygon, or nil if
+// it has no area.
+func Envelope(content RecordContent) *Polygon {
+	b, ok := boxOf(content)
+	if !ok || b.Xmin == b.Xmax || b.Ymin == b.Ymax {
+		return nil
+	}
+	return polygonOf([][]Point{{{b.Xmin, b.Ymin}, {b.Xmin, b.Ymax}, {b.Xmax, b.Ymax}, {b.Xmax, b.Ymin}, {b.Xmin, b.Ymin}}})
+}
+
+// MinimumRotatedRectangle returns the rectangle of least area containing
+// the shape, which has a side in common with the convex hull, or nil if
+// the shape has no area.
+func MinimumRotatedRectangle(content RecordContent) *Polygon {
+	hull := convexHull(verticesOfShape(content))
+	if hull == nil {
+		return nil
+	}
+	var best []Point
+	bestArea := math.Inf(1)
+	for i := range hull {
+		a, b := hull[i], hull[(i+1)%len(hull)]
+		l := math.Hypot(b.X-a.X, b.Y-a.Y)
+		ux, uy := (b.X-a.X)/l, (b.Y-a.Y)/l // along the edge
+		vx, vy := -uy, ux                  // perpendicular, towards the hull
+		minU, maxU, maxV := math.Inf(1), math.Inf(-1), 0.0
+		for _, p := range hull {
+			u := (p.X-a.X)*ux + (p.Y-a.Y)*uy
+			v := (p.X-a.X)*vx + (p.Y-a.Y)*vy
+			minU, maxU, maxV = math.Min(minU, u), math.Max(maxU, u), math.Max(maxV, v)
+		}
+		if area := (maxU - minU) * maxV; area < bestArea {
+			bestArea = area
+			corner := func(u, v float64) Point { return Point{a.X + u*ux + v*vx, a.Y + u*uy + v*vy} }
+			// clockwise, as v points to the left of u
+			best = []Point{corner(minU, 0), corner(minU, maxV), corner(maxU, maxV), corner(maxU, 0), corner(minU, 0)}
+		}
+	}
+	return polygonOf([][]Point{best})
+}
+
+func verticesOfShape(content RecordContent) (pts []Point) {
+	eachXY(content, func(x, y *float64) { pts = append(pts, Point{*x, *y}) })
+	return
+}
+
+// convexHull returns the hull counter clockwise and not closed using
+// Andrew's monotone chain, nil if the points are on a line.
+func convexHull(pts []Point) []Point {
+	pts = append([]Point{}, pts...)
+	sort.Slice(pts, func(i, j int) bool { return pointLess(pts[i], pts[j]) })
+	cross := func(o, a, b Point) float64 {
+		return (a.X-o.X)*(b.Y-o.Y) - (a.Y-o.Y)*(b.X-o.X)
+	}
+	var hull []Point
+	for pass := 0; pass < 2; pass++ {
+		start := len(hull)
+		for _, p := range pts {
+			for len(hull) >= start+2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+				hull = hull[:len(hull)-1]
+			}
+			hull = append(hull, p)
+		}
+		hull = hull[:len(hull)-1] // the last point starts the other chain
+		for i, j := 0, len(pts)-1; i < j; i, j = i+1, j-1 {
+			pts[i], pts[j] = pts[j], pts[i]
+		}
+	}
+	if len(hull) < 3 {
+		return nil
+	}
+	return hull
+}
+
+// ringOrNil returns a counter clockwise ring as a closed clockwise ring
+// ready for polygonOf.
+func ringOrNil(ccw []Point) [][]Point {
+	if ccw == nil {
+		return nil
+	}
+	ring := canonical(ccw, true)
+	return [][]Point{append(ring, ring[0])}
+}
+
+// Buffer returns the area within distance of the shape, approximating
+// quarter circles by segments straight segments. A negative distance
+// shrinks polygons, for other shapes it returns nil as it does if
+// nothing remains.
+//
+// The buffer is the union of the shape with circles around its points
+// and rounded rectangles around its segments, which are subtracted for
+// a negative distance.
+func Buffer(content RecordContent, distance float64, segments int) *Polygon {
+	if segments < 1 {
+		segments = 1
+	}
+	parts, areal := partsOf(content)
+	if distance == 0 || (distance < 0 && !areal) {
+		if areal {
+			return UnionAll([]RecordContent{content})
+		}
+		return nil
+	}
+	r := math.Abs(distance)
+	var pieces []RecordContent
+	for _, part := range parts {
+		if len(part) == 1 || (len(part) > 0 && !areal && allSame(part)) {
+			pieces = append(pieces, polygonOf(ringOrNil(circle(part[0], r, segments))))
+			continue
+		}
+		for i := 1; i < len(part); i++ {
+			if part[i] != part[i-1] {
+				pieces = append(pieces, polygonOf(ringOrNil(convexHull(append(circle(part[i-1], r, segments), circle(part[i], r, segments)...)))))
+			}
+		}
+		if areal && len(part) > 1 && part[0] != part[len(part)-1] {
+			n := len(part) - 1
+			pieces = append(pieces, polygonOf(ringOrNil(convexHull(append(circle(part[n], r, segments), circle(part[0], r, segments)...)))))
+		}
+	}
+	around := UnionAll(pieces)
+	switch {
+	case !areal:
+		return around
+	case distance > 0:
+		return Union(content, around)
+	}
+	return Difference(content, around)
+}
+
+func allSame(pts []Point) bool {
+	for _, p := range pts {
+		if p != pts[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// circle returns the vertices of a regular polygon inscribed into the
+// circle, counter clockwise. The angles are the same for all centers so
+// neighbouring circles line up exactly.
+func circle(c Point, r float64, segments int) []Point {
+	n := 4 * segments
+	pts := make([]Point, n)
+	for i := range pts {
+		s, co := math.Sincos(2 * math.Pi * float64(i) / float64(n))
+		pts[i] = Point{c.X + r*co, c.Y + r*s}
+	}
+	return pts
+}
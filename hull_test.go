@@ -0,0 +1,77 @@
+package shapefile
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHulls(t *testing.T) {
+	u := polygon([]Point{{0, 0}, {0, 3}, {1, 3}, {1, 1}, {2, 1}, {2, 3}, {3, 3}, {3, 0}, {0, 0}})
+	hull := ConvexHull(u)
+	if a := hull.Area(); a != 9 || len(hull.Points) != 5 {
+		t.Errorf("unexpected hull: %v", hull)
+	}
+	if a, _ := ringArea(hull.Points); a >= 0 {
+		t.Errorf("hull not clockwise")
+	}
+	if ConvexHull(polyline(Point{0, 0}, Point{1, 1}, Point{2, 2})) != nil {
+		t.Errorf("expected no hull for collinear points")
+	}
+	if e := Envelope(polyline(Point{0, 0}, Point{3, 1}, Point{1, 2})); e.Area() != 6 || e.Box != (Box{0, 0, 3, 2}) {
+		t.Errorf("unexpected envelope: %v", e)
+	}
+
+	// diamond, its envelope is twice as large
+	diamond := polygon([]Point{{5, 0}, {0, 5}, {5, 10}, {10, 5}, {5, 0}})
+	if r := MinimumRotatedRectangle(diamond); math.Abs(r.Area()-50) > 1e-9 || !Within(diamond, bufferedBy(r, 1e-9)) {
+		t.Errorf("unexpected rectangle: %v", r)
+	}
+	if r := MinimumRotatedRectangle(u); math.Abs(r.Area()-9) > 1e-9 {
+		t.Errorf("unexpected rectangle: %v", r)
+	}
+}
+
+// bufferedBy grows pg a little to compensate rounding.
+func bufferedBy(pg *Polygon, d float64) *Polygon {
+	return Buffer(pg, d, 1)
+}
+
+func TestBuffer(t *testing.T) {
+	const r, segs = 2.0, 8
+	n := 4.0 * segs
+	circleArea := n / 2 * r * r * math.Sin(2*math.Pi/n)
+
+	if a := Buffer(&Point{1, 1}, r, segs).Area(); math.Abs(a-circleArea) > 1e-9 {
+		t.Errorf("unexpected point buffer area: %v, expected %v", a, circleArea)
+	}
+	line := polyline(Point{0, 0}, Point{10, 0})
+	if a := Buffer(line, r, segs).Area(); math.Abs(a-(circleArea+2*r*10)) > 1e-9 {
+		t.Errorf("unexpected line buffer area: %v", a)
+	}
+	// the joint of a bent line is rounded
+	bent := polyline(Point{0, 0}, Point{10, 0}, Point{10, 10})
+	b := Buffer(bent, r, segs)
+	if a := b.Area(); math.Abs(a-(circleArea+2*r*20-r*r+circleArea/4)) > 1e-9 {
+		t.Errorf("unexpected bent line buffer area: %v", a)
+	}
+	if !Contains(b, bent) || Contains(b, &Point{5, 5}) {
+		t.Errorf("unexpected buffer %v", b)
+	}
+
+	sq := polygon(square(0, 0, 10, 10))
+	if a := Buffer(sq, r, segs).Area(); math.Abs(a-(100+4*10*r+circleArea)) > 1e-9 {
+		t.Errorf("unexpected grown area: %v", a)
+	}
+	if a := Buffer(sq, -r, segs).Area(); math.Abs(a-36) > 1e-9 {
+		t.Errorf("unexpected shrunk area: %v", a)
+	}
+	if Buffer(sq, -6, segs) != nil {
+		t.Errorf("expected nothing to remain")
+	}
+	// the hole shrinks
+	holed := polygon(square(0, 0, 10, 10), square(3, 3, 7, 7))
+	unitCircle := circleArea / (r * r)
+	if a := Buffer(holed, 1, segs).Area(); math.Abs(a-(140+unitCircle-4)) > 1e-9 {
+		t.Errorf("unexpected area with hole: %v", a)
+	}
+}
@@ -0,0 +1,220 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+type JoinMode int
+
+const (
+	JoinFirst JoinMode = iota // one row per left feature, joined to the first match
+	JoinAll                   // one row per pair of matching features
+)
+
+// JoinOptions control SpatialJoin.
+type JoinOptions struct {
+	Mode JoinMode
+	// Nearest joins each left feature to the closest right feature
+	// instead of testing the predicate, to all within MaxDistance for
+	// JoinAll. Matches are ordered by distance.
+	Nearest     bool
+	MaxDistance float64 // no limit if 0, except for JoinAll
+	// Fields lists the right columns to join, nil for all. Names that
+	// are already taken are prefixed with R_.
+	Fields []string
+	// DistanceField, if set, is the name of a column holding the
+	// distance to the joined feature.
+	DistanceField string
+	// DropUnmatched leaves out left features without a match, by default
+	// they are kept with blank right columns.
+	DropUnmatched bool
+}
+
+// SpatialJoin attaches the attributes of right features to the left
+// features they match, e.g. the district to each polling station using
+// Within. The predicate is called with the left and right shapes, both
+// datasets need to use the same coordinate system. The right dataset is
+// searched using its spatial index.
+func SpatialJoin(left, right *Dataset, predicate func(a, b RecordContent) bool, opts JoinOptions) (out *Dataset, err error) {
+	if right.DBF == nil {
+		return nil, fmt.Errorf("right dataset has no attributes")
+	}
+	if opts.Nearest && opts.Mode == JoinAll && opts.MaxDistance <= 0 {
+		return nil, fmt.Errorf("joining all nearest features needs a maximum distance")
+	}
+	if !opts.Nearest && predicate == nil {
+		return nil, fmt.Errorf("no predicate")
+	}
+
+	var fields []FieldDescriptor
+	taken := map[string]bool{}
+	if left.DBF != nil {
+		for _, fd := range left.DBF.FieldDescriptors {
+			fields = append(fields, fd)
+			taken[fd.FieldName()] = true
+		}
+	}
+	var cols []int
+	if opts.Fields == nil {
+		for i := range right.DBF.FieldDescriptors {
+			cols = append(cols, i)
+		}
+	}
+	for _, name := range opts.Fields {
+		col := right.DBF.fieldIndex(name)
+		if col == -1 {
+			return nil, fmt.Errorf("no such field: %s", name)
+		}
+		cols = append(cols, col)
+	}
+	for _, col := range cols {
+		fd := right.DBF.FieldDescriptors[col]
+		name := uniqueFieldName(fd.FieldName(), taken)
+		fields = append(fields, NewFieldDescriptor(name, fd.FieldType, fd.FieldLength, fd.DecimalCount))
+	}
+	if opts.DistanceField != "" {
+		fields = append(fields, NewFieldDescriptor(uniqueFieldName(opts.DistanceField, taken), Number, 19, 3))
+	}
+
+	out = NewDataset(left.Shapefile.Header.ShapeType, fields, left.CRS)
+	for _, f := range left.Features() {
+		if f.Deleted {
+			continue
+		}
+		var matches []joinMatch
+		if opts.Nearest {
+			matches = nearestFeatures(right, f.Record.Content, opts)
+		} else {
+			matches = matchingFeatures(right, f.Record.Content, predicate, opts)
+		}
+		if len(matches) == 0 {
+			if opts.DropUnmatched {
+				continue
+			}
+			matches = []joinMatch{{}}
+		}
+		for _, m := range matches {
+			row := append([]interface{}{}, f.Attributes...)
+			for _, col := range cols {
+				var v interface{}
+				if m.feature != nil {
+					v = m.feature.Attributes[col]
+				}
+				row = append(row, v)
+			}
+			if opts.DistanceField != "" {
+				var d interface{}
+				if m.feature != nil {
+					d = m.distance
+				}
+				row = append(row, d)
+			}
+			if err = out.Add(f.Record.Content, row); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return
+}
+
+type joinMatch struct {
+	feature  *Feature
+	distance float64
+}
+
+// uniqueFieldName returns a column name not taken yet, at most 10
+// characters long, and marks it as taken.
+func uniqueFieldName(name string, taken map[string]bool) string {
+	cut := func(s string) string {
+		if len(s) > 10 {
+			return s[:10]
+		}
+		return s
+	}
+	n := cut(name)
+	if taken[n] {
+		n = cut("R_" + name)
+	}
+	for i := 2; taken[n]; i++ {
+		suffix := strconv.Itoa(i)
+		n = cut(name)
+		if len(n)+len(suffix) > 10 {
+			n = n[:10-len(suffix)]
+		}
+		n += suffix
+	}
+	taken[n] = true
+	return n
+}
+
+func matchingFeatures(ds *Dataset, content RecordContent, predicate func(a, b RecordContent) bool, opts JoinOptions) (matches []joinMatch) {
+	b, ok := boxOf(content)
+	if !ok {
+		return
+	}
+	for f := range ds.Query(b) {
+		if f.Deleted || !predicate(content, f.Record.Content) {
+			continue
+		}
+		m := joinMatch{feature: f}
+		if opts.DistanceField != "" {
+			m.distance = Distance(content, f.Record.Content)
+		}
+		matches = append(matches, m)
+	}
+	// the index yields features in no particular order
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].feature.Record.Header.RecordNumber < matches[j].feature.Record.Header.RecordNumber
+	})
+	if opts.Mode == JoinFirst && len(matches) > 1 {
+		matches = matches[:1]
+	}
+	return
+}
+
+// nearestFeatures finds the features closest to content. A first
+// candidate is found using the index nearest to a point on content,
+// features closer than that must lie within its distance of the
+// bounding box of content.
+func nearestFeatures(ds *Dataset, content RecordContent, opts JoinOptions) (matches []joinMatch) {
+	b, ok := boxOf(content)
+	if !ok {
+		return
+	}
+	limit := opts.MaxDistance
+	if limit <= 0 {
+		limit = math.Inf(1)
+	}
+	if opts.Mode == JoinFirst {
+		var p Point
+		eachXY(content, func(x, y *float64) { p = Point{*x, *y} })
+		for _, f := range ds.Nearest(p, 1) {
+			limit = math.Min(limit, Distance(content, f.Record.Content))
+		}
+		if math.IsInf(limit, 1) {
+			return
+		}
+	}
+	search := Box{b.Xmin - limit, b.Ymin - limit, b.Xmax + limit, b.Ymax + limit}
+	for f := range ds.Query(search) {
+		if f.Deleted {
+			continue
+		}
+		if d := Distance(content, f.Record.Content); d <= limit {
+			matches = append(matches, joinMatch{f, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].feature.Record.Header.RecordNumber < matches[j].feature.Record.Header.RecordNumber
+	})
+	if opts.Mode == JoinFirst && len(matches) > 1 {
+		matches = matches[:1]
+	}
+	return
+}
@@ -0,0 +1,96 @@
+package shapefile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpatialJoin(t *testing.T) {
+	districts, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a station inside each district, and one in the North Sea
+	stations := NewDataset(POINT, []FieldDescriptor{NewFieldDescriptor("WKR_NR", Number, 3, 0)}, nil)
+	for _, f := range districts.Features() {
+		p := f.Record.Content.(*Polygon).PointOnSurface()
+		if err = stations.Add(&p, []interface{}{f.Attributes[0]}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = stations.Add(&Point{400000, 6000000}, []interface{}{int64(0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	joined, err := SpatialJoin(stations, districts, Within, JoinOptions{Fields: []string{"WKR_NR", "LAND_NAME"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, fd := range joined.DBF.FieldDescriptors {
+		names = append(names, fd.FieldName())
+	}
+	if len(names) != 3 || names[1] != "R_WKR_NR" || names[2] != "LAND_NAME" {
+		t.Errorf("unexpected fields: %v", names)
+	}
+	features := joined.Features()
+	if len(features) != 300 {
+		t.Fatalf("expected 300 rows, got %d", len(features))
+	}
+	for _, f := range features[:299] {
+		if f.Attributes[0] != f.Attributes[1] {
+			t.Errorf("station %v joined to district %v", f.Attributes[0], f.Attributes[1])
+		}
+	}
+	if sea := features[299].Attributes; sea[1] != nil || sea[2] != nil {
+		t.Errorf("expected no district at sea: %v", sea)
+	}
+
+	joined, err = SpatialJoin(stations, districts, Within, JoinOptions{Fields: []string{"WKR_NAME"}, DropUnmatched: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(joined.Features()); n != 299 {
+		t.Errorf("expected unmatched station to be dropped, got %d rows", n)
+	}
+
+	// the nearest district to the station at sea is on the coast
+	sea := NewDataset(POINT, nil, nil)
+	sea.Add(&Point{400000, 6000000}, nil)
+	joined, err = SpatialJoin(sea, districts, nil, JoinOptions{Nearest: true, Fields: []string{"LAND_NAME"}, DistanceField: "DIST"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := joined.Features()[0].Attributes
+	if s := strings.TrimSpace(row[0].(string)); s != "Niedersachsen" && s != "Schleswig-Holstein" {
+		t.Errorf("unexpected nearest state: %q", row[0])
+	}
+	if d := row[1].(float64); d <= 0 || d > 200000 {
+		t.Errorf("unexpected distance: %v", d)
+	}
+	nearest := row[1].(float64)
+
+	joined, err = SpatialJoin(sea, districts, nil, JoinOptions{Nearest: true, Mode: JoinAll, MaxDistance: nearest + 30000, DistanceField: "DIST"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := joined.Features()
+	if len(rows) < 2 {
+		t.Fatalf("expected several districts within range, got %d", len(rows))
+	}
+	last := 0.0
+	for _, f := range rows {
+		d := f.Attributes[len(f.Attributes)-1].(float64)
+		if d < last || d > nearest+30000 {
+			t.Errorf("unexpected distance %v", d)
+		}
+		last = d
+	}
+	if rows[0].Attributes[len(rows[0].Attributes)-1] != nearest {
+		t.Errorf("expected the nearest district first")
+	}
+
+	if _, err = SpatialJoin(sea, districts, nil, JoinOptions{Nearest: true, Mode: JoinAll}); err == nil {
+		t.Errorf("expected error without maximum distance")
+	}
+}
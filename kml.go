@@ -0,0 +1,398 @@
+package shapefile
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// KML 2.2, as read by Google Earth:
+// https://developers.google.com/kml/documentation/kmlreference
+// Coordinates are longitude, latitude and altitude in meters on WGS84.
+
+// KMLOptions control WriteKML.
+type KMLOptions struct {
+	Name      string // of the document, none if empty
+	NameField string // column naming the placemarks, none if empty
+}
+
+// WriteKML writes the features of ds as placemarks, with their
+// attributes as ExtendedData. Shapes with Z values keep them as absolute
+// altitudes, others are clamped to the ground. Polygons are split into
+// an outer boundary each with the holes inside it, and MultiPatches into
+// triangles. The coordinates are reprojected to WGS84, those of datasets
+// without a CRS are taken as longitude and latitude.
+func WriteKML(w io.Writer, ds *Dataset, opts KMLOptions) (err error) {
+	var lonLat func(x, y float64) (float64, float64, error)
+	if lonLat, err = lonLatOf(ds); err != nil {
+		return
+	}
+	nameCol := -1
+	if opts.NameField != "" {
+		if nameCol, err = styleField(ds, opts.NameField); err != nil {
+			return
+		}
+	}
+	bw := bufio.NewWriter(w)
+	bw.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<kml xmlns=\"http://www.opengis.net/kml/2.2\">\n<Document>\n")
+	if opts.Name != "" {
+		fmt.Fprintf(bw, "<name>%s</name>\n", escapeXML(opts.Name))
+	}
+	for _, f := range ds.Features() {
+		if f.Deleted {
+			continue
+		}
+		var geometry string
+		if geometry, err = kmlGeometry(f.Record.Content, lonLat); err != nil {
+			return
+		}
+		if geometry == "" {
+			continue
+		}
+		bw.WriteString("<Placemark>")
+		if nameCol != -1 {
+			fmt.Fprintf(bw, "<name>%s</name>", escapeXML(formatValue(f.Attributes[nameCol])))
+		}
+		if f.Attributes != nil {
+			bw.WriteString("<ExtendedData>")
+			for i, fd := range ds.DBF.FieldDescriptors {
+				if f.Attributes[i] != nil {
+					fmt.Fprintf(bw, "<Data name=\"%s\"><value>%s</value></Data>", escapeXML(fd.FieldName()), escapeXML(formatValue(f.Attributes[i])))
+				}
+			}
+			bw.WriteString("</ExtendedData>")
+		}
+		bw.WriteString(geometry)
+		bw.WriteString("</Placemark>\n")
+	}
+	bw.WriteString("</Document>\n</kml>\n")
+	return bw.Flush()
+}
+
+// lonLatOf returns the conversion of coordinates of ds to longitude and
+// latitude, which is none if ds has no CRS or is in WGS84 already.
+func lonLatOf(ds *Dataset) (lonLat func(x, y float64) (float64, float64, error), err error) {
+	if ds.CRS == nil || ds.CRS.EPSG == 4326 {
+		return func(x, y float64) (float64, float64, error) { return x, y, nil }, nil
+	}
+	var wgs84 *CRS
+	if wgs84, err = CRSFromEPSG(4326); err != nil {
+		return
+	}
+	var t *Transformer
+	if t, err = NewTransformer(ds.CRS, wgs84); err != nil {
+		return
+	}
+	return t.Point, nil
+}
+
+// kmlGeometry returns the KML geometry of a shape, a MultiGeometry if it
+// has several parts, or nothing for null shapes.
+func kmlGeometry(content RecordContent, lonLat func(x, y float64) (float64, float64, error)) (kml string, err error) {
+	z, _ := zmOf(content)
+	altitude := ""
+	if z != nil {
+		altitude = "<altitudeMode>absolute</altitudeMode>"
+	}
+	parts, areal := verticesOf(content)
+	mp, faces := content.(*MultiPatch)
+	if faces {
+		// triangles, which are polygons, too
+		parts, areal = triangleRings(mp), true
+	}
+	for _, part := range parts {
+		for i := range part {
+			if part[i].X, part[i].Y, err = lonLat(part[i].X, part[i].Y); err != nil {
+				return
+			}
+		}
+	}
+	coordinates := func(vs []vertex) string {
+		var b strings.Builder
+		b.WriteString("<coordinates>")
+		for i, v := range vs {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteString(strconv.FormatFloat(v.X, 'f', -1, 64) + "," + strconv.FormatFloat(v.Y, 'f', -1, 64))
+			if z != nil {
+				b.WriteString("," + strconv.FormatFloat(v.Z, 'f', -1, 64))
+			}
+		}
+		b.WriteString("</coordinates>")
+		return b.String()
+	}
+	var geometries []string
+	switch {
+	case areal:
+		rings := make([][]Point, len(parts))
+		for i, part := range parts {
+			for _, v := range part {
+				rings[i] = append(rings[i], v.point())
+			}
+		}
+		// KML wants outer boundaries counter clockwise, holes clockwise.
+		// Faces keep their winding, which tells their front in 3D.
+		ring := func(i int, ccw bool) string {
+			vs := parts[i]
+			if a, _ := ringArea(rings[i]); !faces && (a > 0) != ccw {
+				vs = make([]vertex, len(parts[i]))
+				for j, v := range parts[i] {
+					vs[len(vs)-1-j] = v
+				}
+			}
+			if len(vs) > 0 && vs[0].point() != vs[len(vs)-1].point() {
+				vs = append(vs[:len(vs):len(vs)], vs[0])
+			}
+			return "<LinearRing>" + coordinates(vs) + "</LinearRing>"
+		}
+		polygons := groupRings(rings)
+		if faces {
+			// the triangles lie on top of one another rather than in holes
+			polygons = make([][]int, len(rings))
+			for i := range rings {
+				polygons[i] = []int{i}
+			}
+		}
+		for _, polygon := range polygons {
+			kml := "<Polygon>" + altitude + "<outerBoundaryIs>" + ring(polygon[0], true) + "</outerBoundaryIs>"
+			for _, hole := range polygon[1:] {
+				kml += "<innerBoundaryIs>" + ring(hole, false) + "</innerBoundaryIs>"
+			}
+			geometries = append(geometries, kml+"</Polygon>")
+		}
+	default:
+		for _, part := range parts {
+			if len(part) == 1 {
+				geometries = append(geometries, "<Point>"+altitude+coordinates(part)+"</Point>")
+			} else {
+				geometries = append(geometries, "<LineString>"+altitude+coordinates(part)+"</LineString>")
+			}
+		}
+	}
+	if len(geometries) == 1 {
+		return geometries[0], nil
+	}
+	if len(geometries) > 1 {
+		return "<MultiGeometry>" + strings.Join(geometries, "") + "</MultiGeometry>", nil
+	}
+	return
+}
+
+// triangleRings returns the triangles of a MultiPatch as closed rings.
+func triangleRings(mp *MultiPatch) (rings [][]vertex) {
+	m := mp.Triangulate()
+	for _, t := range m.Triangles {
+		var ring []vertex
+		for _, i := range []uint32{t[0], t[1], t[2], t[0]} {
+			v := m.Vertices[i]
+			ring = append(ring, vertex{X: v[0], Y: v[1], Z: v[2]})
+		}
+		rings = append(rings, ring)
+	}
+	return
+}
+
+type kmlPlacemark struct {
+	Name        string          `xml:"name"`
+	Description string          `xml:"description"`
+	Data        []kmlData       `xml:"ExtendedData>Data"`
+	SimpleData  []kmlSimpleData `xml:"ExtendedData>SchemaData>SimpleData"`
+	kmlGeometries
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlSimpleData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
+type kmlGeometries struct {
+	Points        []string        `xml:"Point>coordinates"`
+	LineStrings   []string        `xml:"LineString>coordinates"`
+	LinearRings   []string        `xml:"LinearRing>coordinates"`
+	Polygons      []kmlPolygon    `xml:"Polygon"`
+	MultiGeometry []kmlGeometries `xml:"MultiGeometry"`
+}
+
+type kmlPolygon struct {
+	Outer string   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inner []string `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+// ReadKML reads the placemarks of a KML document, in any folder, into
+// datasets in WGS84, one for each type of shape. Placemarks with polygons
+// become polygons, with lines lines and with points points, a placemark
+// mixing them keeps the polygons, or else the lines. Shapes have Z values
+// if any of their coordinates has an altitude. The attributes are the
+// name, the description and the ExtendedData of the placemarks.
+func ReadKML(r io.Reader) (datasets []*Dataset, err error) {
+	var features []importedFeature
+	names := []string{"name", "description"}
+	known := map[string]bool{"name": true, "description": true}
+	dec := xml.NewDecoder(r)
+	for {
+		var tok xml.Token
+		if tok, err = dec.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+		var pm kmlPlacemark
+		if err = dec.DecodeElement(&pm, &start); err != nil {
+			return
+		}
+		var content RecordContent
+		if content, err = pm.shape(); err != nil {
+			return
+		}
+		if content == nil {
+			continue
+		}
+		attributes := map[string]string{}
+		add := func(name, value string) {
+			if !known[name] {
+				known[name] = true
+				names = append(names, name)
+			}
+			attributes[name] = strings.TrimSpace(value)
+		}
+		add("name", pm.Name)
+		add("description", pm.Description)
+		for _, d := range pm.Data {
+			add(d.Name, d.Value)
+		}
+		for _, d := range pm.SimpleData {
+			add(d.Name, d.Value)
+		}
+		features = append(features, importedFeature{content, attributes})
+	}
+	var wgs84 *CRS
+	if wgs84, err = CRSFromEPSG(4326); err != nil {
+		return
+	}
+	return importDatasets(features, names, wgs84)
+}
+
+// shape returns the geometries of the placemark as a single shape, nil
+// if it has none.
+func (pm *kmlPlacemark) shape() (content RecordContent, err error) {
+	var points, lines, rings [][]vertex
+	hasZ := false
+	parse := func(s string) (vs []vertex, err error) {
+		for _, tuple := range strings.Fields(s) {
+			c := strings.Split(tuple, ",")
+			if len(c) < 2 || len(c) > 3 {
+				return nil, fmt.Errorf("invalid coordinates: %s", tuple)
+			}
+			v := vertex{M: math.NaN()}
+			if v.X, err = strconv.ParseFloat(c[0], 64); err != nil {
+				return
+			}
+			if v.Y, err = strconv.ParseFloat(c[1], 64); err != nil {
+				return
+			}
+			if len(c) == 3 {
+				if v.Z, err = strconv.ParseFloat(c[2], 64); err != nil {
+					return
+				}
+				hasZ = true
+			}
+			vs = append(vs, v)
+		}
+		return
+	}
+	var walk func(g *kmlGeometries) error
+	walk = func(g *kmlGeometries) (err error) {
+		var vs []vertex
+		for _, s := range g.Points {
+			if vs, err = parse(s); err != nil {
+				return
+			}
+			for _, v := range vs {
+				points = append(points, []vertex{v})
+			}
+		}
+		for _, s := range append(g.LineStrings, g.LinearRings...) {
+			if vs, err = parse(s); err != nil {
+				return
+			}
+			if len(vs) > 1 {
+				lines = append(lines, vs)
+			}
+		}
+		for _, p := range g.Polygons {
+			for i, s := range append([]string{p.Outer}, p.Inner...) {
+				if vs, err = parse(s); err != nil {
+					return
+				}
+				if len(vs) < 3 {
+					continue
+				}
+				if vs[0].point() != vs[len(vs)-1].point() {
+					vs = append(vs, vs[0])
+				}
+				// shapefiles want outer rings clockwise, holes counter
+				// clockwise
+				ring := make([]Point, len(vs))
+				for j, v := range vs {
+					ring[j] = v.point()
+				}
+				if a, _ := ringArea(ring); (a > 0) == (i == 0) {
+					for j, k := 0, len(vs)-1; j < k; j, k = j+1, k-1 {
+						vs[j], vs[k] = vs[k], vs[j]
+					}
+				}
+				rings = append(rings, vs)
+			}
+		}
+		for i := range g.MultiGeometry {
+			if err = walk(&g.MultiGeometry[i]); err != nil {
+				return
+			}
+		}
+		return
+	}
+	if err = walk(&pm.kmlGeometries); err != nil {
+		return
+	}
+	var template RecordContent
+	var parts [][]vertex
+	switch {
+	case len(rings) > 0:
+		template, parts = &Polygon{}, rings
+		if hasZ {
+			template = &PolygonZ{}
+		}
+	case len(lines) > 0:
+		template, parts = &PolyLine{}, lines
+		if hasZ {
+			template = &PolyLineZ{}
+		}
+	case len(points) == 1:
+		template, parts = &Point{}, points
+		if hasZ {
+			template = &PointZ{}
+		}
+	case len(points) > 1:
+		template, parts = &MultiPoint{}, points
+		if hasZ {
+			template = &MultiPointZ{}
+		}
+	default:
+		return nil, nil
+	}
+	return withVertices(template, parts), nil
+}
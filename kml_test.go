@@ -0,0 +1,110 @@
+package shapefile
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKMLRoundTrip(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("NAME", Character, 10, 0), NewFieldDescriptor("POP", Number, 6, 0)}
+	ds := NewDataset(POLYGON, fields, mustEPSG(t, 4326))
+	// two islands, one with a lake
+	pg := polygon(square(0, 0, 10, 10), square(3, 3, 7, 7), square(20, 0, 30, 10))
+	ds.Add(pg, []interface{}{"A & B", int64(42)})
+	ds.Add(polygon(square(0, 20, 1, 21)), []interface{}{"C", nil})
+	var buf bytes.Buffer
+	if err := WriteKML(&buf, ds, KMLOptions{Name: "test", NameField: "name"}); err != nil {
+		t.Fatal(err)
+	}
+	kml := buf.String()
+	expected := []string{
+		"<name>A &amp; B</name><ExtendedData><Data name=\"NAME\"><value>A &amp; B</value></Data><Data name=\"POP\"><value>42</value></Data></ExtendedData><MultiGeometry><Polygon>",
+		// outer boundaries counter clockwise, holes clockwise
+		"<outerBoundaryIs><LinearRing><coordinates>0,0 10,0 10,10 0,10 0,0</coordinates></LinearRing></outerBoundaryIs><innerBoundaryIs><LinearRing><coordinates>3,3 3,7 7,7 7,3 3,3</coordinates></LinearRing></innerBoundaryIs></Polygon><Polygon>",
+		"<ExtendedData><Data name=\"NAME\"><value>C</value></Data></ExtendedData><Polygon>",
+	}
+	for _, e := range expected {
+		if !strings.Contains(kml, e) {
+			t.Errorf("expected %s in\n%s", e, kml)
+		}
+	}
+
+	datasets, err := ReadKML(strings.NewReader(kml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datasets) != 1 || datasets[0].Shapefile.Header.ShapeType != POLYGON || datasets[0].CRS.EPSG != 4326 {
+		t.Fatalf("expected a polygon dataset, got %v", datasets)
+	}
+	features := datasets[0].Features()
+	// the hole comes back counter clockwise as shapefiles want it
+	hole := []Point{{3, 3}, {7, 3}, {7, 7}, {3, 7}, {3, 3}}
+	if got := features[0].Record.Content.(*Polygon); !reflect.DeepEqual(got.Points[5:10], hole) || !reflect.DeepEqual(got.Points[:5], pg.Points[:5]) || !reflect.DeepEqual(got.Points[10:], pg.Points[10:]) {
+		t.Errorf("expected the rings in shapefile order, got %v", got.Points)
+	}
+	var names []string
+	for _, fd := range datasets[0].DBF.FieldDescriptors {
+		names = append(names, fd.FieldName())
+	}
+	if !reflect.DeepEqual(names, []string{"name", "NAME_1", "POP"}) {
+		t.Errorf("unexpected fields %v", names)
+	}
+	if !reflect.DeepEqual(features[0].Attributes, []interface{}{"A & B", "A & B", int64(42)}) || features[1].Attributes[2] != nil {
+		t.Errorf("unexpected attributes %v %v", features[0].Attributes, features[1].Attributes)
+	}
+}
+
+func TestReadKML(t *testing.T) {
+	kml := `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2"><Document><Folder>
+<Placemark><name>Summit</name><Point><coordinates>10.98,47.42,2962</coordinates></Point></Placemark>
+<Placemark><name>Trail</name><description>steep</description>
+  <ExtendedData><SchemaData schemaUrl="#s"><SimpleData name="length">1.5</SimpleData></SchemaData></ExtendedData>
+  <MultiGeometry><LineString><coordinates>0,0 1,1</coordinates></LineString><LineString><coordinates>
+    1,1 2,1
+  </coordinates></LineString></MultiGeometry></Placemark>
+<Placemark><name>Nothing</name></Placemark>
+</Folder></Document></kml>`
+	datasets, err := ReadKML(strings.NewReader(kml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(datasets) != 2 {
+		t.Fatalf("expected a point and a line dataset, got %d", len(datasets))
+	}
+	p, ok := datasets[0].Features()[0].Record.Content.(*PointZ)
+	if !ok || p.X != 10.98 || p.Y != 47.42 || p.Z != 2962 || !math.IsNaN(p.M) {
+		t.Errorf("unexpected summit %v", datasets[0].Features()[0].Record.Content)
+	}
+	line := datasets[1].Features()[0]
+	if pl := line.Record.Content.(*PolyLine); !reflect.DeepEqual(pl.Parts, []int32{0, 2}) || len(pl.Points) != 4 {
+		t.Errorf("unexpected trail %v", pl)
+	}
+	if !reflect.DeepEqual(line.Attributes, []interface{}{"Trail", "steep", 1.5}) {
+		t.Errorf("unexpected attributes %v", line.Attributes)
+	}
+	if len(datasets[0].DBF.FieldDescriptors) != 1 {
+		t.Errorf("expected the summit to have a name only")
+	}
+}
+
+func TestKMLMultiPatch(t *testing.T) {
+	ds := NewDataset(MULTI_PATCH, nil, mustEPSG(t, 4326))
+	mp := house()
+	ds.Add(mp, nil)
+	var buf bytes.Buffer
+	if err := WriteKML(&buf, ds, KMLOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	kml := buf.String()
+	// every triangle is a face of its own, none is a hole of another
+	if n, expected := strings.Count(kml, "<Polygon>"), len(mp.Triangulate().Triangles); n != expected {
+		t.Errorf("expected %d polygons, got %d", expected, n)
+	}
+	if strings.Contains(kml, "innerBoundaryIs") {
+		t.Errorf("unexpected inner boundaries in\n%s", kml)
+	}
+}
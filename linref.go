@@ -0,0 +1,274 @@
+package shapefile
+
+import (
+	"math"
+	"sort"
+)
+
+// Linear referencing locates positions along routes, PolyLineM and
+// PolyLineZ shapes, by their M values, e.g. the kilometre posts of a road.
+// Measures need not increase along the route, where they repeat the first
+// position wins.
+
+// routeParts returns the vertices of a route, nil for other shapes.
+func routeParts(content RecordContent) [][]vertex {
+	switch content.(type) {
+	case *PolyLineM, *PolyLineZ:
+		parts, _ := verticesOf(content)
+		return parts
+	}
+	return nil
+}
+
+// pointOn returns a PointM or PointZ matching the type of the route.
+func pointOn(content RecordContent, v vertex) RecordContent {
+	if _, ok := content.(*PolyLineZ); ok {
+		return &PointZ{v.X, v.Y, v.Z, v.M}
+	}
+	return &PointM{v.X, v.Y, v.M}
+}
+
+// PointAtMeasure returns the first position along the route with measure
+// m as a PointM, or a PointZ for PolyLineZ routes, nil if there is none.
+func PointAtMeasure(content RecordContent, m float64) RecordContent {
+	for _, part := range routeParts(content) {
+		if len(part) == 1 && part[0].M == m {
+			return pointOn(content, part[0])
+		}
+		for i := 1; i < len(part); i++ {
+			a, b := part[i-1], part[i]
+			if !measured(a.M) || !measured(b.M) || m < math.Min(a.M, b.M) || m > math.Max(a.M, b.M) {
+				continue
+			}
+			t := 0.0
+			if a.M != b.M {
+				t = (m - a.M) / (b.M - a.M)
+			}
+			return pointOn(content, lerp(a, b, t))
+		}
+	}
+	return nil
+}
+
+// LineBetweenMeasures returns the parts of the route with measures from
+// from to to, in either order, as a shape of the route's type. Z and M
+// values are interpolated where the route is cut. It returns nil if no
+// stretch of the route lies in the range.
+func LineBetweenMeasures(content RecordContent, from, to float64) RecordContent {
+	lo, hi := math.Min(from, to), math.Max(from, to)
+	var runs [][]vertex
+	for _, part := range routeParts(content) {
+		var run []vertex
+		flush := func() {
+			if len(run) > 1 {
+				runs = append(runs, run)
+			}
+			run = nil
+		}
+		for i := 1; i < len(part); i++ {
+			a, b := part[i-1], part[i]
+			if !measured(a.M) || !measured(b.M) {
+				flush()
+				continue
+			}
+			t0, t1 := 0.0, 1.0
+			if a.M == b.M {
+				if a.M < lo || a.M > hi {
+					flush()
+					continue
+				}
+			} else {
+				t0, t1 = (lo-a.M)/(b.M-a.M), (hi-a.M)/(b.M-a.M)
+				if t0 > t1 {
+					t0, t1 = t1, t0
+				}
+				t0, t1 = math.Max(t0, 0), math.Min(t1, 1)
+				if t0 > t1 {
+					flush()
+					continue
+				}
+			}
+			start, end := lerp(a, b, t0), lerp(a, b, t1)
+			if len(run) > 0 && run[len(run)-1] != start {
+				flush()
+			}
+			if len(run) == 0 {
+				run = append(run, start)
+			}
+			if end != run[len(run)-1] {
+				run = append(run, end)
+			}
+		}
+		flush()
+	}
+	return withVertices(content, runs)
+}
+
+// MeasureAt returns the measure of the point on the route closest to p
+// and the distance of p to it. Segments with missing measures are left
+// out, ok is false if that leaves nothing.
+func MeasureAt(content RecordContent, p Point) (m, distance float64, ok bool) {
+	distance = math.Inf(1)
+	for _, part := range routeParts(content) {
+		if len(part) == 1 && measured(part[0].M) {
+			if d := math.Hypot(p.X-part[0].X, p.Y-part[0].Y); d < distance {
+				m, distance, ok = part[0].M, d, true
+			}
+		}
+		for i := 1; i < len(part); i++ {
+			a, b := part[i-1], part[i]
+			if !measured(a.M) || !measured(b.M) {
+				continue
+			}
+			v := lerp(a, b, segmentParam(p, a.point(), b.point()))
+			if d := math.Hypot(p.X-v.X, p.Y-v.Y); d < distance {
+				m, distance, ok = v.M, d, true
+			}
+		}
+	}
+	return
+}
+
+// segmentParam returns the position of the point on the segment from a
+// to b closest to p, between 0 at a and 1 at b.
+func segmentParam(p, a, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	l := dx*dx + dy*dy
+	if l == 0 {
+		return 0
+	}
+	return math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/l))
+}
+
+// station is a measure known at a distance along a route.
+type station struct{ s, m float64 }
+
+// stations are sorted by distance.
+type stations []station
+
+// at interpolates the measure at distance s linearly between the
+// neighbouring stations. Before the first and after the last station the
+// rate of the closest pair is used, with a single station the measure
+// increases by the distance.
+func (st stations) at(s float64) float64 {
+	if len(st) == 1 {
+		return st[0].m + s - st[0].s
+	}
+	i := sort.Search(len(st), func(i int) bool { return st[i].s > s })
+	if i == 0 {
+		i = 1
+	} else if i == len(st) {
+		i = len(st) - 1
+	}
+	a, b := st[i-1], st[i]
+	return a.m + (s-a.s)*(b.m-a.m)/(b.s-a.s)
+}
+
+// along returns the distance of each vertex from the start of the route,
+// not counting the gaps between parts.
+func along(parts [][]vertex) [][]float64 {
+	dist := make([][]float64, len(parts))
+	s := 0.0
+	for i, part := range parts {
+		dist[i] = make([]float64, len(part))
+		for j := range part {
+			if j > 0 {
+				s += math.Hypot(part[j].X-part[j-1].X, part[j].Y-part[j-1].Y)
+			}
+			dist[i][j] = s
+		}
+	}
+	return dist
+}
+
+// calibrated returns a route of content's type, or a PolyLineM for a
+// PolyLine, with the measure of every vertex set by measure.
+func calibrated(content RecordContent, parts [][]vertex, measure func(i, j int) float64) RecordContent {
+	out := make([][]vertex, len(parts))
+	for i, part := range parts {
+		out[i] = make([]vertex, len(part))
+		for j, v := range part {
+			v.M = measure(i, j)
+			out[i][j] = v
+		}
+	}
+	if _, ok := content.(*PolyLine); ok {
+		content = &PolyLineM{}
+	}
+	return withVertices(content, out)
+}
+
+// Calibrate sets the measures of a route from points with known
+// measures, e.g. the positions of mile posts. Each point is placed on the
+// closest position along the route and the measures in between are
+// interpolated by distance, beyond the first and last point they are
+// extrapolated. A single point shifts measures equal to the distance
+// along the route. PolyLines are turned into PolyLineMs, nil is returned
+// for other shapes or if there are no points.
+func Calibrate(content RecordContent, points []PointM) RecordContent {
+	var parts [][]vertex
+	switch s := content.(type) {
+	case *PolyLine:
+		parts, _ = verticesOf(s)
+	default:
+		parts = routeParts(content)
+	}
+	if parts == nil || len(points) == 0 {
+		return nil
+	}
+	dist := along(parts)
+	var st stations
+	for _, p := range points {
+		best, s := math.Inf(1), 0.0
+		for i, part := range parts {
+			for j := 1; j < len(part); j++ {
+				a, b := part[j-1].point(), part[j].point()
+				t := segmentParam(Point{p.X, p.Y}, a, b)
+				x, y := a.X+t*(b.X-a.X), a.Y+t*(b.Y-a.Y)
+				if d := math.Hypot(p.X-x, p.Y-y); d < best {
+					best, s = d, dist[i][j-1]+t*(dist[i][j]-dist[i][j-1])
+				}
+			}
+		}
+		st = append(st, station{s, p.M})
+	}
+	sort.SliceStable(st, func(i, j int) bool { return st[i].s < st[j].s })
+	// points at the same position would divide by zero
+	unique := st[:1]
+	for _, x := range st[1:] {
+		if x.s > unique[len(unique)-1].s {
+			unique = append(unique, x)
+		}
+	}
+	return calibrated(content, parts, func(i, j int) float64 { return unique.at(dist[i][j]) })
+}
+
+// InterpolateMeasures fills in missing measures of a route by
+// interpolating between the closest measured vertices by distance along
+// the route, extrapolating at its ends as Calibrate does. It returns nil
+// for shapes other than routes, which are returned unchanged if no vertex
+// is measured.
+func InterpolateMeasures(content RecordContent) RecordContent {
+	parts := routeParts(content)
+	if parts == nil {
+		return nil
+	}
+	dist := along(parts)
+	var st stations
+	for i, part := range parts {
+		for j, v := range part {
+			if measured(v.M) && (len(st) == 0 || dist[i][j] > st[len(st)-1].s) {
+				st = append(st, station{dist[i][j], v.M})
+			}
+		}
+	}
+	if len(st) == 0 {
+		return content
+	}
+	return calibrated(content, parts, func(i, j int) float64 {
+		if m := parts[i][j].M; measured(m) {
+			return m
+		}
+		return st.at(dist[i][j])
+	})
+}
@@ -0,0 +1,115 @@
+package shapefile
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// route returns a measured L of 10 east and 10 north with kilometre
+// posts every 10 and a second part continuing from 30 to 40.
+func route() *PolyLineM {
+	pl := &PolyLineM{
+		Parts:  []int32{0, 3},
+		Points: []Point{{0, 0}, {10, 0}, {10, 10}, {20, 10}, {30, 10}},
+		MArray: []float64{0, 10, 20, 30, 40},
+	}
+	pl.MRange = MRange{0, 40}
+	updateBox(pl)
+	return pl
+}
+
+func TestPointAtMeasure(t *testing.T) {
+	tests := []struct {
+		m        float64
+		expected RecordContent
+	}{
+		{0, &PointM{0, 0, 0}},
+		{5, &PointM{5, 0, 5}},
+		{15, &PointM{10, 5, 15}},
+		{35, &PointM{25, 10, 35}},
+		{25, nil}, // in the gap between the parts
+		{41, nil},
+	}
+	for _, test := range tests {
+		if got := PointAtMeasure(route(), test.m); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.m, test.expected, got)
+		}
+	}
+
+	z := &PolyLineZ{Parts: []int32{0}, Points: []Point{{0, 0}, {10, 0}}, ZArray: []float64{100, 200}, MArray: []float64{0, 10}}
+	if got := PointAtMeasure(z, 2.5); !reflect.DeepEqual(got, &PointZ{2.5, 0, 125, 2.5}) {
+		t.Errorf("unexpected point along a PolyLineZ: %v", got)
+	}
+	if PointAtMeasure(polyline(Point{0, 0}, Point{1, 1}), 0) != nil {
+		t.Errorf("expected no measures along a PolyLine")
+	}
+}
+
+func TestLineBetweenMeasures(t *testing.T) {
+	got := LineBetweenMeasures(route(), 35, 5).(*PolyLineM)
+	expected := &PolyLineM{
+		Parts:  []int32{0, 3},
+		Points: []Point{{5, 0}, {10, 0}, {10, 10}, {20, 10}, {25, 10}},
+		MArray: []float64{5, 10, 20, 30, 35},
+		MRange: MRange{5, 35},
+	}
+	updateBox(expected)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if got := LineBetweenMeasures(route(), 12, 14).(*PolyLineM); !reflect.DeepEqual(got.Points, []Point{{10, 2}, {10, 4}}) {
+		t.Errorf("unexpected stretch along a segment: %v", got.Points)
+	}
+	if got := LineBetweenMeasures(route(), 22, 28); got != nil {
+		t.Errorf("expected nothing in the gap, got %v", got)
+	}
+}
+
+func TestMeasureAt(t *testing.T) {
+	m, d, ok := MeasureAt(route(), Point{12, 4})
+	if !ok || m != 14 || d != 2 {
+		t.Errorf("expected measure 14 at distance 2, got %v at %v", m, d)
+	}
+	m, d, ok = MeasureAt(route(), Point{-3, -4})
+	if !ok || m != 0 || d != 5 {
+		t.Errorf("expected measure 0 at distance 5, got %v at %v", m, d)
+	}
+	pl := route()
+	for i := range pl.MArray {
+		pl.MArray[i] = math.NaN()
+	}
+	if _, _, ok = MeasureAt(pl, Point{}); ok {
+		t.Errorf("expected no measure along an unmeasured route")
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	// posts at 100 and 110 along the first leg, distances are 10 apart
+	got := Calibrate(polyline(Point{0, 0}, Point{10, 0}, Point{10, 10}), []PointM{{10, -1, 110}, {0, -1, 100}}).(*PolyLineM)
+	if !reflect.DeepEqual(got.MArray, []float64{100, 110, 120}) || got.MRange != (MRange{100, 120}) {
+		t.Errorf("unexpected calibration: %v %v", got.MArray, got.MRange)
+	}
+	// a single post shifts the distances
+	got = Calibrate(route(), []PointM{{10, 0, 1000}}).(*PolyLineM)
+	if !reflect.DeepEqual(got.MArray, []float64{990, 1000, 1010, 1010, 1020}) {
+		t.Errorf("unexpected shifted measures: %v", got.MArray)
+	}
+	if Calibrate(route(), nil) != nil || Calibrate(&Point{}, []PointM{{}}) != nil {
+		t.Errorf("expected no calibration")
+	}
+}
+
+func TestInterpolateMeasures(t *testing.T) {
+	pl := route()
+	pl.MArray = []float64{math.NaN(), 10, -1e39, 30, math.NaN()}
+	got := InterpolateMeasures(pl).(*PolyLineM)
+	// the gap between the parts doesn't count, so the end of the first
+	// part is at the same distance as the start of the second
+	if !reflect.DeepEqual(got.MArray, []float64{-10, 10, 30, 30, 50}) {
+		t.Errorf("unexpected interpolated measures: %v", got.MArray)
+	}
+	if InterpolateMeasures(polyline(Point{0, 0}, Point{1, 1})) != nil {
+		t.Errorf("expected a PolyLine not to be interpolated")
+	}
+}
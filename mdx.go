@@ -0,0 +1,168 @@
+package shapefile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// dBase IV .mdx multiple index files, see:
+// http://www.clicketyclick.dk/databases/xbase/format/mdx.html
+//
+// A 544 byte header is followed by the tag table, each tag has a header
+// page pointing to the root of its B-tree. Pages are BlockSize bytes,
+// page numbers count 512 byte blocks. Each page starts with the number of
+// keys and the previous page, followed by entries of KeyItemLength bytes:
+// record number (leaves) or child page (branches) followed by the key.
+// Branch pages have one more child than keys, in leaves the pointer
+// following the last key is 0. Character keys are space padded, date keys
+// are float64 julian days and numeric keys are 12 byte BCD numbers.
+
+type MDXFile struct {
+	BlockSize  uint16 // in bytes
+	Production bool
+	Tags       []*MDXTag
+	r          io.ReaderAt
+}
+
+type MDXTag struct {
+	Name          string
+	KeyType       FieldType // Character, Number or Date
+	RootPage      uint32
+	KeyLength     uint16
+	KeyItemLength uint16
+	Descending    bool
+	Unique        bool
+	Expression    string
+	mdx           *MDXFile
+}
+
+func NewMDXFile(r io.ReaderAt) (mdx *MDXFile, err error) {
+	raw := make([]byte, 544)
+	if _, err = r.ReadAt(raw, 0); err != nil {
+		return
+	}
+	mdx = &MDXFile{BlockSize: L.Uint16(raw[22:]), Production: raw[24] != 0, r: r}
+	if mdx.BlockSize < 512 || mdx.BlockSize%512 != 0 {
+		return nil, fmt.Errorf("invalid block size: %d", mdx.BlockSize)
+	}
+	entryLen := int64(raw[26])
+	numTags := int(L.Uint16(raw[28:]))
+	if entryLen < 32 || numTags > int(raw[25]) {
+		return nil, fmt.Errorf("invalid tag table: %d tags of %d bytes", numTags, entryLen)
+	}
+
+	for i := 0; i != numTags; i++ {
+		entry := make([]byte, entryLen)
+		if _, err = r.ReadAt(entry, 544+int64(i)*entryLen); err != nil {
+			return nil, err
+		}
+		tag := &MDXTag{Name: cString(entry[4:15]), KeyType: FieldType(entry[20]), mdx: mdx}
+		hdr := make([]byte, 124)
+		if _, err = r.ReadAt(hdr, int64(L.Uint32(entry))*512); err != nil {
+			return nil, err
+		}
+		tag.RootPage = L.Uint32(hdr)
+		tag.Descending = hdr[8]&0x08 != 0
+		tag.Unique = hdr[8]&0x40 != 0 || hdr[23] != 0
+		tag.KeyLength = L.Uint16(hdr[12:])
+		tag.KeyItemLength = L.Uint16(hdr[18:])
+		tag.Expression = cString(hdr[24:])
+		if tag.KeyItemLength < tag.KeyLength+4 || tag.KeyItemLength > mdx.BlockSize-8 {
+			return nil, fmt.Errorf("tag %s: invalid key item length %d", tag.Name, tag.KeyItemLength)
+		}
+		mdx.Tags = append(mdx.Tags, tag)
+	}
+	return
+}
+
+// Tag returns the tag with the given name, nil if there is none.
+func (mdx *MDXFile) Tag(name string) *MDXTag {
+	for _, t := range mdx.Tags {
+		if strings.EqualFold(t.Name, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+func (mdx *MDXFile) Close() error {
+	return closeReader(mdx.r)
+}
+
+func (t *MDXTag) readPage(ptr int64) (p *btreePage, err error) {
+	raw := make([]byte, t.mdx.BlockSize)
+	if _, err = t.mdx.r.ReadAt(raw, ptr*512); err != nil {
+		return
+	}
+	n := int(L.Uint32(raw))
+	size := int(t.KeyItemLength)
+	if 8+(n+1)*size > len(raw) {
+		return nil, fmt.Errorf("invalid number of keys in page %d: %d", ptr, n)
+	}
+	p = &btreePage{leaf: L.Uint32(raw[8+n*size:]) == 0}
+	for i := 0; i != n; i++ {
+		e := raw[8+i*size:]
+		p.keys = append(p.keys, e[4:4+t.KeyLength])
+		p.ptrs = append(p.ptrs, int64(L.Uint32(e)))
+	}
+	if !p.leaf {
+		p.ptrs = append(p.ptrs, int64(L.Uint32(raw[8+n*size:])))
+	}
+	return
+}
+
+func (t *MDXTag) Lookup(key interface{}) ([]uint32, error) {
+	if t.Descending {
+		return nil, fmt.Errorf("tag %s: descending indexes are not supported", t.Name)
+	}
+	var cmp func([]byte) int
+	switch t.KeyType {
+	case Character:
+		s, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("character index, can't look up: %v", key)
+		}
+		cmp = func(k []byte) int { return compareChar(k, s) }
+	case Number, Date:
+		f, ok := keyNumber(key)
+		if !ok {
+			return nil, fmt.Errorf("numeric index, can't look up: %v", key)
+		}
+		if t.KeyType == Date {
+			cmp = func(k []byte) int { return compareFloat(math.Float64frombits(L.Uint64(k)), f) }
+		} else {
+			cmp = func(k []byte) int { return compareFloat(bcdFloat(k), f) }
+		}
+	default:
+		return nil, fmt.Errorf("tag %s: unsupported key type %c", t.Name, t.KeyType)
+	}
+	return btreeLookup(t.readPage, int64(t.RootPage), cmp)
+}
+
+func (t *MDXTag) Close() error {
+	return t.mdx.Close()
+}
+
+// bcdFloat decodes dBase IV numeric keys: the first byte is 0x34 plus the
+// decimal exponent, bit 7 of the second is the sign, followed by BCD
+// digits of the mantissa 0.ddd...
+func bcdFloat(k []byte) float64 {
+	if len(k) < 2 {
+		return 0
+	}
+	digits := make([]byte, 0, 2*len(k))
+	for _, b := range k[2:] {
+		digits = append(digits, '0'+b>>4, '0'+b&0x0f)
+	}
+	f, err := strconv.ParseFloat(fmt.Sprintf("0.%se%d", digits, int(k[0])-0x34), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	if k[1]&0x80 != 0 {
+		f = -f
+	}
+	return f
+}
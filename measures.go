@@ -0,0 +1,352 @@
+package shapefile
+
+import (
+	"math"
+)
+
+// Planar measures are in the units of the coordinates. The geodesic
+// variants expect longitude/latitude in degrees and return meters and
+// square meters on the WGS84 ellipsoid.
+//
+// Rings nested in an odd number of other rings are holes, their area is
+// subtracted regardless of their orientation.
+
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+)
+
+// holes reports for each ring whether it's a hole. Nesting is decided
+// by the first vertex not on the other ring, as rings may touch.
+func holes(rings [][]Point) []bool {
+	hole := make([]bool, len(rings))
+	for i, ring := range rings {
+		for j, other := range rings {
+			if i != j && ringInside(ring, other) {
+				hole[i] = !hole[i]
+			}
+		}
+	}
+	return hole
+}
+
+// groupRings returns the rings as polygons, each the index of an outer
+// ring followed by those of the holes directly inside it, for formats
+// which, unlike shapefiles, keep polygons apart.
+func groupRings(rings [][]Point) (polygons [][]int) {
+	hole := holes(rings)
+	for i := range rings {
+		if !hole[i] {
+			polygons = append(polygons, []int{i})
+		}
+	}
+	for i, ring := range rings {
+		if !hole[i] {
+			continue
+		}
+		// the smallest outer ring around it
+		in, smallest := -1, math.Inf(1)
+		for j, p := range polygons {
+			a, _ := ringArea(rings[p[0]])
+			if math.Abs(a) < smallest && ringInside(ring, rings[p[0]]) {
+				in, smallest = j, math.Abs(a)
+			}
+		}
+		if in != -1 {
+			polygons[in] = append(polygons[in], i)
+		}
+	}
+	return
+}
+
+func ringInside(ring, other []Point) bool {
+	for _, p := range ring {
+		onBoundary := false
+		for k := 1; k < len(other) && !onBoundary; k++ {
+			onBoundary = onSegment(p, other[k-1], other[k])
+		}
+		if len(other) > 1 && !onBoundary {
+			onBoundary = onSegment(p, other[len(other)-1], other[0])
+		}
+		if !onBoundary {
+			return pointInRings(p.X, p.Y, [][]Point{other})
+		}
+	}
+	return false
+}
+
+// ringArea returns the signed area and the centroid of a ring using the
+// shoelace formula, relative to the first vertex to limit cancellation.
+func ringArea(ring []Point) (area float64, c Point) {
+	if len(ring) < 3 {
+		return
+	}
+	o := ring[0]
+	var cx, cy float64
+	for i := range ring {
+		j := (i + 1) % len(ring)
+		x0, y0 := ring[i].X-o.X, ring[i].Y-o.Y
+		x1, y1 := ring[j].X-o.X, ring[j].Y-o.Y
+		cross := x0*y1 - x1*y0
+		area += cross
+		cx += (x0 + x1) * cross
+		cy += (y0 + y1) * cross
+	}
+	area /= 2
+	if area != 0 {
+		c = Point{o.X + cx/(6*area), o.Y + cy/(6*area)}
+	}
+	return
+}
+
+func polygonArea(rings [][]Point) (area float64) {
+	hole := holes(rings)
+	for i, ring := range rings {
+		a, _ := ringArea(ring)
+		if hole[i] {
+			area -= math.Abs(a)
+		} else {
+			area += math.Abs(a)
+		}
+	}
+	return
+}
+
+func linesLength(parts [][]Point) (length float64) {
+	for _, part := range parts {
+		for i := 1; i < len(part); i++ {
+			length += math.Hypot(part[i].X-part[i-1].X, part[i].Y-part[i-1].Y)
+		}
+	}
+	return
+}
+
+// centroid returns the center of mass of the shape, treating polygons as
+// areas, polylines as lines and multipoints as points. Degenerate shapes
+// fall back to the lower dimension. The centroid of an empty shape is NaN.
+func centroid(parts [][]Point, areal bool) Point {
+	if areal {
+		hole := holes(parts)
+		var sum, cx, cy float64
+		for i, ring := range parts {
+			a, c := ringArea(ring)
+			a = math.Abs(a)
+			if hole[i] {
+				a = -a
+			}
+			sum += a
+			cx += a * c.X
+			cy += a * c.Y
+		}
+		if sum != 0 {
+			return Point{cx / sum, cy / sum}
+		}
+	}
+	var sum, cx, cy float64
+	for _, part := range parts {
+		for i := 1; i < len(part); i++ {
+			l := math.Hypot(part[i].X-part[i-1].X, part[i].Y-part[i-1].Y)
+			sum += l
+			cx += l * (part[i].X + part[i-1].X) / 2
+			cy += l * (part[i].Y + part[i-1].Y) / 2
+		}
+	}
+	if sum != 0 {
+		return Point{cx / sum, cy / sum}
+	}
+	var n float64
+	for _, part := range parts {
+		for _, p := range part {
+			cx += p.X
+			cy += p.Y
+			n++
+		}
+	}
+	return Point{cx / n, cy / n}
+}
+
+// pointOnSurface returns a point guaranteed to lie on the shape: inside
+// polygons, and the vertex closest to the centroid otherwise.
+func pointOnSurface(parts [][]Point, areal bool) Point {
+	if areal {
+		if p, ok := interiorPoint(parts); ok {
+			return p
+		}
+	}
+	c := centroid(parts, false)
+	best, d := Point{math.NaN(), math.NaN()}, math.Inf(1)
+	for _, part := range parts {
+		for _, p := range part {
+			if dp := math.Hypot(p.X-c.X, p.Y-c.Y); dp < d {
+				best, d = p, dp
+			}
+		}
+	}
+	return best
+}
+
+// geodesicLength sums the lengths of the geodesics between the vertices.
+func geodesicLength(parts [][]Point) (length float64) {
+	for _, part := range parts {
+		for i := 1; i < len(part); i++ {
+			length += vincenty(part[i-1], part[i])
+		}
+	}
+	return
+}
+
+// vincenty returns the length of the geodesic between two points on the
+// WGS84 ellipsoid using Vincenty's inverse formula. For nearly antipodal
+// points, where the iteration doesn't converge, the last approximation is
+// used.
+func vincenty(p1, p2 Point) float64 {
+	const b = wgs84A * (1 - wgs84F)
+	L := (p2.X - p1.X) * degree
+	U1 := math.Atan((1 - wgs84F) * math.Tan(p1.Y*degree))
+	U2 := math.Atan((1 - wgs84F) * math.Tan(p2.Y*degree))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	var sinSigma, cosSigma, sigma, cos2Alpha, cos2SigmaM float64
+	for i := 0; i != 200; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma = math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			return 0 // coincident points
+		}
+		cosSigma = sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma = math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha = 1 - sinAlpha*sinAlpha
+		cos2SigmaM = 0
+		if cos2Alpha != 0 { // not on the equator
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha
+		}
+		C := wgs84F / 16 * cos2Alpha * (4 + wgs84F*(4-3*cos2Alpha))
+		prev := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) < 1e-12 {
+			break
+		}
+	}
+	uSq := cos2Alpha * (wgs84A*wgs84A - b*b) / (b * b)
+	A := 1 + uSq/16384*(4096+uSq*(-768+uSq*(320-175*uSq)))
+	B := uSq / 1024 * (256 + uSq*(-128+uSq*(74-47*uSq)))
+	deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+		B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+	return b * A * (sigma - deltaSigma)
+}
+
+// geodesicArea returns the area of the rings on the WGS84 ellipsoid. The
+// rings are mapped to the authalic sphere, which has the same surface
+// area as the ellipsoid, and the spherical excess of each edge is summed
+// up. The edges are taken to be great circles on that sphere, which is
+// indistinguishable from geodesics for edges of usual length.
+func geodesicArea(rings [][]Point) (area float64) {
+	const e2 = wgs84F * (2 - wgs84F)
+	e := math.Sqrt(e2)
+	q := func(lat float64) float64 {
+		s := math.Sin(lat)
+		return (1 - e2) * (s/(1-e2*s*s) - math.Log((1-e*s)/(1+e*s))/(2*e))
+	}
+	qp := q(math.Pi / 2)
+	r2 := wgs84A * wgs84A * qp / 2 // squared radius of the authalic sphere
+	authalic := func(lat float64) float64 {
+		return math.Asin(math.Max(-1, math.Min(1, q(lat*degree)/qp)))
+	}
+
+	hole := holes(rings)
+	for i, ring := range rings {
+		var excess float64
+		for j := range ring {
+			p1, p2 := ring[j], ring[(j+1)%len(ring)]
+			dLon := math.Remainder((p2.X-p1.X)*degree, 2*math.Pi)
+			b1, b2 := authalic(p1.Y), authalic(p2.Y)
+			excess += 2 * math.Atan(math.Tan(dLon/2)*math.Sin((b1+b2)/2)/math.Cos((b1-b2)/2))
+		}
+		a := math.Abs(excess) * r2
+		if hole[i] {
+			area -= a
+		} else {
+			area += a
+		}
+	}
+	return
+}
+
+// Length returns the planar length of the line, summed over all parts.
+// For polygons this is the perimeter.
+func (p *PolyLine) Length() float64 { return linesLength(splitParts(p.Parts, p.Points)) }
+
+// GeodesicLength returns the length of the line in meters, the
+// coordinates being longitude and latitude on WGS84.
+func (p *PolyLine) GeodesicLength() float64 { return geodesicLength(splitParts(p.Parts, p.Points)) }
+
+func (p *PolyLine) Centroid() Point { return centroid(splitParts(p.Parts, p.Points), false) }
+
+// PointOnSurface returns the vertex closest to the centroid.
+func (p *PolyLine) PointOnSurface() Point {
+	return pointOnSurface(splitParts(p.Parts, p.Points), false)
+}
+
+func (p *PolyLineM) Length() float64 { return linesLength(splitParts(p.Parts, p.Points)) }
+
+func (p *PolyLineM) GeodesicLength() float64 { return geodesicLength(splitParts(p.Parts, p.Points)) }
+
+func (p *PolyLineM) Centroid() Point { return centroid(splitParts(p.Parts, p.Points), false) }
+
+func (p *PolyLineM) PointOnSurface() Point {
+	return pointOnSurface(splitParts(p.Parts, p.Points), false)
+}
+
+func (p *PolyLineZ) Length() float64 { return linesLength(splitParts(p.Parts, p.Points)) }
+
+func (p *PolyLineZ) GeodesicLength() float64 { return geodesicLength(splitParts(p.Parts, p.Points)) }
+
+func (p *PolyLineZ) Centroid() Point { return centroid(splitParts(p.Parts, p.Points), false) }
+
+func (p *PolyLineZ) PointOnSurface() Point {
+	return pointOnSurface(splitParts(p.Parts, p.Points), false)
+}
+
+// Area returns the planar area of the polygon, holes excluded.
+func (p *Polygon) Area() float64 { return polygonArea(splitParts(p.Parts, p.Points)) }
+
+// GeodesicArea returns the area in square meters, the coordinates being
+// longitude and latitude on WGS84.
+func (p *Polygon) GeodesicArea() float64 { return geodesicArea(splitParts(p.Parts, p.Points)) }
+
+func (p *Polygon) Perimeter() float64 { return p.Length() }
+
+func (p *Polygon) Centroid() Point { return centroid(splitParts(p.Parts, p.Points), true) }
+
+// PointOnSurface returns a point inside the polygon, unlike the centroid
+// which may lie outside of it or in a hole.
+func (p *Polygon) PointOnSurface() Point { return pointOnSurface(splitParts(p.Parts, p.Points), true) }
+
+func (p *PolygonM) Area() float64 { return polygonArea(splitParts(p.Parts, p.Points)) }
+
+func (p *PolygonM) GeodesicArea() float64 { return geodesicArea(splitParts(p.Parts, p.Points)) }
+
+func (p *PolygonM) Perimeter() float64 { return p.Length() }
+
+func (p *PolygonM) Centroid() Point { return centroid(splitParts(p.Parts, p.Points), true) }
+
+func (p *PolygonM) PointOnSurface() Point { return pointOnSurface(splitParts(p.Parts, p.Points), true) }
+
+func (p *PolygonZ) Area() float64 { return polygonArea(splitParts(p.Parts, p.Points)) }
+
+func (p *PolygonZ) GeodesicArea() float64 { return geodesicArea(splitParts(p.Parts, p.Points)) }
+
+func (p *PolygonZ) Perimeter() float64 { return p.Length() }
+
+func (p *PolygonZ) Centroid() Point { return centroid(splitParts(p.Parts, p.Points), true) }
+
+func (p *PolygonZ) PointOnSurface() Point { return pointOnSurface(splitParts(p.Parts, p.Points), true) }
+
+func (mp *MultiPoint) Centroid() Point { return centroid(partsOf(mp)) }
+
+func (mp *MultiPointM) Centroid() Point { return centroid(partsOf(mp)) }
+
+func (mp *MultiPointZ) Centroid() Point { return centroid(partsOf(mp)) }
@@ -0,0 +1,84 @@
+package shapefile
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPlanarMeasures(t *testing.T) {
+	// the hole is oriented like the outer ring, it's detected by nesting
+	holed := polygon(square(0, 0, 10, 10), square(4, 4, 6, 6))
+	if a := holed.Area(); a != 96 {
+		t.Errorf("unexpected area: %v", a)
+	}
+	if l := holed.Perimeter(); l != 48 {
+		t.Errorf("unexpected perimeter: %v", l)
+	}
+	if c := holed.Centroid(); c != (Point{5, 5}) {
+		t.Errorf("unexpected centroid: %v", c)
+	}
+	if p := holed.PointOnSurface(); !Contains(holed, &p) {
+		t.Errorf("point on surface not inside: %v", p)
+	}
+
+	// U shape, the centroid lies outside
+	u := polygon([]Point{{0, 0}, {0, 3}, {1, 3}, {1, 1}, {2, 1}, {2, 3}, {3, 3}, {3, 0}, {0, 0}})
+	if a := u.Area(); a != 7 {
+		t.Errorf("unexpected area: %v", a)
+	}
+	if c := u.Centroid(); math.Abs(c.X-1.5) > 1e-12 || math.Abs(c.Y-9.5/7) > 1e-12 {
+		t.Errorf("unexpected centroid: %v", c)
+	}
+	if p := u.PointOnSurface(); !Contains(u, &p) {
+		t.Errorf("point on surface not inside: %v", p)
+	}
+
+	line := polyline(Point{0, 0}, Point{3, 4}, Point{3, 10})
+	if l := line.Length(); l != 11 {
+		t.Errorf("unexpected length: %v", l)
+	}
+	if c := line.Centroid(); math.Abs(c.X-(5*1.5+6*3)/11) > 1e-12 || math.Abs(c.Y-(5*2+6*7)/11.0) > 1e-12 {
+		t.Errorf("unexpected centroid: %v", c)
+	}
+	if p := line.PointOnSurface(); p != (Point{3, 4}) {
+		t.Errorf("unexpected point on surface: %v", p)
+	}
+
+	mp := &MultiPoint{Points: []Point{{0, 0}, {2, 0}, {1, 3}}}
+	if c := mp.Centroid(); c != (Point{1, 1}) {
+		t.Errorf("unexpected centroid: %v", c)
+	}
+}
+
+func TestGeodesicMeasures(t *testing.T) {
+	// Flinders Peak to Buninyong, the example from Vincenty's paper
+	flinders := Point{144 + 25/60.0 + 29.52440/3600, -(37 + 57/60.0 + 3.72030/3600)}
+	buninyong := Point{143 + 55/60.0 + 35.38390/3600, -(37 + 39/60.0 + 10.15610/3600)}
+	if d := polyline(flinders, buninyong).GeodesicLength(); math.Abs(d-54972.271) > 0.001 {
+		t.Errorf("unexpected length: %v", d)
+	}
+
+	// one degree cell at the equator
+	cell := polygon(square(0, 0, 1, 1))
+	if a := cell.GeodesicArea(); math.Abs(a/12308778361.469-1) > 1e-4 {
+		t.Errorf("unexpected area: %v", a)
+	}
+	if a := polygon(square(0, 0, 1, 1), square(0.25, 0.25, 0.75, 0.75)).GeodesicArea(); math.Abs(a/(0.75*12308778361.469)-1) > 1e-3 {
+		t.Errorf("unexpected area with hole: %v", a)
+	}
+}
+
+func TestWahlkreisArea(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	area := 0.0
+	for _, f := range ds.Features() {
+		area += f.Record.Content.(*Polygon).Area()
+	}
+	// Germany has about 357,600 km²
+	if km2 := area / 1e6; km2 < 355000 || km2 > 360000 {
+		t.Errorf("unexpected area: %v km²", km2)
+	}
+}
@@ -0,0 +1,538 @@
+package shapefile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Mesh is an indexed triangle mesh. The triangles are wound counter
+// clockwise seen from the front, as expected by OBJ and glTF.
+type Mesh struct {
+	Vertices  [][3]float64 // X, Y, Z
+	Triangles [][3]uint32  // indices into Vertices
+}
+
+// Triangulate converts all parts of the MultiPatch into triangles. The
+// vertices of the mesh are the points of the MultiPatch. Rings are
+// triangulated by ear clipping after projecting them onto their plane,
+// inner rings following an outer ring and rings following a first ring
+// are holes. The front of a ring is the side it appears clockwise from.
+func (mp *MultiPatch) Triangulate() *Mesh {
+	m := &Mesh{Vertices: make([][3]float64, len(mp.Points))}
+	for i, p := range mp.Points {
+		m.Vertices[i] = [3]float64{p.X, p.Y, 0}
+		if len(mp.ZArray) == len(mp.Points) {
+			m.Vertices[i][2] = mp.ZArray[i]
+		}
+	}
+	part := func(i int) (idx []uint32) {
+		end := int32(len(mp.Points))
+		if i+1 < len(mp.Parts) {
+			end = mp.Parts[i+1]
+		}
+		if mp.Parts[i] < 0 || mp.Parts[i] > end || end > int32(len(mp.Points)) {
+			return nil
+		}
+		for j := mp.Parts[i]; j < end; j++ {
+			idx = append(idx, uint32(j))
+		}
+		return
+	}
+	typeOf := func(i int) PartType {
+		if i < len(mp.PartTypes) {
+			return mp.PartTypes[i]
+		}
+		return RING
+	}
+	for i := 0; i < len(mp.Parts); i++ {
+		idx := part(i)
+		switch typeOf(i) {
+		case TRIANGLE_STRIP:
+			for j := 0; j+2 < len(idx); j++ {
+				if j%2 == 0 {
+					m.add(idx[j], idx[j+1], idx[j+2])
+				} else {
+					m.add(idx[j+1], idx[j], idx[j+2])
+				}
+			}
+		case TRIANGLE_FAN:
+			for j := 1; j+1 < len(idx); j++ {
+				m.add(idx[0], idx[j], idx[j+1])
+			}
+		case OUTER_RING, FIRST_RING, RING, INNER_RING:
+			// a lone ring or inner ring has no holes
+			follower := PartType(-1)
+			switch typeOf(i) {
+			case OUTER_RING:
+				follower = INNER_RING
+			case FIRST_RING:
+				follower = RING
+			}
+			rings := [][]uint32{idx}
+			for i+1 < len(mp.Parts) && typeOf(i+1) == follower {
+				i++
+				rings = append(rings, part(i))
+			}
+			m.addRings(rings)
+		}
+	}
+	return m
+}
+
+func (m *Mesh) add(a, b, c uint32) {
+	if a != b && b != c && a != c {
+		m.Triangles = append(m.Triangles, [3]uint32{a, b, c})
+	}
+}
+
+func (m *Mesh) sub(a, b uint32) [3]float64 {
+	va, vb := m.Vertices[a], m.Vertices[b]
+	return [3]float64{va[0] - vb[0], va[1] - vb[1], va[2] - vb[2]}
+}
+
+func cross3(a, b [3]float64) [3]float64 {
+	return [3]float64{a[1]*b[2] - a[2]*b[1], a[2]*b[0] - a[0]*b[2], a[0]*b[1] - a[1]*b[0]}
+}
+
+func dot3(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+// addRings triangulates an outer ring with holes.
+func (m *Mesh) addRings(rings [][]uint32) {
+	for i, r := range rings {
+		// drop the closing vertex
+		if len(r) > 1 && m.Vertices[r[0]] == m.Vertices[r[len(r)-1]] {
+			rings[i] = r[:len(r)-1]
+		}
+	}
+	if len(rings[0]) < 3 {
+		return
+	}
+	// Newell's normal, it points to the side the outer ring appears
+	// counter clockwise from, i.e. to the back
+	var n [3]float64
+	outer := rings[0]
+	for i := range outer {
+		a, b := m.Vertices[outer[i]], m.Vertices[outer[(i+1)%len(outer)]]
+		n[0] += (a[1] - b[1]) * (a[2] + b[2])
+		n[1] += (a[2] - b[2]) * (a[0] + b[0])
+		n[2] += (a[0] - b[0]) * (a[1] + b[1])
+	}
+	// project onto the plane of the largest component
+	ax, ay := 0, 1
+	switch {
+	case math.Abs(n[0]) >= math.Abs(n[1]) && math.Abs(n[0]) >= math.Abs(n[2]):
+		ax, ay = 1, 2
+	case math.Abs(n[1]) >= math.Abs(n[2]):
+		ax, ay = 2, 0
+	}
+	pt := func(i uint32) Point { return Point{m.Vertices[i][ax], m.Vertices[i][ay]} }
+	area := func(r []uint32) (a float64) {
+		for i := range r {
+			p, q := pt(r[i]), pt(r[(i+1)%len(r)])
+			a += p.X*q.Y - q.X*p.Y
+		}
+		return
+	}
+	// outer ring counter clockwise and holes clockwise in the projection
+	orient := func(r []uint32, ccw bool) []uint32 {
+		if (area(r) > 0) != ccw {
+			rev := make([]uint32, len(r))
+			for i, v := range r {
+				rev[len(r)-1-i] = v
+			}
+			return rev
+		}
+		return r
+	}
+	poly := orient(outer, true)
+	var holes [][]uint32
+	for _, h := range rings[1:] {
+		if len(h) >= 3 {
+			holes = append(holes, orient(h, false))
+		}
+	}
+	// holes further right first, so they can be bridged to
+	maxX := func(r []uint32) (x float64) {
+		x = math.Inf(-1)
+		for _, v := range r {
+			x = math.Max(x, pt(v).X)
+		}
+		return
+	}
+	sort.SliceStable(holes, func(i, j int) bool { return maxX(holes[i]) > maxX(holes[j]) })
+	for i, h := range holes {
+		poly = bridgeHole(poly, h, holes[i+1:], pt)
+	}
+	for _, t := range earClip(poly, pt) {
+		// face away from the normal
+		if dot3(cross3(m.sub(t[1], t[0]), m.sub(t[2], t[0])), n) > 0 {
+			t[1], t[2] = t[2], t[1]
+		}
+		m.add(t[0], t[1], t[2])
+	}
+}
+
+// bridgeHole merges the hole into the polygon by connecting the hole's
+// rightmost vertex to the closest visible vertex of the polygon right of
+// it, so the bridge can't pass through the hole. Bridges must not cross
+// the holes still to be merged either.
+func bridgeHole(poly, hole []uint32, others [][]uint32, pt func(uint32) Point) []uint32 {
+	hi := 0
+	for i, v := range hole {
+		if pt(v).X > pt(hole[hi]).X {
+			hi = i
+		}
+	}
+	h := pt(hole[hi])
+	blocked := func(a, b Point, ring []uint32) bool {
+		for i := range ring {
+			p, q := pt(ring[i]), pt(ring[(i+1)%len(ring)])
+			if p != a && p != b && segmentDistance(p.X, p.Y, a, b) == 0 {
+				return true // passes through a vertex
+			}
+			if p != a && q != a && p != b && q != b && segmentsCross(a, b, p, q) {
+				return true
+			}
+		}
+		return false
+	}
+	best, bestDist := -1, math.Inf(1)
+	for i, v := range poly {
+		p := pt(v)
+		d := math.Hypot(p.X-h.X, p.Y-h.Y)
+		if p.X < h.X || d >= bestDist || !locallyInside(poly, i, h, pt) || blocked(h, p, poly) || blocked(h, p, hole) {
+			continue
+		}
+		free := true
+		for _, o := range others {
+			free = free && !blocked(h, p, o)
+		}
+		if free {
+			best, bestDist = i, d
+		}
+	}
+	if best == -1 {
+		return poly
+	}
+	merged := append([]uint32{}, poly[:best+1]...)
+	for i := 0; i <= len(hole); i++ {
+		merged = append(merged, hole[(hi+i)%len(hole)])
+	}
+	merged = append(merged, poly[best])
+	return append(merged, poly[best+1:]...)
+}
+
+// locallyInside reports whether the direction from the i-th vertex of
+// the counter clockwise polygon towards p points into the polygon. This
+// picks the right copy of vertices the polygon passes several times.
+func locallyInside(poly []uint32, i int, p Point, pt func(uint32) Point) bool {
+	v := pt(poly[i])
+	prev, next := pt(poly[(i+len(poly)-1)%len(poly)]), pt(poly[(i+1)%len(poly)])
+	cross := func(a, b Point) float64 {
+		return (a.X-v.X)*(b.Y-v.Y) - (a.Y-v.Y)*(b.X-v.X)
+	}
+	if cross(next, prev) >= 0 {
+		return cross(next, p) > 0 && cross(p, prev) > 0
+	}
+	return cross(next, p) > 0 || cross(p, prev) > 0
+}
+
+// segmentsCross reports whether the segments cross at a point inside
+// both of them.
+func segmentsCross(a1, a2, b1, b2 Point) bool {
+	side := func(p, q, r Point) float64 {
+		return (q.X-p.X)*(r.Y-p.Y) - (q.Y-p.Y)*(r.X-p.X)
+	}
+	d1, d2 := side(b1, b2, a1), side(b1, b2, a2)
+	d3, d4 := side(a1, a2, b1), side(a1, a2, b2)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// earClip triangulates a counter clockwise polygon, which may touch
+// itself at the bridges to holes.
+func earClip(poly []uint32, pt func(uint32) Point) (tris [][3]uint32) {
+	cross := func(a, b, c Point) float64 {
+		return (b.X-a.X)*(c.Y-a.Y) - (b.Y-a.Y)*(c.X-a.X)
+	}
+	inside := func(p, a, b, c Point) bool {
+		return cross(a, b, p) >= 0 && cross(b, c, p) >= 0 && cross(c, a, p) >= 0
+	}
+	idx := append([]uint32{}, poly...)
+	for len(idx) > 3 {
+		clipped := false
+		for i := range idx {
+			prev, cur, next := idx[(i+len(idx)-1)%len(idx)], idx[i], idx[(i+1)%len(idx)]
+			a, b, c := pt(prev), pt(cur), pt(next)
+			if cross(a, b, c) <= 0 {
+				continue // reflex or degenerate
+			}
+			ear := true
+			for j, v := range idx {
+				// a diagonal crossing an edge happens at vertices shared
+				// by bridges whose other copy leads through the ear
+				p, q := pt(v), pt(idx[(j+1)%len(idx)])
+				if (p != a && p != b && p != c && inside(p, a, b, c)) || segmentsCross(a, c, p, q) {
+					ear = false
+					break
+				}
+			}
+			if ear {
+				tris = append(tris, [3]uint32{prev, cur, next})
+				idx = append(idx[:i], idx[i+1:]...)
+				clipped = true
+				break
+			}
+		}
+		if !clipped {
+			// degenerate input, drop a collinear vertex or give up
+			for i := range idx {
+				a, b, c := pt(idx[(i+len(idx)-1)%len(idx)]), pt(idx[i]), pt(idx[(i+1)%len(idx)])
+				if cross(a, b, c) == 0 {
+					idx = append(idx[:i], idx[i+1:]...)
+					clipped = true
+					break
+				}
+			}
+			if !clipped {
+				return
+			}
+		}
+	}
+	if len(idx) == 3 && cross(pt(idx[0]), pt(idx[1]), pt(idx[2])) > 0 {
+		tris = append(tris, [3]uint32{idx[0], idx[1], idx[2]})
+	}
+	return
+}
+
+// datasetMeshes triangulates the MultiPatch features of ds, leaving out
+// deleted and empty ones, and returns the center of their bounding box.
+func datasetMeshes(ds *Dataset) (meshes []*Mesh, names []string, center [3]float64, err error) {
+	if ds.Shapefile.Header.ShapeType != MULTI_PATCH {
+		return nil, nil, center, fmt.Errorf("can't export %s shapes as a mesh", ds.Shapefile.Header.ShapeType)
+	}
+	min := [3]float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	max := [3]float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, f := range ds.Features() {
+		mp, ok := f.Record.Content.(*MultiPatch)
+		if !ok || f.Deleted {
+			continue
+		}
+		m := mp.Triangulate()
+		if len(m.Triangles) == 0 {
+			continue
+		}
+		for _, v := range m.Vertices {
+			for i := range v {
+				min[i], max[i] = math.Min(min[i], v[i]), math.Max(max[i], v[i])
+			}
+		}
+		meshes = append(meshes, m)
+		names = append(names, strconv.Itoa(int(f.Record.Header.RecordNumber)))
+	}
+	if len(meshes) > 0 {
+		for i := range center {
+			center[i] = (min[i] + max[i]) / 2
+		}
+	}
+	return
+}
+
+// yUp converts a vertex relative to the center into the Y up coordinates
+// used by OBJ and glTF, with north pointing to -Z.
+func yUp(v, center [3]float64) [3]float64 {
+	return [3]float64{v[0] - center[0], v[2] - center[2], -(v[1] - center[1])}
+}
+
+// WriteOBJ writes the MultiPatch features of ds as Wavefront OBJ, one
+// object named after the record number per feature. Coordinates are Y up
+// and relative to the center of the data, which is noted in a comment,
+// as real world coordinates are too large for most viewers.
+func WriteOBJ(w io.Writer, ds *Dataset) (err error) {
+	var meshes []*Mesh
+	var names []string
+	var center [3]float64
+	if meshes, names, center, err = datasetMeshes(ds); err != nil {
+		return
+	}
+	bw := bufio.NewWriter(w)
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	fmt.Fprintf(bw, "# origin %s %s %s\n", f(center[0]), f(center[1]), f(center[2]))
+	offset := 1
+	for i, m := range meshes {
+		fmt.Fprintf(bw, "o %s\n", names[i])
+		for _, v := range m.Vertices {
+			v = yUp(v, center)
+			fmt.Fprintf(bw, "v %s %s %s\n", f(v[0]), f(v[1]), f(v[2]))
+		}
+		for _, t := range m.Triangles {
+			fmt.Fprintf(bw, "f %d %d %d\n", int(t[0])+offset, int(t[1])+offset, int(t[2])+offset)
+		}
+		offset += len(m.Vertices)
+	}
+	return bw.Flush()
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfNode struct {
+	Name        string    `json:"name,omitempty"`
+	Mesh        *int      `json:"mesh,omitempty"`
+	Children    []int     `json:"children,omitempty"`
+	Translation []float64 `json:"translation,omitempty"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Mode       int            `json:"mode"`
+}
+
+type gltfMesh struct {
+	Name       string          `json:"name,omitempty"`
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfBuffer struct {
+	ByteLength int `json:"byteLength"`
+}
+
+type gltfDocument struct {
+	Asset struct {
+		Version   string `json:"version"`
+		Generator string `json:"generator,omitempty"`
+	} `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes"`
+	Meshes      []gltfMesh       `json:"meshes,omitempty"`
+	Accessors   []gltfAccessor   `json:"accessors,omitempty"`
+	BufferViews []gltfBufferView `json:"bufferViews,omitempty"`
+	Buffers     []gltfBuffer     `json:"buffers,omitempty"`
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+const (
+	glbMagic     = 0x46546c67 // glTF
+	glbChunkJSON = 0x4e4f534a
+	glbChunkBIN  = 0x004e4942
+
+	gltfFloat         = 5126
+	gltfUnsignedInt   = 5125
+	gltfArrayBuffer   = 34962
+	gltfElementBuffer = 34963
+	gltfTriangles     = 4
+)
+
+// WriteGLB writes the MultiPatch features of ds as binary glTF 2.0, one
+// mesh and node named after the record number per feature. Positions are
+// stored as 32 bit floats relative to the center of the data, which is
+// the translation of the root node, and converted to glTF's Y up.
+func WriteGLB(w io.Writer, ds *Dataset) (err error) {
+	var meshes []*Mesh
+	var names []string
+	var center [3]float64
+	if meshes, names, center, err = datasetMeshes(ds); err != nil {
+		return
+	}
+	var doc gltfDocument
+	doc.Asset.Version = "2.0"
+	doc.Asset.Generator = "github.com/a2800276/shapefile"
+	doc.Scenes = []gltfScene{{Nodes: []int{0}}}
+	origin := yUp(center, [3]float64{})
+	doc.Nodes = []gltfNode{{Translation: origin[:]}}
+
+	var bin bytes.Buffer
+	view := func(data interface{}, target int) int {
+		doc.BufferViews = append(doc.BufferViews, gltfBufferView{0, bin.Len(), binary.Size(data), target})
+		binary.Write(&bin, L, data)
+		return len(doc.BufferViews) - 1
+	}
+	for i, m := range meshes {
+		pos := make([][3]float32, len(m.Vertices))
+		min := []float32{float32(math.Inf(1)), float32(math.Inf(1)), float32(math.Inf(1))}
+		max := []float32{float32(math.Inf(-1)), float32(math.Inf(-1)), float32(math.Inf(-1))}
+		for j, v := range m.Vertices {
+			v = yUp(v, center)
+			for k := range v {
+				pos[j][k] = float32(v[k])
+				if pos[j][k] < min[k] {
+					min[k] = pos[j][k]
+				}
+				if pos[j][k] > max[k] {
+					max[k] = pos[j][k]
+				}
+			}
+		}
+		doc.Accessors = append(doc.Accessors,
+			gltfAccessor{view(pos, gltfArrayBuffer), gltfFloat, len(pos), "VEC3", min, max},
+			gltfAccessor{view(m.Triangles, gltfElementBuffer), gltfUnsignedInt, 3 * len(m.Triangles), "SCALAR", nil, nil},
+		)
+		mesh := len(doc.Meshes)
+		doc.Meshes = append(doc.Meshes, gltfMesh{names[i], []gltfPrimitive{{
+			Attributes: map[string]int{"POSITION": len(doc.Accessors) - 2},
+			Indices:    len(doc.Accessors) - 1,
+			Mode:       gltfTriangles,
+		}}})
+		doc.Nodes[0].Children = append(doc.Nodes[0].Children, len(doc.Nodes))
+		doc.Nodes = append(doc.Nodes, gltfNode{Name: names[i], Mesh: &mesh})
+	}
+	if bin.Len() > 0 {
+		doc.Buffers = []gltfBuffer{{bin.Len()}}
+	}
+
+	var js []byte
+	if js, err = json.Marshal(doc); err != nil {
+		return
+	}
+	// chunks are 4 byte aligned, JSON padded with spaces
+	for len(js)%4 != 0 {
+		js = append(js, ' ')
+	}
+	for bin.Len()%4 != 0 {
+		bin.WriteByte(0)
+	}
+	length := 12 + 8 + len(js)
+	if bin.Len() > 0 {
+		length += 8 + bin.Len()
+	}
+	if err = binary.Write(w, L, [3]uint32{glbMagic, 2, uint32(length)}); err != nil {
+		return
+	}
+	if err = binary.Write(w, L, [2]uint32{uint32(len(js)), glbChunkJSON}); err != nil {
+		return
+	}
+	if _, err = w.Write(js); err != nil || bin.Len() == 0 {
+		return
+	}
+	if err = binary.Write(w, L, [2]uint32{uint32(bin.Len()), glbChunkBIN}); err != nil {
+		return
+	}
+	_, err = w.Write(bin.Bytes())
+	return
+}
@@ -0,0 +1,222 @@
+package shapefile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// house returns a 10x6 building 3 high with strip walls, a fan roof with
+// its ridge 2 higher and a floor around a 2x2 courtyard.
+func house() *MultiPatch {
+	mp := &MultiPatch{}
+	add := func(typ PartType, pts ...[3]float64) {
+		mp.Parts = append(mp.Parts, int32(len(mp.Points)))
+		mp.PartTypes = append(mp.PartTypes, typ)
+		for _, p := range pts {
+			mp.Points = append(mp.Points, Point{p[0], p[1]})
+			mp.ZArray = append(mp.ZArray, p[2])
+		}
+	}
+	var walls [][3]float64
+	for _, p := range square(0, 0, 10, 6) {
+		walls = append(walls, [3]float64{p.X, p.Y, 0}, [3]float64{p.X, p.Y, 3})
+	}
+	add(TRIANGLE_STRIP, walls...)
+	roof := [][3]float64{{5, 3, 5}}
+	for _, p := range square(0, 0, 10, 6) {
+		roof = append(roof, [3]float64{p.X, p.Y, 3})
+	}
+	add(TRIANGLE_FAN, roof...)
+	flat := func(pts []Point) (r [][3]float64) {
+		for _, p := range pts {
+			r = append(r, [3]float64{p.X, p.Y, 0})
+		}
+		return
+	}
+	add(OUTER_RING, flat(square(0, 0, 10, 6))...)
+	add(INNER_RING, flat(square(4, 2, 6, 4))...)
+	updateBox(mp)
+	mp.ZRange = ZRange{0, 5}
+	return mp
+}
+
+// normal returns the unnormalized normal of the triangle, its length is
+// twice the area.
+func (m *Mesh) normal(t [3]uint32) [3]float64 {
+	return cross3(m.sub(t[1], t[0]), m.sub(t[2], t[0]))
+}
+
+func TestTriangulate(t *testing.T) {
+	m := house().Triangulate()
+	if len(m.Triangles) != 8+4+8 {
+		t.Fatalf("expected 20 triangles, got %d", len(m.Triangles))
+	}
+	var walls, roof, floor float64
+	for _, tri := range m.Triangles {
+		n := m.normal(tri)
+		a := math.Sqrt(dot3(n, n)) / 2
+		switch {
+		case tri[0] < 10:
+			walls += a
+		case tri[0] < 16:
+			roof += a
+		default:
+			floor += a
+			if n[2] <= 0 {
+				t.Errorf("floor triangle %v not facing the side the ring is clockwise from", tri)
+			}
+		}
+	}
+	check := func(name string, got, expected float64) {
+		if math.Abs(got-expected) > 1e-9 {
+			t.Errorf("%s area %v, expected %v", name, got, expected)
+		}
+	}
+	check("walls", walls, 32*3)
+	check("roof", roof, 10*math.Sqrt(13)+6*math.Sqrt(29))
+	check("floor", floor, 60-4)
+
+	// rings following a first ring are holes as well, a lone ring is not
+	mp := &MultiPatch{Parts: []int32{0, 5, 10}, PartTypes: []PartType{FIRST_RING, RING, RING}}
+	mp.Points = append(append(append(mp.Points, square(0, 0, 10, 10)...), square(1, 1, 2, 2)...), square(3, 3, 4, 4)...)
+	m = mp.Triangulate()
+	var area float64
+	for _, tri := range m.Triangles {
+		n := m.normal(tri)
+		area += n[2] / 2
+	}
+	if area != 98 {
+		t.Errorf("expected an area of 98, got %v", area)
+	}
+	mp.PartTypes = []PartType{RING, RING, RING}
+	if m = mp.Triangulate(); len(m.Triangles) != 6 {
+		t.Errorf("expected 3 separate squares, got %d triangles", len(m.Triangles))
+	}
+
+	// many holes bridged to the same vertices
+	grid := &MultiPatch{Parts: []int32{0}, PartTypes: []PartType{OUTER_RING}, Points: square(0, 0, 16, 16)}
+	for i := 0.0; i < 5; i++ {
+		for j := 0.0; j < 5; j++ {
+			grid.Parts = append(grid.Parts, int32(len(grid.Points)))
+			grid.PartTypes = append(grid.PartTypes, INNER_RING)
+			x, y := 3*i+1+i/8, 3*j+1+j/5
+			grid.Points = append(grid.Points, square(x, y, x+2, y+2)...)
+		}
+	}
+	m = grid.Triangulate()
+	area = 0
+	for _, tri := range m.Triangles {
+		area += m.normal(tri)[2] / 2
+	}
+	if math.Abs(area-(256-25*4)) > 1e-9 {
+		t.Errorf("expected an area of 156 around the holes, got %v", area)
+	}
+
+	// concave rings are cut into ears
+	l := &MultiPatch{Parts: []int32{0}, PartTypes: []PartType{RING}, Points: []Point{{0, 0}, {0, 2}, {1, 2}, {1, 1}, {2, 1}, {2, 0}, {0, 0}}}
+	m = l.Triangulate()
+	area = 0
+	for _, tri := range m.Triangles {
+		area += m.normal(tri)[2] / 2
+	}
+	if len(m.Triangles) != 4 || area != 3 {
+		t.Errorf("unexpected triangulation of an L: %v", m.Triangles)
+	}
+}
+
+func TestMultiPatchRoundTrip(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "house.shp")
+	ds := NewDataset(MULTI_PATCH, nil, nil)
+	if err := ds.Add(house(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := ds.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	copied, err := OpenDataset(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := copied.Shapefile.Records[0].Content.(*MultiPatch)
+	if !reflect.DeepEqual(mp, house()) {
+		t.Errorf("unexpected multipatch read back: %v", mp)
+	}
+}
+
+func TestMeshExport(t *testing.T) {
+	ds := NewDataset(MULTI_PATCH, nil, nil)
+	ds.Add(house(), nil)
+	h := house()
+	for i := range h.Points {
+		h.Points[i].X += 20
+	}
+	updateBox(h)
+	ds.Add(h, nil)
+
+	var obj bytes.Buffer
+	if err := WriteOBJ(&obj, ds); err != nil {
+		t.Fatal(err)
+	}
+	var objects, vertices, faces int
+	scanner := bufio.NewScanner(&obj)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch fields[0] {
+		case "#":
+			if strings.Join(fields, " ") != "# origin 15 3 2.5" {
+				t.Errorf("unexpected origin: %v", fields)
+			}
+		case "o":
+			objects++
+		case "v":
+			vertices++
+			if vertices == 1 && strings.Join(fields, " ") != "v -15 -2.5 3" {
+				t.Errorf("unexpected first vertex: %v", fields)
+			}
+		case "f":
+			faces++
+		}
+	}
+	if objects != 2 || vertices != 2*26 || faces != 2*20 {
+		t.Errorf("unexpected OBJ: %d objects, %d vertices, %d faces", objects, vertices, faces)
+	}
+
+	var glb bytes.Buffer
+	if err := WriteGLB(&glb, ds); err != nil {
+		t.Fatal(err)
+	}
+	raw := glb.Bytes()
+	var header [5]uint32
+	binary.Read(bytes.NewReader(raw), L, &header)
+	if header[0] != glbMagic || header[1] != 2 || int(header[2]) != len(raw) || header[4] != glbChunkJSON {
+		t.Fatalf("unexpected GLB header: %x", header)
+	}
+	var doc gltfDocument
+	if err := json.Unmarshal(raw[20:20+header[3]], &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Asset.Version != "2.0" || len(doc.Meshes) != 2 || len(doc.Nodes) != 3 || len(doc.Accessors) != 4 {
+		t.Errorf("unexpected glTF document: %+v", doc)
+	}
+	if !reflect.DeepEqual(doc.Nodes[0].Translation, []float64{15, 2.5, -3}) {
+		t.Errorf("unexpected origin: %v", doc.Nodes[0].Translation)
+	}
+	if doc.Accessors[1].Count != 3*20 || doc.Accessors[0].Max[1] != 2.5 {
+		t.Errorf("unexpected accessors: %+v", doc.Accessors[:2])
+	}
+	bin := raw[20+header[3]:]
+	if n := binary.LittleEndian.Uint32(bin); int(n) != doc.Buffers[0].ByteLength || n%4 != 0 || int(n)+8 != len(bin) {
+		t.Errorf("unexpected BIN chunk length %d", n)
+	}
+
+	if err := WriteOBJ(&obj, NewDataset(POLYGON, nil, nil)); err == nil {
+		t.Errorf("expected exporting polygons to fail")
+	}
+}
@@ -0,0 +1,578 @@
+package shapefile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Mapbox Vector Tiles, version 2 of the specification:
+// https://github.com/mapbox/vector-tile-spec/tree/master/2.1
+// Shapes are projected to Web Mercator, clipped to each tile plus a
+// buffer and quantized to the tile's grid. The protobuf messages are few
+// and simple enough to be encoded by hand.
+
+// webMercatorMax is half the width of the Web Mercator world in meters,
+// which is square, so tiles are square, too.
+const webMercatorMax = 20037508.342789244
+
+// TileOptions control NewTiler and WriteTiles.
+type TileOptions struct {
+	MinZoom, MaxZoom int
+	Layer            string   // name of the layer, the base name of the file or features if empty
+	Fields           []string // attributes to include as properties, all if nil
+	Extent           int      // tile units per side, 4096 if 0
+	Buffer           int      // tile units kept around each tile, 64 if 0, negative for none
+	// Tolerance in tile units to simplify shapes to at each zoom level,
+	// borders shared by features are simplified identically. 0 keeps all
+	// vertices but those that end up on the same grid point.
+	Tolerance float64
+	// TMS numbers rows from the south, as the tile_row of MBTiles does,
+	// instead of from the north.
+	TMS  bool
+	Gzip bool // compress tiles, as tile servers and MBTiles expect
+}
+
+// Tiler cuts a dataset into vector tiles.
+type Tiler struct {
+	opts     TileOptions
+	features []*Feature
+	shapes   []RecordContent // in Web Mercator
+	fields   []int
+	names    []string
+	types    []string // of the fields, as TileJSON has them
+	index    *RTree
+	extent   Box // of all shapes, in Web Mercator
+
+	mu     sync.Mutex
+	zoomed map[int][]RecordContent // simplified shapes by zoom level
+}
+
+// NewTiler projects the features of ds to Web Mercator, which needs the
+// CRS of ds to be known.
+func NewTiler(ds *Dataset, opts TileOptions) (t *Tiler, err error) {
+	if opts.MinZoom < 0 || opts.MaxZoom < opts.MinZoom || opts.MaxZoom > 24 {
+		return nil, fmt.Errorf("invalid zoom range %d-%d", opts.MinZoom, opts.MaxZoom)
+	}
+	if opts.Extent <= 0 {
+		opts.Extent = 4096
+	}
+	if opts.Buffer == 0 {
+		opts.Buffer = 64
+	} else if opts.Buffer < 0 {
+		opts.Buffer = 0
+	}
+	if opts.Layer == "" && ds.base != "" {
+		opts.Layer = filepath.Base(ds.base)
+	} else if opts.Layer == "" {
+		opts.Layer = "features"
+	}
+	var merc *CRS
+	if merc, err = CRSFromEPSG(3857); err != nil {
+		return
+	}
+	var tr *Transformer
+	if tr, err = NewTransformer(ds.CRS, merc); err != nil {
+		return
+	}
+	t = &Tiler{opts: opts, zoomed: map[int][]RecordContent{}}
+	if ds.DBF != nil {
+		add := func(col int) {
+			fd := ds.DBF.FieldDescriptors[col]
+			typ := "Number"
+			switch fd.FieldType {
+			case Character, Date:
+				typ = "String"
+			case Logical:
+				typ = "Boolean"
+			}
+			t.fields = append(t.fields, col)
+			t.names = append(t.names, fd.FieldName())
+			t.types = append(t.types, typ)
+		}
+		if opts.Fields == nil {
+			for i := range ds.DBF.FieldDescriptors {
+				add(i)
+			}
+		}
+		for _, name := range opts.Fields {
+			col := ds.DBF.fieldIndex(name)
+			if col == -1 {
+				return nil, fmt.Errorf("no such field: %s", name)
+			}
+			add(col)
+		}
+	} else if len(opts.Fields) > 0 {
+		return nil, fmt.Errorf("dataset has no attributes")
+	}
+
+	// Web Mercator ends at about 85.05°, beyond that y grows to infinity
+	maxLat := math.Atan(math.Sinh(math.Pi)) / degree
+	geographic := ds.CRS.IsGeographic()
+	var boxes []Box
+	t.extent = Box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, f := range ds.Features() {
+		if f.Deleted {
+			continue
+		}
+		parts, areal := partsOf(f.Record.Content)
+		projected := make([][]Point, len(parts))
+		for i, part := range parts {
+			projected[i] = make([]Point, len(part))
+			for j, p := range part {
+				if geographic {
+					p.Y = math.Max(-maxLat, math.Min(maxLat, p.Y))
+				}
+				if p.X, p.Y, err = tr.Point(p.X, p.Y); err != nil {
+					return nil, err
+				}
+				projected[i][j] = p
+			}
+		}
+		shape := shapeOfParts(projected, areal)
+		b, ok := boxOf(shape)
+		if !ok {
+			continue
+		}
+		t.features = append(t.features, f)
+		t.shapes = append(t.shapes, shape)
+		boxes = append(boxes, b)
+		t.extent = t.extent.union(b)
+	}
+	t.index = NewRTree(boxes)
+	return
+}
+
+// shapeOfParts returns a Polygon, PolyLine or, if all parts are single
+// points, a MultiPoint.
+func shapeOfParts(parts [][]Point, areal bool) RecordContent {
+	if areal {
+		return polygonOf(parts)
+	}
+	points := true
+	for _, part := range parts {
+		points = points && len(part) == 1
+	}
+	if points {
+		mp := &MultiPoint{}
+		for _, part := range parts {
+			mp.Points = append(mp.Points, part[0])
+		}
+		mp.NumPoints = int32(len(mp.Points))
+		updateBox(mp)
+		return mp
+	}
+	pl := &PolyLine{}
+	for _, part := range parts {
+		pl.Parts = append(pl.Parts, int32(len(pl.Points)))
+		pl.Points = append(pl.Points, part...)
+	}
+	updateBox(pl)
+	return pl
+}
+
+// tileSize returns the width of a tile at zoom z in meters.
+func tileSize(z int) float64 {
+	return 2 * webMercatorMax / float64(int(1)<<uint(z))
+}
+
+// tileBox returns the extent of a tile in Web Mercator, rows counted from
+// the north.
+func tileBox(z, x, y int) Box {
+	size := tileSize(z)
+	return Box{-webMercatorMax + float64(x)*size, webMercatorMax - float64(y+1)*size,
+		-webMercatorMax + float64(x+1)*size, webMercatorMax - float64(y)*size}
+}
+
+// tileRange returns the tiles at zoom z intersecting b.
+func tileRange(z int, b Box) (x0, y0, x1, y1 int) {
+	size, n := tileSize(z), int(1)<<uint(z)
+	clamp := func(v float64) int {
+		return int(math.Max(0, math.Min(float64(n-1), math.Floor(v))))
+	}
+	return clamp((b.Xmin + webMercatorMax) / size), clamp((webMercatorMax - b.Ymax) / size),
+		clamp((b.Xmax + webMercatorMax) / size), clamp((webMercatorMax - b.Ymin) / size)
+}
+
+// shapesAt returns the shapes simplified for zoom z.
+func (t *Tiler) shapesAt(z int) []RecordContent {
+	if t.opts.Tolerance <= 0 {
+		return t.shapes
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.zoomed[z] == nil {
+		t.zoomed[z] = SimplifyShared(t.shapes, DouglasPeucker, t.opts.Tolerance*tileSize(z)/float64(t.opts.Extent))
+	}
+	return t.zoomed[z]
+}
+
+// Tile returns the encoded tile z/x/y, rows counted as set by the TMS
+// option, or nil if no feature is in it.
+func (t *Tiler) Tile(z, x, y int) ([]byte, error) {
+	if z < t.opts.MinZoom || z > t.opts.MaxZoom {
+		return nil, fmt.Errorf("zoom %d out of range", z)
+	}
+	n := int(1) << uint(z)
+	if x < 0 || x >= n || y < 0 || y >= n {
+		return nil, fmt.Errorf("no tile %d/%d/%d", z, x, y)
+	}
+	if t.opts.TMS {
+		y = n - 1 - y
+	}
+	var ids []int
+	for id := range t.index.Search(t.bufferedBox(z, x, y)) {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return t.encode(z, x, y, t.shapesAt(z), ids)
+}
+
+func (t *Tiler) bufferedBox(z, x, y int) Box {
+	b := tileBox(z, x, y)
+	buffer := float64(t.opts.Buffer) * tileSize(z) / float64(t.opts.Extent)
+	return Box{b.Xmin - buffer, b.Ymin - buffer, b.Xmax + buffer, b.Ymax + buffer}
+}
+
+// encode returns the tile with the features ids, or nil if none of them
+// remain after clipping and quantizing.
+func (t *Tiler) encode(z, x, y int, shapes []RecordContent, ids []int) (tile []byte, err error) {
+	b := tileBox(z, x, y)
+	scale := float64(t.opts.Extent) / tileSize(z)
+	quantize := func(p Point) Point {
+		return Point{math.Round((p.X - b.Xmin) * scale), math.Round((b.Ymax - p.Y) * scale)}
+	}
+	var features pbWriter
+	keys, values := map[string]uint32{}, map[interface{}]uint32{}
+	var keyList []string
+	var valueList []interface{}
+	count := 0
+	for _, id := range ids {
+		clipped := ClipToBox(shapes[id], t.bufferedBox(z, x, y))
+		if clipped == nil {
+			continue
+		}
+		parts, areal := partsOf(clipped)
+		for i, part := range parts {
+			q := make([]Point, len(part))
+			for j, p := range part {
+				q[j] = quantize(p)
+			}
+			parts[i] = q
+		}
+		typ, geometry := mvtGeometry(parts, areal)
+		if geometry == nil {
+			continue
+		}
+		var tags []uint32
+		if f := t.features[id]; f.Attributes != nil {
+			for i, col := range t.fields {
+				v := mvtValue(f.Attributes[col])
+				if v == nil {
+					continue
+				}
+				k, ok := keys[t.names[i]]
+				if !ok {
+					k = uint32(len(keyList))
+					keys[t.names[i]] = k
+					keyList = append(keyList, t.names[i])
+				}
+				vi, ok := values[v]
+				if !ok {
+					vi = uint32(len(valueList))
+					values[v] = vi
+					valueList = append(valueList, v)
+				}
+				tags = append(tags, k, vi)
+			}
+		}
+		var feature pbWriter
+		feature.uint(1, uint64(t.features[id].Record.Header.RecordNumber))
+		feature.packed(2, tags)
+		feature.uint(3, uint64(typ))
+		feature.packed(4, geometry)
+		features.bytes(2, feature.buf)
+		count++
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	var layer pbWriter
+	layer.uint(15, 2)
+	layer.bytes(1, []byte(t.opts.Layer))
+	layer.buf = append(layer.buf, features.buf...)
+	for _, k := range keyList {
+		layer.bytes(3, []byte(k))
+	}
+	for _, v := range valueList {
+		var value pbWriter
+		switch v := v.(type) {
+		case string:
+			value.bytes(1, []byte(v))
+		case float64:
+			value.double(3, v)
+		case int64:
+			if v < 0 {
+				value.uint(6, uint64(v<<1)^uint64(v>>63))
+			} else {
+				value.uint(5, uint64(v))
+			}
+		case bool:
+			if v {
+				value.uint(7, 1)
+			} else {
+				value.uint(7, 0)
+			}
+		}
+		layer.bytes(4, value.buf)
+	}
+	layer.uint(5, uint64(t.opts.Extent))
+	var pb pbWriter
+	pb.bytes(3, layer.buf)
+	if !t.opts.Gzip {
+		return pb.buf, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err = zw.Write(pb.buf); err != nil {
+		return
+	}
+	if err = zw.Close(); err != nil {
+		return
+	}
+	return buf.Bytes(), nil
+}
+
+// mvtValue returns the value as property, nil if it's missing.
+func mvtValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return formatValue(v)
+	case float64:
+		if math.IsNaN(v) {
+			return nil
+		}
+		return v
+	case int64, bool:
+		return v
+	}
+	return nil
+}
+
+const (
+	mvtPoint      = 1
+	mvtLineString = 2
+	mvtPolygon    = 3
+
+	mvtMoveTo    = 1
+	mvtLineTo    = 2
+	mvtClosePath = 7
+)
+
+// mvtGeometry encodes parts given in tile units, nil if nothing is left
+// of them. Rings are oriented and ordered as the specification wants:
+// each exterior ring, with a positive area in tile units as y points
+// down, is followed by its holes.
+func mvtGeometry(parts [][]Point, areal bool) (typ int, geometry []uint32) {
+	var cx, cy int32
+	command := func(id, count int) {
+		geometry = append(geometry, uint32(id&7|count<<3))
+	}
+	to := func(p Point) {
+		x, y := int32(p.X), int32(p.Y)
+		dx, dy := x-cx, y-cy
+		geometry = append(geometry, uint32(dx<<1^dx>>31), uint32(dy<<1^dy>>31))
+		cx, cy = x, y
+	}
+	var points, lines [][]Point
+	for _, part := range parts {
+		if len(part) == 1 {
+			points = append(points, part)
+			continue
+		}
+		var line []Point
+		for _, p := range part {
+			if len(line) == 0 || line[len(line)-1] != p {
+				line = append(line, p)
+			}
+		}
+		if len(line) > 1 {
+			lines = append(lines, line)
+		}
+	}
+	switch {
+	case areal:
+		rings := orientRings(lines)
+		for _, polygon := range groupRings(rings) {
+			for _, i := range polygon {
+				ring := rings[i]
+				command(mvtMoveTo, 1)
+				to(ring[0])
+				command(mvtLineTo, len(ring)-1)
+				for _, p := range ring[1:] {
+					to(p)
+				}
+				command(mvtClosePath, 1)
+			}
+		}
+		typ = mvtPolygon
+	case len(lines) > 0:
+		for _, line := range lines {
+			command(mvtMoveTo, 1)
+			to(line[0])
+			command(mvtLineTo, len(line)-1)
+			for _, p := range line[1:] {
+				to(p)
+			}
+		}
+		typ = mvtLineString
+	case len(points) > 0:
+		command(mvtMoveTo, len(points))
+		for _, p := range points {
+			to(p[0])
+		}
+		typ = mvtPoint
+	}
+	return
+}
+
+// WriteTiles writes the tiles of the zoom range as dir/z/x/y.pbf along
+// with a metadata.json holding the entries of the metadata table of
+// MBTiles, from which tools like mb-util create an .mbtiles file.
+func WriteTiles(ds *Dataset, dir string, opts TileOptions) (err error) {
+	var t *Tiler
+	if t, err = NewTiler(ds, opts); err != nil {
+		return
+	}
+	for z := t.opts.MinZoom; z <= t.opts.MaxZoom; z++ {
+		shapes := t.shapesAt(z)
+		// the features by tile, in the order of the dataset
+		tiles := map[[2]int][]int{}
+		var order [][2]int
+		for id, shape := range shapes {
+			b, ok := boxOf(shape)
+			if !ok {
+				continue
+			}
+			buffer := float64(t.opts.Buffer) * tileSize(z) / float64(t.opts.Extent)
+			x0, y0, x1, y1 := tileRange(z, Box{b.Xmin - buffer, b.Ymin - buffer, b.Xmax + buffer, b.Ymax + buffer})
+			for x := x0; x <= x1; x++ {
+				for y := y0; y <= y1; y++ {
+					k := [2]int{x, y}
+					if tiles[k] == nil {
+						order = append(order, k)
+					}
+					tiles[k] = append(tiles[k], id)
+				}
+			}
+		}
+		for _, k := range order {
+			var tile []byte
+			if tile, err = t.encode(z, k[0], k[1], shapes, tiles[k]); err != nil {
+				return
+			}
+			if tile == nil {
+				continue
+			}
+			row := k[1]
+			if t.opts.TMS {
+				row = (1 << uint(z)) - 1 - row
+			}
+			path := filepath.Join(dir, strconv.Itoa(z), strconv.Itoa(k[0]))
+			if err = os.MkdirAll(path, 0755); err != nil {
+				return
+			}
+			if err = os.WriteFile(filepath.Join(path, strconv.Itoa(row)+".pbf"), tile, 0644); err != nil {
+				return
+			}
+		}
+	}
+	var meta []byte
+	if meta, err = json.MarshalIndent(t.metadata(), "", "  "); err != nil {
+		return
+	}
+	return os.WriteFile(filepath.Join(dir, "metadata.json"), meta, 0644)
+}
+
+// metadata returns the entries of the MBTiles metadata table.
+func (t *Tiler) metadata() map[string]string {
+	lonLat := func(x, y float64) (float64, float64) {
+		return x / webMercatorMax * 180, math.Atan(math.Sinh(y/webMercatorMax*math.Pi)) / degree
+	}
+	num := func(v float64) string {
+		return strconv.FormatFloat(math.Round(v*1e6)/1e6, 'f', -1, 64)
+	}
+	w, s := lonLat(t.extent.Xmin, t.extent.Ymin)
+	e, n := lonLat(t.extent.Xmax, t.extent.Ymax)
+	type vectorLayer struct {
+		ID      string            `json:"id"`
+		Fields  map[string]string `json:"fields"`
+		MinZoom int               `json:"minzoom"`
+		MaxZoom int               `json:"maxzoom"`
+	}
+	layer := vectorLayer{ID: t.opts.Layer, Fields: map[string]string{}, MinZoom: t.opts.MinZoom, MaxZoom: t.opts.MaxZoom}
+	for i, name := range t.names {
+		layer.Fields[name] = t.types[i]
+	}
+	layers, _ := json.Marshal(struct {
+		VectorLayers []vectorLayer `json:"vector_layers"`
+	}{[]vectorLayer{layer}})
+	scheme := "xyz"
+	if t.opts.TMS {
+		scheme = "tms"
+	}
+	return map[string]string{
+		"name":    t.opts.Layer,
+		"format":  "pbf",
+		"scheme":  scheme,
+		"minzoom": strconv.Itoa(t.opts.MinZoom),
+		"maxzoom": strconv.Itoa(t.opts.MaxZoom),
+		"bounds":  num(w) + "," + num(s) + "," + num(e) + "," + num(n),
+		"center":  num((w+e)/2) + "," + num((s+n)/2) + "," + strconv.Itoa(t.opts.MinZoom),
+		"json":    string(layers),
+	}
+}
+
+// pbWriter appends protobuf fields to buf.
+type pbWriter struct {
+	buf []byte
+}
+
+func (w *pbWriter) key(field, wireType int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field<<3|wireType))
+}
+
+func (w *pbWriter) uint(field int, v uint64) {
+	w.key(field, 0)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *pbWriter) double(field int, v float64) {
+	w.key(field, 1)
+	w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+}
+
+func (w *pbWriter) bytes(field int, b []byte) {
+	w.key(field, 2)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *pbWriter) packed(field int, vs []uint32) {
+	if len(vs) == 0 {
+		return
+	}
+	var p []byte
+	for _, v := range vs {
+		p = binary.AppendUvarint(p, uint64(v))
+	}
+	w.bytes(field, p)
+}
@@ -0,0 +1,220 @@
+package shapefile
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// pbFields decodes a protobuf message into its fields, varints as
+// uint64, fixed64 as float64 and length delimited ones as []byte.
+func pbFields(t *testing.T, buf []byte) (fields map[int][]interface{}) {
+	fields = map[int][]interface{}{}
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		buf = buf[n:]
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(buf)
+			buf = buf[n:]
+			fields[int(key>>3)] = append(fields[int(key>>3)], v)
+		case 1:
+			fields[int(key>>3)] = append(fields[int(key>>3)], math.Float64frombits(binary.LittleEndian.Uint64(buf)))
+			buf = buf[8:]
+		case 2:
+			l, n := binary.Uvarint(buf)
+			fields[int(key>>3)] = append(fields[int(key>>3)], buf[n:n+int(l)])
+			buf = buf[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return
+}
+
+func pbPacked(b []byte) (vs []uint32) {
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		vs = append(vs, uint32(v))
+		b = b[n:]
+	}
+	return
+}
+
+func TestTile(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("NAME", Character, 10, 0), NewFieldDescriptor("POP", Number, 6, 0)}
+	ds := NewDataset(POLYGON, fields, mustEPSG(t, 4326))
+	// a square with a hole, its upper left corner in the center of the
+	// world, at zoom 1 in tile 1/1/1
+	ds.Add(polygon(square(0, -40, 40, 0), square(10, -30, 30, -10)), []interface{}{"square", int64(-7)})
+	tiler, err := NewTiler(ds, TileOptions{MaxZoom: 1, Layer: "squares", Extent: 256, Buffer: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, xy := range [][2]int{{0, 0}, {0, 1}, {1, 0}} {
+		if tile, _ := tiler.Tile(1, xy[0], xy[1]); tile != nil {
+			t.Errorf("expected tile %v to be empty", xy)
+		}
+	}
+	tile, err := tiler.Tile(1, 1, 1)
+	if err != nil || tile == nil {
+		t.Fatalf("expected a tile, got %v", err)
+	}
+	layers := pbFields(t, tile)[3]
+	if len(layers) != 1 {
+		t.Fatalf("expected a layer, got %d", len(layers))
+	}
+	layer := pbFields(t, layers[0].([]byte))
+	if string(layer[1][0].([]byte)) != "squares" || layer[15][0] != uint64(2) || layer[5][0] != uint64(256) {
+		t.Errorf("unexpected layer header: %v", layer)
+	}
+	if string(layer[3][0].([]byte)) != "NAME" || string(layer[3][1].([]byte)) != "POP" {
+		t.Errorf("unexpected keys: %v", layer[3])
+	}
+	if v := pbFields(t, layer[4][0].([]byte)); string(v[1][0].([]byte)) != "square" {
+		t.Errorf("unexpected string value: %v", v)
+	}
+	if v := pbFields(t, layer[4][1].([]byte)); v[6][0] != uint64(13) {
+		t.Errorf("expected -7 as sint, got %v", v)
+	}
+	feature := pbFields(t, layer[2][0].([]byte))
+	if feature[1][0] != uint64(1) || feature[3][0] != uint64(mvtPolygon) {
+		t.Errorf("unexpected feature: %v", feature)
+	}
+	if tags := pbPacked(feature[2][0].([]byte)); !reflect.DeepEqual(tags, []uint32{0, 0, 1, 1}) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+	// tile pixels of 40° are 256/180*40, y grows southwards and more so
+	// closer to the poles
+	y := func(lat float64) float64 {
+		return math.Round(math.Log(math.Tan(math.Pi/4+lat*degree/2)) / math.Pi * -256)
+	}
+	x := func(lon float64) float64 {
+		return math.Round(lon / 180 * 256)
+	}
+	var rings [][]Point
+	var cx, cy int32
+	geometry := pbPacked(feature[4][0].([]byte))
+	for i := 0; i < len(geometry); {
+		id, count := geometry[i]&7, int(geometry[i]>>3)
+		i++
+		if id == mvtClosePath {
+			continue
+		}
+		if id == mvtMoveTo {
+			rings = append(rings, nil)
+		}
+		for ; count > 0; count-- {
+			dx, dy := int32(geometry[i]>>1)^-int32(geometry[i]&1), int32(geometry[i+1]>>1)^-int32(geometry[i+1]&1)
+			cx, cy = cx+dx, cy+dy
+			rings[len(rings)-1] = append(rings[len(rings)-1], Point{float64(cx), float64(cy)})
+			i += 2
+		}
+	}
+	if len(rings) != 2 {
+		t.Fatalf("expected an exterior ring and a hole, got %v", rings)
+	}
+	if a, _ := ringArea(rings[0]); a <= 0 {
+		t.Errorf("expected the exterior ring to have a positive area, got %v", a)
+	}
+	if a, _ := ringArea(rings[1]); a >= 0 {
+		t.Errorf("expected the hole to have a negative area, got %v", a)
+	}
+	b := ringsBox(rings[:1])
+	if b != (Box{0, 0, x(40), y(-40)}) {
+		t.Errorf("unexpected exterior ring: %v", rings[0])
+	}
+	if b = ringsBox(rings[1:]); b != (Box{x(10), y(-10), x(30), y(-30)}) {
+		t.Errorf("unexpected hole: %v", rings[1])
+	}
+
+	if _, err = NewTiler(NewDataset(POINT, nil, nil), TileOptions{}); err == nil {
+		t.Errorf("expected a missing CRS to fail")
+	}
+}
+
+func TestTileDateLogical(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("BUILT", Date, 8, 0), NewFieldDescriptor("LISTED", Logical, 1, 0)}
+	ds := NewDataset(POINT, fields, mustEPSG(t, 4326))
+	ds.Add(&Point{10, 10}, []interface{}{"19840229", true})
+	tiler, err := NewTiler(ds, TileOptions{MaxZoom: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tiler.types, []string{"String", "Boolean"}) {
+		t.Errorf("unexpected types %v", tiler.types)
+	}
+	tile, err := tiler.Tile(0, 0, 0)
+	if err != nil || tile == nil {
+		t.Fatalf("expected a tile, got %v", err)
+	}
+	layer := pbFields(t, pbFields(t, tile)[3][0].([]byte))
+	if v := pbFields(t, layer[4][0].([]byte)); string(v[1][0].([]byte)) != "19840229" {
+		t.Errorf("expected the date as string, got %v", v)
+	}
+	if v := pbFields(t, layer[4][1].([]byte)); v[7][0] != uint64(1) {
+		t.Errorf("expected true as bool, got %v", v)
+	}
+}
+
+func TestWriteTiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.CRS = mustEPSG(t, 25832)
+	opts := TileOptions{MinZoom: 4, MaxZoom: 6, Fields: []string{"WKR_NR", "LAND_NAME"}, Tolerance: 1, TMS: true}
+	if err = WriteTiles(ds, dir, opts); err != nil {
+		t.Fatal(err)
+	}
+	// Germany is in tile 8/5 at zoom 4, 16/10 and 17/10 at zoom 5, the
+	// tiles at zoom 6 are cut from those
+	for _, tile := range []string{"4/8/10.pbf", "5/16/21.pbf", "5/17/21.pbf"} {
+		if _, err := os.Stat(filepath.Join(dir, tile)); err != nil {
+			t.Errorf("expected tile %s", tile)
+		}
+	}
+	tiles, _ := filepath.Glob(filepath.Join(dir, "6", "*", "*.pbf"))
+	if len(tiles) < 4 || len(tiles) > 9 {
+		t.Errorf("expected 4 to 9 tiles at zoom 6, got %d", len(tiles))
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta map[string]string
+	if err = json.Unmarshal(raw, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta["name"] != "Geometrie_Wahlkreise_18DBT" || meta["minzoom"] != "4" || meta["maxzoom"] != "6" || meta["scheme"] != "tms" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+	var layers struct {
+		VectorLayers []struct {
+			ID     string
+			Fields map[string]string
+		} `json:"vector_layers"`
+	}
+	json.Unmarshal([]byte(meta["json"]), &layers)
+	if len(layers.VectorLayers) != 1 || !reflect.DeepEqual(layers.VectorLayers[0].Fields, map[string]string{"WKR_NR": "Number", "LAND_NAME": "String"}) {
+		t.Errorf("unexpected vector layers: %s", meta["json"])
+	}
+
+	// every district is in the tile at zoom 4
+	tiler, _ := NewTiler(ds, TileOptions{MinZoom: 4, MaxZoom: 4})
+	tile, _ := tiler.Tile(4, 8, 5)
+	layer := pbFields(t, pbFields(t, tile)[3][0].([]byte))
+	if len(layer[2]) != 299 {
+		t.Errorf("expected 299 features, got %d", len(layer[2]))
+	}
+}
@@ -0,0 +1,117 @@
+package shapefile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// dBase III .ndx single index files, see:
+// http://www.clicketyclick.dk/databases/xbase/format/ndx.html
+//
+// The file consists of 512 byte pages, the first one is the header. Each
+// page starts with the number of keys, followed by entries of
+// KeyRecordSize bytes: the left child page, the record number and the
+// key. Leaf pages have no children, branch pages have one more child than
+// keys. Numeric and date keys are stored as little endian float64.
+
+const ndxPageSize = 512
+
+type NDXHeader struct {
+	RootPage      uint32
+	NumPages      uint32
+	KeyLength     uint16
+	KeysPerPage   uint16
+	KeyType       uint16 // 0 = character, 1 = numeric or date
+	KeyRecordSize uint32
+	Unique        bool
+	Expression    string
+}
+
+type NDXFile struct {
+	Header *NDXHeader
+	r      io.ReaderAt
+}
+
+func NewNDXFile(r io.ReaderAt) (ndx *NDXFile, err error) {
+	raw := make([]byte, ndxPageSize)
+	if _, err = r.ReadAt(raw, 0); err != nil {
+		return
+	}
+	hdr := &NDXHeader{
+		RootPage:      L.Uint32(raw[0:]),
+		NumPages:      L.Uint32(raw[4:]),
+		KeyLength:     L.Uint16(raw[12:]),
+		KeysPerPage:   L.Uint16(raw[14:]),
+		KeyType:       L.Uint16(raw[16:]),
+		KeyRecordSize: L.Uint32(raw[18:]),
+		Unique:        raw[23] != 0,
+		Expression:    cString(raw[24:]),
+	}
+	if hdr.KeyRecordSize < uint32(hdr.KeyLength)+8 || hdr.KeyRecordSize > ndxPageSize-4 {
+		return nil, fmt.Errorf("invalid key record size: %d", hdr.KeyRecordSize)
+	}
+	if hdr.KeyType == 1 && hdr.KeyLength != 8 {
+		return nil, fmt.Errorf("invalid numeric key length: %d", hdr.KeyLength)
+	}
+	return &NDXFile{hdr, r}, nil
+}
+
+func (ndx *NDXFile) readPage(ptr int64) (p *btreePage, err error) {
+	raw := make([]byte, ndxPageSize)
+	if _, err = ndx.r.ReadAt(raw, ptr*ndxPageSize); err != nil {
+		return
+	}
+	n := int(L.Uint32(raw))
+	size := int(ndx.Header.KeyRecordSize)
+	if 4+n*size > ndxPageSize {
+		return nil, fmt.Errorf("invalid number of keys in page %d: %d", ptr, n)
+	}
+	p = &btreePage{leaf: L.Uint32(raw[4:]) == 0}
+	for i := 0; i != n; i++ {
+		e := raw[4+i*size:]
+		p.keys = append(p.keys, e[8:8+ndx.Header.KeyLength])
+		if p.leaf {
+			p.ptrs = append(p.ptrs, int64(L.Uint32(e[4:])))
+		} else {
+			p.ptrs = append(p.ptrs, int64(L.Uint32(e)))
+		}
+	}
+	if !p.leaf && 4+n*size+4 <= ndxPageSize {
+		if last := L.Uint32(raw[4+n*size:]); last != 0 {
+			p.ptrs = append(p.ptrs, int64(last))
+		}
+	}
+	return
+}
+
+func (ndx *NDXFile) Lookup(key interface{}) ([]uint32, error) {
+	var cmp func([]byte) int
+	if ndx.Header.KeyType == 0 {
+		s, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("character index, can't look up: %v", key)
+		}
+		cmp = func(k []byte) int { return compareChar(k, s) }
+	} else {
+		f, ok := keyNumber(key)
+		if !ok {
+			return nil, fmt.Errorf("numeric index, can't look up: %v", key)
+		}
+		cmp = func(k []byte) int { return compareFloat(math.Float64frombits(L.Uint64(k)), f) }
+	}
+	return btreeLookup(ndx.readPage, int64(ndx.Header.RootPage), cmp)
+}
+
+func (ndx *NDXFile) Close() error {
+	return closeReader(ndx.r)
+}
+
+// cString returns the bytes up to the first 0 as a string.
+func cString(b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i != -1 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
@@ -0,0 +1,416 @@
+package shapefile
+
+import (
+	"math"
+	"sort"
+)
+
+// Polygon overlay: the boundaries of both polygons are split where they
+// meet, the pieces are selected depending on which side of the other
+// polygon they lie, and linked up into rings again. Before that, outer
+// rings are oriented counter clockwise and holes clockwise, so the
+// interior is always to the left of an edge.
+
+type overlayOp int
+
+const (
+	opIntersection overlayOp = iota
+	opUnion
+	opDifference
+)
+
+type edge struct {
+	from, to Point
+}
+
+// orientRings returns the rings oriented with the interior to the left,
+// dropping degenerate rings and repeated vertices. Rings nested in an
+// odd number of others are holes, as with pointInRings.
+func orientRings(rings [][]Point) (oriented [][]Point) {
+	var clean [][]Point
+	for _, ring := range rings {
+		var r []Point
+		for _, p := range ring {
+			if len(r) == 0 || r[len(r)-1] != p {
+				r = append(r, p)
+			}
+		}
+		if len(r) > 1 && r[0] == r[len(r)-1] {
+			r = r[:len(r)-1]
+		}
+		if len(r) < 3 {
+			continue
+		}
+		if a, _ := ringArea(r); a == 0 {
+			continue
+		}
+		clean = append(clean, r)
+	}
+	hole := holes(clean)
+	for i, r := range clean {
+		a, _ := ringArea(r)
+		if (a > 0) == hole[i] {
+			r = canonical(r, true)
+		}
+		oriented = append(oriented, r)
+	}
+	return
+}
+
+// snapRings moves the vertices of rings lying within tolerance of a
+// vertex of to onto it. Neighbouring polygons often have vertices which
+// are meant to be shared but differ by rounding.
+func snapRings(rings, to [][]Point) [][]Point {
+	var scale float64
+	for _, r := range to {
+		for _, p := range r {
+			scale = math.Max(scale, math.Max(math.Abs(p.X), math.Abs(p.Y)))
+		}
+	}
+	cell := tolerance(Point{scale, scale})
+	type key struct{ x, y int64 }
+	grid := map[key][]Point{}
+	keyOf := func(p Point) key {
+		return key{int64(math.Floor(p.X / cell)), int64(math.Floor(p.Y / cell))}
+	}
+	for _, r := range to {
+		for _, p := range r {
+			k := keyOf(p)
+			grid[k] = append(grid[k], p)
+		}
+	}
+	snapped := make([][]Point, len(rings))
+	for i, r := range rings {
+		snapped[i] = make([]Point, len(r))
+		for j, p := range r {
+			snapped[i][j] = p
+			k := keyOf(p)
+		search:
+			for dx := int64(-1); dx <= 1; dx++ {
+				for dy := int64(-1); dy <= 1; dy++ {
+					for _, q := range grid[key{k.x + dx, k.y + dy}] {
+						if near(p, q) {
+							snapped[i][j] = q
+							break search
+						}
+					}
+				}
+			}
+		}
+	}
+	return snapped
+}
+
+func ringEdges(rings [][]Point) (edges []edge) {
+	for _, r := range rings {
+		for i := range r {
+			edges = append(edges, edge{r[i], r[(i+1)%len(r)]})
+		}
+	}
+	return
+}
+
+// splitEdges splits the edges of a and b wherever they meet.
+func splitEdges(a, b []edge) (sa, sb []edge) {
+	splits := func(edges []edge) [][]Point {
+		s := make([][]Point, len(edges))
+		for i, e := range edges {
+			s[i] = []Point{e.from, e.to}
+		}
+		return s
+	}
+	as, bs := splits(a), splits(b)
+	tree := edgeTree(b)
+	for i, ea := range a {
+		for j := range tree.Search(edgeBox(ea)) {
+			eb := b[j]
+			for _, p := range segmentIntersections(ea.from, ea.to, eb.from, eb.to) {
+				as[i] = append(as[i], p)
+				bs[j] = append(bs[j], p)
+			}
+		}
+	}
+	pieces := func(edges []edge, s [][]Point) (out []edge) {
+		for i, e := range edges {
+			pts := s[i]
+			sort.Slice(pts, func(k, l int) bool {
+				return math.Hypot(pts[k].X-e.from.X, pts[k].Y-e.from.Y) < math.Hypot(pts[l].X-e.from.X, pts[l].Y-e.from.Y)
+			})
+			for k := 1; k < len(pts); k++ {
+				if pts[k-1] != pts[k] {
+					out = append(out, edge{pts[k-1], pts[k]})
+				}
+			}
+		}
+		return
+	}
+	return pieces(a, as), pieces(b, bs)
+}
+
+func edgeBox(e edge) Box {
+	return Box{math.Min(e.from.X, e.to.X), math.Min(e.from.Y, e.to.Y), math.Max(e.from.X, e.to.X), math.Max(e.from.Y, e.to.Y)}
+}
+
+// edgeTree indexes the bounding boxes of edges.
+func edgeTree(edges []edge) *RTree {
+	boxes := make([]Box, len(edges))
+	for i, e := range edges {
+		boxes[i] = edgeBox(e)
+	}
+	return NewRTree(boxes)
+}
+
+// overlay combines the polygons a and b given as rings. The result is in
+// shapefile orientation: outer rings clockwise, holes counter clockwise,
+// each followed by the holes within it, and explicitly closed.
+func overlay(a, b [][]Point, op overlayOp) [][]Point {
+	a, b = orientRings(a), orientRings(snapRings(b, a))
+	ea, eb := splitEdges(ringEdges(a), ringEdges(b))
+	ga, gb := &geom{rings: a}, &geom{rings: b}
+	ga.box, gb.box = ringsBox(a), ringsBox(b)
+	ga.empty, gb.empty = len(a) == 0, len(b) == 0
+
+	treeA, treeB := edgeTree(ea), edgeTree(eb)
+
+	// side classifies an edge relative to the other polygon: 1 inside,
+	// -1 outside, 2 shared in the same direction, -2 shared in opposite
+	// direction.
+	side := func(e edge, other *geom, edges []edge, tree *RTree) int {
+		m := Point{(e.from.X + e.to.X) / 2, (e.from.Y + e.to.Y) / 2}
+		switch other.locate(m) {
+		case interior:
+			return 1
+		case exterior:
+			return -1
+		}
+		// on the boundary, compare with the direction of the other
+		// polygon's edges there. Those needn't end at the same vertices.
+		same, opposite := false, false
+		tol := tolerance(m)
+		for i := range tree.Search(Box{m.X - tol, m.Y - tol, m.X + tol, m.Y + tol}) {
+			o := edges[i]
+			if !onSegment(m, o.from, o.to) {
+				continue
+			}
+			if (e.to.X-e.from.X)*(o.to.X-o.from.X)+(e.to.Y-e.from.Y)*(o.to.Y-o.from.Y) > 0 {
+				same = true
+			} else {
+				opposite = true
+			}
+		}
+		switch {
+		case same && opposite: // between two of the other's rings
+			return 1
+		case same:
+			return 2
+		case opposite:
+			return -2
+		}
+		if pointInRings(m.X, m.Y, other.rings) {
+			return 1
+		}
+		return -1
+	}
+
+	var selected []edge
+	for _, e := range ea {
+		s := side(e, gb, eb, treeB)
+		switch op {
+		case opIntersection:
+			if s == 1 || s == 2 {
+				selected = append(selected, e)
+			}
+		case opUnion:
+			if s == -1 || s == 2 {
+				selected = append(selected, e)
+			}
+		case opDifference:
+			if s == -1 || s == -2 {
+				selected = append(selected, e)
+			}
+		}
+	}
+	for _, e := range eb {
+		s := side(e, ga, ea, treeA)
+		switch op {
+		case opIntersection:
+			if s == 1 {
+				selected = append(selected, e)
+			}
+		case opUnion:
+			if s == -1 {
+				selected = append(selected, e)
+			}
+		case opDifference:
+			if s == 1 {
+				selected = append(selected, edge{e.to, e.from})
+			}
+		}
+	}
+	return assembleRings(selected)
+}
+
+func ringsBox(rings [][]Point) Box {
+	b := Box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, r := range rings {
+		for _, p := range r {
+			b.Xmin, b.Ymin = math.Min(b.Xmin, p.X), math.Min(b.Ymin, p.Y)
+			b.Xmax, b.Ymax = math.Max(b.Xmax, p.X), math.Max(b.Ymax, p.Y)
+		}
+	}
+	return b
+}
+
+// assembleRings links edges with the interior to their left into rings.
+// Where several edges leave a vertex the one turning left the most is
+// taken, which keeps rings touching at a vertex apart.
+func assembleRings(edges []edge) [][]Point {
+	out := map[Point][]int{}
+	for i, e := range edges {
+		out[e.from] = append(out[e.from], i)
+	}
+	used := make([]bool, len(edges))
+	var shells, inner [][]Point
+	for i := range edges {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		ring := []Point{edges[i].from}
+		cur := edges[i]
+		for cur.to != ring[0] {
+			ring = append(ring, cur.to)
+			inAngle := math.Atan2(cur.to.Y-cur.from.Y, cur.to.X-cur.from.X)
+			next, best := -1, math.Inf(-1)
+			for _, j := range out[cur.to] {
+				if used[j] {
+					continue
+				}
+				e := edges[j]
+				turn := math.Remainder(math.Atan2(e.to.Y-e.from.Y, e.to.X-e.from.X)-inAngle, 2*math.Pi)
+				if e.to == cur.from {
+					turn = -math.Pi // going back is the last resort
+				}
+				if turn > best {
+					next, best = j, turn
+				}
+			}
+			if next == -1 {
+				ring = nil // dangling, numerically inconsistent input
+				break
+			}
+			used[next] = true
+			cur = edges[next]
+		}
+		if len(ring) < 3 {
+			continue
+		}
+		a, _ := ringArea(ring)
+		if math.Abs(a) <= tolerance(ring[0])*linesLength([][]Point{append(ring, ring[0])}) {
+			continue // sliver left by nearly collinear edges
+		}
+		ring = canonical(ring, true)
+		ring = append(ring, ring[0])
+		switch {
+		case a > 0:
+			shells = append(shells, ring)
+		case a < 0:
+			inner = append(inner, ring)
+		}
+	}
+
+	// put each hole after the smallest shell containing it. Holes in no
+	// shell are left over by numerically inconsistent input and dropped.
+	owned := make([][][]Point, len(shells))
+	for _, h := range inner {
+		owner, area := -1, math.Inf(1)
+		for i, s := range shells {
+			if a, _ := ringArea(s); math.Abs(a) < area && pointInRings(h[0].X, h[0].Y, [][]Point{s}) {
+				owner, area = i, math.Abs(a)
+			}
+		}
+		if owner == -1 {
+			continue
+		}
+		owned[owner] = append(owned[owner], h)
+	}
+	var rings [][]Point
+	for i, s := range shells {
+		rings = append(rings, s)
+		rings = append(rings, owned[i]...)
+	}
+	return rings
+}
+
+// Intersection returns the area covered by both a and b, which must be
+// polygons, or nil if they don't overlap. Z and M values are dropped.
+func Intersection(a, b RecordContent) *Polygon {
+	return booleanOp(a, b, opIntersection)
+}
+
+// Union returns the area covered by a or b, or nil if both are empty.
+func Union(a, b RecordContent) *Polygon {
+	return booleanOp(a, b, opUnion)
+}
+
+// Difference returns the area of a not covered by b, or nil if nothing
+// remains.
+func Difference(a, b RecordContent) *Polygon {
+	return booleanOp(a, b, opDifference)
+}
+
+// UnionAll returns the union of all polygons, or nil if there are none.
+// Shapes are merged pairwise in a balanced way, so the rings growing
+// along the way are merged only a logarithmic number of times.
+func UnionAll(shapes []RecordContent) *Polygon {
+	var layer [][][]Point
+	for _, s := range shapes {
+		if rings, areal := partsOf(s); areal && len(rings) > 0 {
+			layer = append(layer, rings)
+		}
+	}
+	if len(layer) == 0 {
+		return nil
+	}
+	if len(layer) == 1 {
+		layer[0] = overlay(layer[0], nil, opUnion)
+	}
+	for len(layer) > 1 {
+		var next [][][]Point
+		for i := 0; i < len(layer); i += 2 {
+			if i+1 == len(layer) {
+				next = append(next, layer[i])
+				continue
+			}
+			next = append(next, overlay(layer[i], layer[i+1], opUnion))
+		}
+		layer = next
+	}
+	return polygonOf(layer[0])
+}
+
+func booleanOp(a, b RecordContent, op overlayOp) *Polygon {
+	ra, areal := partsOf(a)
+	if !areal {
+		ra = nil
+	}
+	rb, areal := partsOf(b)
+	if !areal {
+		rb = nil
+	}
+	return polygonOf(overlay(ra, rb, op))
+}
+
+// polygonOf returns a polygon made up of rings, nil if there are none.
+func polygonOf(rings [][]Point) *Polygon {
+	if len(rings) == 0 {
+		return nil
+	}
+	pg := &Polygon{}
+	for _, r := range rings {
+		pg.Parts = append(pg.Parts, int32(len(pg.Points)))
+		pg.Points = append(pg.Points, r...)
+	}
+	updateBox(pg)
+	return pg
+}
@@ -0,0 +1,99 @@
+package shapefile
+
+import (
+	"testing"
+)
+
+func TestBooleanOps(t *testing.T) {
+	a := polygon(square(0, 0, 10, 10))
+	tests := []struct {
+		name               string
+		b                  *Polygon
+		union, inter, diff float64
+		parts              int
+	}{
+		{"overlapping", polygon(square(5, 5, 15, 15)), 175, 25, 75, 1},
+		{"adjacent", polygon(square(10, 0, 20, 10)), 200, 0, 100, 1},
+		{"sharing part of a side", polygon(square(10, 5, 20, 20)), 250, 0, 100, 1},
+		{"disjoint", polygon(square(20, 20, 30, 30)), 200, 0, 100, 2},
+		{"inside", polygon(square(2, 2, 4, 4)), 100, 4, 96, 1},
+		{"identical", polygon(square(0, 0, 10, 10)), 100, 100, 0, 1},
+		{"crossing", polygon(square(-5, 4, 15, 6)), 120, 20, 80, 1},
+		{"holed", polygon(square(-5, -5, 15, 15), square(1, 1, 9, 9)), 400, 36, 64, 1},
+	}
+	area := func(p *Polygon) float64 {
+		if p == nil {
+			return 0
+		}
+		return p.Area()
+	}
+	for _, test := range tests {
+		u := Union(a, test.b)
+		if got := area(u); got != test.union {
+			t.Errorf("%s: union area %v, expected %v", test.name, got, test.union)
+		}
+		if got := area(Intersection(a, test.b)); got != test.inter {
+			t.Errorf("%s: intersection area %v, expected %v", test.name, got, test.inter)
+		}
+		if got := area(Difference(a, test.b)); got != test.diff {
+			t.Errorf("%s: difference area %v, expected %v", test.name, got, test.diff)
+		}
+		outer := 0
+		for _, h := range holes(splitParts(u.Parts, u.Points)) {
+			if !h {
+				outer++
+			}
+		}
+		if outer != test.parts {
+			t.Errorf("%s: union has %v outer rings, expected %v", test.name, outer, test.parts)
+		}
+	}
+
+	// the difference punches a hole which is oriented counter clockwise
+	d := Difference(a, polygon(square(2, 2, 4, 4)))
+	if len(d.Parts) != 2 {
+		t.Fatalf("expected a hole: %v", d.Parts)
+	}
+	rings := splitParts(d.Parts, d.Points)
+	if outer, _ := ringArea(rings[0]); outer >= 0 {
+		t.Errorf("outer ring not clockwise")
+	}
+	if hole, _ := ringArea(rings[1]); hole <= 0 {
+		t.Errorf("hole not counter clockwise")
+	}
+
+	// a ring of squares around the middle one leaves a hole
+	var frame []RecordContent
+	for x := 0.0; x < 3; x++ {
+		for y := 0.0; y < 3; y++ {
+			if x != 1 || y != 1 {
+				frame = append(frame, polygon(square(x, y, x+1, y+1)))
+			}
+		}
+	}
+	u := UnionAll(frame)
+	if u.Area() != 8 || len(u.Parts) != 2 {
+		t.Errorf("unexpected union: %v", u)
+	}
+	if UnionAll(nil) != nil {
+		t.Errorf("expected union of nothing to be nil")
+	}
+}
+
+func TestAssembleRingsOrphanHole(t *testing.T) {
+	// a counter clockwise shell and a clockwise hole outside it, both with
+	// the interior to the left
+	var edges []edge
+	for _, r := range [][]Point{canonical(square(0, 0, 1, 1), true), square(5, 5, 6, 6)} {
+		for i := 1; i < len(r); i++ {
+			edges = append(edges, edge{r[i-1], r[i]})
+		}
+	}
+	rings := assembleRings(edges)
+	if len(rings) != 1 {
+		t.Fatalf("expected the shell only, got %v", rings)
+	}
+	if a, _ := ringArea(rings[0]); a >= 0 {
+		t.Errorf("expected a clockwise shell, got %v", rings[0])
+	}
+}
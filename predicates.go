@@ -0,0 +1,376 @@
+package shapefile
+
+import (
+	"math"
+	"sort"
+)
+
+// Spatial predicates between shapes, following the OGC simple features
+// definitions. Polygon rings are evaluated with the even-odd rule, so
+// holes are respected regardless of ring orientation, and the boundary
+// of a polyline consists of the end points of its open parts. All
+// computations are planar.
+
+type location int
+
+const (
+	exterior location = iota
+	boundary
+	interior
+)
+
+// geom is a shape decomposed into its elements.
+type geom struct {
+	points []Point
+	lines  [][]Point
+	rings  [][]Point
+	box    Box
+	empty  bool
+}
+
+func geomOf(content RecordContent) *geom {
+	g := &geom{}
+	parts, areal := partsOf(content)
+	for _, part := range parts {
+		switch {
+		case len(part) == 0:
+		case areal:
+			g.rings = append(g.rings, part)
+		case len(part) == 1:
+			g.points = append(g.points, part[0])
+		default:
+			g.lines = append(g.lines, part)
+		}
+	}
+	var ok bool
+	g.box, ok = boxOf(content)
+	g.empty = !ok
+	return g
+}
+
+func (g *geom) dimension() int {
+	switch {
+	case g.rings != nil:
+		return 2
+	case g.lines != nil:
+		return 1
+	}
+	return 0
+}
+
+// segments calls f for every segment of the lines and rings of g. Rings
+// are closed implicitly.
+func (g *geom) segments(f func(a, b Point)) {
+	for _, line := range g.lines {
+		for i := 1; i < len(line); i++ {
+			f(line[i-1], line[i])
+		}
+	}
+	for _, ring := range g.rings {
+		for i := range ring {
+			j := (i + 1) % len(ring)
+			if i != j && ring[i] != ring[j] {
+				f(ring[i], ring[j])
+			}
+		}
+	}
+}
+
+// tolerance is the distance below which points are considered equal,
+// relative to the magnitude of the coordinates.
+func tolerance(p Point) float64 {
+	return 1e-12 * (1 + math.Abs(p.X) + math.Abs(p.Y))
+}
+
+func near(p, q Point) bool {
+	return math.Abs(p.X-q.X) <= tolerance(p) && math.Abs(p.Y-q.Y) <= tolerance(p)
+}
+
+func onSegment(p, a, b Point) bool {
+	return segmentDistance(p.X, p.Y, a, b) <= tolerance(p)
+}
+
+// locate returns the location of p relative to g.
+func (g *geom) locate(p Point) location {
+	if g.empty || p.X < g.box.Xmin-tolerance(p) || p.X > g.box.Xmax+tolerance(p) ||
+		p.Y < g.box.Ymin-tolerance(p) || p.Y > g.box.Ymax+tolerance(p) {
+		return exterior
+	}
+	if g.rings != nil {
+		loc := exterior
+		g.segments(func(a, b Point) {
+			if loc == exterior && onSegment(p, a, b) {
+				loc = boundary
+			}
+		})
+		if loc == exterior && pointInRings(p.X, p.Y, g.rings) {
+			loc = interior
+		}
+		return loc
+	}
+	for _, q := range g.points {
+		if near(p, q) {
+			return interior
+		}
+	}
+	// mod-2 rule: end points shared by an even number of parts are
+	// interior.
+	ends, on := 0, false
+	for _, line := range g.lines {
+		first, last := line[0], line[len(line)-1]
+		if first != last {
+			if near(p, first) {
+				ends++
+			}
+			if near(p, last) {
+				ends++
+			}
+		}
+		for i := 1; i < len(line) && !on; i++ {
+			on = onSegment(p, line[i-1], line[i])
+		}
+	}
+	switch {
+	case ends%2 == 1:
+		return boundary
+	case on:
+		return interior
+	}
+	return exterior
+}
+
+// segmentIntersections returns the points where the segments a1-a2 and
+// b1-b2 meet: none, one, or the ends of their common part if they are
+// collinear.
+func segmentIntersections(a1, a2, b1, b2 Point) (pts []Point) {
+	// endpoints on the other segment are taken as they are, so segments
+	// sharing a vertex or running along each other meet at their vertices
+	// rather than at computed points that are off by rounding.
+	add := func(p Point) {
+		for _, q := range pts {
+			if q == p {
+				return
+			}
+		}
+		pts = append(pts, p)
+	}
+	for _, p := range []Point{b1, b2} {
+		if onSegment(p, a1, a2) {
+			add(p)
+		}
+	}
+	for _, p := range []Point{a1, a2} {
+		if onSegment(p, b1, b2) {
+			add(p)
+		}
+	}
+	d := (a2.X-a1.X)*(b2.Y-b1.Y) - (a2.Y-a1.Y)*(b2.X-b1.X)
+	if pts != nil || d == 0 {
+		return
+	}
+	t := ((b1.X-a1.X)*(b2.Y-b1.Y) - (b1.Y-a1.Y)*(b2.X-b1.X)) / d
+	u := ((b1.X-a1.X)*(a2.Y-a1.Y) - (b1.Y-a1.Y)*(a2.X-a1.X)) / d
+	if t < 0 || t > 1 || u < 0 || u > 1 {
+		return nil
+	}
+	return []Point{{a1.X + t*(a2.X-a1.X), a1.Y + t*(a2.Y-a1.Y)}}
+}
+
+// samples returns points representing g with respect to other: its
+// points and vertices, the points where its segments meet those of
+// other, and the midpoints between them. Each sub-segment between two
+// samples lies either completely inside, on the boundary of or outside
+// other.
+func (g *geom) samples(other *geom) (pts []Point) {
+	pts = append(pts, g.points...)
+	var others [][2]Point
+	other.segments(func(a, b Point) {
+		others = append(others, [2]Point{a, b})
+	})
+	g.segments(func(a, b Point) {
+		split := []Point{a, b}
+		sb := Box{math.Min(a.X, b.X), math.Min(a.Y, b.Y), math.Max(a.X, b.X), math.Max(a.Y, b.Y)}
+		if sb.Intersects(other.box) {
+			for _, o := range others {
+				split = append(split, segmentIntersections(a, b, o[0], o[1])...)
+			}
+			for _, p := range other.points {
+				if onSegment(p, a, b) {
+					split = append(split, p)
+				}
+			}
+		}
+		sort.Slice(split, func(i, j int) bool {
+			return math.Hypot(split[i].X-a.X, split[i].Y-a.Y) < math.Hypot(split[j].X-a.X, split[j].Y-a.Y)
+		})
+		pts = append(pts, split[0])
+		for i := 1; i < len(split); i++ {
+			p, q := split[i-1], split[i]
+			if p != q {
+				pts = append(pts, Point{(p.X + q.X) / 2, (p.Y + q.Y) / 2}, q)
+			}
+		}
+	})
+	return
+}
+
+// interiorPoint returns a point strictly inside the rings, found on a
+// horizontal line through the middle of the first ring.
+func interiorPoint(rings [][]Point) (p Point, ok bool) {
+	if len(rings) == 0 || len(rings[0]) == 0 {
+		return
+	}
+	ymin, ymax := math.Inf(1), math.Inf(-1)
+	for _, q := range rings[0] {
+		ymin, ymax = math.Min(ymin, q.Y), math.Max(ymax, q.Y)
+	}
+	y := (ymin + ymax) / 2
+	var xs []float64
+	for _, ring := range rings {
+		for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+			a, b := ring[i], ring[j]
+			if (a.Y > y) != (b.Y > y) {
+				xs = append(xs, (b.X-a.X)*(y-a.Y)/(b.Y-a.Y)+a.X)
+			}
+		}
+	}
+	sort.Float64s(xs)
+	// take the widest inside interval
+	best := 0.0
+	for i := 0; i+1 < len(xs); i += 2 {
+		if w := xs[i+1] - xs[i]; w > best {
+			best, p, ok = w, Point{(xs[i] + xs[i+1]) / 2, y}, true
+		}
+	}
+	return
+}
+
+// relation summarizes how two shapes relate.
+type relation struct {
+	intersects bool // they have at least one point in common
+	interiors  bool // their interiors intersect
+	// part of b lies outside of a, or a's boundary lies in b's interior
+	// which means that b's interior reaches a's exterior.
+	bInAExterior   bool
+	dimA, dimB     int
+	emptyA, emptyB bool
+}
+
+func relate(ca, cb RecordContent) (r relation) {
+	a, b := geomOf(ca), geomOf(cb)
+	r.dimA, r.dimB = a.dimension(), b.dimension()
+	r.emptyA, r.emptyB = a.empty, b.empty
+	if a.empty || b.empty {
+		return
+	}
+	if !a.box.Intersects(b.box) {
+		r.bInAExterior = true
+		return
+	}
+	for _, p := range b.samples(a) {
+		self, loc := b.locate(p), a.locate(p)
+		if loc == exterior {
+			r.bInAExterior = true
+			continue
+		}
+		r.intersects = true
+		// boundary points of areas inside another area are surrounded
+		// by interior points of both
+		if loc == interior && (self == interior || a.rings != nil && b.rings != nil) {
+			r.interiors = true
+		}
+	}
+	for _, p := range a.samples(b) {
+		self, loc := a.locate(p), b.locate(p)
+		if loc == exterior {
+			continue
+		}
+		r.intersects = true
+		if loc == interior && (self == interior || a.rings != nil && b.rings != nil) {
+			r.interiors = true
+			if self == boundary && a.rings != nil && b.rings != nil {
+				r.bInAExterior = true
+			}
+		}
+	}
+	if !r.interiors && a.rings != nil && b.rings != nil {
+		if p, ok := interiorPoint(a.rings); ok && b.locate(p) == interior {
+			r.interiors = true
+		}
+	}
+	return
+}
+
+// Intersects reports whether the shapes have at least one point in
+// common.
+func Intersects(a, b RecordContent) bool {
+	return relate(a, b).intersects
+}
+
+// Contains reports whether no point of b lies outside of a, and at least
+// one point of the interior of b lies in the interior of a.
+func Contains(a, b RecordContent) bool {
+	r := relate(a, b)
+	if r.emptyA || r.emptyB || r.dimB > r.dimA {
+		return false
+	}
+	return !r.bInAExterior && r.interiors
+}
+
+// Within reports whether a lies within b, i.e. b contains a.
+func Within(a, b RecordContent) bool {
+	return Contains(b, a)
+}
+
+// Touches reports whether the shapes have at least one point in common,
+// but their interiors don't intersect.
+func Touches(a, b RecordContent) bool {
+	r := relate(a, b)
+	if r.dimA == 0 && r.dimB == 0 {
+		return false
+	}
+	return r.intersects && !r.interiors
+}
+
+// Distance returns the shortest planar distance between the shapes, 0
+// if they intersect. It's +Inf if either shape has no vertices.
+func Distance(ca, cb RecordContent) float64 {
+	a, b := geomOf(ca), geomOf(cb)
+	if a.empty || b.empty {
+		return math.Inf(1)
+	}
+	if Intersects(ca, cb) {
+		return 0
+	}
+	// the shapes don't intersect, so the closest points include a vertex
+	// of one of them.
+	d := math.Inf(1)
+	vertexDistance := func(g, other *geom) {
+		for _, p := range g.points {
+			d = math.Min(d, other.pointDistance(p))
+		}
+		for _, parts := range [][][]Point{g.lines, g.rings} {
+			for _, part := range parts {
+				for _, p := range part {
+					d = math.Min(d, other.pointDistance(p))
+				}
+			}
+		}
+	}
+	vertexDistance(a, b)
+	vertexDistance(b, a)
+	return d
+}
+
+// pointDistance returns the distance of p to the points and segments of
+// g, ignoring the interior of areas.
+func (g *geom) pointDistance(p Point) float64 {
+	d := math.Inf(1)
+	for _, q := range g.points {
+		d = math.Min(d, math.Hypot(p.X-q.X, p.Y-q.Y))
+	}
+	g.segments(func(a, b Point) {
+		d = math.Min(d, segmentDistance(p.X, p.Y, a, b))
+	})
+	return d
+}
@@ -0,0 +1,116 @@
+package shapefile
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func square(xmin, ymin, xmax, ymax float64) []Point {
+	return []Point{{xmin, ymin}, {xmin, ymax}, {xmax, ymax}, {xmax, ymin}, {xmin, ymin}}
+}
+
+func polygon(rings ...[]Point) *Polygon {
+	pg := &Polygon{}
+	for _, r := range rings {
+		pg.Parts = append(pg.Parts, int32(len(pg.Points)))
+		pg.Points = append(pg.Points, r...)
+	}
+	updateBox(pg)
+	return pg
+}
+
+func polyline(pts ...Point) *PolyLine {
+	pl := &PolyLine{Parts: []int32{0}, Points: pts}
+	updateBox(pl)
+	return pl
+}
+
+func TestPredicates(t *testing.T) {
+	// 10x10 square with a 2x2 hole in the middle
+	holed := polygon(square(0, 0, 10, 10), square(4, 4, 6, 6))
+	tests := []struct {
+		name                                  string
+		a, b                                  RecordContent
+		intersects, contains, within, touches bool
+		distance                              float64
+	}{
+		{"point inside", holed, &Point{1, 1}, true, true, false, false, 0},
+		{"point in hole", holed, &Point{5, 5}, false, false, false, false, 1},
+		{"point on boundary", holed, &Point{0, 5}, true, false, false, true, 0},
+		{"point on hole boundary", holed, &Point{4, 5}, true, false, false, true, 0},
+		{"point outside", holed, &Point{13, 14}, false, false, false, false, 5},
+		{"line inside", holed, polyline(Point{1, 1}, Point{3, 9}), true, true, false, false, 0},
+		{"line across hole", holed, polyline(Point{1, 5}, Point{9, 5}), true, false, false, false, 0},
+		{"line along edge", holed, polyline(Point{0, 1}, Point{0, 9}), true, false, false, true, 0},
+		{"line crossing", polyline(Point{-1, -1}, Point{1, 1}), polyline(Point{-1, 1}, Point{1, -1}), true, false, false, false, 0},
+		{"lines touching", polyline(Point{0, 0}, Point{1, 1}), polyline(Point{1, 1}, Point{2, 0}), true, false, false, true, 0},
+		{"sub line", polyline(Point{0, 0}, Point{1, 1}, Point{4, 4}), polyline(Point{0.5, 0.5}, Point{2, 2}), true, true, false, false, 0},
+		{"parallel lines", polyline(Point{0, 0}, Point{4, 0}), polyline(Point{1, 2}, Point{3, 2}), false, false, false, false, 2},
+		{"polygon inside", holed, polygon(square(1, 1, 3, 3)), true, true, false, false, 0},
+		{"polygon covering hole", holed, polygon(square(3, 3, 7, 7)), true, false, false, false, 0},
+		{"polygon in hole", holed, polygon(square(4.5, 4.5, 5.5, 5.5)), false, false, false, false, 0.5},
+		{"filled hole", holed, polygon(square(4, 4, 6, 6)), true, false, false, true, 0},
+		{"adjacent", polygon(square(0, 0, 1, 1)), polygon(square(1, 0, 2, 1)), true, false, false, true, 0},
+		{"corner", polygon(square(0, 0, 1, 1)), polygon(square(1, 1, 2, 2)), true, false, false, true, 0},
+		{"overlapping", polygon(square(0, 0, 2, 2)), polygon(square(1, 1, 3, 3)), true, false, false, false, 0},
+		{"equal", polygon(square(0, 0, 2, 2)), polygon(square(0, 0, 2, 2)), true, true, true, false, 0},
+		{"inside, shared edge", polygon(square(0, 0, 2, 2)), polygon(square(0, 0, 1, 1)), true, true, false, false, 0},
+		{"swapped", polygon(square(1, 1, 3, 3)), holed, true, false, true, false, 0},
+		{"points", &MultiPoint{Points: []Point{{0, 0}, {1, 1}}}, &Point{1, 1}, true, true, false, false, 0},
+		{"null", holed, &Null{}, false, false, false, false, math.Inf(1)},
+	}
+	for _, test := range tests {
+		if v := Intersects(test.a, test.b); v != test.intersects {
+			t.Errorf("%s: Intersects = %v", test.name, v)
+		}
+		if v := Intersects(test.b, test.a); v != test.intersects {
+			t.Errorf("%s: Intersects (swapped) = %v", test.name, v)
+		}
+		if v := Contains(test.a, test.b); v != test.contains {
+			t.Errorf("%s: Contains = %v", test.name, v)
+		}
+		if v := Within(test.a, test.b); v != test.within {
+			t.Errorf("%s: Within = %v", test.name, v)
+		}
+		if v := Touches(test.a, test.b); v != test.touches {
+			t.Errorf("%s: Touches = %v", test.name, v)
+		}
+		if v := Touches(test.b, test.a); v != test.touches {
+			t.Errorf("%s: Touches (swapped) = %v", test.name, v)
+		}
+		if d := Distance(test.a, test.b); math.Abs(d-test.distance) > 1e-9 && d != test.distance {
+			t.Errorf("%s: Distance = %v", test.name, d)
+		}
+	}
+}
+
+func TestContainsAddress(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utm, err := ParseWKT(prj_etrs_utm32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTransformer(mustEPSG(t, 4326), utm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reichstag building
+	x, y, err := tr.Point(13.3761, 52.5186)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := &Point{x, y}
+	var found []string
+	for f := range ds.Query(Box{x, y, x, y}) {
+		if Contains(f.Record.Content, pt) {
+			found = append(found, strings.TrimSpace(f.Attributes[1].(string)))
+		}
+	}
+	if len(found) != 1 || found[0] != "Berlin-Mitte" {
+		t.Errorf("unexpected Wahlkreise: %v", found)
+	}
+}
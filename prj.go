@@ -0,0 +1,478 @@
+package shapefile
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// .prj files contain the coordinate reference system of the dataset in
+// the ESRI dialect of OGC WKT1, e.g.:
+//
+//	PROJCS["ETRS_1989_UTM_Zone_32N",GEOGCS["GCS_ETRS_1989",
+//	DATUM["D_ETRS_1989",SPHEROID["GRS_1980",6378137.0,298.257222101]],
+//	PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],
+//	PROJECTION["Transverse_Mercator"],PARAMETER["False_Easting",500000.0],
+//	...,UNIT["Meter",1.0]]
+//
+// The dialect isn't formally specified, see:
+// http://docs.opengeospatial.org/is/12-063r5/12-063r5.html#appendix_b (WKT1)
+
+type CRS struct {
+	Name          string // name of the PROJCS, or of the GEOGCS for geographic systems
+	GeogName      string // name of the GEOGCS
+	Datum         Datum
+	PrimeMeridian PrimeMeridian
+	AngularUnit   Unit
+	Projection    string // empty for geographic systems
+	Parameters    []Parameter
+	LinearUnit    Unit
+	EPSG          int // 0 if not recognised
+}
+
+type Datum struct {
+	Name      string
+	Ellipsoid Ellipsoid
+	ToWGS84   []float64 // optional 3 or 7 Helmert parameters, as found in OGC WKT
+}
+
+type Ellipsoid struct {
+	Name          string
+	SemiMajor     float64
+	InvFlattening float64 // 0 for a sphere
+}
+
+type PrimeMeridian struct {
+	Name      string
+	Longitude float64 // in the angular unit of the GEOGCS
+}
+
+type Unit struct {
+	Name   string
+	Factor float64 // radians per unit for angular, meters per unit for linear units
+}
+
+type Parameter struct {
+	Name  string
+	Value float64
+}
+
+func (c *CRS) String() string {
+	str := fmt.Sprintf("Name       : %s\n", c.Name)
+	str += fmt.Sprintf("Datum      : %s\n", c.Datum.Name)
+	str += fmt.Sprintf("Ellipsoid  : %s %f %f\n", c.Datum.Ellipsoid.Name, c.Datum.Ellipsoid.SemiMajor, c.Datum.Ellipsoid.InvFlattening)
+	str += fmt.Sprintf("Projection : %s\n", c.Projection)
+	for _, p := range c.Parameters {
+		str += fmt.Sprintf("  %s = %f\n", p.Name, p.Value)
+	}
+	str += fmt.Sprintf("EPSG       : %d\n", c.EPSG)
+	return str
+}
+
+func (c *CRS) IsGeographic() bool {
+	return c.Projection == ""
+}
+
+// Parameter returns the value of the named projection parameter, names are
+// compared case insensitive.
+func (c *CRS) Parameter(name string) (v float64, ok bool) {
+	for _, p := range c.Parameters {
+		if strings.EqualFold(p.Name, name) {
+			return p.Value, true
+		}
+	}
+	return 0, false
+}
+
+func NewCRSFromReader(r io.Reader) (crs *CRS, err error) {
+	var b []byte
+	if b, err = ioutil.ReadAll(r); err != nil {
+		return
+	}
+	return ParseWKT(string(b))
+}
+
+func ParseWKT(wkt string) (crs *CRS, err error) {
+	var n *wktNode
+	if n, err = parseWKTNode(wkt); err != nil {
+		return
+	}
+	crs = &CRS{}
+	switch n.Keyword {
+	case "PROJCS":
+		crs.Name = n.name()
+		geog := n.child("GEOGCS")
+		if geog == nil {
+			return nil, fmt.Errorf("PROJCS without GEOGCS")
+		}
+		if err = crs.readGeogCS(geog); err != nil {
+			return
+		}
+		if p := n.child("PROJECTION"); p != nil {
+			crs.Projection = p.name()
+		} else {
+			return nil, fmt.Errorf("PROJCS without PROJECTION")
+		}
+		for _, c := range n.children("PARAMETER") {
+			crs.Parameters = append(crs.Parameters, Parameter{c.name(), c.number(1)})
+		}
+		if u := n.child("UNIT"); u != nil {
+			crs.LinearUnit = Unit{u.name(), u.number(1)}
+		} else {
+			crs.LinearUnit = Unit{"Meter", 1}
+		}
+	case "GEOGCS":
+		crs.Name = n.name()
+		if err = crs.readGeogCS(n); err != nil {
+			return
+		}
+	default:
+		return nil, fmt.Errorf("unsupported coordinate system: %s", n.Keyword)
+	}
+	crs.EPSG = n.authority()
+	if crs.EPSG == 0 {
+		crs.EPSG = guessEPSG(crs)
+	}
+	return
+}
+
+func (c *CRS) readGeogCS(n *wktNode) error {
+	c.GeogName = n.name()
+	d := n.child("DATUM")
+	if d == nil {
+		return fmt.Errorf("GEOGCS without DATUM")
+	}
+	c.Datum.Name = d.name()
+	s := d.child("SPHEROID")
+	if s == nil {
+		return fmt.Errorf("DATUM without SPHEROID")
+	}
+	c.Datum.Ellipsoid = Ellipsoid{s.name(), s.number(1), s.number(2)}
+	if s.number(1) <= 0 {
+		return fmt.Errorf("invalid semi major axis: %f", s.number(1))
+	}
+	if t := d.child("TOWGS84"); t != nil {
+		for i := range t.Values {
+			c.Datum.ToWGS84 = append(c.Datum.ToWGS84, t.number(i))
+		}
+	}
+	if p := n.child("PRIMEM"); p != nil {
+		c.PrimeMeridian = PrimeMeridian{p.name(), p.number(1)}
+	} else {
+		c.PrimeMeridian = PrimeMeridian{"Greenwich", 0}
+	}
+	if u := n.child("UNIT"); u != nil {
+		c.AngularUnit = Unit{u.name(), u.number(1)}
+	} else {
+		c.AngularUnit = Unit{"Degree", degree}
+	}
+	return nil
+}
+
+// WKT renders the CRS in the ESRI dialect expected in .prj files.
+func (c *CRS) WKT() string {
+	geog := fmt.Sprintf("GEOGCS[%q,DATUM[%q,SPHEROID[%q,%s,%s]", c.GeogName, c.Datum.Name,
+		c.Datum.Ellipsoid.Name, wktFloat(c.Datum.Ellipsoid.SemiMajor), wktFloat(c.Datum.Ellipsoid.InvFlattening))
+	if len(c.Datum.ToWGS84) != 0 {
+		vals := make([]string, len(c.Datum.ToWGS84))
+		for i, v := range c.Datum.ToWGS84 {
+			vals[i] = wktFloat(v)
+		}
+		geog += fmt.Sprintf(",TOWGS84[%s]", strings.Join(vals, ","))
+	}
+	geog += fmt.Sprintf("],PRIMEM[%q,%s],UNIT[%q,%s]]", c.PrimeMeridian.Name, wktFloat(c.PrimeMeridian.Longitude),
+		c.AngularUnit.Name, wktFloat(c.AngularUnit.Factor))
+	if c.IsGeographic() {
+		return geog
+	}
+	str := fmt.Sprintf("PROJCS[%q,%s,PROJECTION[%q]", c.Name, geog, c.Projection)
+	for _, p := range c.Parameters {
+		str += fmt.Sprintf(",PARAMETER[%q,%s]", p.Name, wktFloat(p.Value))
+	}
+	str += fmt.Sprintf(",UNIT[%q,%s]]", c.LinearUnit.Name, wktFloat(c.LinearUnit.Factor))
+	return str
+}
+
+// Write writes the CRS in .prj format to w.
+func (c *CRS) Write(w io.Writer) (err error) {
+	_, err = io.WriteString(w, c.WKT())
+	return
+}
+
+// ESRI writes numbers with at least one decimal place, e.g. `0.0`
+func wktFloat(f float64) string {
+	str := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(str, ".") {
+		str += ".0"
+	}
+	return str
+}
+
+const degree = 0.0174532925199433
+
+// CRSFromEPSG returns the definition of a few commonly used coordinate
+// reference systems: WGS84 (4326), ETRS89 (4258), DHDN (4314), Web Mercator
+// (3857), WGS84 UTM (32601-32660, 32701-32760), ETRS89 UTM (25828-25838)
+// and DHDN Gauss-Krüger (31466-31469).
+func CRSFromEPSG(code int) (crs *CRS, err error) {
+	var wkt string
+	switch {
+	case code == 4326, code == 4258, code == 4314:
+		wkt = epsgGeogCS[code]
+	case code == 3857:
+		wkt = `PROJCS["WGS_1984_Web_Mercator_Auxiliary_Sphere",` + epsgGeogCS[4326] +
+			`,PROJECTION["Mercator_Auxiliary_Sphere"],PARAMETER["False_Easting",0.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",0.0],PARAMETER["Standard_Parallel_1",0.0],PARAMETER["Auxiliary_Sphere_Type",0.0],UNIT["Meter",1.0]]`
+	case code > 32600 && code <= 32660:
+		wkt = utmWKT("WGS_1984", epsgGeogCS[4326], code-32600, false)
+	case code > 32700 && code <= 32760:
+		wkt = utmWKT("WGS_1984", epsgGeogCS[4326], code-32700, true)
+	case code >= 25828 && code <= 25838:
+		wkt = utmWKT("ETRS_1989", epsgGeogCS[4258], code-25800, false)
+	case code >= 31466 && code <= 31469:
+		zone := code - 31464
+		wkt = fmt.Sprintf(`PROJCS["DHDN_3_Degree_Gauss_Zone_%d",%s,PROJECTION["Gauss_Kruger"],PARAMETER["False_Easting",%d.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",%d.0],PARAMETER["Scale_Factor",1.0],PARAMETER["Latitude_Of_Origin",0.0],UNIT["Meter",1.0]]`,
+			zone, epsgGeogCS[4314], zone*1000000+500000, zone*3)
+	default:
+		return nil, fmt.Errorf("unknown EPSG code: %d", code)
+	}
+	if crs, err = ParseWKT(wkt); err != nil {
+		return
+	}
+	crs.EPSG = code
+	return
+}
+
+var epsgGeogCS = map[int]string{
+	4326: `GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984",SPHEROID["WGS_1984",6378137.0,298.257223563]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`,
+	4258: `GEOGCS["GCS_ETRS_1989",DATUM["D_ETRS_1989",SPHEROID["GRS_1980",6378137.0,298.257222101]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`,
+	4314: `GEOGCS["GCS_Deutsches_Hauptdreiecksnetz",DATUM["D_Deutsches_Hauptdreiecksnetz",SPHEROID["Bessel_1841",6377397.155,299.1528128]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`,
+}
+
+func utmWKT(datum, geogcs string, zone int, south bool) string {
+	hemi, northing := "N", 0
+	if south {
+		hemi, northing = "S", 10000000
+	}
+	return fmt.Sprintf(`PROJCS["%s_UTM_Zone_%d%s",%s,PROJECTION["Transverse_Mercator"],PARAMETER["False_Easting",500000.0],PARAMETER["False_Northing",%d.0],PARAMETER["Central_Meridian",%d.0],PARAMETER["Scale_Factor",0.9996],PARAMETER["Latitude_Of_Origin",0.0],UNIT["Meter",1.0]]`,
+		datum, zone, hemi, geogcs, northing, zone*6-183)
+}
+
+// ESRI .prj files don't carry AUTHORITY nodes, recognise the EPSG code
+// by the names ArcGIS uses instead.
+func guessEPSG(c *CRS) int {
+	if c.IsGeographic() {
+		switch strings.ToUpper(c.Name) {
+		case "GCS_WGS_1984", "WGS 84":
+			return 4326
+		case "GCS_ETRS_1989", "ETRS89":
+			return 4258
+		case "GCS_DEUTSCHES_HAUPTDREIECKSNETZ", "DHDN":
+			return 4314
+		case "GCS_NORTH_AMERICAN_1983", "NAD83":
+			return 4269
+		case "GCS_NORTH_AMERICAN_1927", "NAD27":
+			return 4267
+		}
+		return 0
+	}
+	name := strings.ToUpper(c.Name)
+	switch name {
+	case "WGS_1984_WEB_MERCATOR_AUXILIARY_SPHERE", "WGS_1984_WEB_MERCATOR", "WGS 84 / PSEUDO-MERCATOR":
+		return 3857
+	case "RGF_1993_LAMBERT_93", "RGF93 / LAMBERT-93":
+		return 2154
+	case "ETRS_1989_LAEA", "ETRS89 / LAEA EUROPE":
+		return 3035
+	}
+	var zone int
+	var hemi string
+	if i := strings.Index(name, "_UTM_ZONE_"); i != -1 {
+		if _, err := fmt.Sscanf(name[i+len("_UTM_ZONE_"):], "%d%s", &zone, &hemi); err != nil {
+			return 0
+		}
+		switch {
+		case strings.HasPrefix(name, "WGS_1984") && hemi == "N" && zone >= 1 && zone <= 60:
+			return 32600 + zone
+		case strings.HasPrefix(name, "WGS_1984") && hemi == "S" && zone >= 1 && zone <= 60:
+			return 32700 + zone
+		case strings.HasPrefix(name, "ETRS_1989") && hemi == "N" && zone >= 28 && zone <= 38:
+			return 25800 + zone
+		case strings.HasPrefix(name, "NAD_1983") && hemi == "N" && zone >= 1 && zone <= 23:
+			return 26900 + zone
+		}
+		return 0
+	}
+	if strings.HasPrefix(name, "DHDN_3_DEGREE_GAUSS_ZONE_") {
+		if _, err := fmt.Sscanf(name[len("DHDN_3_DEGREE_GAUSS_ZONE_"):], "%d", &zone); err == nil && zone >= 2 && zone <= 5 {
+			return 31464 + zone
+		}
+	}
+	return 0
+}
+
+// wktNode is a generic `KEYWORD[value, value, ...]` element, values are
+// strings, float64 or nested *wktNode.
+type wktNode struct {
+	Keyword string
+	Values  []interface{}
+}
+
+func (n *wktNode) name() string {
+	if len(n.Values) != 0 {
+		if s, ok := n.Values[0].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+func (n *wktNode) number(i int) float64 {
+	if i < len(n.Values) {
+		if f, ok := n.Values[i].(float64); ok {
+			return f
+		}
+	}
+	return 0
+}
+
+func (n *wktNode) child(keyword string) *wktNode {
+	for _, v := range n.Values {
+		if c, ok := v.(*wktNode); ok && c.Keyword == keyword {
+			return c
+		}
+	}
+	return nil
+}
+
+func (n *wktNode) children(keyword string) (nodes []*wktNode) {
+	for _, v := range n.Values {
+		if c, ok := v.(*wktNode); ok && c.Keyword == keyword {
+			nodes = append(nodes, c)
+		}
+	}
+	return
+}
+
+// authority returns the EPSG code of an AUTHORITY["EPSG","1234"] child.
+func (n *wktNode) authority() int {
+	a := n.child("AUTHORITY")
+	if a == nil || !strings.EqualFold(a.name(), "EPSG") || len(a.Values) < 2 {
+		return 0
+	}
+	switch v := a.Values[1].(type) {
+	case string:
+		code, _ := strconv.Atoi(v)
+		return code
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+func parseWKTNode(wkt string) (n *wktNode, err error) {
+	p := &wktParser{str: wkt}
+	if n, err = p.node(); err != nil {
+		return
+	}
+	p.skipSpace()
+	if p.pos != len(p.str) {
+		return nil, fmt.Errorf("unexpected trailing data at %d", p.pos)
+	}
+	return
+}
+
+type wktParser struct {
+	str string
+	pos int
+}
+
+func (p *wktParser) skipSpace() {
+	for p.pos < len(p.str) && strings.IndexByte(" \t\r\n", p.str[p.pos]) != -1 {
+		p.pos++
+	}
+}
+
+func (p *wktParser) word() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.str) {
+		c := p.str[p.pos]
+		if c == '_' || c == '.' || c == '-' || c == '+' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			p.pos++
+			continue
+		}
+		break
+	}
+	return p.str[start:p.pos]
+}
+
+func (p *wktParser) node() (n *wktNode, err error) {
+	n = &wktNode{Keyword: strings.ToUpper(p.word())}
+	if n.Keyword == "" {
+		return nil, fmt.Errorf("expected keyword at %d", p.pos)
+	}
+	p.skipSpace()
+	if p.pos == len(p.str) || (p.str[p.pos] != '[' && p.str[p.pos] != '(') {
+		return nil, fmt.Errorf("expected '[' after %s at %d", n.Keyword, p.pos)
+	}
+	closing := byte(']')
+	if p.str[p.pos] == '(' {
+		closing = ')'
+	}
+	p.pos++
+	for {
+		p.skipSpace()
+		if p.pos == len(p.str) {
+			return nil, fmt.Errorf("unterminated %s", n.Keyword)
+		}
+		switch c := p.str[p.pos]; {
+		case c == '"':
+			end := strings.IndexByte(p.str[p.pos+1:], '"')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated string at %d", p.pos)
+			}
+			n.Values = append(n.Values, p.str[p.pos+1:p.pos+1+end])
+			p.pos += end + 2
+		case c == '-' || c == '+' || c == '.' || (c >= '0' && c <= '9'):
+			w := p.word()
+			var f float64
+			if f, err = strconv.ParseFloat(w, 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", w, p.pos)
+			}
+			n.Values = append(n.Values, f)
+		default:
+			start := p.pos
+			w := p.word()
+			if w == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, p.pos)
+			}
+			p.skipSpace()
+			if p.pos < len(p.str) && (p.str[p.pos] == '[' || p.str[p.pos] == '(') {
+				p.pos = start
+				var child *wktNode
+				if child, err = p.node(); err != nil {
+					return
+				}
+				n.Values = append(n.Values, child)
+			} else {
+				// bare enum values such as AXIS["X",EAST]
+				n.Values = append(n.Values, w)
+			}
+		}
+		p.skipSpace()
+		if p.pos == len(p.str) {
+			return nil, fmt.Errorf("unterminated %s", n.Keyword)
+		}
+		switch p.str[p.pos] {
+		case ',':
+			p.pos++
+		case closing:
+			p.pos++
+			return
+		default:
+			return nil, fmt.Errorf("unexpected %q at %d", p.str[p.pos], p.pos)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package shapefile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const prj_etrs_utm32 = `PROJCS["ETRS_1989_UTM_Zone_32N",GEOGCS["GCS_ETRS_1989",DATUM["D_ETRS_1989",SPHEROID["GRS_1980",6378137.0,298.257222101]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]],PROJECTION["Transverse_Mercator"],PARAMETER["False_Easting",500000.0],PARAMETER["False_Northing",0.0],PARAMETER["Central_Meridian",9.0],PARAMETER["Scale_Factor",0.9996],PARAMETER["Latitude_Of_Origin",0.0],UNIT["Meter",1.0]]`
+
+func TestParsePRJ(t *testing.T) {
+	crs, err := NewCRSFromReader(strings.NewReader(prj_etrs_utm32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crs.Name != "ETRS_1989_UTM_Zone_32N" {
+		t.Errorf("unexpected name: %s", crs.Name)
+	}
+	if crs.IsGeographic() || crs.Projection != "Transverse_Mercator" {
+		t.Errorf("unexpected projection: %s", crs.Projection)
+	}
+	if crs.Datum.Ellipsoid.SemiMajor != 6378137.0 || crs.Datum.Ellipsoid.InvFlattening != 298.257222101 {
+		t.Errorf("unexpected ellipsoid: %v", crs.Datum.Ellipsoid)
+	}
+	if cm, ok := crs.Parameter("central_meridian"); !ok || cm != 9 {
+		t.Errorf("unexpected central meridian: %f", cm)
+	}
+	if crs.LinearUnit.Factor != 1 || crs.AngularUnit.Factor != degree {
+		t.Errorf("unexpected units: %v %v", crs.LinearUnit, crs.AngularUnit)
+	}
+	if crs.EPSG != 25832 {
+		t.Errorf("unexpected EPSG code: %d", crs.EPSG)
+	}
+
+	var buf bytes.Buffer
+	if err = crs.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != prj_etrs_utm32 {
+		t.Errorf("round trip failed:\n%s", buf.String())
+	}
+}
+
+func TestParseWKTAuthority(t *testing.T) {
+	wkt := `GEOGCS["WGS 84",
+	  DATUM["WGS_1984", SPHEROID["WGS 84",6378137,298.257223563, AUTHORITY["EPSG","7030"]],
+	    TOWGS84[0,0,0,0,0,0,0], AUTHORITY["EPSG","6326"]],
+	  PRIMEM["Greenwich",0], UNIT["degree",0.0174532925199433],
+	  AXIS["Latitude",NORTH], AXIS["Longitude",EAST], AUTHORITY["EPSG","4326"]]`
+	crs, err := ParseWKT(wkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !crs.IsGeographic() || crs.EPSG != 4326 || len(crs.Datum.ToWGS84) != 7 {
+		t.Errorf("unexpected crs: %s", crs.String())
+	}
+}
+
+func TestParseWKTInvalid(t *testing.T) {
+	for _, wkt := range []string{
+		``,
+		`GEOGCS["GCS_WGS_1984"`,
+		`GEOGCS["GCS_WGS_1984",PRIMEM["Greenwich",0.0]]`,
+		`LOCAL_CS["local"]`,
+	} {
+		if _, err := ParseWKT(wkt); err == nil {
+			t.Errorf("expected error for: %s", wkt)
+		}
+	}
+}
+
+func TestCRSFromEPSG(t *testing.T) {
+	for _, code := range []int{4326, 3857, 32632, 32733, 25832, 31467} {
+		crs, err := CRSFromEPSG(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// what we write must be recognised when read back
+		if crs2, err := ParseWKT(crs.WKT()); err != nil || crs2.EPSG != code {
+			t.Errorf("EPSG %d not recognised: %s", code, crs.WKT())
+		}
+	}
+	if _, err := CRSFromEPSG(1); err == nil {
+		t.Errorf("expected error for unknown code")
+	}
+}
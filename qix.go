@@ -0,0 +1,252 @@
+package shapefile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// .qix is the quadtree index used by shapelib, MapServer and GDAL. See
+// shptree.c in shapelib and maptree.c in MapServer.
+//
+// header (version 1):
+//	0  "SQT"
+//	3  byte order: 1 = LSB, 2 = MSB
+//	4  version 1
+//	5  3 bytes reserved
+//	8  int32 number of shapes
+//	12 int32 max depth of the tree
+// followed by the nodes, depth first:
+//	int32      number of bytes taken up by the children of this node
+//	float64[4] xmin, ymin, xmax, ymax
+//	int32      number of shapes in this node
+//	int32[]    0 based shape ids
+//	int32      number of children
+// Files without the "SQT" signature are the old native order format, of
+// which only the little endian variant is supported.
+
+type QIXIndex struct {
+	NumShapes int32
+	MaxDepth  int32
+	r         io.ReaderAt
+	order     binary.ByteOrder
+	root      int64 // offset of the root node
+}
+
+func NewQIXIndex(r io.ReaderAt) (idx *QIXIndex, err error) {
+	idx = &QIXIndex{r: r, order: L, root: 16}
+	hdr := make([]byte, 16)
+	if _, err = r.ReadAt(hdr, 0); err != nil {
+		return nil, err
+	}
+	if string(hdr[0:3]) == "SQT" {
+		switch hdr[3] {
+		case 1:
+		case 2:
+			idx.order = B
+		default:
+			return nil, fmt.Errorf("invalid byte order: %d", hdr[3])
+		}
+		if hdr[4] != 1 {
+			return nil, fmt.Errorf("unsupported .qix version: %d", hdr[4])
+		}
+		idx.NumShapes = int32(idx.order.Uint32(hdr[8:]))
+		idx.MaxDepth = int32(idx.order.Uint32(hdr[12:]))
+	} else {
+		idx.NumShapes = int32(idx.order.Uint32(hdr[0:]))
+		idx.MaxDepth = int32(idx.order.Uint32(hdr[4:]))
+		idx.root = 8
+	}
+	return
+}
+
+// Search returns the (0 based) indices of the shapes in all nodes of the
+// tree intersecting b. Only the nodes needed are read from disk. The
+// result may contain shapes that don't intersect b themselves.
+func (idx *QIXIndex) Search(b Box) (ids []int, err error) {
+	_, err = idx.searchNode(idx.root, b, &ids)
+	return
+}
+
+// searchNode returns the offset of the node following the node at off.
+func (idx *QIXIndex) searchNode(off int64, b Box, ids *[]int) (next int64, err error) {
+	raw := make([]byte, 40)
+	if _, err = idx.r.ReadAt(raw, off); err != nil {
+		return
+	}
+	childBytes := int64(int32(idx.order.Uint32(raw)))
+	nb := Box{
+		math.Float64frombits(idx.order.Uint64(raw[4:])),
+		math.Float64frombits(idx.order.Uint64(raw[12:])),
+		math.Float64frombits(idx.order.Uint64(raw[20:])),
+		math.Float64frombits(idx.order.Uint64(raw[28:])),
+	}
+	numShapes := int64(int32(idx.order.Uint32(raw[36:])))
+	if childBytes < 0 || numShapes < 0 {
+		return 0, fmt.Errorf("invalid node at %d", off)
+	}
+	next = off + 40 + numShapes*4 + 4 + childBytes
+	if !nb.Intersects(b) {
+		return
+	}
+
+	raw = make([]byte, numShapes*4+4)
+	if _, err = idx.r.ReadAt(raw, off+40); err != nil {
+		return
+	}
+	for i := int64(0); i != numShapes; i++ {
+		*ids = append(*ids, int(int32(idx.order.Uint32(raw[i*4:]))))
+	}
+	numChildren := int(int32(idx.order.Uint32(raw[numShapes*4:])))
+	child := off + 40 + numShapes*4 + 4
+	for i := 0; i != numChildren; i++ {
+		if child, err = idx.searchNode(child, b, ids); err != nil {
+			return
+		}
+	}
+	if child != next {
+		return 0, fmt.Errorf("inconsistent node size at %d", off)
+	}
+	return
+}
+
+// SearchRecords uses the .qix index to find candidate shapes and reads
+// them from shp via the .shx index, returning those whose bounding box
+// actually intersects b.
+func (idx *QIXIndex) SearchRecords(shp io.ReaderAt, shx *ShxFile, b Box) (recs []*Record, err error) {
+	var ids []int
+	if ids, err = idx.Search(b); err != nil {
+		return
+	}
+	return readIntersecting(shp, shx, ids, b)
+}
+
+type qixNode struct {
+	box      Box
+	ids      []int32
+	children []*qixNode
+}
+
+// shapelib splits nodes into overlapping halves
+const qixSplitRatio = 0.55
+
+// WriteQIX builds a quadtree over the shapes of s the same way shapelib's
+// shptree does and writes it to w in .qix format. If maxDepth is 0 it's
+// chosen from the number of shapes.
+func WriteQIX(w io.Writer, s *Shapefile, maxDepth int) (err error) {
+	h := s.Header
+	if maxDepth == 0 {
+		for nodes := 1; nodes*4 < len(s.Records); nodes *= 2 {
+			maxDepth++
+		}
+		maxDepth = max(1, min(maxDepth, 12))
+	}
+	root := &qixNode{box: Box{h.Xmin, h.Ymin, h.Xmax, h.Ymax}}
+	for i, r := range s.Records {
+		if b, ok := boxOf(r.Content); ok {
+			root.add(int32(i), b, maxDepth)
+		}
+	}
+	root.trim()
+
+	bw := bufio.NewWriter(w)
+	hdr := []byte{'S', 'Q', 'T', 1, 1, 0, 0, 0}
+	if _, err = bw.Write(hdr); err != nil {
+		return
+	}
+	if err = binary.Write(bw, L, []int32{int32(len(s.Records)), int32(maxDepth)}); err != nil {
+		return
+	}
+	if err = root.write(bw); err != nil {
+		return
+	}
+	return bw.Flush()
+}
+
+func (n *qixNode) add(id int32, b Box, depth int) {
+	if depth > 1 && n.children == nil {
+		h1, h2 := splitBox(n.box)
+		q1, q2 := splitBox(h1)
+		q3, q4 := splitBox(h2)
+		for _, q := range []Box{q1, q2, q3, q4} {
+			if boxContains(q, b) {
+				n.children = []*qixNode{{box: q1}, {box: q2}, {box: q3}, {box: q4}}
+				break
+			}
+		}
+	}
+	for _, c := range n.children {
+		if boxContains(c.box, b) {
+			c.add(id, b, depth-1)
+			return
+		}
+	}
+	n.ids = append(n.ids, id)
+}
+
+// trim removes empty subtrees, it returns true if n itself is empty.
+func (n *qixNode) trim() bool {
+	var children []*qixNode
+	for _, c := range n.children {
+		if !c.trim() {
+			children = append(children, c)
+		}
+	}
+	n.children = children
+	return len(n.ids) == 0 && len(n.children) == 0
+}
+
+// size returns the number of bytes taken up by n and its children.
+func (n *qixNode) size() (size int) {
+	size = 44 + 4*len(n.ids)
+	for _, c := range n.children {
+		size += c.size()
+	}
+	return
+}
+
+func (n *qixNode) write(w io.Writer) (err error) {
+	if err = binary.Write(w, L, int32(n.size()-44-4*len(n.ids))); err != nil {
+		return
+	}
+	if err = binary.Write(w, L, []float64{n.box.Xmin, n.box.Ymin, n.box.Xmax, n.box.Ymax}); err != nil {
+		return
+	}
+	if err = binary.Write(w, L, int32(len(n.ids))); err != nil {
+		return
+	}
+	if err = binary.Write(w, L, n.ids); err != nil {
+		return
+	}
+	if err = binary.Write(w, L, int32(len(n.children))); err != nil {
+		return
+	}
+	for _, c := range n.children {
+		if err = c.write(w); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// splitBox splits b along its longer side into two overlapping halves.
+func splitBox(b Box) (b1, b2 Box) {
+	b1, b2 = b, b
+	if b.Xmax-b.Xmin > b.Ymax-b.Ymin {
+		r := (b.Xmax - b.Xmin) * qixSplitRatio
+		b1.Xmax = b.Xmin + r
+		b2.Xmin = b.Xmax - r
+	} else {
+		r := (b.Ymax - b.Ymin) * qixSplitRatio
+		b1.Ymax = b.Ymin + r
+		b2.Ymin = b.Ymax - r
+	}
+	return
+}
+
+// boxContains reports whether inner lies completely within outer.
+func boxContains(outer, inner Box) bool {
+	return inner.Xmin >= outer.Xmin && inner.Xmax <= outer.Xmax && inner.Ymin >= outer.Ymin && inner.Ymax <= outer.Ymax
+}
@@ -0,0 +1,70 @@
+package shapefile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"sort"
+	"testing"
+)
+
+func TestQIX(t *testing.T) {
+	shp, _ := ioutil.ReadFile(testfile)
+	s, err := NewShapefile(bytes.NewReader(shp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = WriteQIX(&buf, s, 0); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := NewQIXIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.NumShapes != 299 || idx.MaxDepth != 7 {
+		t.Errorf("unexpected header: %d shapes, depth %d", idx.NumShapes, idx.MaxDepth)
+	}
+
+	// all shapes are found when querying the full extent
+	h := s.Header
+	ids, err := idx.Search(Box{h.Xmin, h.Ymin, h.Xmax, h.Ymax})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 299 {
+		t.Errorf("expected 299 shapes, found %d", len(ids))
+	}
+
+	q := Box{500000, 5500000, 550000, 5550000}
+	if ids, _ = idx.Search(q); len(ids) >= 299/2 {
+		t.Errorf("index doesn't narrow down the search: %d", len(ids))
+	}
+	recs, err := idx.SearchRecords(bytes.NewReader(shp), shxFor(t, testfile), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found, expected []int
+	for _, r := range recs {
+		found = append(found, int(r.Header.RecordNumber))
+	}
+	for _, r := range s.Records {
+		if b, _ := boxOf(r.Content); b.Intersects(q) {
+			expected = append(expected, int(r.Header.RecordNumber))
+		}
+	}
+	sort.Ints(found)
+	if len(expected) == 0 || len(found) != len(expected) {
+		t.Fatalf("expected %v, found %v", expected, found)
+	}
+	for i := range found {
+		if found[i] != expected[i] {
+			t.Errorf("expected %v, found %v", expected, found)
+		}
+	}
+}
+
+func TestQIXInvalid(t *testing.T) {
+	if _, err := NewQIXIndex(bytes.NewReader([]byte("SQT\x03\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"))); err == nil {
+		t.Errorf("expected error for invalid byte order")
+	}
+}
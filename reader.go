@@ -0,0 +1,89 @@
+package shapefile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Reader reads a shapefile and its attributes one feature at a time,
+// without keeping the whole file in memory.
+type Reader struct {
+	Header *MainFileHeader
+	Fields []FieldDescriptor // nil if there is no .dbf file
+	// Filter, if set, skips features whose attributes don't match. The
+	// geometry of skipped features is not decoded.
+	Filter *Filter
+
+	shp       io.Reader
+	dbf       *DBFFile
+	dbfReader io.Reader
+	remaining int32 // 16 bit words left in the .shp file
+	rawShape  []byte
+	rawEntry  []byte
+}
+
+// NewReader prepares reading the .shp file shp along with the .dbf file
+// dbf, which may be nil.
+func NewReader(shp, dbf io.Reader) (r *Reader, err error) {
+	r = &Reader{shp: shp, dbfReader: dbf}
+	if r.Header, err = NewMainFileHeaderFromReader(shp); err != nil {
+		return nil, err
+	}
+	r.remaining = r.Header.FileLength - 50
+	if dbf != nil {
+		r.dbf = &DBFFile{}
+		if err = r.dbf.readHead(dbf); err != nil {
+			return nil, err
+		}
+		r.Fields = r.dbf.FieldDescriptors
+		r.rawEntry = make([]byte, r.dbf.DBFFileHeader.LenRecord)
+	}
+	return
+}
+
+// Next returns the next feature, skipping deleted records and those not
+// matching the Filter. At the end of the file it returns io.EOF.
+func (r *Reader) Next() (f *Feature, err error) {
+	if r.Filter != nil && r.dbf == nil {
+		return nil, fmt.Errorf("can't filter without a .dbf file")
+	}
+	for r.remaining > 0 {
+		var rh *MainFileRecordHeader
+		if rh, err = NewMainFileRecordHeaderFromReader(r.shp); err != nil {
+			return nil, err
+		}
+		if rh.ContentLength < 0 {
+			return nil, fmt.Errorf("invalid content length %d in record %d", rh.ContentLength, rh.RecordNumber)
+		}
+		r.remaining -= rh.ContentLength + 4
+		if n := int(rh.ContentLength) * 2; cap(r.rawShape) < n {
+			r.rawShape = make([]byte, n)
+		}
+		raw := r.rawShape[:rh.ContentLength*2]
+		if _, err = io.ReadFull(r.shp, raw); err != nil {
+			return nil, err
+		}
+
+		f = &Feature{Record: &Record{Header: rh}}
+		if r.dbf != nil {
+			if _, err = io.ReadFull(r.dbfReader, r.rawEntry); err != nil {
+				return nil, err
+			}
+			if r.rawEntry[0] == 0x2a { // record deleted
+				continue
+			}
+			if f.Attributes, err = r.dbf.parseEntry(r.rawEntry); err != nil {
+				return nil, err
+			}
+			if r.Filter != nil && !r.Filter.Match(f.Attributes) {
+				continue
+			}
+		}
+		if f.Record.Content, err = RecordRecordContent(bytes.NewReader(raw)); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	return nil, io.EOF
+}
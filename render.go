@@ -0,0 +1,325 @@
+package shapefile
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+)
+
+// Style is the look of a feature, nil colors aren't drawn. Polygons are
+// filled and outlined, lines stroked and points drawn as filled circles.
+type Style struct {
+	Fill   color.Color
+	Stroke color.Color
+}
+
+// RenderOptions control Render.
+type RenderOptions struct {
+	// Width and Height of the image in pixels. Width defaults to 256, a
+	// zero Height follows from the aspect ratio of the extent. Otherwise
+	// the extent is centered keeping its aspect ratio.
+	Width, Height int
+	Extent        Box // zero for the extent of the dataset
+	Background    color.Color
+	Style         Style
+	StrokeWidth   float64 // in pixels, 1 if 0
+	PointRadius   float64 // in pixels, 3 if 0
+	// StyleFunc, if set, picks the style of each feature, e.g. one
+	// returned by CategoryStyle or GraduatedStyle.
+	StyleFunc func(f *Feature) Style
+}
+
+// Render draws the features of ds into an image. Polygons are filled
+// scanline by scanline using the even-odd rule, so holes stay empty
+// regardless of the orientation of their rings.
+func Render(ds *Dataset, opts RenderOptions) (img *image.RGBA, err error) {
+	var vp viewport
+	if vp, err = newViewport(ds, opts.Extent, opts.Width, opts.Height); err != nil {
+		return
+	}
+	img = image.NewRGBA(image.Rect(0, 0, vp.width, vp.height))
+	if opts.Background != nil {
+		draw.Draw(img, img.Bounds(), image.NewUniform(opts.Background), image.Point{}, draw.Src)
+	}
+	strokeWidth, radius := opts.StrokeWidth, opts.PointRadius
+	if strokeWidth <= 0 {
+		strokeWidth = 1
+	}
+	if radius <= 0 {
+		radius = 3
+	}
+	for _, f := range ds.Features() {
+		if f.Deleted {
+			continue
+		}
+		style := opts.Style
+		if opts.StyleFunc != nil {
+			style = opts.StyleFunc(f)
+		}
+		parts, areal := partsOf(f.Record.Content)
+		px := make([][]Point, len(parts))
+		for i, part := range parts {
+			px[i] = make([]Point, len(part))
+			for j, p := range part {
+				px[i][j] = vp.pixel(p)
+			}
+		}
+		if mp, ok := f.Record.Content.(*MultiPatch); ok && style.Fill != nil {
+			// the footprint of the triangles
+			m := mp.Triangulate()
+			for _, t := range m.Triangles {
+				tri := make([]Point, 3)
+				for i, v := range t {
+					tri[i] = vp.pixel(Point{m.Vertices[v][0], m.Vertices[v][1]})
+				}
+				fillRings(img, [][]Point{tri}, style.Fill)
+			}
+		}
+		if areal && style.Fill != nil {
+			fillRings(img, px, style.Fill)
+		}
+		for _, part := range px {
+			if len(part) == 1 {
+				c := style.Fill
+				if c == nil {
+					c = style.Stroke
+				}
+				if c != nil {
+					fillRings(img, [][]Point{circle(part[0], radius, 4)}, c)
+				}
+				continue
+			}
+			if style.Stroke != nil {
+				strokeLine(img, part, strokeWidth, style.Stroke)
+			}
+		}
+	}
+	return
+}
+
+// viewport maps map coordinates to pixels, y pointing down.
+type viewport struct {
+	width, height     int
+	scale, offX, offY float64
+	ext               Box
+}
+
+// newViewport fits the extent, that of the dataset if it's zero, into an
+// image as described for RenderOptions.
+func newViewport(ds *Dataset, ext Box, width, height int) (vp viewport, err error) {
+	if ext == (Box{}) {
+		h := ds.Shapefile.Header
+		ext = Box{h.Xmin, h.Ymin, h.Xmax, h.Ymax}
+	}
+	if ext.Xmin > ext.Xmax || ext.Ymin > ext.Ymax {
+		return vp, fmt.Errorf("invalid extent %v", &ext)
+	}
+	// make room around single points or straight lines
+	if ext.Xmax == ext.Xmin {
+		ext.Xmin, ext.Xmax = ext.Xmin-1, ext.Xmax+1
+	}
+	if ext.Ymax == ext.Ymin {
+		ext.Ymin, ext.Ymax = ext.Ymin-1, ext.Ymax+1
+	}
+	if width <= 0 {
+		width = 256
+	}
+	if height <= 0 {
+		height = int(math.Max(1, math.Round(float64(width)*(ext.Ymax-ext.Ymin)/(ext.Xmax-ext.Xmin))))
+	}
+	vp = viewport{width: width, height: height, ext: ext}
+	vp.scale = math.Min(float64(width)/(ext.Xmax-ext.Xmin), float64(height)/(ext.Ymax-ext.Ymin))
+	vp.offX = (float64(width) - vp.scale*(ext.Xmax-ext.Xmin)) / 2
+	vp.offY = (float64(height) - vp.scale*(ext.Ymax-ext.Ymin)) / 2
+	return
+}
+
+func (vp viewport) pixel(p Point) Point {
+	return Point{vp.offX + (p.X-vp.ext.Xmin)*vp.scale, vp.offY + (vp.ext.Ymax-p.Y)*vp.scale}
+}
+
+// fillRings fills the area enclosed by the rings, given in pixels, using
+// the even-odd rule. Pixels are filled if their center is inside.
+func fillRings(img *image.RGBA, rings [][]Point, c color.Color) {
+	type edge struct{ a, b Point } // a above b
+	var edges []edge
+	for _, ring := range rings {
+		for i := range ring {
+			a, b := ring[i], ring[(i+1)%len(ring)]
+			if a.Y == b.Y {
+				continue
+			}
+			if a.Y > b.Y {
+				a, b = b, a
+			}
+			edges = append(edges, edge{a, b})
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].a.Y < edges[j].a.Y })
+	bounds := img.Bounds()
+	src := image.NewUniform(c)
+	first := int(math.Max(float64(bounds.Min.Y), math.Floor(edges[0].a.Y)))
+	var active []edge
+	var xs []float64
+	next := 0
+	for y := first; y < bounds.Max.Y; y++ {
+		cy := float64(y) + 0.5
+		for next < len(edges) && edges[next].a.Y <= cy {
+			active = append(active, edges[next])
+			next++
+		}
+		xs = xs[:0]
+		kept := active[:0]
+		for _, e := range active {
+			if e.b.Y <= cy {
+				continue // done with
+			}
+			kept = append(kept, e)
+			if e.a.Y <= cy {
+				xs = append(xs, e.a.X+(cy-e.a.Y)*(e.b.X-e.a.X)/(e.b.Y-e.a.Y))
+			}
+		}
+		active = kept
+		if len(active) == 0 && next == len(edges) {
+			break
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			x0 := int(math.Max(float64(bounds.Min.X), math.Ceil(xs[i]-0.5)))
+			x1 := int(math.Min(float64(bounds.Max.X), math.Ceil(xs[i+1]-0.5)))
+			if x0 < x1 {
+				draw.Draw(img, image.Rect(x0, y, x1, y+1), src, image.Point{}, draw.Over)
+			}
+		}
+	}
+}
+
+// strokeLine draws the line, given in pixels, as a quadrilateral per
+// segment, with round joins if it is wide enough for them to show.
+func strokeLine(img *image.RGBA, line []Point, width float64, c color.Color) {
+	w := width / 2
+	for i := 1; i < len(line); i++ {
+		a, b := line[i-1], line[i]
+		l := math.Hypot(b.X-a.X, b.Y-a.Y)
+		if l == 0 {
+			continue
+		}
+		nx, ny := -(b.Y-a.Y)/l*w, (b.X-a.X)/l*w
+		fillRings(img, [][]Point{{{a.X + nx, a.Y + ny}, {b.X + nx, b.Y + ny}, {b.X - nx, b.Y - ny}, {a.X - nx, a.Y - ny}}}, c)
+	}
+	if width > 2 {
+		for _, p := range line {
+			fillRings(img, [][]Point{circle(p, w, 2)}, c)
+		}
+	}
+}
+
+// DefaultPalette are the colors CategoryStyle uses if none are given.
+var DefaultPalette = []color.Color{
+	color.RGBA{0x8d, 0xd3, 0xc7, 0xff}, color.RGBA{0xff, 0xff, 0xb3, 0xff},
+	color.RGBA{0xbe, 0xba, 0xda, 0xff}, color.RGBA{0xfb, 0x80, 0x72, 0xff},
+	color.RGBA{0x80, 0xb1, 0xd3, 0xff}, color.RGBA{0xfd, 0xb4, 0x62, 0xff},
+	color.RGBA{0xb3, 0xde, 0x69, 0xff}, color.RGBA{0xfc, 0xcd, 0xe5, 0xff},
+	color.RGBA{0xd9, 0xd9, 0xd9, 0xff}, color.RGBA{0xbc, 0x80, 0xbd, 0xff},
+	color.RGBA{0xcc, 0xeb, 0xc5, 0xff}, color.RGBA{0xff, 0xed, 0x6f, 0xff},
+}
+
+// CategoryStyle fills features by the value of field, giving each
+// distinct value the next color of the palette in the order they appear
+// in ds. The palette is reused if there are more values than colors.
+func CategoryStyle(ds *Dataset, field string, base Style, palette []color.Color) (func(*Feature) Style, error) {
+	col, err := styleField(ds, field)
+	if err != nil {
+		return nil, err
+	}
+	if len(palette) == 0 {
+		palette = DefaultPalette
+	}
+	colors := map[interface{}]color.Color{}
+	for _, f := range ds.Features() {
+		if f.Attributes == nil {
+			continue
+		}
+		if k := groupKey(f.Attributes[col]); colors[k] == nil {
+			colors[k] = palette[len(colors)%len(palette)]
+		}
+	}
+	return func(f *Feature) Style {
+		s := base
+		if f.Attributes != nil {
+			if c := colors[groupKey(f.Attributes[col])]; c != nil {
+				s.Fill = c
+			}
+		}
+		return s
+	}, nil
+}
+
+// GraduatedStyle fills features by the numeric value of field, dividing
+// the range of values in ds into classes of equal width colored from
+// from to to. Features without a value keep the base style.
+func GraduatedStyle(ds *Dataset, field string, base Style, from, to color.Color, classes int) (func(*Feature) Style, error) {
+	col, err := styleField(ds, field)
+	if err != nil {
+		return nil, err
+	}
+	if classes < 1 {
+		classes = 5
+	}
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, f := range ds.Features() {
+		if f.Attributes == nil {
+			continue
+		}
+		if v, ok := keyNumber(f.Attributes[col]); ok {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	ramp := make([]color.Color, classes)
+	for i := range ramp {
+		t := 0.0
+		if classes > 1 {
+			t = float64(i) / float64(classes-1)
+		}
+		ramp[i] = mixColors(from, to, t)
+	}
+	return func(f *Feature) Style {
+		s := base
+		if f.Attributes == nil {
+			return s
+		}
+		if v, ok := keyNumber(f.Attributes[col]); ok {
+			class := 0
+			if hi > lo {
+				class = int(math.Min(float64(classes-1), math.Floor((v-lo)/(hi-lo)*float64(classes))))
+			}
+			s.Fill = ramp[class]
+		}
+		return s
+	}, nil
+}
+
+func styleField(ds *Dataset, field string) (col int, err error) {
+	if ds.DBF == nil {
+		return -1, fmt.Errorf("dataset has no attributes")
+	}
+	if col = ds.DBF.fieldIndex(field); col == -1 {
+		return -1, fmt.Errorf("no such field: %s", field)
+	}
+	return
+}
+
+func mixColors(a, b color.Color, t float64) color.Color {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	mix := func(x, y uint32) uint16 {
+		return uint16(math.Round(float64(x) + t*(float64(y)-float64(x))))
+	}
+	return color.RGBA64{mix(ar, br), mix(ag, bg), mix(ab, bb), mix(aa, ba)}
+}
@@ -0,0 +1,85 @@
+package shapefile
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	ds := NewDataset(POLYGON, nil, nil)
+	ds.Add(polygon(square(0, 0, 10, 10), square(3, 3, 7, 7)), nil)
+	red, white := color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}
+	img, err := Render(ds, RenderOptions{Width: 20, Background: white, Style: Style{Fill: red}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 20 || b.Dy() != 20 {
+		t.Fatalf("unexpected size %v", b)
+	}
+	filled := 0
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			if img.RGBAAt(x, y) == red {
+				filled++
+			}
+		}
+	}
+	// 400 pixels minus the 8x8 hole
+	if filled != 400-64 {
+		t.Errorf("expected 336 filled pixels, got %d", filled)
+	}
+	if img.RGBAAt(10, 10) != white || img.RGBAAt(1, 1) != red {
+		t.Errorf("hole filled or ring empty")
+	}
+
+	// the extent is centered keeping its aspect ratio
+	ds = NewDataset(POLY_LINE, nil, nil)
+	ds.Add(polyline(Point{0, 0}, Point{10, 0}), nil)
+	img, _ = Render(ds, RenderOptions{Width: 10, Height: 10, Extent: Box{0, 0, 10, 2}, Style: Style{Stroke: red}})
+	if img.RGBAAt(5, 5) != red || img.RGBAAt(5, 4) == red || img.RGBAAt(5, 3) == red {
+		t.Errorf("expected a line across the middle of the image")
+	}
+}
+
+func TestRenderStyles(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	category, err := CategoryStyle(ds, "land_name", Style{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fills := map[color.Color]bool{}
+	for _, f := range ds.Features() {
+		fills[category(f).Fill] = true
+	}
+	if len(fills) != 12 {
+		t.Errorf("expected the 16 states to use all 12 colors, got %d", len(fills))
+	}
+
+	from, to := color.RGBA{0, 0, 0, 0xff}, color.RGBA{0xff, 0xff, 0xff, 0xff}
+	graduated, err := GraduatedStyle(ds, "WKR_NR", Style{}, from, to, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last := ds.Features()[0], ds.Features()[len(ds.Features())-1]
+	if c := color.RGBAModel.Convert(graduated(first).Fill); c != from {
+		t.Errorf("expected district %v in the first class, got %v", first.Attributes[0], c)
+	}
+	if c := color.RGBAModel.Convert(graduated(last).Fill); c != to {
+		t.Errorf("expected district %v in the last class, got %v", last.Attributes[0], c)
+	}
+	if _, err = GraduatedStyle(ds, "NOPE", Style{}, from, to, 3); err == nil {
+		t.Errorf("expected an unknown field to fail")
+	}
+
+	img, err := Render(ds, RenderOptions{Width: 200, StyleFunc: category})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the middle of Germany is in Hessen or Thüringen
+	if _, _, _, a := img.At(img.Bounds().Dx()/2, img.Bounds().Dy()/2).RGBA(); a == 0 {
+		t.Errorf("expected the center to be filled")
+	}
+}
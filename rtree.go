@@ -0,0 +1,154 @@
+package shapefile
+
+import (
+	"container/heap"
+	"iter"
+	"math"
+	"sort"
+)
+
+// RTree is a static R-tree over bounding boxes, bulk loaded using the
+// Sort-Tile-Recursive algorithm:
+// Leutenegger et al. "STR: A Simple and Efficient Algorithm for R-Tree Packing"
+// Items are identified by their index in the slice passed to NewRTree.
+type RTree struct {
+	root *rtreeNode
+}
+
+// number of entries per node
+const rtreeNodeSize = 16
+
+type rtreeNode struct {
+	box      Box
+	children []*rtreeNode // nil for leaves
+	id       int          // item index, only valid for leaves
+}
+
+func NewRTree(boxes []Box) *RTree {
+	if len(boxes) == 0 {
+		return &RTree{}
+	}
+	nodes := make([]*rtreeNode, len(boxes))
+	for i, b := range boxes {
+		nodes[i] = &rtreeNode{box: b, id: i}
+	}
+	for len(nodes) > 1 {
+		nodes = strPack(nodes)
+	}
+	return &RTree{nodes[0]}
+}
+
+// strPack groups nodes into parents of at most rtreeNodeSize children.
+func strPack(nodes []*rtreeNode) (parents []*rtreeNode) {
+	numParents := (len(nodes) + rtreeNodeSize - 1) / rtreeNodeSize
+	numSlabs := int(math.Ceil(math.Sqrt(float64(numParents))))
+	slabSize := numSlabs * rtreeNodeSize
+
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].box.Xmin+nodes[i].box.Xmax < nodes[j].box.Xmin+nodes[j].box.Xmax
+	})
+	for s := 0; s < len(nodes); s += slabSize {
+		slab := nodes[s:min(s+slabSize, len(nodes))]
+		sort.Slice(slab, func(i, j int) bool {
+			return slab[i].box.Ymin+slab[i].box.Ymax < slab[j].box.Ymin+slab[j].box.Ymax
+		})
+		for i := 0; i < len(slab); i += rtreeNodeSize {
+			children := slab[i:min(i+rtreeNodeSize, len(slab))]
+			parent := &rtreeNode{children: append([]*rtreeNode{}, children...), box: children[0].box}
+			for _, c := range children[1:] {
+				parent.box = parent.box.union(c.box)
+			}
+			parents = append(parents, parent)
+		}
+	}
+	return
+}
+
+// Search calls yield with the index of every box intersecting b.
+func (t *RTree) Search(b Box) iter.Seq[int] {
+	return func(yield func(int) bool) {
+		if t.root != nil {
+			t.root.search(b, yield)
+		}
+	}
+}
+
+func (n *rtreeNode) search(b Box, yield func(int) bool) bool {
+	if !n.box.Intersects(b) {
+		return true
+	}
+	if n.children == nil {
+		return yield(n.id)
+	}
+	for _, c := range n.children {
+		if !c.search(b, yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// Nearest returns the indices of up to k items closest to (x, y), closest
+// first. dist computes the exact distance of an item, it must never be
+// less than the distance to the item's bounding box. If dist is nil, the
+// distance to the bounding box is used.
+func (t *RTree) Nearest(x, y float64, k int, dist func(id int) float64) (ids []int) {
+	if t.root == nil || k <= 0 {
+		return
+	}
+	// best first search, items are queued a second time with their exact
+	// distance once their box is the closest candidate.
+	q := &rtreeQueue{{node: t.root, dist: t.root.box.distance(x, y)}}
+	for q.Len() != 0 && len(ids) < k {
+		e := heap.Pop(q).(rtreeQueueEntry)
+		switch {
+		case e.exact:
+			ids = append(ids, e.node.id)
+		case e.node.children == nil:
+			d := e.dist
+			if dist != nil {
+				d = dist(e.node.id)
+			}
+			heap.Push(q, rtreeQueueEntry{node: e.node, dist: d, exact: true})
+		default:
+			for _, c := range e.node.children {
+				heap.Push(q, rtreeQueueEntry{node: c, dist: c.box.distance(x, y)})
+			}
+		}
+	}
+	return
+}
+
+type rtreeQueueEntry struct {
+	node  *rtreeNode
+	dist  float64
+	exact bool
+}
+
+type rtreeQueue []rtreeQueueEntry
+
+func (q rtreeQueue) Len() int            { return len(q) }
+func (q rtreeQueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q rtreeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *rtreeQueue) Push(x interface{}) { *q = append(*q, x.(rtreeQueueEntry)) }
+func (q *rtreeQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+func (b Box) Intersects(o Box) bool {
+	return b.Xmin <= o.Xmax && o.Xmin <= b.Xmax && b.Ymin <= o.Ymax && o.Ymin <= b.Ymax
+}
+
+func (b Box) union(o Box) Box {
+	return Box{math.Min(b.Xmin, o.Xmin), math.Min(b.Ymin, o.Ymin), math.Max(b.Xmax, o.Xmax), math.Max(b.Ymax, o.Ymax)}
+}
+
+// distance from (x, y) to the box, 0 if the point is inside.
+func (b Box) distance(x, y float64) float64 {
+	dx := math.Max(0, math.Max(b.Xmin-x, x-b.Xmax))
+	dy := math.Max(0, math.Max(b.Ymin-y, y-b.Ymax))
+	return math.Hypot(dx, dy)
+}
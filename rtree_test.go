@@ -0,0 +1,91 @@
+package shapefile
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestRTreeSearch(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	boxes := make([]Box, 1000)
+	for i := range boxes {
+		x, y := rnd.Float64()*1000, rnd.Float64()*1000
+		boxes[i] = Box{x, y, x + rnd.Float64()*20, y + rnd.Float64()*20}
+	}
+	tree := NewRTree(boxes)
+	for i := 0; i != 100; i++ {
+		x, y := rnd.Float64()*1000, rnd.Float64()*1000
+		q := Box{x, y, x + 50, y + 50}
+
+		var expected, found []int
+		for id, b := range boxes {
+			if b.Intersects(q) {
+				expected = append(expected, id)
+			}
+		}
+		for id := range tree.Search(q) {
+			found = append(found, id)
+		}
+		sort.Ints(found)
+		if len(found) != len(expected) {
+			t.Fatalf("expected %d results, found %d", len(expected), len(found))
+		}
+		for i := range found {
+			if found[i] != expected[i] {
+				t.Fatalf("unexpected result: %v", found)
+			}
+		}
+	}
+
+	if ids := tree.Nearest(500, 500, 3, nil); len(ids) != 3 {
+		t.Errorf("unexpected nearest: %v", ids)
+	} else if boxes[ids[0]].distance(500, 500) > boxes[ids[2]].distance(500, 500) {
+		t.Errorf("nearest not ordered: %v", ids)
+	}
+	if ids := NewRTree(nil).Nearest(0, 0, 1, nil); len(ids) != 0 {
+		t.Errorf("empty tree found something")
+	}
+}
+
+func TestDatasetQuery(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.Features()) != 299 || ds.Features()[0].Attributes == nil {
+		t.Fatalf("unexpected features")
+	}
+
+	// everything
+	h := ds.Shapefile.Header
+	count := 0
+	for range ds.Query(Box{h.Xmin, h.Ymin, h.Xmax, h.Ymax}) {
+		count++
+	}
+	if count != 299 {
+		t.Errorf("expected all features, found %d", count)
+	}
+
+	// a point within the first district must be found in exactly one polygon
+	first := ds.Features()[0].Record.Content.(*Polygon)
+	p := first.Points[0]
+	nearest := ds.Nearest(p, 1)
+	if len(nearest) != 1 || pointDistance(p.X, p.Y, nearest[0].Record.Content) != 0 {
+		t.Errorf("nearest district doesn't contain the point")
+	}
+	var containing []*Feature
+	for f := range ds.Query(Box{p.X, p.Y, p.X, p.Y}) {
+		if pointDistance(p.X, p.Y, f.Record.Content) == 0 {
+			containing = append(containing, f)
+		}
+	}
+	if len(containing) == 0 {
+		t.Errorf("no district contains the point")
+	}
+
+	// far away from everything
+	if n := ds.Nearest(Point{0, 0}, 2); len(n) != 2 {
+		t.Errorf("expected 2 features, found %d", len(n))
+	}
+}
@@ -0,0 +1,231 @@
+package shapefile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// .sbn/.sbx are ESRI's proprietary spatial index files. There is no
+// official documentation, this follows the reverse engineered format as
+// implemented in GDAL's sbnsearch.c:
+//
+// .sbn: 100 byte header
+//	0   int32 BE  file code 9994
+//	4   int32 BE  -400
+//	24  int32 BE  file length in 16 bit words
+//	28  int32 BE  number of shapes
+//	32  4 x float64 BE  xmin, ymin, xmax, ymax
+//	... z and m range, unused
+// followed by the bin header record (id -1) containing an (offset, count)
+// pair per tree node: the offset in 16 bit words of the node's first bin
+// and the number of features in its bins. The bins follow. Each bin
+// starts with its id and length in 16 bit words, followed by up to 100
+// features of 8 bytes: the feature's bounding box quantized to 0-255 over
+// the extent of the file (xmin, ymin, xmax, ymax) and its 1 based shape
+// id (int32 BE). A node with more than 100 features has several bins in a
+// row.
+//
+// The nodes form a complete binary tree over the 256x256 grid, stored
+// breadth first: the children of node i are 2i+1 and 2i+2 and halve its
+// extent, the root's along x, theirs along y and so on. A feature is
+// kept in the deepest node it fits in, so only the nodes whose extent
+// meets the query need to be read.
+//
+// .sbx: the same header as .sbn followed by an (offset, length) pair per
+// record of the .sbn in 16 bit words, exactly like .shx. The node offsets
+// make it redundant.
+
+type SBNHeader struct {
+	FileLength int32 // in 16 bit words
+	NumShapes  int32
+	Xmin       float64
+	Ymin       float64
+	Xmax       float64
+	Ymax       float64
+}
+
+type SBNIndex struct {
+	Header *SBNHeader
+	r      io.ReaderAt
+	nodes  []sbnNode
+}
+
+type sbnNode struct {
+	offset int64 // of the first bin, in bytes
+	count  int   // of the features in the node's bins
+}
+
+type sbnRecordHeader struct {
+	ID     int32
+	Length int32 // in 16 bit words
+}
+
+func readSBNHeader(r io.Reader) (hdr *SBNHeader, err error) {
+	raw := make([]byte, 100)
+	if _, err = io.ReadFull(r, raw); err != nil {
+		return
+	}
+	if code := int32(B.Uint32(raw)); code != 9994 {
+		return nil, fmt.Errorf("invalid fileCode: %d", code)
+	}
+	hdr = &SBNHeader{
+		FileLength: int32(B.Uint32(raw[24:])),
+		NumShapes:  int32(B.Uint32(raw[28:])),
+	}
+	bounds := []*float64{&hdr.Xmin, &hdr.Ymin, &hdr.Xmax, &hdr.Ymax}
+	for i, f := range bounds {
+		*f = math.Float64frombits(B.Uint64(raw[32+8*i:]))
+	}
+	// some writers use little endian, as in .shp
+	if !(hdr.Xmin <= hdr.Xmax && hdr.Ymin <= hdr.Ymax) || math.IsInf(hdr.Xmax-hdr.Xmin, 0) {
+		for i, f := range bounds {
+			*f = math.Float64frombits(L.Uint64(raw[32+8*i:]))
+		}
+	}
+	if !(hdr.Xmin <= hdr.Xmax && hdr.Ymin <= hdr.Ymax) {
+		return nil, fmt.Errorf("invalid extent")
+	}
+	return
+}
+
+// NewSBNIndex prepares queries against the .sbn file in sbn by reading
+// its tree nodes. The .sbx file isn't needed for that, if sbx isn't nil
+// it is only checked to belong to the .sbn.
+func NewSBNIndex(sbn io.ReaderAt, sbx io.Reader) (idx *SBNIndex, err error) {
+	idx = &SBNIndex{r: sbn}
+	if idx.Header, err = readSBNHeader(io.NewSectionReader(sbn, 0, 100)); err != nil {
+		return nil, err
+	}
+	if sbx != nil {
+		var hdr *SBNHeader
+		if hdr, err = readSBNHeader(sbx); err != nil {
+			return nil, err
+		}
+		if hdr.NumShapes != idx.Header.NumShapes {
+			return nil, fmt.Errorf(".sbx for %d shapes, .sbn for %d", hdr.NumShapes, idx.Header.NumShapes)
+		}
+	}
+
+	var rh sbnRecordHeader
+	if err = binary.Read(io.NewSectionReader(sbn, 100, 8), B, &rh); err != nil {
+		return nil, err
+	}
+	if rh.ID != -1 || rh.Length < 0 {
+		return nil, fmt.Errorf("invalid bin header")
+	}
+	raw := make([]byte, int(rh.Length)*2)
+	if _, err = io.ReadFull(io.NewSectionReader(sbn, 108, int64(len(raw))), raw); err != nil {
+		return nil, err
+	}
+	idx.nodes = make([]sbnNode, len(raw)/8)
+	for i := range idx.nodes {
+		offset, count := int32(B.Uint32(raw[8*i:])), int32(B.Uint32(raw[8*i+4:]))
+		if count < 0 || count > idx.Header.NumShapes || (count > 0 && offset <= 0) {
+			return nil, fmt.Errorf("invalid node %d: %d features at %d", i, count, offset)
+		}
+		idx.nodes[i] = sbnNode{int64(offset) * 2, int(count)}
+	}
+	return
+}
+
+// quantize maps a box into the 0-255 grid of the index, rounding
+// outwards.
+func (idx *SBNIndex) quantize(b Box) (q [4]int) {
+	h := idx.Header
+	scale := func(v, min, max float64, up bool) int {
+		if max == min {
+			return 0
+		}
+		f := (v - min) / (max - min) * 255
+		if up {
+			f = math.Ceil(f)
+		} else {
+			f = math.Floor(f)
+		}
+		return int(math.Max(0, math.Min(255, f)))
+	}
+	return [4]int{
+		scale(b.Xmin, h.Xmin, h.Xmax, false), scale(b.Ymin, h.Ymin, h.Ymax, false),
+		scale(b.Xmax, h.Xmin, h.Xmax, true), scale(b.Ymax, h.Ymin, h.Ymax, true),
+	}
+}
+
+// Search returns the (0 based) indices of the shapes whose quantized
+// bounding box intersects b. Because of the quantization the result may
+// contain shapes that don't intersect b, but none are missing. Only the
+// bins of the tree nodes whose extent meets b are read.
+func (idx *SBNIndex) Search(b Box) (ids []int, err error) {
+	h := idx.Header
+	if b.Xmin > h.Xmax || b.Xmax < h.Xmin || b.Ymin > h.Ymax || b.Ymax < h.Ymin {
+		return
+	}
+	q := idx.quantize(b)
+	var search func(node int, extent [4]int, axis int) error
+	search = func(node int, extent [4]int, axis int) error {
+		if node >= len(idx.nodes) {
+			return nil
+		}
+		var rh sbnRecordHeader
+		off := idx.nodes[node].offset
+		for left := idx.nodes[node].count; left > 0; left -= int(rh.Length) / 4 {
+			if err := binary.Read(io.NewSectionReader(idx.r, off, 8), B, &rh); err != nil {
+				return err
+			}
+			if rh.Length < 4 {
+				return fmt.Errorf("invalid bin length %d at %d", rh.Length, off)
+			}
+			raw := make([]byte, int(rh.Length)*2)
+			if _, err := io.ReadFull(io.NewSectionReader(idx.r, off+8, int64(len(raw))), raw); err != nil {
+				return err
+			}
+			for f := 0; f+8 <= len(raw); f += 8 {
+				if int(raw[f]) <= q[2] && int(raw[f+2]) >= q[0] && int(raw[f+1]) <= q[3] && int(raw[f+3]) >= q[1] {
+					ids = append(ids, int(B.Uint32(raw[f+4:]))-1)
+				}
+			}
+			off += 8 + int64(len(raw))
+		}
+		// the children split the extent at mid, the cells next to it are
+		// searched on both sides in case a writer rounds differently.
+		mid := 1 + (extent[axis]+extent[axis+2])/2
+		lower, upper := extent, extent
+		lower[axis+2], upper[axis] = mid, mid-1
+		if q[axis] <= lower[axis+2] {
+			if err := search(2*node+1, lower, 1-axis); err != nil {
+				return err
+			}
+		}
+		if q[axis+2] >= upper[axis] {
+			return search(2*node+2, upper, 1-axis)
+		}
+		return nil
+	}
+	err = search(0, [4]int{0, 0, 255, 255}, 0)
+	return
+}
+
+// SearchRecords uses the .sbn index to find candidate shapes and reads
+// them from shp via the .shx index, returning those whose bounding box
+// actually intersects b.
+func (idx *SBNIndex) SearchRecords(shp io.ReaderAt, shx *ShxFile, b Box) (recs []*Record, err error) {
+	var ids []int
+	if ids, err = idx.Search(b); err != nil {
+		return
+	}
+	return readIntersecting(shp, shx, ids, b)
+}
+
+func readIntersecting(shp io.ReaderAt, shx *ShxFile, ids []int, b Box) (recs []*Record, err error) {
+	var rec *Record
+	for _, id := range ids {
+		if rec, err = shx.ReadRecord(shp, id); err != nil {
+			return nil, err
+		}
+		if rb, ok := boxOf(rec.Content); ok && rb.Intersects(b) {
+			recs = append(recs, rec)
+		}
+	}
+	return
+}
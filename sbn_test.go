@@ -0,0 +1,213 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"testing"
+)
+
+// shxFor creates the .shx index of the test file by walking its records.
+func shxFor(t *testing.T, fn string) *ShxFile {
+	file, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	s, err := NewShapefile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shx := &ShxFile{Header: s.Header}
+	offset := int32(50)
+	for _, r := range s.Records {
+		shx.Records = append(shx.Records, ShxRecord{offset, r.Header.ContentLength})
+		offset += 4 + r.Header.ContentLength
+	}
+	return shx
+}
+
+// sbnFor writes a .sbn keeping each shape in the deepest node of a tree
+// of depth 6 it fits in, nodes in bins of up to 100, and the matching
+// .sbx. It returns the extent of each node and the node of each bin.
+func sbnFor(s *Shapefile) (sbn, sbx []byte, extents [][4]int, binNodes map[int64]int) {
+	const depth = 6
+	h := s.Header
+	q := func(v, min, max float64) byte {
+		return byte(math.Floor((v - min) / (max - min) * 255))
+	}
+	extents = make([][4]int, 1<<depth-1)
+	extents[0] = [4]int{0, 0, 255, 255}
+	for i := 1; i < len(extents); i++ {
+		parent := extents[(i-1)/2]
+		axis := 0
+		if d := int(math.Log2(float64(i + 1))); d%2 == 0 {
+			axis = 1
+		}
+		mid := 1 + (parent[axis]+parent[axis+2])/2
+		extents[i] = parent
+		if i%2 == 1 {
+			extents[i][axis+2] = mid - 1
+		} else {
+			extents[i][axis] = mid
+		}
+	}
+	features := make([][]byte, len(extents))
+	for i, r := range s.Records {
+		b, _ := boxOf(r.Content)
+		f := []byte{q(b.Xmin, h.Xmin, h.Xmax), q(b.Ymin, h.Ymin, h.Ymax), q(b.Xmax, h.Xmin, h.Xmax), q(b.Ymax, h.Ymin, h.Ymax), 0, 0, 0, 0}
+		B.PutUint32(f[4:], uint32(i+1))
+		node := 0
+		for {
+			fits := func(c int) bool {
+				e := extents[c]
+				return int(f[0]) >= e[0] && int(f[1]) >= e[1] && int(f[2]) <= e[2] && int(f[3]) <= e[3]
+			}
+			if c := 2*node + 1; c < len(extents) && fits(c) {
+				node = c
+			} else if c := 2*node + 2; c < len(extents) && fits(c) {
+				node = c
+			} else {
+				break
+			}
+		}
+		features[node] = append(features[node], f...)
+	}
+
+	var bins bytes.Buffer
+	nodes := make([]byte, 8*len(extents))
+	var index bytes.Buffer
+	binary.Write(&index, B, []int32{50, int32(len(nodes) / 2)})
+	start := 100 + 8 + len(nodes)
+	binNodes = map[int64]int{}
+	id := int32(1)
+	for i, f := range features {
+		if len(f) == 0 {
+			continue
+		}
+		B.PutUint32(nodes[8*i:], uint32((start+bins.Len())/2))
+		B.PutUint32(nodes[8*i+4:], uint32(len(f)/8))
+		for ; len(f) > 0; id++ {
+			bin := f
+			if len(bin) > 800 {
+				bin = bin[:800]
+			}
+			f = f[len(bin):]
+			binNodes[int64(start+bins.Len())] = i
+			binary.Write(&index, B, []int32{int32((start + bins.Len()) / 2), int32(len(bin) / 2)})
+			binary.Write(&bins, B, []int32{id, int32(len(bin) / 2)})
+			bins.Write(bin)
+		}
+	}
+	var body bytes.Buffer
+	binary.Write(&body, B, []int32{-1, int32(len(nodes) / 2)})
+	body.Write(nodes)
+	body.Write(bins.Bytes())
+
+	header := func(length int) []byte {
+		hdr := make([]byte, 100)
+		B.PutUint32(hdr, 9994)
+		B.PutUint32(hdr[24:], uint32(50+length/2))
+		B.PutUint32(hdr[28:], uint32(len(s.Records)))
+		for i, f := range []float64{h.Xmin, h.Ymin, h.Xmax, h.Ymax} {
+			B.PutUint64(hdr[32+8*i:], math.Float64bits(f))
+		}
+		return hdr
+	}
+	return append(header(body.Len()), body.Bytes()...), append(header(index.Len()), index.Bytes()...), extents, binNodes
+}
+
+// binReader records the offsets of the bins read.
+type binReader struct {
+	io.ReaderAt
+	bins map[int64]int
+	read map[int64]bool
+}
+
+func (r *binReader) ReadAt(p []byte, off int64) (int, error) {
+	if _, ok := r.bins[off]; ok {
+		r.read[off] = true
+	}
+	return r.ReaderAt.ReadAt(p, off)
+}
+
+func TestSBNSearch(t *testing.T) {
+	shp, _ := ioutil.ReadFile(testfile)
+	s, err := NewShapefile(bytes.NewReader(shp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shx := shxFor(t, testfile)
+	sbn, sbx, extents, binNodes := sbnFor(s)
+
+	for _, rdr := range []io.Reader{nil, bytes.NewReader(sbx)} {
+		r := &binReader{bytes.NewReader(sbn), binNodes, map[int64]bool{}}
+		idx, err := NewSBNIndex(r, rdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if idx.Header.NumShapes != 299 || len(idx.nodes) != 63 {
+			t.Fatalf("unexpected index: %d shapes %d nodes", idx.Header.NumShapes, len(idx.nodes))
+		}
+
+		q := Box{500000, 5500000, 550000, 5550000}
+		recs, err := idx.SearchRecords(bytes.NewReader(shp), shx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var found, expected []int
+		for _, r := range recs {
+			found = append(found, int(r.Header.RecordNumber))
+		}
+		for _, r := range s.Records {
+			if b, _ := boxOf(r.Content); b.Intersects(q) {
+				expected = append(expected, int(r.Header.RecordNumber))
+			}
+		}
+		sort.Ints(found)
+		if len(expected) == 0 || len(found) != len(expected) {
+			t.Fatalf("expected %v, found %v", expected, found)
+		}
+		for i := range found {
+			if found[i] != expected[i] {
+				t.Errorf("expected %v, found %v", expected, found)
+			}
+		}
+
+		// only bins of nodes next to the query are read
+		qq := idx.quantize(q)
+		if len(r.read) == 0 || len(r.read) >= len(binNodes)/2 {
+			t.Errorf("read %d of %d bins", len(r.read), len(binNodes))
+		}
+		for off := range r.read {
+			e := extents[binNodes[off]]
+			if e[0] > qq[2]+1 || e[2] < qq[0]-1 || e[1] > qq[3]+1 || e[3] < qq[1]-1 {
+				t.Errorf("read bin of node %d at %v for %v", binNodes[off], e, qq)
+			}
+		}
+
+		if ids, _ := idx.Search(Box{0, 0, 1, 1}); len(ids) != 0 {
+			t.Errorf("found shapes outside extent")
+		}
+	}
+}
+
+func TestShxReadRecord(t *testing.T) {
+	shx := shxFor(t, testfile)
+	file, _ := os.Open(testfile)
+	defer file.Close()
+	rec, err := shx.ReadRecord(file, 298)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Header.RecordNumber != 299 {
+		t.Errorf("unexpected record: %d", rec.Header.RecordNumber)
+	}
+	if _, err = shx.ReadRecord(file, 299); err == nil {
+		t.Errorf("expected error reading past the last record")
+	}
+}
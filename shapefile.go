@@ -17,6 +17,12 @@ type Record struct {
 type RecordContent interface{}
 
 func NewShapefile(rdr io.Reader) (s *Shapefile, err error) {
+	return readShapefile(rdr, nil)
+}
+
+// readShapefile reads a complete shapefile, calling each (if not nil) on
+// every record as soon as it's read.
+func readShapefile(rdr io.Reader, each func(*Record) error) (s *Shapefile, err error) {
 	s = &Shapefile{}
 
 	var h *MainFileHeader
@@ -38,9 +44,20 @@ func NewShapefile(rdr io.Reader) (s *Shapefile, err error) {
 		i = i - rh.ContentLength - 4
 		rec = &Record{}
 		rec.Header = rh
-		if rec.Content, err = RecordRecordContent(rdr); err != nil {
+		// limit the content to the record, some parts of shapes are
+		// optional
+		content := io.LimitReader(rdr, int64(rh.ContentLength)*2)
+		if rec.Content, err = RecordRecordContent(content); err != nil {
 			return
 		}
+		if _, err = io.Copy(io.Discard, content); err != nil {
+			return
+		}
+		if each != nil {
+			if err = each(rec); err != nil {
+				return
+			}
+		}
 		s.Records = append(s.Records, rec)
 	}
 	return
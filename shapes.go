@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 )
 
 var L = binary.LittleEndian
@@ -204,6 +205,7 @@ type PointM struct {
 func ReadPointM(r io.Reader) (pm *PointM, err error) {
 	pm = &PointM{}
 	err = binary.Read(r, L, pm)
+	pm.M = fromNoData(pm.M)
 	return
 }
 
@@ -211,6 +213,61 @@ type MRange struct {
 	Mmin float64
 	Mmax float64
 }
+
+// NoData is written for M values which are NaN. The spec considers any
+// M value less than -10^38 to be "no data", these are read as NaN.
+const NoData = -1e39
+
+// measured reports whether m is a measure rather than missing.
+func measured(m float64) bool {
+	return !math.IsNaN(m) && m >= -1e38
+}
+
+func fromNoData(m float64) float64 {
+	if !measured(m) {
+		return math.NaN()
+	}
+	return m
+}
+
+func toNoData(m float64) float64 {
+	if !measured(m) {
+		return NoData
+	}
+	return m
+}
+
+// readM reads the M range and values following the points of a shape.
+// They are optional, MArray is nil if the record ends before them, so r
+// must end with the record. The range is that of the measured values,
+// whatever the record says, NaN if there are none.
+func readM(r io.Reader, n int) (mr MRange, m []float64, err error) {
+	if err = binary.Read(r, L, &mr); err == io.EOF {
+		return MRange{}, nil, nil
+	} else if err != nil {
+		return
+	}
+	m = make([]float64, n)
+	if err = binary.Read(r, L, m); err != nil {
+		return
+	}
+	for i := range m {
+		m[i] = fromNoData(m[i])
+	}
+	mr.Mmin, mr.Mmax = rangeOf(m, fromNoData(mr.Mmin), fromNoData(mr.Mmax))
+	return
+}
+
+// readZ reads the Z range and values following the points of a shape.
+func readZ(r io.Reader, n int) (zr ZRange, z []float64, err error) {
+	if err = binary.Read(r, L, &zr); err != nil {
+		return
+	}
+	z = make([]float64, n)
+	err = binary.Read(r, L, z)
+	return
+}
+
 type MultiPointM struct {
 	Box    Box
 	Points []Point
@@ -228,11 +285,7 @@ func ReadMultiPointM(r io.Reader) (mp *MultiPointM, err error) {
 		return
 	}
 
-	if err = binary.Read(r, L, &mp.MRange); err != nil {
-		return
-	}
-	mp.MArray = make([]float64, len(mp.Points))
-	err = binary.Read(r, L, mp.MArray)
+	mp.MRange, mp.MArray, err = readM(r, len(mp.Points))
 	return
 
 }
@@ -247,7 +300,7 @@ type PolyLineM struct {
 
 func ReadPolyLineM(r io.Reader) (pl *PolyLineM, err error) {
 	pl = &PolyLineM{}
-	if err = binary.Read(r, L, pl.Box); err != nil {
+	if err = binary.Read(r, L, &pl.Box); err != nil {
 		return
 	}
 
@@ -255,12 +308,7 @@ func ReadPolyLineM(r io.Reader) (pl *PolyLineM, err error) {
 		return
 	}
 
-	if err = binary.Read(r, L, pl.MRange); err != nil {
-		return
-	}
-	pl.MArray = make([]float64, len(pl.Points))
-
-	err = binary.Read(r, L, pl.MArray)
+	pl.MRange, pl.MArray, err = readM(r, len(pl.Points))
 	return
 }
 
@@ -270,19 +318,14 @@ type PolygonM struct {
 
 func ReadPolygonM(r io.Reader) (pg *PolygonM, err error) {
 	pg = &PolygonM{}
-	if err = binary.Read(r, L, pg.Box); err != nil {
+	if err = binary.Read(r, L, &pg.Box); err != nil {
 		return
 	}
 	if pg.Parts, pg.Points, err = readPartsPoints(r); err != nil {
 		return
 	}
 
-	if err = binary.Read(r, L, pg.MRange); err != nil {
-		return
-	}
-	pg.MArray = make([]float64, len(pg.Points))
-
-	err = binary.Read(r, L, pg.MArray)
+	pg.MRange, pg.MArray, err = readM(r, len(pg.Points))
 	return
 }
 
@@ -293,9 +336,18 @@ type PointZ struct {
 	M float64
 }
 
+// ReadPointZ reads a PointZ, M is NaN if r ends before it.
 func ReadPointZ(r io.Reader) (p *PointZ, err error) {
 	p = &PointZ{}
-	err = binary.Read(r, L, &p)
+	var xyz [3]float64
+	if err = binary.Read(r, L, &xyz); err != nil {
+		return
+	}
+	p.X, p.Y, p.Z = xyz[0], xyz[1], xyz[2]
+	if err = binary.Read(r, L, &p.M); err == io.EOF {
+		p.M, err = math.NaN(), nil
+	}
+	p.M = fromNoData(p.M)
 	return
 
 }
@@ -315,25 +367,16 @@ type MultiPointZ struct {
 
 func ReadMultiPointZ(r io.Reader) (mp *MultiPointZ, err error) {
 	mp = &MultiPointZ{}
-	if err = binary.Read(r, L, mp.Box); err != nil {
+	if err = binary.Read(r, L, &mp.Box); err != nil {
 		return
 	}
 	if mp.Points, err = readNumPoints(r); err != nil {
 		return
 	}
-	if err = binary.Read(r, L, mp.ZRange); err != nil {
-		return
-	}
-	mp.ZArray = make([]float64, len(mp.Points))
-	if err = binary.Read(r, L, mp.ZArray); err != nil {
-		return
-	}
-	if err = binary.Read(r, L, mp.MRange); err != nil {
+	if mp.ZRange, mp.ZArray, err = readZ(r, len(mp.Points)); err != nil {
 		return
 	}
-	mp.MArray = make([]float64, len(mp.Points))
-
-	err = binary.Read(r, L, mp.MArray)
+	mp.MRange, mp.MArray, err = readM(r, len(mp.Points))
 	return
 }
 
@@ -352,28 +395,18 @@ type PolyLineZ struct {
 func ReadPolyLineZ(r io.Reader) (pl *PolyLineZ, err error) {
 	pl = &PolyLineZ{}
 
-	if err = binary.Read(r, L, pl.Box); err != nil {
+	if err = binary.Read(r, L, &pl.Box); err != nil {
 		return
 	}
 	if pl.Parts, pl.Points, err = readPartsPoints(r); err != nil {
 		return
 	}
+	pl.NumParts, pl.NumPoints = int32(len(pl.Parts)), int32(len(pl.Points))
 
-	if err = binary.Read(r, L, pl.ZRange); err != nil {
-		return
-	}
-
-	pl.ZArray = make([]float64, len(pl.Points))
-	if err = binary.Read(r, L, pl.ZArray); err != nil {
-		return
-	}
-	if err = binary.Read(r, L, pl.MRange); err != nil {
-		return
-	}
-	pl.MArray = make([]float64, len(pl.Points))
-	if err = binary.Read(r, L, pl.MArray); err != nil {
+	if pl.ZRange, pl.ZArray, err = readZ(r, len(pl.Points)); err != nil {
 		return
 	}
+	pl.MRange, pl.MArray, err = readM(r, len(pl.Points))
 	return
 
 }
@@ -385,28 +418,18 @@ type PolygonZ struct {
 func ReadPolygonZ(r io.Reader) (pg *PolygonZ, err error) {
 	pg = &PolygonZ{}
 
-	if err = binary.Read(r, L, pg.Box); err != nil {
+	if err = binary.Read(r, L, &pg.Box); err != nil {
 		return
 	}
 	if pg.Parts, pg.Points, err = readPartsPoints(r); err != nil {
 		return
 	}
+	pg.NumParts, pg.NumPoints = int32(len(pg.Parts)), int32(len(pg.Points))
 
-	if err = binary.Read(r, L, pg.ZRange); err != nil {
-		return
-	}
-
-	pg.ZArray = make([]float64, len(pg.Points))
-	if err = binary.Read(r, L, pg.ZArray); err != nil {
-		return
-	}
-	if err = binary.Read(r, L, pg.MRange); err != nil {
-		return
-	}
-	pg.MArray = make([]float64, len(pg.Points))
-	if err = binary.Read(r, L, pg.MArray); err != nil {
+	if pg.ZRange, pg.ZArray, err = readZ(r, len(pg.Points)); err != nil {
 		return
 	}
+	pg.MRange, pg.MArray, err = readM(r, len(pg.Points))
 	return
 
 }
@@ -446,14 +469,17 @@ type MultiPatch struct {
 	Parts     []int32
 	PartTypes []PartType
 	Points    []Point
-	ZRange    ZRange    // optional
+	ZRange    ZRange
+	ZArray    []float64
 	MRange    MRange    // optional
 	MArray    []float64 // optional
 }
 
+// ReadMultiPatch reads a MultiPatch, r must end with the record as the M
+// values are optional.
 func ReadMultiPatch(r io.Reader) (mp *MultiPatch, err error) {
 	mp = &MultiPatch{}
-	if err = binary.Read(r, L, mp.Box); err != nil {
+	if err = binary.Read(r, L, &mp.Box); err != nil {
 		return
 	}
 
@@ -465,26 +491,25 @@ func ReadMultiPatch(r io.Reader) (mp *MultiPatch, err error) {
 	if err = binary.Read(r, L, &pts); err != nil {
 		return
 	}
+	if prts < 0 || pts < 0 {
+		return nil, fmt.Errorf("invalid number of parts %d or points %d", prts, pts)
+	}
 	mp.Parts = make([]int32, prts)
-	if err = binary.Read(r, L, &mp.Parts); err != nil {
+	if err = binary.Read(r, L, mp.Parts); err != nil {
 		return
 	}
 	mp.PartTypes = make([]PartType, prts)
-	if err = binary.Read(r, L, &mp.PartTypes); err != nil {
+	if err = binary.Read(r, L, mp.PartTypes); err != nil {
 		return
 	}
 	mp.Points = make([]Point, pts)
 	if err = binary.Read(r, L, mp.Points); err != nil {
 		return
 	}
-	if err = binary.Read(r, L, mp.ZRange); err != nil {
-		return
-	}
-	if err = binary.Read(r, L, mp.MRange); err != nil {
+	if mp.ZRange, mp.ZArray, err = readZ(r, int(pts)); err != nil {
 		return
 	}
-	mp.MArray = make([]float64, pts)
-	err = binary.Read(r, L, mp.MArray)
+	mp.MRange, mp.MArray, err = readM(r, int(pts))
 	return
 
 }
@@ -0,0 +1,52 @@
+package shapefile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The .shx index file has the same 100 byte header as the main file,
+// followed by one fixed length entry per record pointing into the .shp.
+
+type ShxRecord struct {
+	Offset        int32 // offset of the record header in the .shp in 16 bit words
+	ContentLength int32 // length in 16 bit words, same as in the record header
+}
+
+type ShxFile struct {
+	Header  *MainFileHeader
+	Records []ShxRecord
+}
+
+func NewShxFile(r io.Reader) (shx *ShxFile, err error) {
+	shx = &ShxFile{}
+	if shx.Header, err = NewMainFileHeaderFromReader(r); err != nil {
+		return
+	}
+	num := (shx.Header.FileLength - 50) / 4 // 4 words per entry
+	if num < 0 {
+		return nil, fmt.Errorf("invalid file length: %d", shx.Header.FileLength)
+	}
+	shx.Records = make([]ShxRecord, num)
+	err = binary.Read(r, B, shx.Records)
+	return
+}
+
+// ReadRecord reads the record with the (0 based) index i from the .shp
+// file without reading the records before it.
+func (shx *ShxFile) ReadRecord(shp io.ReaderAt, i int) (rec *Record, err error) {
+	if i < 0 || i >= len(shx.Records) {
+		return nil, fmt.Errorf("no record %d, file contains %d", i, len(shx.Records))
+	}
+	e := shx.Records[i]
+	r := io.NewSectionReader(shp, int64(e.Offset)*2, int64(e.ContentLength)*2+8)
+	rec = &Record{}
+	if rec.Header, err = NewMainFileRecordHeaderFromReader(r); err != nil {
+		return nil, err
+	}
+	if rec.Content, err = RecordRecordContent(r); err != nil {
+		return nil, err
+	}
+	return
+}
@@ -0,0 +1,483 @@
+package shapefile
+
+import (
+	"container/heap"
+	"math"
+)
+
+type SimplifyMethod int
+
+const (
+	// DouglasPeucker drops vertices closer than the tolerance to the line
+	// connecting the vertices kept around them.
+	DouglasPeucker SimplifyMethod = iota
+	// VisvalingamWhyatt repeatedly drops the vertex forming the smallest
+	// triangle with its neighbours, as long as that area is below the
+	// tolerance.
+	VisvalingamWhyatt
+)
+
+// Simplify returns a simplified copy of a polyline or polygon, shapes of
+// other types are returned as is. The end points of lines are kept, rings
+// which would collapse are left unsimplified. Z and M values of the
+// remaining vertices are preserved.
+func Simplify(content RecordContent, method SimplifyMethod, tolerance float64) RecordContent {
+	parts, areal := partsOf(content)
+	if !simplifiable(content) {
+		return content
+	}
+	var selected [][]int
+	offset := 0
+	for _, part := range parts {
+		keep := simplifyPart(part, method, tolerance)
+		if areal && count(keep) < 4 {
+			keep = allTrue(len(part))
+		}
+		var idx []int
+		for i, k := range keep {
+			if k {
+				idx = append(idx, offset+i)
+			}
+		}
+		selected = append(selected, idx)
+		offset += len(part)
+	}
+	return selectVertices(content, selected)
+}
+
+// SimplifyShared simplifies the polylines and polygons of a whole layer,
+// preserving topology: borders shared by several shapes are simplified
+// identically, so adjacent polygons don't develop gaps or overlaps.
+// Vertices where the shapes sharing a border change are always kept.
+// Borders are only recognized as shared if their vertices are identical.
+// Rings may start at a different vertex afterwards. Different borders
+// may still cross each other if the tolerance is large compared to the
+// distance between them.
+func SimplifyShared(contents []RecordContent, method SimplifyMethod, tolerance float64) []RecordContent {
+	type neighbours struct {
+		prev, next Point
+		junction   bool
+	}
+	seen := map[Point]*neighbours{}
+	ordered := func(a, b Point) (Point, Point) {
+		if pointLess(b, a) {
+			return b, a
+		}
+		return a, b
+	}
+	closed := func(part []Point) bool {
+		return len(part) > 3 && part[0] == part[len(part)-1]
+	}
+
+	// find the junctions: end points of lines and vertices whose
+	// neighbours differ between the parts they belong to.
+	shapes := make([][][]Point, len(contents))
+	for s, content := range contents {
+		if simplifiable(content) {
+			shapes[s], _ = partsOf(content)
+		}
+		for _, part := range shapes[s] {
+			n := len(part)
+			if closed(part) {
+				n--
+			}
+			for i := 0; i < n; i++ {
+				var prev, next Point
+				switch {
+				case closed(part):
+					prev, next = part[(i+n-1)%n], part[(i+1)%n]
+				case i == 0 || i == n-1:
+					seen[part[i]] = &neighbours{junction: true}
+					continue
+				default:
+					prev, next = part[i-1], part[i+1]
+				}
+				prev, next = ordered(prev, next)
+				if nb, ok := seen[part[i]]; !ok {
+					seen[part[i]] = &neighbours{prev: prev, next: next}
+				} else if nb.prev != prev || nb.next != next {
+					nb.junction = true
+				}
+			}
+		}
+	}
+
+	// split the parts into arcs between junctions, rings are rotated to
+	// start at a junction. Arcs are identified by their vertices in
+	// canonical direction.
+	type arc struct {
+		start, end int // positions in the part's order
+		key        string
+		reversed   bool
+	}
+	type partArcs struct {
+		order []int // indices of the part's vertices in traversal order
+		arcs  []arc
+	}
+	masks := map[string][]bool{}
+	parts := make([][]partArcs, len(contents))
+	for s := range shapes {
+		for _, part := range shapes[s] {
+			pa := partArcs{}
+			var cuts []int
+			if !closed(part) {
+				pa.order = span(0, len(part)-1, len(part))
+				for i, p := range part {
+					if seen[p].junction {
+						cuts = append(cuts, i)
+					}
+				}
+			} else {
+				n := len(part) - 1
+				start := -1
+				for i := 0; i < n && start == -1; i++ {
+					if seen[part[i]].junction {
+						start = i
+					}
+				}
+				if start == -1 {
+					// a ring not touching any other, start at its smallest vertex
+					start = 0
+					for i := 1; i < n; i++ {
+						if pointLess(part[i], part[start]) {
+							start = i
+						}
+					}
+				}
+				pa.order = span(start, start+n, n)
+				for i, j := range pa.order {
+					if i == 0 || i == n || seen[part[j]].junction {
+						cuts = append(cuts, i)
+					}
+				}
+			}
+			for i := 1; i < len(cuts); i++ {
+				a := arc{start: cuts[i-1], end: cuts[i]}
+				pts := make([]Point, 0, a.end-a.start+1)
+				for _, j := range pa.order[a.start : a.end+1] {
+					pts = append(pts, part[j])
+				}
+				a.key, a.reversed = arcKey(pts)
+				if _, ok := masks[a.key]; !ok {
+					masks[a.key] = simplifyPart(canonical(pts, a.reversed), method, tolerance)
+				}
+				pa.arcs = append(pa.arcs, a)
+			}
+			parts[s] = append(parts[s], pa)
+		}
+	}
+
+	keepPart := func(pa partArcs) (keep []bool) {
+		keep = make([]bool, len(pa.order))
+		if len(pa.arcs) == 0 {
+			return allTrue(len(pa.order))
+		}
+		for _, a := range pa.arcs {
+			mask := masks[a.key]
+			for i := a.start; i <= a.end; i++ {
+				if a.reversed {
+					keep[i] = keep[i] || mask[a.end-i]
+				} else {
+					keep[i] = keep[i] || mask[i-a.start]
+				}
+			}
+		}
+		return
+	}
+	// don't simplify the arcs of rings which would collapse
+	for s := range parts {
+		if _, areal := partsOf(contents[s]); !areal {
+			continue
+		}
+		for _, pa := range parts[s] {
+			if count(keepPart(pa)) < 4 {
+				for _, a := range pa.arcs {
+					masks[a.key] = allTrue(a.end - a.start + 1)
+				}
+			}
+		}
+	}
+
+	simplified := make([]RecordContent, len(contents))
+	for s, content := range contents {
+		if !simplifiable(content) {
+			simplified[s] = content
+			continue
+		}
+		var selected [][]int
+		offset := 0
+		for p, pa := range parts[s] {
+			var idx []int
+			for i, k := range keepPart(pa) {
+				if k {
+					idx = append(idx, offset+pa.order[i])
+				}
+			}
+			selected = append(selected, idx)
+			offset += len(shapes[s][p])
+		}
+		simplified[s] = selectVertices(content, selected)
+	}
+	return simplified
+}
+
+func simplifiable(content RecordContent) bool {
+	switch content.(type) {
+	case *PolyLine, *Polygon, *PolyLineM, *PolygonM, *PolyLineZ, *PolygonZ:
+		return true
+	}
+	return false
+}
+
+// span returns the indices from start to end (inclusive) wrapping at n.
+func span(start, end, n int) (idx []int) {
+	for i := start; i <= end; i++ {
+		idx = append(idx, i%n)
+	}
+	return
+}
+
+// arcKey identifies the arc independently of its direction, and reports
+// whether the canonical direction is the reverse.
+func arcKey(pts []Point) (key string, reversed bool) {
+	n := len(pts)
+	for i := 0; i < n; i++ {
+		a, b := pts[i], pts[n-1-i]
+		if a != b {
+			reversed = pointLess(b, a)
+			break
+		}
+	}
+	buf := make([]byte, 0, 16*n)
+	for _, p := range canonical(pts, reversed) {
+		buf = L.AppendUint64(buf, math.Float64bits(p.X))
+		buf = L.AppendUint64(buf, math.Float64bits(p.Y))
+	}
+	return string(buf), reversed
+}
+
+func pointLess(a, b Point) bool {
+	return a.X < b.X || a.X == b.X && a.Y < b.Y
+}
+
+func canonical(pts []Point, reversed bool) []Point {
+	if !reversed {
+		return pts
+	}
+	rev := make([]Point, len(pts))
+	for i, p := range pts {
+		rev[len(pts)-1-i] = p
+	}
+	return rev
+}
+
+func count(keep []bool) (n int) {
+	for _, k := range keep {
+		if k {
+			n++
+		}
+	}
+	return
+}
+
+func allTrue(n int) []bool {
+	keep := make([]bool, n)
+	for i := range keep {
+		keep[i] = true
+	}
+	return keep
+}
+
+// simplifyPart returns which vertices of pts to keep. The end points are
+// always kept, closed parts are split at the vertex farthest from the
+// start for Douglas-Peucker.
+func simplifyPart(pts []Point, method SimplifyMethod, tolerance float64) []bool {
+	keep := make([]bool, len(pts))
+	if len(pts) < 3 {
+		return allTrue(len(pts))
+	}
+	last := len(pts) - 1
+	keep[0], keep[last] = true, true
+	if method == VisvalingamWhyatt {
+		visvalingam(pts, keep, tolerance)
+		return keep
+	}
+	if pts[0] == pts[last] {
+		far, d := 0, -1.0
+		for i, p := range pts {
+			if dp := math.Hypot(p.X-pts[0].X, p.Y-pts[0].Y); dp > d {
+				far, d = i, dp
+			}
+		}
+		keep[far] = true
+		douglasPeucker(pts, keep, 0, far, tolerance)
+		douglasPeucker(pts, keep, far, last, tolerance)
+		return keep
+	}
+	douglasPeucker(pts, keep, 0, last, tolerance)
+	return keep
+}
+
+func douglasPeucker(pts []Point, keep []bool, first, last int, tolerance float64) {
+	stack := [][2]int{{first, last}}
+	for len(stack) != 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		far, d := -1, tolerance
+		for i := s[0] + 1; i < s[1]; i++ {
+			if dp := segmentDistance(pts[i].X, pts[i].Y, pts[s[0]], pts[s[1]]); dp > d {
+				far, d = i, dp
+			}
+		}
+		if far != -1 {
+			keep[far] = true
+			stack = append(stack, [2]int{s[0], far}, [2]int{far, s[1]})
+		}
+	}
+}
+
+type vwVertex struct {
+	i          int
+	area       float64
+	prev, next *vwVertex
+	index      int // in the heap
+}
+
+type vwHeap []*vwVertex
+
+func (h vwHeap) Len() int           { return len(h) }
+func (h vwHeap) Less(i, j int) bool { return h[i].area < h[j].area }
+func (h vwHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *vwHeap) Push(x interface{}) {
+	v := x.(*vwVertex)
+	v.index = len(*h)
+	*h = append(*h, v)
+}
+func (h *vwHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+func visvalingam(pts []Point, keep []bool, tolerance float64) {
+	triangle := func(v *vwVertex) float64 {
+		a, b, c := pts[v.prev.i], pts[v.i], pts[v.next.i]
+		return math.Abs((b.X-a.X)*(c.Y-a.Y)-(c.X-a.X)*(b.Y-a.Y)) / 2
+	}
+	vertices := make([]*vwVertex, len(pts))
+	for i := range pts {
+		vertices[i] = &vwVertex{i: i}
+		if i > 0 {
+			vertices[i].prev, vertices[i-1].next = vertices[i-1], vertices[i]
+		}
+	}
+	h := vwHeap{}
+	for _, v := range vertices[1 : len(pts)-1] {
+		v.area = triangle(v)
+		heap.Push(&h, v)
+	}
+	// removing a vertex may not make its neighbours cheaper to remove
+	// than the vertex itself, that would change the order of removal.
+	for h.Len() != 0 && h[0].area < tolerance {
+		v := heap.Pop(&h).(*vwVertex)
+		v.prev.next, v.next.prev = v.next, v.prev
+		for _, n := range []*vwVertex{v.prev, v.next} {
+			if n.prev != nil && n.next != nil {
+				n.area = math.Max(triangle(n), v.area)
+				heap.Fix(&h, n.index)
+			}
+		}
+	}
+	for _, v := range h {
+		keep[v.i] = true
+	}
+}
+
+// selectVertices returns a copy of the shape made up of the given parts,
+// each a list of indices into the shape's points. The Z and M values of
+// the vertices are carried over. Empty parts are dropped.
+func selectVertices(content RecordContent, parts [][]int) RecordContent {
+	sel := func(points []Point, arrays ...*[]float64) (newParts []int32, newPoints []Point) {
+		newArrays := make([][]float64, len(arrays))
+		for _, part := range parts {
+			if len(part) == 0 {
+				continue
+			}
+			newParts = append(newParts, int32(len(newPoints)))
+			for _, i := range part {
+				newPoints = append(newPoints, points[i])
+				for a, arr := range arrays {
+					if len(*arr) == len(points) {
+						newArrays[a] = append(newArrays[a], (*arr)[i])
+					}
+				}
+			}
+		}
+		for a, arr := range arrays {
+			*arr = newArrays[a]
+		}
+		return
+	}
+	var out RecordContent
+	switch s := content.(type) {
+	case *PolyLine:
+		c := *s
+		c.Parts, c.Points = sel(s.Points)
+		out = &c
+	case *Polygon:
+		c := *s
+		c.Parts, c.Points = sel(s.Points)
+		out = &c
+	case *PolyLineM:
+		c := *s
+		c.Parts, c.Points = sel(s.Points, &c.MArray)
+		c.MRange.Mmin, c.MRange.Mmax = rangeOf(c.MArray, c.MRange.Mmin, c.MRange.Mmax)
+		out = &c
+	case *PolygonM:
+		c := *s
+		c.Parts, c.Points = sel(s.Points, &c.MArray)
+		c.MRange.Mmin, c.MRange.Mmax = rangeOf(c.MArray, c.MRange.Mmin, c.MRange.Mmax)
+		out = &c
+	case *PolyLineZ:
+		c := *s
+		c.Parts, c.Points = sel(s.Points, &c.ZArray, &c.MArray)
+		c.NumParts, c.NumPoints = int32(len(c.Parts)), int32(len(c.Points))
+		c.ZRange.Zmin, c.ZRange.Zmax = rangeOf(c.ZArray, c.ZRange.Zmin, c.ZRange.Zmax)
+		c.MRange.Mmin, c.MRange.Mmax = rangeOf(c.MArray, c.MRange.Mmin, c.MRange.Mmax)
+		out = &c
+	case *PolygonZ:
+		c := *s
+		c.Parts, c.Points = sel(s.Points, &c.ZArray, &c.MArray)
+		c.NumParts, c.NumPoints = int32(len(c.Parts)), int32(len(c.Points))
+		c.ZRange.Zmin, c.ZRange.Zmax = rangeOf(c.ZArray, c.ZRange.Zmin, c.ZRange.Zmax)
+		c.MRange.Mmin, c.MRange.Mmax = rangeOf(c.MArray, c.MRange.Mmin, c.MRange.Mmax)
+		out = &c
+	default:
+		return content
+	}
+	updateBox(out)
+	return out
+}
+
+// rangeOf returns the range of values, or the old range if there are
+// none. NaN and no data values are left out, the range is NaN if there
+// is nothing else.
+func rangeOf(values []float64, oldMin, oldMax float64) (lo, hi float64) {
+	if len(values) == 0 {
+		return oldMin, oldMax
+	}
+	lo, hi = math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if measured(v) {
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+	}
+	if lo > hi {
+		return math.NaN(), math.NaN()
+	}
+	return
+}
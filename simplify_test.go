@@ -0,0 +1,93 @@
+package shapefile
+
+import (
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	line := polyline(Point{0, 0}, Point{1, 0.1}, Point{2, -0.1}, Point{3, 5}, Point{4, 6}, Point{5, 7}, Point{6, 8.1}, Point{7, 9})
+	dp := Simplify(line, DouglasPeucker, 0.5).(*PolyLine)
+	if len(dp.Points) != 4 || dp.Points[1] != (Point{2, -0.1}) || dp.Points[2] != (Point{3, 5}) {
+		t.Errorf("unexpected Douglas-Peucker result: %v", dp.Points)
+	}
+	if dp.Box != (Box{0, -0.1, 7, 9}) || len(line.Points) != 8 {
+		t.Errorf("unexpected box or modified input")
+	}
+	vw := Simplify(line, VisvalingamWhyatt, 0.5).(*PolyLine)
+	if len(vw.Points) != 4 || vw.Points[1] != (Point{2, -0.1}) || vw.Points[2] != (Point{3, 5}) {
+		t.Errorf("unexpected Visvalingam-Whyatt result: %v", vw.Points)
+	}
+
+	// rings which would collapse are kept
+	tiny := polygon(square(0, 0, 10, 10), square(4, 4, 4.1, 4.1))
+	s := Simplify(tiny, DouglasPeucker, 1).(*Polygon)
+	if len(s.Parts) != 2 || len(s.Points) != 10 {
+		t.Errorf("unexpected result: %v %v", s.Parts, s.Points)
+	}
+
+	lz := &PolyLineZ{Parts: []int32{0}, Points: line.Points, ZArray: []float64{1, 2, 3, 4, 5, 6, 7, 8}}
+	z := Simplify(lz, DouglasPeucker, 0.5).(*PolyLineZ)
+	if len(z.ZArray) != 4 || z.ZArray[1] != 3 || z.ZRange != (ZRange{1, 8}) || z.NumPoints != 4 {
+		t.Errorf("unexpected Z values: %v %v", z.ZArray, z.ZRange)
+	}
+}
+
+func TestSimplifyShared(t *testing.T) {
+	// two polygons sharing a wiggly border, the rings start at different
+	// vertices and run in opposite directions.
+	border := []Point{{5, 0}, {5.2, 1}, {4.8, 2}, {5.3, 3}, {4.9, 4}, {5.1, 5}, {5, 6}, {4.7, 7}, {5, 10}}
+	var left, right []Point
+	left = append(left, Point{0, 10}, Point{5, 10})
+	for i := len(border) - 2; i >= 0; i-- {
+		left = append(left, border[i])
+	}
+	left = append(left, Point{0, 0}, Point{0, 10})
+	right = append(right, border[3:]...)
+	right = append(right, Point{10, 10}, Point{10, 0})
+	right = append(right, border[:4]...)
+
+	a, b := polygon(left), polygon(right)
+	if !Touches(a, b) {
+		t.Fatal("invalid test data")
+	}
+	for _, method := range []SimplifyMethod{DouglasPeucker, VisvalingamWhyatt} {
+		tolerance := 0.5
+		if method == VisvalingamWhyatt {
+			tolerance = 0.3
+		}
+		s := SimplifyShared([]RecordContent{a, b}, method, tolerance)
+		sa, sb := s[0].(*Polygon), s[1].(*Polygon)
+		if len(sa.Points) >= len(a.Points) || len(sb.Points) >= len(b.Points) {
+			t.Errorf("%d: nothing simplified", method)
+		}
+		if !Touches(sa, sb) || sa.Area()+sb.Area() != 100 {
+			t.Errorf("%d: gaps or overlaps: %v %v", method, sa.Points, sb.Points)
+		}
+	}
+
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []RecordContent
+	points := 0
+	for _, f := range ds.Features() {
+		contents = append(contents, f.Record.Content)
+		points += len(f.Record.Content.(*Polygon).Points)
+	}
+	simplified := SimplifyShared(contents, DouglasPeucker, 100)
+	after := 0
+	for _, c := range simplified {
+		after += len(c.(*Polygon).Points)
+	}
+	if after >= points {
+		t.Errorf("expected fewer points: %d -> %d", points, after)
+	}
+	for i := 0; i != 20; i++ {
+		for j := i + 1; j != len(contents); j++ {
+			if Intersects(contents[i], contents[j]) && !Touches(simplified[i], simplified[j]) {
+				t.Errorf("%d and %d no longer touch", i, j)
+			}
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package shapefile
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SQLMode selects what WriteSQL does with the table.
+type SQLMode int
+
+const (
+	SQLCreate  SQLMode = iota // create the table and load the rows
+	SQLAppend                 // load the rows into an existing table
+	SQLReplace                // drop the table if it exists, then create and load it
+	SQLPrepare                // only create the table
+)
+
+// SQLOptions control WriteSQL.
+type SQLOptions struct {
+	Table          string // optionally qualified by the schema, e.g. public.wahlkreise, parts may be double quoted
+	GeometryColumn string // geom if empty
+	SRID           int    // of the geometries, 0 if unknown
+	Mode           SQLMode
+	Copy           bool // load the rows using COPY instead of INSERT statements
+	Index          bool // create a GiST index on the geometry column
+	// BatchSize commits every so many rows, 0 loads all rows in one
+	// transaction. NoTransaction leaves out BEGIN and COMMIT altogether.
+	BatchSize     int
+	NoTransaction bool
+}
+
+// geometryColumn returns the name of the geometry column.
+func (opts SQLOptions) geometryColumn() string {
+	if opts.GeometryColumn == "" {
+		return "geom"
+	}
+	return opts.GeometryColumn
+}
+
+// sqlColumns returns the column names of the fields, lower case as
+// PostgreSQL folds them. Names clashing with the gid or geometry column
+// are prefixed with underscores, as shp2pgsql does.
+func sqlColumns(fields []FieldDescriptor, opts SQLOptions) (columns []string) {
+	for _, fd := range fields {
+		name := strings.ToLower(fd.FieldName())
+		if name == "gid" || name == strings.ToLower(opts.geometryColumn()) {
+			name = "__" + name
+		}
+		columns = append(columns, name)
+	}
+	return
+}
+
+// sqlIdentifier quotes a possibly schema qualified name. Parts already
+// double quoted are kept, dots in them don't separate parts.
+func sqlIdentifier(name string) string {
+	var parts []string
+	start, quoted := 0, false
+	for i := 0; i <= len(name); i++ {
+		switch {
+		case i == len(name) || name[i] == '.' && !quoted:
+			parts = append(parts, name[start:i])
+			start = i + 1
+		case name[i] == '"':
+			quoted = !quoted
+		}
+	}
+	for i, p := range parts {
+		if len(p) < 2 || p[0] != '"' || p[len(p)-1] != '"' {
+			parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// CreateTableSQL returns the CREATE TABLE statement for a shapefile of
+// the shape type with the fields: a serial gid primary key, a column for
+// each field and the PostGIS geometry column. Character fields become
+// varchar, Number fields without decimals int2, int4 or int8 as wide as
+// needed, other numbers numeric with the field's width and decimals,
+// Date fields date and Logical fields boolean.
+// Polylines and polygons are MULTILINESTRINGs and MULTIPOLYGONs as EWKB
+// writes them.
+func CreateTableSQL(shapeType ShapeType, fields []FieldDescriptor, opts SQLOptions) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE %s (gid serial PRIMARY KEY", sqlIdentifier(opts.Table))
+	for i, name := range sqlColumns(fields, opts) {
+		fd := fields[i]
+		typ := fmt.Sprintf("varchar(%d)", fd.FieldLength)
+		switch {
+		case fd.FieldType == Number && fd.DecimalCount == 0 && fd.FieldLength < 5:
+			typ = "int2"
+		case fd.FieldType == Number && fd.DecimalCount == 0 && fd.FieldLength < 10:
+			typ = "int4"
+		case fd.FieldType == Number && fd.DecimalCount == 0 && fd.FieldLength < 19:
+			typ = "int8"
+		case fd.FieldType == Number || fd.FieldType == Float:
+			typ = fmt.Sprintf("numeric(%d,%d)", fd.FieldLength, fd.DecimalCount)
+		case fd.FieldType == Date:
+			typ = "date"
+		case fd.FieldType == Logical:
+			typ = "boolean"
+		}
+		fmt.Fprintf(&b, ",\n%s %s", sqlIdentifier(name), typ)
+	}
+	geometry := map[ShapeType]string{
+		POINT: "POINT", MULTI_POINT: "MULTIPOINT", POLY_LINE: "MULTILINESTRING", POLYGON: "MULTIPOLYGON",
+	}[shapeType%10]
+	switch {
+	case shapeType == MULTI_PATCH:
+		geometry = "TINZ"
+	case geometry == "":
+		geometry = "GEOMETRY"
+	case shapeType/10 == 1:
+		geometry += "ZM"
+	case shapeType/10 == 2:
+		geometry += "M"
+	}
+	if opts.SRID != 0 {
+		geometry += "," + strconv.Itoa(opts.SRID)
+	}
+	fmt.Fprintf(&b, ",\n%s geometry(%s));\n", sqlIdentifier(opts.geometryColumn()), geometry)
+	return b.String()
+}
+
+// WriteSQL writes a PostgreSQL script loading the features of r into a
+// PostGIS table, like shp2pgsql does. The features are streamed, so any
+// size of file can be loaded. Geometries are hex encoded EWKB, text is
+// converted to UTF-8.
+func WriteSQL(w io.Writer, r *Reader, opts SQLOptions) (err error) {
+	if opts.Table == "" {
+		return fmt.Errorf("no table name")
+	}
+	bw := bufio.NewWriter(w)
+	table := sqlIdentifier(opts.Table)
+	begin := func() {
+		if !opts.NoTransaction {
+			bw.WriteString("BEGIN;\n")
+		}
+	}
+	commit := func() {
+		if !opts.NoTransaction {
+			bw.WriteString("COMMIT;\n")
+		}
+	}
+	bw.WriteString("SET CLIENT_ENCODING TO UTF8;\nSET STANDARD_CONFORMING_STRINGS TO ON;\n")
+	begin()
+	if opts.Mode == SQLReplace {
+		fmt.Fprintf(bw, "DROP TABLE IF EXISTS %s;\n", table)
+	}
+	if opts.Mode != SQLAppend {
+		bw.WriteString(CreateTableSQL(r.Header.ShapeType, r.Fields, opts))
+	}
+
+	var columns []string
+	for _, name := range sqlColumns(r.Fields, opts) {
+		columns = append(columns, sqlIdentifier(name))
+	}
+	columns = append(columns, sqlIdentifier(opts.geometryColumn()))
+	into := table + " (" + strings.Join(columns, ",") + ")"
+	copying := false
+	for rows := 0; opts.Mode != SQLPrepare; rows++ {
+		var f *Feature
+		if f, err = r.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+		if opts.BatchSize > 0 && rows > 0 && rows%opts.BatchSize == 0 {
+			if copying {
+				bw.WriteString("\\.\n")
+				copying = false
+			}
+			commit()
+			begin()
+		}
+		var geometry string
+		if raw := EWKB(f.Record.Content, opts.SRID); raw != nil {
+			geometry = strings.ToUpper(hex.EncodeToString(raw))
+		}
+		values := make([]string, 0, len(columns))
+		if opts.Copy {
+			if !copying {
+				fmt.Fprintf(bw, "COPY %s FROM stdin;\n", into)
+				copying = true
+			}
+			for _, v := range f.Attributes {
+				values = append(values, copyValue(v))
+			}
+			if geometry == "" {
+				geometry = `\N`
+			}
+			bw.WriteString(strings.Join(append(values, geometry), "\t") + "\n")
+			continue
+		}
+		for i, v := range f.Attributes {
+			values = append(values, sqlValue(v, r.Fields[i]))
+		}
+		if geometry == "" {
+			geometry = "NULL"
+		} else {
+			geometry = "'" + geometry + "'"
+		}
+		fmt.Fprintf(bw, "INSERT INTO %s VALUES (%s);\n", into, strings.Join(append(values, geometry), ","))
+	}
+	if copying {
+		bw.WriteString("\\.\n")
+	}
+	if opts.Index {
+		fmt.Fprintf(bw, "CREATE INDEX ON %s USING GIST (%s);\n", table, sqlIdentifier(opts.geometryColumn()))
+	}
+	commit()
+	if opts.Index {
+		fmt.Fprintf(bw, "ANALYZE %s;\n", table)
+	}
+	return bw.Flush()
+}
+
+// sqlValue returns an attribute as an SQL literal. Text is quoted unless
+// it's in a numeric field, empty numbers are NULL.
+func sqlValue(v interface{}, fd FieldDescriptor) string {
+	s := formatValue(v)
+	switch {
+	case v == nil:
+		return "NULL"
+	case fd.FieldType == Number || fd.FieldType == Float:
+		if s = strings.TrimSpace(s); s == "" {
+			return "NULL"
+		}
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return s
+		}
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// copyValue returns an attribute in the text format of COPY.
+func copyValue(v interface{}) string {
+	if v == nil {
+		return `\N`
+	}
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(formatValue(v))
+}
@@ -0,0 +1,97 @@
+package shapefile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSQL(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("NAME", Character, 20, 0), NewFieldDescriptor("POP", Number, 6, 0), NewFieldDescriptor("GID", Number, 12, 3)}
+	ds := NewDataset(POINT, fields, nil)
+	ds.Add(&Point{1, 2}, []interface{}{"O'Brien\tInc", int64(42), 1.5})
+	ds.Add(nil, []interface{}{"", nil, nil})
+	ds.Add(&Point{3, 4}, []interface{}{"C", int64(7), nil})
+	fn := filepath.Join(t.TempDir(), "places.shp")
+	if err := ds.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	write := func(opts SQLOptions) string {
+		shp, _ := os.Open(fn)
+		defer shp.Close()
+		dbf, _ := os.Open(strings.TrimSuffix(fn, ".shp") + ".dbf")
+		defer dbf.Close()
+		r, err := NewReader(shp, dbf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err = WriteSQL(&buf, r, opts); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	point := "'0101000020E6100000000000000000F03F0000000000000040'"
+
+	sql := write(SQLOptions{Table: "public.places", SRID: 4326, Mode: SQLReplace, Index: true})
+	expected := []string{
+		"BEGIN;\nDROP TABLE IF EXISTS \"public\".\"places\";\n",
+		"CREATE TABLE \"public\".\"places\" (gid serial PRIMARY KEY,\n\"name\" varchar(20),\n\"pop\" int4,\n\"__gid\" numeric(12,3),\n\"geom\" geometry(POINT,4326));\n",
+		"INSERT INTO \"public\".\"places\" (\"name\",\"pop\",\"__gid\",\"geom\") VALUES ('O''Brien\tInc',42,1.5," + point + ");\n",
+		"VALUES ('',NULL,NULL,NULL);\n",
+		"CREATE INDEX ON \"public\".\"places\" USING GIST (\"geom\");\nCOMMIT;\nANALYZE \"public\".\"places\";\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(sql, e) {
+			t.Errorf("expected %s in\n%s", e, sql)
+		}
+	}
+
+	sql = write(SQLOptions{Table: "places", SRID: 4326, Mode: SQLAppend, Copy: true, BatchSize: 2})
+	expected = []string{
+		"BEGIN;\nCOPY \"places\" (\"name\",\"pop\",\"__gid\",\"geom\") FROM stdin;\nO'Brien\\tInc\t42\t1.5\t" + strings.Trim(point, "'") + "\n\t\\N\t\\N\t\\N\n\\.\nCOMMIT;\nBEGIN;\nCOPY ",
+		"C\t7\t\\N\t0101000020E610000000000000000008400000000000001040\n\\.\nCOMMIT;\n",
+	}
+	for _, e := range expected {
+		if !strings.Contains(sql, e) {
+			t.Errorf("expected %s in\n%s", e, sql)
+		}
+	}
+	if strings.Contains(sql, "CREATE TABLE") {
+		t.Errorf("expected no table to be created when appending")
+	}
+
+	sql = write(SQLOptions{Table: "places", Mode: SQLPrepare, NoTransaction: true})
+	if strings.Contains(sql, "INSERT") || strings.Contains(sql, "BEGIN") || !strings.Contains(sql, "geometry(POINT));") {
+		t.Errorf("expected only the table without a transaction, got\n%s", sql)
+	}
+}
+
+func TestCreateTableSQLDateLogical(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("BUILT", Date, 8, 0), NewFieldDescriptor("LISTED", Logical, 1, 0)}
+	expected := "CREATE TABLE \"houses\" (gid serial PRIMARY KEY,\n\"built\" date,\n\"listed\" boolean,\n\"geom\" geometry(POINT));\n"
+	if sql := CreateTableSQL(POINT, fields, SQLOptions{Table: "houses"}); sql != expected {
+		t.Errorf("expected %s, got %s", expected, sql)
+	}
+	if v := sqlValue("19840229", fields[0]) + "," + sqlValue(true, fields[1]) + "," + sqlValue(nil, fields[1]); v != "'19840229','T',NULL" {
+		t.Errorf("unexpected values %s", v)
+	}
+}
+
+func TestSQLIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"places":           `"places"`,
+		"public.places":    `"public"."places"`,
+		`"my.data"`:        `"my.data"`,
+		`public."my.data"`: `"public"."my.data"`,
+		`O"Brien`:          `"O""Brien"`,
+		`"say ""hi"".x".t`: `"say ""hi"".x"."t"`,
+	}
+	for name, expected := range tests {
+		if got := sqlIdentifier(name); got != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package shapefile
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SVGOptions control WriteSVG.
+type SVGOptions struct {
+	// Width, Height and Extent define the viewport as for RenderOptions.
+	Width, Height int
+	Extent        Box
+	// ClassFields are columns whose values become CSS classes of the
+	// form field-value, e.g. land_name-Bayern.
+	ClassFields []string
+	// DataFields are columns written as data-field attributes.
+	DataFields []string
+	// TitleField is the column shown as tooltip, if set.
+	TitleField string
+	// CSS is added as style sheet, the classes can be styled there.
+	CSS string
+	// Tolerance in pixels to simplify the shapes to, borders shared by
+	// features are simplified identically. 0 keeps all vertices.
+	Tolerance   float64
+	PointRadius float64 // in pixels, 3 if 0
+	Precision   int     // decimals of pixel coordinates, 1 if 0
+}
+
+// WriteSVG writes the features of ds as an SVG document with one path
+// per feature. Polygons use the even-odd fill rule, so holes stay empty,
+// points are drawn as circles. The defaults are gray polygons and points
+// with dark outlines and lines, which the CSS can override.
+func WriteSVG(w io.Writer, ds *Dataset, opts SVGOptions) (err error) {
+	var vp viewport
+	if vp, err = newViewport(ds, opts.Extent, opts.Width, opts.Height); err != nil {
+		return
+	}
+	var classCols, dataCols []int
+	for _, name := range opts.ClassFields {
+		var col int
+		if col, err = styleField(ds, name); err != nil {
+			return
+		}
+		classCols = append(classCols, col)
+	}
+	for _, name := range opts.DataFields {
+		var col int
+		if col, err = styleField(ds, name); err != nil {
+			return
+		}
+		dataCols = append(dataCols, col)
+	}
+	titleCol := -1
+	if opts.TitleField != "" {
+		if titleCol, err = styleField(ds, opts.TitleField); err != nil {
+			return
+		}
+	}
+	radius, precision := opts.PointRadius, opts.Precision
+	if radius <= 0 {
+		radius = 3
+	}
+	if precision <= 0 {
+		precision = 1
+	}
+
+	var features []*Feature
+	var shapes []RecordContent
+	for _, f := range ds.Features() {
+		if f.Deleted {
+			continue
+		}
+		features = append(features, f)
+		shapes = append(shapes, f.Record.Content)
+	}
+	if opts.Tolerance > 0 {
+		shapes = SimplifyShared(shapes, DouglasPeucker, opts.Tolerance/vp.scale)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", vp.width, vp.height, vp.width, vp.height)
+	if opts.CSS != "" {
+		fmt.Fprintf(bw, "<style>%s</style>\n", escapeXML(opts.CSS))
+	}
+	bw.WriteString("<g fill=\"#c0c0c0\" stroke=\"#404040\" stroke-width=\"1\" stroke-linejoin=\"round\">\n")
+	num := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	coord := func(p Point) string {
+		f := math.Pow(10, float64(precision))
+		return num(math.Round(p.X*f)/f) + " " + num(math.Round(p.Y*f)/f)
+	}
+	for i, f := range features {
+		parts, areal := partsOf(shapes[i])
+		var d strings.Builder
+		points := true
+		for _, part := range parts {
+			if len(part) == 1 {
+				// a circle as two half circles
+				p := vp.pixel(part[0])
+				fmt.Fprintf(&d, "M%s a%s %s 0 1 0 %s 0 a%s %s 0 1 0 %s 0Z", coord(Point{p.X - radius, p.Y}), num(radius), num(radius), num(2*radius), num(radius), num(radius), num(-2*radius))
+				continue
+			}
+			points = false
+			for j, p := range part {
+				if j == 0 {
+					d.WriteString("M")
+				} else {
+					d.WriteString("L")
+				}
+				d.WriteString(coord(vp.pixel(p)))
+			}
+			if areal {
+				d.WriteString("Z")
+			}
+		}
+		if d.Len() == 0 {
+			continue
+		}
+		bw.WriteString("<path")
+		if len(classCols) > 0 && f.Attributes != nil {
+			var classes []string
+			for j, col := range classCols {
+				classes = append(classes, cssClass(strings.ToLower(opts.ClassFields[j])+"-"+formatValue(f.Attributes[col])))
+			}
+			fmt.Fprintf(bw, " class=\"%s\"", escapeXML(strings.Join(classes, " ")))
+		}
+		for j, col := range dataCols {
+			if f.Attributes != nil {
+				fmt.Fprintf(bw, " data-%s=\"%s\"", cssClass(strings.ToLower(opts.DataFields[j])), escapeXML(formatValue(f.Attributes[col])))
+			}
+		}
+		switch {
+		case areal:
+			bw.WriteString(" fill-rule=\"evenodd\"")
+		case !points:
+			bw.WriteString(" fill=\"none\"")
+		}
+		fmt.Fprintf(bw, " d=\"%s\"", d.String())
+		if titleCol != -1 && f.Attributes != nil {
+			fmt.Fprintf(bw, "><title>%s</title></path>\n", escapeXML(formatValue(f.Attributes[titleCol])))
+		} else {
+			bw.WriteString("/>\n")
+		}
+	}
+	bw.WriteString("</g>\n</svg>\n")
+	return bw.Flush()
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// cssClass replaces characters not allowed in class names and data
+// attributes, and which would need escaping in CSS, by underscores.
+func cssClass(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
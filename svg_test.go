@@ -0,0 +1,84 @@
+package shapefile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteSVG(t *testing.T) {
+	fields := []FieldDescriptor{NewFieldDescriptor("NAME", Character, 10, 0), NewFieldDescriptor("POP", Number, 6, 0)}
+	ds := NewDataset(POLYGON, fields, nil)
+	ds.Add(polygon(square(0, 0, 10, 10), square(3, 3, 7, 7)), []interface{}{"A & B", int64(42)})
+	var buf bytes.Buffer
+	opts := SVGOptions{Width: 20, ClassFields: []string{"name"}, DataFields: []string{"POP"}, TitleField: "NAME", CSS: ".name-A___B { fill: red }"}
+	if err := WriteSVG(&buf, ds, opts); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	expected := []string{
+		`width="20" height="20" viewBox="0 0 20 20"`,
+		`<style>.name-A___B { fill: red }</style>`,
+		`<path class="name-A___B" data-pop="42" fill-rule="evenodd" d="M0 20L0 0L20 0L20 20L0 20ZM6 14L6 6L14 6L14 14L6 14Z"><title>A &amp; B</title></path>`,
+	}
+	for _, e := range expected {
+		if !strings.Contains(svg, e) {
+			t.Errorf("expected %s in\n%s", e, svg)
+		}
+	}
+	if err := WriteSVG(&buf, ds, SVGOptions{TitleField: "NOPE"}); err == nil {
+		t.Errorf("expected an unknown field to fail")
+	}
+
+	ds = NewDataset(POLY_LINE, nil, nil)
+	ds.Add(polyline(Point{0, 0}, Point{10, 0}), nil)
+	buf.Reset()
+	WriteSVG(&buf, ds, SVGOptions{Width: 10, Height: 10, Extent: Box{0, 0, 10, 2}})
+	if !strings.Contains(buf.String(), `<path fill="none" d="M0 6L10 6"/>`) {
+		t.Errorf("unexpected line\n%s", buf.String())
+	}
+}
+
+func TestWriteSVGSimplified(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var full, simplified bytes.Buffer
+	if err = WriteSVG(&full, ds, SVGOptions{Width: 500, ClassFields: []string{"LAND_NAME"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(full.String(), "<path"); n != 299 {
+		t.Errorf("expected 299 paths, got %d", n)
+	}
+	if !strings.Contains(full.String(), `class="land_name-Bayern"`) {
+		t.Errorf("expected a class for Bayern")
+	}
+	if err = WriteSVG(&simplified, ds, SVGOptions{Width: 500, ClassFields: []string{"LAND_NAME"}, Tolerance: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if simplified.Len() >= full.Len()*2/3 {
+		t.Errorf("expected simplifying to a pixel to save a third, got %d of %d bytes", simplified.Len(), full.Len())
+	}
+}
+
+func TestWriteSVGLatin1(t *testing.T) {
+	// the names in the test data are Latin-1
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = WriteSVG(&buf, ds, SVGOptions{Width: 500, ClassFields: []string{"LAND_NAME"}, TitleField: "LAND_NAME"}); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	for _, e := range []string{`class="land_name-Thüringen"`, `<title>Thüringen</title>`} {
+		if !strings.Contains(svg, e) {
+			t.Errorf("expected %s", e)
+		}
+	}
+	if strings.Contains(svg, "�") {
+		t.Errorf("unexpected replacement character")
+	}
+}
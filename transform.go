@@ -0,0 +1,417 @@
+package shapefile
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Reprojection between coordinate reference systems. Formulas follow
+// EPSG Guidance Note 7-2:
+// https://www.iogp.org/wp-content/uploads/2019/09/373-07-02.pdf
+// Transverse Mercator uses Krüger's series to third order in n, which is
+// accurate to well below a millimeter within a few zones of the central
+// meridian.
+
+// Transform reprojects the coordinates of geom from one CRS to another in
+// place. Z and M values are preserved, bounding boxes are recalculated.
+func Transform(geom RecordContent, from, to *CRS) (err error) {
+	var t *Transformer
+	if t, err = NewTransformer(from, to); err != nil {
+		return
+	}
+	return t.Transform(geom)
+}
+
+// Transformer caches the setup needed to convert coordinates between two
+// coordinate reference systems.
+type Transformer struct {
+	from, to   *crsDef
+	datumShift bool
+}
+
+func NewTransformer(from, to *CRS) (t *Transformer, err error) {
+	t = &Transformer{}
+	if t.from, err = newCRSDef(from); err != nil {
+		return nil, err
+	}
+	if t.to, err = newCRSDef(to); err != nil {
+		return nil, err
+	}
+	if !sameDatum(from, to) {
+		if t.from.toWGS84 == nil {
+			return nil, fmt.Errorf("no datum shift known for %s", from.Datum.Name)
+		}
+		if t.to.toWGS84 == nil {
+			return nil, fmt.Errorf("no datum shift known for %s", to.Datum.Name)
+		}
+		t.datumShift = true
+	}
+	return
+}
+
+// Transform reprojects the coordinates of geom in place.
+func (t *Transformer) Transform(geom RecordContent) (err error) {
+	eachXY(geom, func(x, y *float64) {
+		if err != nil {
+			return
+		}
+		*x, *y, err = t.Point(*x, *y)
+	})
+	if err == nil {
+		updateBox(geom)
+	}
+	return
+}
+
+// Point reprojects a single coordinate pair.
+func (t *Transformer) Point(x, y float64) (xOut, yOut float64, err error) {
+	var lon, lat float64
+	if lon, lat, err = t.from.inverse(x, y); err != nil {
+		return
+	}
+	if t.datumShift {
+		lon, lat = t.shift(lon, lat)
+	}
+	return t.to.forward(lon, lat)
+}
+
+func (t *Transformer) shift(lon, lat float64) (float64, float64) {
+	X, Y, Z := toGeocentric(t.from.a, t.from.es, lon, lat, 0)
+	X, Y, Z = t.from.toWGS84.apply(X, Y, Z, false)
+	X, Y, Z = t.to.toWGS84.apply(X, Y, Z, true)
+	lon, lat, _ = fromGeocentric(t.to.a, t.to.es, X, Y, Z)
+	return lon, lat
+}
+
+func sameDatum(a, b *CRS) bool {
+	return strings.EqualFold(a.Datum.Name, b.Datum.Name) && a.Datum.Ellipsoid == b.Datum.Ellipsoid &&
+		datumShiftOf(a).equals(datumShiftOf(b))
+}
+
+// helmert holds 7 parameter Helmert transformation parameters in the
+// position vector convention used by TOWGS84: translations in meters,
+// rotations in arc seconds and scale in ppm.
+type helmert struct {
+	tx, ty, tz, rx, ry, rz, s float64
+}
+
+func (h *helmert) equals(o *helmert) bool {
+	if h == nil || o == nil {
+		return h == o
+	}
+	return *h == *o
+}
+
+// apply transforms geocentric coordinates to WGS84, or from WGS84 if
+// inverse is set.
+func (h *helmert) apply(x, y, z float64, inverse bool) (float64, float64, float64) {
+	const sec = math.Pi / (180 * 3600)
+	tx, ty, tz := h.tx, h.ty, h.tz
+	rx, ry, rz := h.rx*sec, h.ry*sec, h.rz*sec
+	s := 1 + h.s*1e-6
+	if inverse {
+		tx, ty, tz, rx, ry, rz, s = -tx, -ty, -tz, -rx, -ry, -rz, 1/s
+		x, y, z = x+tx, y+ty, z+tz
+		return s * (x - rz*y + ry*z), s * (rz*x + y - rx*z), s * (-ry*x + rx*y + z)
+	}
+	return tx + s*(x-rz*y+ry*z), ty + s*(rz*x+y-rx*z), tz + s*(-ry*x+rx*y+z)
+}
+
+// datumShiftOf returns the WGS84 parameters of the datum, from TOWGS84 if
+// present in the .prj, else from a small table of well known datums.
+func datumShiftOf(c *CRS) *helmert {
+	if p := c.Datum.ToWGS84; len(p) != 0 {
+		h := &helmert{}
+		vals := []*float64{&h.tx, &h.ty, &h.tz, &h.rx, &h.ry, &h.rz, &h.s}
+		for i := 0; i != len(p) && i != len(vals); i++ {
+			*vals[i] = p[i]
+		}
+		return h
+	}
+	name := strings.ToUpper(strings.TrimPrefix(c.Datum.Name, "D_"))
+	if h, ok := knownDatums[name]; ok {
+		return &h
+	}
+	return nil
+}
+
+var knownDatums = map[string]helmert{
+	"WGS_1984":  {},
+	"ETRS_1989": {},
+	"EUROPEAN_TERRESTRIAL_REFERENCE_SYSTEM_1989": {},
+	"NORTH_AMERICAN_1983":                        {},
+	"DEUTSCHES_HAUPTDREIECKSNETZ":                {598.1, 73.7, 418.2, 0.202, 0.045, -2.455, 6.7},          // EPSG:1777
+	"OSGB_1936":                                  {446.448, -125.157, 542.06, 0.15, 0.247, 0.842, -20.489}, // EPSG:1314
+	"MGI":                                        {577.326, 90.129, 463.919, 5.137, 1.474, 5.297, 2.4232},  // EPSG:1618
+	"CH1903":                                     {674.374, 15.056, 405.346, 0, 0, 0, 0},                   // EPSG:1753
+}
+
+func toGeocentric(a, es, lon, lat, h float64) (x, y, z float64) {
+	sinLat := math.Sin(lat)
+	n := a / math.Sqrt(1-es*sinLat*sinLat)
+	x = (n + h) * math.Cos(lat) * math.Cos(lon)
+	y = (n + h) * math.Cos(lat) * math.Sin(lon)
+	z = (n*(1-es) + h) * sinLat
+	return
+}
+
+func fromGeocentric(a, es, x, y, z float64) (lon, lat, h float64) {
+	lon = math.Atan2(y, x)
+	p := math.Hypot(x, y)
+	lat = math.Atan2(z, p*(1-es))
+	for i := 0; i != 10; i++ {
+		sinLat := math.Sin(lat)
+		n := a / math.Sqrt(1-es*sinLat*sinLat)
+		h = p/math.Cos(lat) - n
+		next := math.Atan2(z, p*(1-es*n/(n+h)))
+		if math.Abs(next-lat) < 1e-14 {
+			lat = next
+			break
+		}
+		lat = next
+	}
+	return
+}
+
+// crsDef is a CRS prepared for computation: angles in radians relative
+// to Greenwich, distances in meters.
+type crsDef struct {
+	a, es, e   float64 // semi major axis, eccentricity squared, eccentricity
+	pm         float64 // prime meridian, radians
+	angular    float64 // radians per angular unit
+	linear     float64 // meters per linear unit
+	toWGS84    *helmert
+	proj       projection // nil for geographic
+	fe, fn, k0 float64
+	lon0, lat0 float64
+}
+
+type projection interface {
+	// forward projects lon/lat in radians (relative to the central meridian)
+	// to x/y in meters, not including false easting/northing.
+	forward(lon, lat float64) (x, y float64)
+	inverse(x, y float64) (lon, lat float64)
+}
+
+func newCRSDef(c *CRS) (d *crsDef, err error) {
+	if c == nil {
+		return nil, fmt.Errorf("missing coordinate reference system")
+	}
+	ell := c.Datum.Ellipsoid
+	d = &crsDef{a: ell.SemiMajor, angular: c.AngularUnit.Factor, linear: c.LinearUnit.Factor}
+	if ell.InvFlattening != 0 {
+		f := 1 / ell.InvFlattening
+		d.es = 2*f - f*f
+		d.e = math.Sqrt(d.es)
+	}
+	if d.angular == 0 {
+		d.angular = degree
+	}
+	if d.linear == 0 {
+		d.linear = 1
+	}
+	d.pm = c.PrimeMeridian.Longitude * d.angular
+	d.toWGS84 = datumShiftOf(c)
+	if c.IsGeographic() {
+		return
+	}
+
+	param := func(def float64, names ...string) float64 {
+		for _, n := range names {
+			if v, ok := c.Parameter(n); ok {
+				return v
+			}
+		}
+		return def
+	}
+	d.fe = param(0, "False_Easting") * d.linear
+	d.fn = param(0, "False_Northing") * d.linear
+	d.k0 = param(1, "Scale_Factor")
+	d.lon0 = param(0, "Central_Meridian", "Longitude_Of_Origin", "Longitude_Of_Center") * d.angular
+	d.lat0 = param(0, "Latitude_Of_Origin", "Latitude_Of_Center") * d.angular
+
+	switch strings.ToLower(c.Projection) {
+	case "transverse_mercator", "gauss_kruger":
+		d.proj = newTMerc(d.a, d.es, d.lat0)
+	case "mercator_auxiliary_sphere", "popular_visualisation_pseudo_mercator":
+		d.proj = &mercator{a: d.a}
+	case "mercator", "mercator_1sp", "mercator_2sp":
+		if sp, ok := c.Parameter("Standard_Parallel_1"); ok {
+			sin := math.Sin(sp * d.angular)
+			d.k0 = math.Cos(sp*d.angular) / math.Sqrt(1-d.es*sin*sin)
+		}
+		d.proj = &mercator{a: d.a, e: d.e}
+	case "lambert_conformal_conic", "lambert_conformal_conic_1sp", "lambert_conformal_conic_2sp":
+		sp1 := param(d.lat0/d.angular, "Standard_Parallel_1") * d.angular
+		sp2 := param(sp1/d.angular, "Standard_Parallel_2") * d.angular
+		d.proj = newLCC(d.a, d.e, d.lat0, sp1, sp2)
+	default:
+		return nil, fmt.Errorf("unsupported projection: %s", c.Projection)
+	}
+	return
+}
+
+// inverse converts coordinates in the CRS to lon/lat in radians relative
+// to Greenwich.
+func (d *crsDef) inverse(x, y float64) (lon, lat float64, err error) {
+	if d.proj == nil {
+		return x*d.angular + d.pm, y * d.angular, nil
+	}
+	x = (x*d.linear - d.fe) / d.k0
+	y = (y*d.linear - d.fn) / d.k0
+	lon, lat = d.proj.inverse(x, y)
+	lon += d.lon0 + d.pm
+	if math.IsNaN(lon) || math.IsNaN(lat) {
+		err = fmt.Errorf("can't unproject %f %f", x, y)
+	}
+	return
+}
+
+// forward converts lon/lat in radians relative to Greenwich to
+// coordinates in the CRS.
+func (d *crsDef) forward(lon, lat float64) (x, y float64, err error) {
+	lon -= d.pm
+	if d.proj == nil {
+		return lon / d.angular, lat / d.angular, nil
+	}
+	lon = math.Remainder(lon-d.lon0, 2*math.Pi)
+	x, y = d.proj.forward(lon, lat)
+	x = (x*d.k0 + d.fe) / d.linear
+	y = (y*d.k0 + d.fn) / d.linear
+	if math.IsNaN(x) || math.IsNaN(y) || math.IsInf(x, 0) || math.IsInf(y, 0) {
+		err = fmt.Errorf("can't project %f %f", lon/degree, lat/degree)
+	}
+	return
+}
+
+type tmerc struct {
+	es, n, A     float64
+	alpha, beta  [3]float64
+	delta        [3]float64
+	y0           float64 // northing of the latitude of origin
+	sqrtN, twoSq float64
+}
+
+func newTMerc(a, es, lat0 float64) *tmerc {
+	f := 1 - math.Sqrt(1-es)
+	n := f / (2 - f)
+	n2, n3 := n*n, n*n*n
+	t := &tmerc{es: es, n: n}
+	t.A = a / (1 + n) * (1 + n2/4 + n2*n2/64)
+	t.alpha = [3]float64{n/2 - 2*n2/3 + 5*n3/16, 13*n2/48 - 3*n3/5, 61 * n3 / 240}
+	t.beta = [3]float64{n/2 - 2*n2/3 + 37*n3/96, n2/48 + n3/15, 17 * n3 / 480}
+	t.delta = [3]float64{2*n - 2*n2/3 - 2*n3, 7*n2/3 - 8*n3/5, 56 * n3 / 15}
+	t.twoSq = 2 * math.Sqrt(n) / (1 + n)
+	_, t.y0 = t.forward(0, lat0)
+	return t
+}
+
+func (t *tmerc) forward(lon, lat float64) (x, y float64) {
+	sin := math.Sin(lat)
+	tau := math.Sinh(math.Atanh(sin) - t.twoSq*math.Atanh(t.twoSq*sin))
+	xi := math.Atan2(tau, math.Cos(lon))
+	eta := math.Atanh(math.Sin(lon) / math.Sqrt(1+tau*tau))
+	x, y = eta, xi
+	for j := 1; j <= 3; j++ {
+		a := t.alpha[j-1]
+		x += a * math.Cos(2*float64(j)*xi) * math.Sinh(2*float64(j)*eta)
+		y += a * math.Sin(2*float64(j)*xi) * math.Cosh(2*float64(j)*eta)
+	}
+	return t.A * x, t.A*y - t.y0
+}
+
+func (t *tmerc) inverse(x, y float64) (lon, lat float64) {
+	xi := (y + t.y0) / t.A
+	eta := x / t.A
+	xi1, eta1 := xi, eta
+	for j := 1; j <= 3; j++ {
+		b := t.beta[j-1]
+		xi1 -= b * math.Sin(2*float64(j)*xi) * math.Cosh(2*float64(j)*eta)
+		eta1 -= b * math.Cos(2*float64(j)*xi) * math.Sinh(2*float64(j)*eta)
+	}
+	chi := math.Asin(math.Sin(xi1) / math.Cosh(eta1))
+	lat = chi
+	for j := 1; j <= 3; j++ {
+		lat += t.delta[j-1] * math.Sin(2*float64(j)*chi)
+	}
+	lon = math.Atan2(math.Sinh(eta1), math.Cos(xi1))
+	return
+}
+
+// mercator is the ellipsoidal Mercator projection, or the spherical one
+// used by Web Mercator if e is 0.
+type mercator struct {
+	a, e float64
+}
+
+func (m *mercator) forward(lon, lat float64) (x, y float64) {
+	x = m.a * lon
+	y = -m.a * math.Log(tsfn(lat, m.e))
+	return
+}
+
+func (m *mercator) inverse(x, y float64) (lon, lat float64) {
+	return x / m.a, phi2(math.Exp(-y/m.a), m.e)
+}
+
+// tsfn computes t as defined for the conformal projections in EPSG 7-2.
+func tsfn(lat, e float64) float64 {
+	sin := e * math.Sin(lat)
+	return math.Tan(math.Pi/4-lat/2) / math.Pow((1-sin)/(1+sin), e/2)
+}
+
+// phi2 inverts tsfn iteratively.
+func phi2(t, e float64) float64 {
+	lat := math.Pi/2 - 2*math.Atan(t)
+	for i := 0; i != 15; i++ {
+		sin := e * math.Sin(lat)
+		next := math.Pi/2 - 2*math.Atan(t*math.Pow((1-sin)/(1+sin), e/2))
+		if math.Abs(next-lat) < 1e-14 {
+			return next
+		}
+		lat = next
+	}
+	return lat
+}
+
+// lcc is the Lambert Conformal Conic projection with one or two standard
+// parallels.
+type lcc struct {
+	a, e, n, F, r0 float64
+}
+
+func newLCC(a, e, lat0, sp1, sp2 float64) *lcc {
+	l := &lcc{a: a, e: e}
+	m := func(lat float64) float64 {
+		sin := math.Sin(lat)
+		return math.Cos(lat) / math.Sqrt(1-e*e*sin*sin)
+	}
+	m1, m2 := m(sp1), m(sp2)
+	t1, t2 := tsfn(sp1, e), tsfn(sp2, e)
+	if math.Abs(sp1-sp2) < 1e-10 {
+		l.n = math.Sin(sp1)
+	} else {
+		l.n = (math.Log(m1) - math.Log(m2)) / (math.Log(t1) - math.Log(t2))
+	}
+	l.F = m1 / (l.n * math.Pow(t1, l.n))
+	l.r0 = a * l.F * math.Pow(tsfn(lat0, e), l.n)
+	return l
+}
+
+func (l *lcc) forward(lon, lat float64) (x, y float64) {
+	r := l.a * l.F * math.Pow(tsfn(lat, l.e), l.n)
+	theta := l.n * lon
+	return r * math.Sin(theta), l.r0 - r*math.Cos(theta)
+}
+
+func (l *lcc) inverse(x, y float64) (lon, lat float64) {
+	dy := l.r0 - y
+	r := math.Hypot(x, dy)
+	if l.n < 0 {
+		r, x, dy = -r, -x, -dy
+	}
+	theta := math.Atan2(x, dy)
+	t := math.Pow(r/(l.a*l.F), 1/l.n)
+	return theta / l.n, phi2(t, l.e)
+}
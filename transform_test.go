@@ -0,0 +1,136 @@
+package shapefile
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func mustEPSG(t *testing.T, code int) *CRS {
+	crs, err := CRSFromEPSG(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return crs
+}
+
+func checkXY(t *testing.T, x, y, ex, ey, tolerance float64) {
+	if math.Abs(x-ex) > tolerance || math.Abs(y-ey) > tolerance {
+		t.Errorf("unexpected coordinate, is: %f %f should: %f %f", x, y, ex, ey)
+	}
+}
+
+func TestTransformUTM(t *testing.T) {
+	// CN Tower, Toronto: 17T 630084 4833439
+	p := &Point{-79.387139, 43.642567}
+	if err := Transform(p, mustEPSG(t, 4326), mustEPSG(t, 32617)); err != nil {
+		t.Fatal(err)
+	}
+	checkXY(t, p.X, p.Y, 630084, 4833439, 1)
+
+	if err := Transform(p, mustEPSG(t, 32617), mustEPSG(t, 4326)); err != nil {
+		t.Fatal(err)
+	}
+	checkXY(t, p.X, p.Y, -79.387139, 43.642567, 1e-8)
+}
+
+func TestTransformWebMercator(t *testing.T) {
+	p := &PointZ{X: 90, Y: 0, Z: 42, M: 7}
+	if err := Transform(p, mustEPSG(t, 4326), mustEPSG(t, 3857)); err != nil {
+		t.Fatal(err)
+	}
+	checkXY(t, p.X, p.Y, 10018754.171394622, 0, 1e-6)
+	if p.Z != 42 || p.M != 7 {
+		t.Errorf("Z/M not preserved: %f %f", p.Z, p.M)
+	}
+}
+
+func TestTransformLCC(t *testing.T) {
+	// EPSG Guidance Note 7-2, example for method 9802
+	wkt := `PROJCS["NAD27 / Texas South Central",GEOGCS["NAD27",DATUM["North_American_Datum_1927",SPHEROID["Clarke 1866",6378206.4,294.9786982138982]],PRIMEM["Greenwich",0],UNIT["degree",0.0174532925199433]],PROJECTION["Lambert_Conformal_Conic_2SP"],PARAMETER["standard_parallel_1",28.38333333333333],PARAMETER["standard_parallel_2",30.28333333333333],PARAMETER["latitude_of_origin",27.83333333333333],PARAMETER["central_meridian",-99],PARAMETER["false_easting",2000000],PARAMETER["false_northing",0],UNIT["US survey foot",0.3048006096012192]]`
+	crs, err := ParseWKT(wkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geog := *crs
+	geog.Projection, geog.Parameters = "", nil
+
+	tr, err := NewTransformer(&geog, crs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y, err := tr.Point(-96, 28.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkXY(t, x, y, 2963503.91, 254759.80, 0.01)
+}
+
+func TestTransformGrads(t *testing.T) {
+	// the Texas example with the angles in grads
+	grad := func(deg float64) string { return strconv.FormatFloat(deg/0.9, 'f', -1, 64) }
+	wkt := `PROJCS["NAD27 / Texas South Central",GEOGCS["NAD27",DATUM["North_American_Datum_1927",SPHEROID["Clarke 1866",6378206.4,294.9786982138982]],PRIMEM["Greenwich",0],UNIT["Grad",0.01570796326794897]],PROJECTION["Lambert_Conformal_Conic_2SP"],PARAMETER["standard_parallel_1",` + grad(28.38333333333333) + `],PARAMETER["standard_parallel_2",` + grad(30.28333333333333) + `],PARAMETER["latitude_of_origin",` + grad(27.83333333333333) + `],PARAMETER["central_meridian",` + grad(-99) + `],PARAMETER["false_easting",2000000],PARAMETER["false_northing",0],UNIT["US survey foot",0.3048006096012192]]`
+	crs, err := ParseWKT(wkt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geog := *crs
+	geog.Projection, geog.Parameters, geog.AngularUnit = "", nil, Unit{"Degree", degree}
+	p := &Point{-96, 28.5}
+	if err = Transform(p, &geog, crs); err != nil {
+		t.Fatal(err)
+	}
+	checkXY(t, p.X, p.Y, 2963503.91, 254759.80, 0.01)
+}
+
+func TestTransformDatumShift(t *testing.T) {
+	// Gauss-Krüger zone 4 (DHDN) to WGS84 and back
+	gk, wgs84 := mustEPSG(t, 31468), mustEPSG(t, 4326)
+	pl := &PolyLine{Points: []Point{{4468000, 5333000}, {4470000, 5335000}}}
+	if err := Transform(pl, gk, wgs84); err != nil {
+		t.Fatal(err)
+	}
+	// roughly Munich, the datum shift moves coordinates about 100m
+	checkXY(t, pl.Points[0].X, pl.Points[0].Y, 11.57, 48.13, 0.05)
+	if pl.Box.Xmin != pl.Points[0].X || pl.Box.Ymax != pl.Points[1].Y {
+		t.Errorf("box not updated: %s", pl.Box.String())
+	}
+	if err := Transform(pl, wgs84, gk); err != nil {
+		t.Fatal(err)
+	}
+	checkXY(t, pl.Points[0].X, pl.Points[0].Y, 4468000, 5333000, 0.01)
+}
+
+func TestTransformUnknownDatum(t *testing.T) {
+	crs, _ := ParseWKT(`GEOGCS["GCS_Foo",DATUM["D_Foo",SPHEROID["Foo",6378000.0,300.0]],PRIMEM["Greenwich",0.0],UNIT["Degree",0.0174532925199433]]`)
+	if _, err := NewTransformer(crs, mustEPSG(t, 4326)); err == nil {
+		t.Errorf("expected error for unknown datum")
+	}
+}
+
+func TestOpenDatasetIn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shapefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	shp, _ := ioutil.ReadFile(testfile)
+	ioutil.WriteFile(filepath.Join(dir, "wk.shp"), shp, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "wk.prj"), []byte(prj_etrs_utm32), 0644)
+
+	ds, err := OpenDatasetIn(filepath.Join(dir, "wk.shp"), mustEPSG(t, 4326))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.DBF != nil || ds.CRS.EPSG != 4326 || len(ds.Shapefile.Records) != 299 {
+		t.Errorf("unexpected dataset")
+	}
+	h := ds.Shapefile.Header
+	// Germany
+	if h.Xmin < 5 || h.Xmax > 16 || h.Ymin < 47 || h.Ymax > 56 {
+		t.Errorf("unexpected extent:\n%s", h.String())
+	}
+}
@@ -0,0 +1,136 @@
+package shapefile
+
+import (
+	"math"
+)
+
+// WKB geometry types and the flags EWKB adds to them
+const (
+	wkbPoint           = 1
+	wkbLineString      = 2
+	wkbPolygon         = 3
+	wkbMultiPoint      = 4
+	wkbMultiLineString = 5
+	wkbMultiPolygon    = 6
+	wkbTIN             = 16
+	wkbTriangle        = 17
+
+	ewkbZ    = 0x80000000
+	ewkbM    = 0x40000000
+	ewkbSRID = 0x20000000
+)
+
+// EWKB returns the shape as PostGIS Extended Well Known Binary, with the
+// SRID if it isn't 0. Polylines and polygons are always MULTILINESTRINGs
+// and MULTIPOLYGONs, so the shapes of a file share a type, polygons
+// grouped into outer rings and their holes. Shapes with Z values have M
+// values, too, MultiPatches are TINs of their triangles. Missing M values
+// are NaN. Null shapes are nil.
+func EWKB(content RecordContent, srid int) []byte {
+	typ := shapeTypeOf(content)
+	hasZ := typ/10 == 1 || typ == MULTI_PATCH
+	hasM := typ/10 == 1 || typ/10 == 2
+	parts, areal := verticesOf(content)
+	if mp, ok := content.(*MultiPatch); ok {
+		parts = triangleRings(mp)
+	}
+	if len(parts) == 0 {
+		return nil
+	}
+	if _, m := zmOf(content); len(m) == 0 && hasM {
+		for _, part := range parts {
+			for i := range part {
+				part[i].M = math.NaN()
+			}
+		}
+	}
+	var buf []byte
+	head := func(typ uint32, srid int) {
+		if hasZ {
+			typ |= ewkbZ
+		}
+		if hasM {
+			typ |= ewkbM
+		}
+		if srid != 0 {
+			typ |= ewkbSRID
+		}
+		buf = append(buf, 1) // little endian
+		buf = L.AppendUint32(buf, typ)
+		if srid != 0 {
+			buf = L.AppendUint32(buf, uint32(srid))
+		}
+	}
+	points := func(vs []vertex) {
+		for _, v := range vs {
+			buf = L.AppendUint64(buf, math.Float64bits(v.X))
+			buf = L.AppendUint64(buf, math.Float64bits(v.Y))
+			if hasZ {
+				buf = L.AppendUint64(buf, math.Float64bits(v.Z))
+			}
+			if hasM {
+				buf = L.AppendUint64(buf, math.Float64bits(v.M))
+			}
+		}
+	}
+	// rings closes the rings, which shapefiles don't always do
+	rings := func(rs [][]vertex) {
+		buf = L.AppendUint32(buf, uint32(len(rs)))
+		for _, r := range rs {
+			if len(r) > 0 && r[0].point() != r[len(r)-1].point() {
+				r = append(r[:len(r):len(r)], r[0])
+			}
+			buf = L.AppendUint32(buf, uint32(len(r)))
+			points(r)
+		}
+	}
+	switch typ {
+	case POINT, POINT_M, POINT_Z:
+		head(wkbPoint, srid)
+		points(parts[0])
+	case MULTI_POINT, MULTI_POINT_M, MULTI_POINT_Z:
+		head(wkbMultiPoint, srid)
+		buf = L.AppendUint32(buf, uint32(len(parts)))
+		for _, part := range parts {
+			head(wkbPoint, 0)
+			points(part)
+		}
+	case POLY_LINE, POLY_LINE_M, POLY_LINE_Z:
+		head(wkbMultiLineString, srid)
+		buf = L.AppendUint32(buf, uint32(len(parts)))
+		for _, part := range parts {
+			head(wkbLineString, 0)
+			buf = L.AppendUint32(buf, uint32(len(part)))
+			points(part)
+		}
+	case MULTI_PATCH:
+		head(wkbTIN, srid)
+		buf = L.AppendUint32(buf, uint32(len(parts)))
+		for _, part := range parts {
+			head(wkbTriangle, 0)
+			rings([][]vertex{part})
+		}
+	default:
+		if !areal {
+			return nil
+		}
+		outlines := make([][]Point, len(parts))
+		for i, part := range parts {
+			for _, v := range part {
+				outlines[i] = append(outlines[i], v.point())
+			}
+		}
+		polygons := groupRings(outlines)
+		head(wkbMultiPolygon, srid)
+		buf = L.AppendUint32(buf, uint32(len(polygons)))
+		for _, polygon := range polygons {
+			head(wkbPolygon, 0)
+			var rs [][]vertex
+			for _, i := range polygon {
+				rs = append(rs, parts[i])
+			}
+			rings(rs)
+		}
+	}
+	return buf
+}
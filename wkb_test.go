@@ -0,0 +1,31 @@
+package shapefile
+
+import (
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEWKB(t *testing.T) {
+	tests := []struct {
+		content  RecordContent
+		srid     int
+		expected string
+	}{
+		{&Point{1, 2}, 4326, "0101000020E6100000" + "000000000000F03F" + "0000000000000040"},
+		{&PointM{1, 2, math.NaN()}, 0, "0101000040" + "000000000000F03F" + "0000000000000040" + "010000000000F87F"},
+		{polyline(Point{0, 0}, Point{1, 0}), 0, "0105000000" + "01000000" + "0102000000" + "02000000" +
+			"0000000000000000" + "0000000000000000" + "000000000000F03F" + "0000000000000000"},
+		// an unclosed ring is closed
+		{&Polygon{PolyLine{Parts: []int32{0}, Points: []Point{{0, 0}, {0, 1}, {1, 0}}}}, 0, "0106000000" + "01000000" + "0103000000" + "01000000" + "04000000" +
+			"0000000000000000" + "0000000000000000" + "0000000000000000" + "000000000000F03F" +
+			"000000000000F03F" + "0000000000000000" + "0000000000000000" + "0000000000000000"},
+		{&Null{}, 0, ""},
+	}
+	for _, test := range tests {
+		if got := strings.ToUpper(hex.EncodeToString(EWKB(test.content, test.srid))); got != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package shapefile
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// WKT returns the shape as OGC Well Known Text: POINT, LINESTRING or
+// POLYGON, or their MULTI variants for several parts. Coordinates carry Z
+// values if the shape has them, and M values if none of them is missing.
+// Polygons are grouped into outer rings and their holes, MultiPatches are
+// written as a MULTIPOLYGON of their triangles. Null shapes are empty.
+func WKT(content RecordContent) string {
+	z, m := zmOf(content)
+	for _, v := range m {
+		if math.IsNaN(v) {
+			m = nil
+			break
+		}
+	}
+	hasZ, hasM := z != nil, m != nil
+	parts, areal := verticesOf(content)
+	mp, faces := content.(*MultiPatch)
+	if faces {
+		parts, hasM = triangleRings(mp), false
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	dim := ""
+	switch {
+	case hasZ && hasM:
+		dim = " ZM"
+	case hasZ:
+		dim = " Z"
+	case hasM:
+		dim = " M"
+	}
+	coordinates := func(vs []vertex) string {
+		var b strings.Builder
+		b.WriteByte('(')
+		for i, v := range vs {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(strconv.FormatFloat(v.X, 'f', -1, 64) + " " + strconv.FormatFloat(v.Y, 'f', -1, 64))
+			if hasZ {
+				b.WriteString(" " + strconv.FormatFloat(v.Z, 'f', -1, 64))
+			}
+			if hasM {
+				b.WriteString(" " + strconv.FormatFloat(v.M, 'f', -1, 64))
+			}
+		}
+		b.WriteByte(')')
+		return b.String()
+	}
+	if faces {
+		// each triangle on its own, they may lie on top of one another
+		var triangles []string
+		for _, part := range parts {
+			triangles = append(triangles, "("+coordinates(part)+")")
+		}
+		return "MULTIPOLYGON" + dim + " (" + strings.Join(triangles, ", ") + ")"
+	}
+	if areal {
+		rings := make([][]Point, len(parts))
+		for i, part := range parts {
+			for _, v := range part {
+				rings[i] = append(rings[i], v.point())
+			}
+		}
+		var polygons []string
+		for _, polygon := range groupRings(rings) {
+			var rs []string
+			for _, i := range polygon {
+				vs := parts[i]
+				if len(vs) > 0 && vs[0].point() != vs[len(vs)-1].point() {
+					vs = append(vs[:len(vs):len(vs)], vs[0])
+				}
+				rs = append(rs, coordinates(vs))
+			}
+			polygons = append(polygons, "("+strings.Join(rs, ", ")+")")
+		}
+		if len(polygons) == 1 {
+			return "POLYGON" + dim + " " + polygons[0]
+		}
+		return "MULTIPOLYGON" + dim + " (" + strings.Join(polygons, ", ") + ")"
+	}
+	switch shapeTypeOf(content) {
+	case POINT, POINT_M, POINT_Z:
+		return "POINT" + dim + " " + coordinates(parts[0])
+	case MULTI_POINT, MULTI_POINT_M, MULTI_POINT_Z:
+		var points []string
+		for _, part := range parts {
+			points = append(points, coordinates(part))
+		}
+		return "MULTIPOINT" + dim + " (" + strings.Join(points, ", ") + ")"
+	}
+	if len(parts) == 1 {
+		return "LINESTRING" + dim + " " + coordinates(parts[0])
+	}
+	var lines []string
+	for _, part := range parts {
+		lines = append(lines, coordinates(part))
+	}
+	return "MULTILINESTRING" + dim + " (" + strings.Join(lines, ", ") + ")"
+}
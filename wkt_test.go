@@ -0,0 +1,32 @@
+package shapefile
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWKT(t *testing.T) {
+	tests := []struct {
+		content  RecordContent
+		expected string
+	}{
+		{&Point{1.5, -2}, "POINT (1.5 -2)"},
+		{&PointZ{1, 2, 3, math.NaN()}, "POINT Z (1 2 3)"},
+		{&PointM{1, 2, 4}, "POINT M (1 2 4)"},
+		{&MultiPoint{Points: []Point{{0, 0}, {1, 1}}}, "MULTIPOINT ((0 0), (1 1))"},
+		{polyline(Point{0, 0}, Point{1, 1}), "LINESTRING (0 0, 1 1)"},
+		{&PolyLineZ{Parts: []int32{0, 2}, Points: []Point{{0, 0}, {1, 1}, {2, 2}, {3, 3}}, ZArray: []float64{1, 2, 3, 4}, MArray: []float64{0, 1, 2, 3}},
+			"MULTILINESTRING ZM ((0 0 1 0, 1 1 2 1), (2 2 3 2, 3 3 4 3))"},
+		{polygon(square(0, 0, 4, 4), square(1, 1, 2, 2)), "POLYGON ((0 0, 0 4, 4 4, 4 0, 0 0), (1 1, 1 2, 2 2, 2 1, 1 1))"},
+		{polygon(square(0, 0, 1, 1), square(2, 0, 3, 1)), "MULTIPOLYGON (((0 0, 0 1, 1 1, 1 0, 0 0)), ((2 0, 2 1, 3 1, 3 0, 2 0)))"},
+		{&Null{}, ""},
+		// a triangle above another isn't a hole of it
+		{&MultiPatch{Parts: []int32{0, 3}, PartTypes: []PartType{TRIANGLE_FAN, TRIANGLE_FAN}, Points: []Point{{0, 0}, {4, 0}, {0, 4}, {1, 1}, {2, 1}, {1, 2}}, ZArray: []float64{0, 0, 0, 5, 5, 5}},
+			"MULTIPOLYGON Z (((0 0 0, 4 0 0, 0 4 0, 0 0 0)), ((1 1 5, 2 1 5, 1 2 5, 1 1 5)))"},
+	}
+	for _, test := range tests {
+		if got := WKT(test.content); got != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Writer writes records to a .shp file along with the .shx index and the
+// .dbf attributes. The headers are filled in by Close, which is why the
+// files need to be seekable.
+type Writer struct {
+	Header MainFileHeader
+	Fields []FieldDescriptor
+
+	shp, shx, dbf io.WriteSeeker
+	closers       []io.Closer
+	length        int32 // of the .shp file in 16 bit words
+	numRecords    int32
+	box           Box
+	zRange        ZRange
+	mRange        MRange
+}
+
+// NewFieldDescriptor returns the description of a .dbf column. Names are
+// cut to 10 characters.
+func NewFieldDescriptor(name string, typ FieldType, length, decimals uint8) (fd FieldDescriptor) {
+	copy(fd.FieldName_[:10], name)
+	fd.FieldType = typ
+	fd.FieldLength = length
+	fd.DecimalCount = decimals
+	return
+}
+
+// NewWriter prepares writing shapes of the given type to shp, shx and dbf.
+// shx and dbf may be nil to skip writing them.
+func NewWriter(shp, shx, dbf io.WriteSeeker, shapeType ShapeType, fields []FieldDescriptor) (w *Writer, err error) {
+	w = &Writer{shp: shp, shx: shx, dbf: dbf, Fields: fields, length: 50}
+	w.Header = MainFileHeader{Version: 1000, ShapeType: shapeType}
+	w.box = Box{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	w.zRange = ZRange{math.Inf(1), math.Inf(-1)}
+	w.mRange = MRange{math.Inf(1), math.Inf(-1)}
+	// placeholders, rewritten by Close
+	if err = writeMainFileHeader(shp, &w.Header); err != nil {
+		return nil, err
+	}
+	if shx != nil {
+		if err = writeMainFileHeader(shx, &w.Header); err != nil {
+			return nil, err
+		}
+	}
+	if dbf != nil {
+		if err = w.writeDBFHead(); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// CreateShapefile creates the .shp, .shx and .dbf files for fn, which is
+// the name of the .shp file.
+func CreateShapefile(fn string, shapeType ShapeType, fields []FieldDescriptor) (w *Writer, err error) {
+	base := strings.TrimSuffix(fn, ".shp")
+	var files []*os.File
+	for _, ext := range []string{".shp", ".shx", ".dbf"} {
+		var file *os.File
+		if file, err = os.Create(base + ext); err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	if w, err = NewWriter(files[0], files[1], files[2], shapeType, fields); err != nil {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, err
+	}
+	for _, f := range files {
+		w.closers = append(w.closers, f)
+	}
+	return
+}
+
+// inferFields derives .dbf columns for values read as text from formats
+// without types. Columns of integers become Number fields, of other
+// numbers Number fields with decimals, anything else Character fields.
+// Numbers with leading zeros, like postal codes, are kept as text. The
+// values are returned converted, empty ones as nil.
+func inferFields(names []string, rows [][]string) (fields []FieldDescriptor, values [][]interface{}) {
+	values = make([][]interface{}, len(rows))
+	for i := range rows {
+		values[i] = make([]interface{}, len(names))
+	}
+	for col, name := range fieldNames(names) {
+		ints, floats, decimals, width := true, true, 0, 1
+		for _, row := range rows {
+			s := row[col]
+			if s == "" {
+				continue
+			}
+			width = max(width, len(s))
+			if digits := strings.TrimLeft(s, "+-"); len(digits) > 1 && digits[0] == '0' && !strings.ContainsAny(s, ".eE") {
+				ints, floats = false, false
+			}
+			if _, err := strconv.ParseInt(s, 10, 64); err != nil || len(s) > 18 {
+				ints = false
+			}
+			if f, err := strconv.ParseFloat(s, 64); err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				floats = false
+			} else if i := strings.IndexByte(strconv.FormatFloat(f, 'f', -1, 64), '.'); i != -1 {
+				decimals = max(decimals, len(strconv.FormatFloat(f, 'f', -1, 64))-i-1)
+			}
+		}
+		decimals = min(decimals, 15)
+		typ := FieldType(Character)
+		switch {
+		case ints:
+			typ = Number
+		case floats:
+			typ, width = Number, 1
+			for _, row := range rows {
+				if f, err := strconv.ParseFloat(row[col], 64); err == nil {
+					width = max(width, len(strconv.FormatFloat(f, 'f', decimals, 64)))
+				}
+			}
+			if width > 20 {
+				typ = Character
+			}
+		}
+		if typ == Character {
+			decimals, width = 0, min(width, 254)
+		}
+		fields = append(fields, NewFieldDescriptor(name, typ, uint8(width), uint8(decimals)))
+		for i, row := range rows {
+			s := row[col]
+			switch {
+			case s == "":
+			case typ == Character:
+				values[i][col] = s
+			case ints:
+				values[i][col], _ = strconv.ParseInt(s, 10, 64)
+			default:
+				values[i][col], _ = strconv.ParseFloat(s, 64)
+			}
+		}
+	}
+	return
+}
+
+// fieldNames makes names usable as .dbf field names: characters other
+// than ASCII letters, digits and underscores are replaced, and names are
+// cut to 10 characters, numbering those that are no longer unique.
+func fieldNames(names []string) (fixed []string) {
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.Map(func(r rune) rune {
+			if r == '_' || r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				return r
+			}
+			return '_'
+		}, name)
+		if name == "" {
+			name = "FIELD"
+		}
+		if len(name) > 10 {
+			name = name[:10]
+		}
+		unique := name
+		for i := 1; seen[strings.ToUpper(unique)]; i++ {
+			suffix := "_" + strconv.Itoa(i)
+			unique = name[:min(len(name), 10-len(suffix))] + suffix
+		}
+		seen[strings.ToUpper(unique)] = true
+		fixed = append(fixed, unique)
+	}
+	return
+}
+
+// Write appends a record. The shape must be of the writer's type or
+// nil, which is written as a null shape. attributes holds a value for
+// each field, nil values are written blank.
+func (w *Writer) Write(content RecordContent, attributes []interface{}) (err error) {
+	if content == nil {
+		content = &Null{}
+	}
+	if typ := shapeTypeOf(content); typ != NULL_SHAPE && typ != w.Header.ShapeType {
+		return fmt.Errorf("can't write %s to a %s file", typ, w.Header.ShapeType)
+	}
+	var raw []byte
+	if raw, err = encodeContent(content); err != nil {
+		return
+	}
+	if w.dbf != nil {
+		if len(attributes) != len(w.Fields) {
+			return fmt.Errorf("expected %d attributes, got %d", len(w.Fields), len(attributes))
+		}
+		var entry []byte
+		if entry, err = w.encodeEntry(attributes); err != nil {
+			return
+		}
+		if _, err = w.dbf.Write(entry); err != nil {
+			return
+		}
+	}
+
+	w.numRecords++
+	rh := MainFileRecordHeader{w.numRecords, int32(len(raw) / 2)}
+	if w.shx != nil {
+		if err = binary.Write(w.shx, B, ShxRecord{w.length, rh.ContentLength}); err != nil {
+			return
+		}
+	}
+	if err = binary.Write(w.shp, B, rh); err != nil {
+		return
+	}
+	if _, err = w.shp.Write(raw); err != nil {
+		return
+	}
+	w.length += 4 + rh.ContentLength
+	w.updateExtent(content)
+	return
+}
+
+func (w *Writer) updateExtent(content RecordContent) {
+	if b, ok := boxOf(content); ok {
+		w.box.Xmin, w.box.Ymin = math.Min(w.box.Xmin, b.Xmin), math.Min(w.box.Ymin, b.Ymin)
+		w.box.Xmax, w.box.Ymax = math.Max(w.box.Xmax, b.Xmax), math.Max(w.box.Ymax, b.Ymax)
+	}
+	z, m := zmOf(content)
+	for _, v := range z {
+		w.zRange.Zmin, w.zRange.Zmax = math.Min(w.zRange.Zmin, v), math.Max(w.zRange.Zmax, v)
+	}
+	for _, v := range m {
+		if measured(v) {
+			w.mRange.Mmin, w.mRange.Mmax = math.Min(w.mRange.Mmin, v), math.Max(w.mRange.Mmax, v)
+		}
+	}
+}
+
+// zmOf returns the Z and M values of a shape.
+func zmOf(content RecordContent) (z, m []float64) {
+	switch s := content.(type) {
+	case *PointM:
+		return nil, []float64{s.M}
+	case *PointZ:
+		return []float64{s.Z}, []float64{s.M}
+	case *MultiPointM:
+		return nil, s.MArray
+	case *MultiPointZ:
+		return s.ZArray, s.MArray
+	case *PolyLineM:
+		return nil, s.MArray
+	case *PolygonM:
+		return nil, s.MArray
+	case *PolyLineZ:
+		return s.ZArray, s.MArray
+	case *PolygonZ:
+		return s.ZArray, s.MArray
+	case *MultiPatch:
+		return s.ZArray, s.MArray
+	}
+	return
+}
+
+// Close fills in the file headers and closes the files if the writer
+// created them.
+func (w *Writer) Close() (err error) {
+	defer func() {
+		for _, c := range w.closers {
+			if cerr := c.Close(); err == nil {
+				err = cerr
+			}
+		}
+	}()
+	h := &w.Header
+	if w.box.Xmin <= w.box.Xmax {
+		h.Xmin, h.Ymin, h.Xmax, h.Ymax = w.box.Xmin, w.box.Ymin, w.box.Xmax, w.box.Ymax
+	}
+	if w.zRange.Zmin <= w.zRange.Zmax {
+		h.Zmin, h.Zmax = w.zRange.Zmin, w.zRange.Zmax
+	}
+	if w.mRange.Mmin <= w.mRange.Mmax {
+		h.Mmin, h.Mmax = w.mRange.Mmin, w.mRange.Mmax
+	}
+
+	h.FileLength = w.length
+	if _, err = w.shp.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	if err = writeMainFileHeader(w.shp, h); err != nil {
+		return
+	}
+	if w.shx != nil {
+		shxHeader := *h
+		shxHeader.FileLength = 50 + 4*w.numRecords
+		if _, err = w.shx.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		if err = writeMainFileHeader(w.shx, &shxHeader); err != nil {
+			return
+		}
+	}
+	if w.dbf != nil {
+		if _, err = w.dbf.Write([]byte{0x1a}); err != nil {
+			return
+		}
+		if _, err = w.dbf.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		err = w.writeDBFHead()
+	}
+	return
+}
+
+func writeMainFileHeader(w io.Writer, h *MainFileHeader) (err error) {
+	head := make([]byte, 100)
+	B.PutUint32(head[0:], 9994)
+	B.PutUint32(head[24:], uint32(h.FileLength))
+	L.PutUint32(head[28:], uint32(h.Version))
+	L.PutUint32(head[32:], uint32(h.ShapeType))
+	for i, f := range []float64{h.Xmin, h.Ymin, h.Xmax, h.Ymax, h.Zmin, h.Zmax, toNoData(h.Mmin), toNoData(h.Mmax)} {
+		L.PutUint64(head[36+8*i:], math.Float64bits(f))
+	}
+	_, err = w.Write(head)
+	return
+}
+
+func (w *Writer) writeDBFHead() (err error) {
+	hdr := newDBFFileHeader(w.Fields, int(w.numRecords))
+	if err = binary.Write(w.dbf, L, &hdr); err != nil {
+		return
+	}
+	if err = binary.Write(w.dbf, L, w.Fields); err != nil {
+		return
+	}
+	_, err = w.dbf.Write([]byte{0x0d}) // end of the field descriptors
+	return
+}
+
+func newDBFFileHeader(fields []FieldDescriptor, numRecords int) DBFFileHeader {
+	now := time.Now()
+	hdr := DBFFileHeader{
+		Version:    3,
+		LastUpdate: [3]uint8{uint8(now.Year() - 1900), uint8(now.Month()), uint8(now.Day())},
+		NumRecords: uint32(numRecords),
+		LenHeader:  uint16(32 + 32*len(fields) + 1),
+		LenRecord:  1,
+	}
+	for _, fd := range fields {
+		hdr.LenRecord += uint16(fd.FieldLength)
+	}
+	return hdr
+}
+
+// encodeEntry formats a .dbf record. Character fields are padded with
+// blanks, numbers are right aligned with the field's decimal count.
+func (w *Writer) encodeEntry(attributes []interface{}) (entry []byte, err error) {
+	entry = []byte{' '} // not deleted
+	for i, fd := range w.Fields {
+		var str string
+		switch v := attributes[i].(type) {
+		case nil:
+		case string:
+			str = v
+		case int64:
+			str = strconv.FormatInt(v, 10)
+		case int:
+			str = strconv.Itoa(v)
+		case float64:
+			str = strconv.FormatFloat(v, 'f', int(fd.DecimalCount), 64)
+		case bool:
+			str = "F"
+			if v {
+				str = "T"
+			}
+		case time.Time:
+			str = v.Format("20060102")
+		default:
+			str = fmt.Sprint(v)
+		}
+		n := int(fd.FieldLength)
+		switch fd.FieldType {
+		case Number, Float:
+			if len(str) > n {
+				return nil, fmt.Errorf("value %s too long for field %s", str, fd.FieldName())
+			}
+			str = strings.Repeat(" ", n-len(str)) + str
+		default:
+			if len(str) > n {
+				str = str[:n]
+			}
+			str += strings.Repeat(" ", n-len(str))
+		}
+		entry = append(entry, str...)
+	}
+	return
+}
+
+// encodeContent encodes a shape including its type. M values are left
+// out if a shape has none, Z values are zero if missing. Missing M
+// values, NaN, are written as NoData.
+func encodeContent(content RecordContent) (raw []byte, err error) {
+	typ := shapeTypeOf(content)
+	buf := &bytes.Buffer{}
+	put := func(data ...interface{}) {
+		for _, d := range data {
+			if err == nil {
+				err = binary.Write(buf, L, d)
+			}
+		}
+	}
+	orZeros := func(values []float64, n int) []float64 {
+		if len(values) == n {
+			return values
+		}
+		return make([]float64, n)
+	}
+	mRange := func(m []float64) MRange {
+		var r MRange
+		r.Mmin, r.Mmax = rangeOf(m, 0, 0)
+		return MRange{toNoData(r.Mmin), toNoData(r.Mmax)}
+	}
+	zRange := func(z []float64) ZRange {
+		var r ZRange
+		r.Zmin, r.Zmax = rangeOf(z, 0, 0)
+		return r
+	}
+	putM := func(m []float64, n int) {
+		if len(m) == n && n > 0 {
+			sentinel := make([]float64, n)
+			for i, v := range m {
+				sentinel[i] = toNoData(v)
+			}
+			put(mRange(m), sentinel)
+		}
+	}
+
+	put(typ)
+	switch s := content.(type) {
+	case *Null:
+	case *Point:
+		put(s)
+	case *PointM:
+		put(s.X, s.Y, toNoData(s.M))
+	case *PointZ:
+		put(s.X, s.Y, s.Z, toNoData(s.M))
+	case *MultiPoint:
+		put(s.Box, int32(len(s.Points)), s.Points)
+	case *MultiPointM:
+		put(s.Box, int32(len(s.Points)), s.Points)
+		putM(s.MArray, len(s.Points))
+	case *MultiPointZ:
+		z := orZeros(s.ZArray, len(s.Points))
+		put(s.Box, int32(len(s.Points)), s.Points, zRange(z), z)
+		putM(s.MArray, len(s.Points))
+	case *PolyLine:
+		put(s.Box, int32(len(s.Parts)), int32(len(s.Points)), s.Parts, s.Points)
+	case *Polygon:
+		put(s.Box, int32(len(s.Parts)), int32(len(s.Points)), s.Parts, s.Points)
+	case *PolyLineM:
+		put(s.Box, int32(len(s.Parts)), int32(len(s.Points)), s.Parts, s.Points)
+		putM(s.MArray, len(s.Points))
+	case *PolygonM:
+		put(s.Box, int32(len(s.Parts)), int32(len(s.Points)), s.Parts, s.Points)
+		putM(s.MArray, len(s.Points))
+	case *PolyLineZ:
+		z := orZeros(s.ZArray, len(s.Points))
+		put(s.Box, int32(len(s.Parts)), int32(len(s.Points)), s.Parts, s.Points, zRange(z), z)
+		putM(s.MArray, len(s.Points))
+	case *PolygonZ:
+		z := orZeros(s.ZArray, len(s.Points))
+		put(s.Box, int32(len(s.Parts)), int32(len(s.Points)), s.Parts, s.Points, zRange(z), z)
+		putM(s.MArray, len(s.Points))
+	case *MultiPatch:
+		types := s.PartTypes
+		if len(types) != len(s.Parts) {
+			types = make([]PartType, len(s.Parts))
+		}
+		z := orZeros(s.ZArray, len(s.Points))
+		put(s.Box, int32(len(s.Parts)), int32(len(s.Points)), s.Parts, types, s.Points, zRange(z), z)
+		putM(s.MArray, len(s.Points))
+	default:
+		return nil, fmt.Errorf("can't write %T", content)
+	}
+	return buf.Bytes(), err
+}
+
+// shapeTypeOf returns the type of a shape as stored in the file.
+func shapeTypeOf(content RecordContent) ShapeType {
+	switch content.(type) {
+	case *Point:
+		return POINT
+	case *PolyLine:
+		return POLY_LINE
+	case *Polygon:
+		return POLYGON
+	case *MultiPoint:
+		return MULTI_POINT
+	case *PointZ:
+		return POINT_Z
+	case *PolyLineZ:
+		return POLY_LINE_Z
+	case *PolygonZ:
+		return POLYGON_Z
+	case *MultiPointZ:
+		return MULTI_POINT_Z
+	case *PointM:
+		return POINT_M
+	case *PolyLineM:
+		return POLY_LINE_M
+	case *PolygonM:
+		return POLYGON_M
+	case *MultiPointM:
+		return MULTI_POINT_M
+	case *MultiPatch:
+		return MULTI_PATCH
+	}
+	return NULL_SHAPE
+}
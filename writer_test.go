@@ -0,0 +1,222 @@
+package shapefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	ds, err := OpenDataset(testfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(t.TempDir(), "copy.shp")
+	w, err := CreateShapefile(fn, ds.Shapefile.Header.ShapeType, ds.DBF.FieldDescriptors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range ds.Features() {
+		if err = w.Write(f.Record.Content, f.Attributes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	orig, _ := os.ReadFile(testfile)
+	written, _ := os.ReadFile(fn)
+	if !bytes.Equal(orig, written) {
+		t.Errorf("written .shp differs from the original")
+	}
+
+	copied, err := OpenDataset(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(copied.DBF.Entries, ds.DBF.Entries) {
+		t.Errorf("attributes differ")
+	}
+	shx, err := os.Open(filepath.Join(filepath.Dir(fn), "copy.shx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shx.Close()
+	index, err := NewShxFile(shx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shp, _ := os.Open(fn)
+	defer shp.Close()
+	rec, err := index.ReadRecord(shp, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rec.Content, ds.Shapefile.Records[42].Content) {
+		t.Errorf("unexpected record read through the index")
+	}
+}
+
+func TestWriterTypes(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "m.shp")
+	fields := []FieldDescriptor{NewFieldDescriptor("NAME", Character, 8, 0), NewFieldDescriptor("VALUE", Number, 8, 2)}
+	w, err := CreateShapefile(fn, MULTI_POINT_M, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mp := &MultiPointM{Points: []Point{{1, 2}, {3, 4}}, MArray: []float64{7, 8}}
+	updateBox(mp)
+	if err = w.Write(mp, []interface{}{"a", 1.5}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(nil, []interface{}{nil, nil}); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Write(&Point{1, 2}, []interface{}{"b", 2.0}); err == nil {
+		t.Errorf("expected writing a point to a multipoint file to fail")
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := OpenDataset(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ds.Shapefile.Header
+	if h.Xmin != 1 || h.Ymax != 4 || h.Mmin != 7 || h.Mmax != 8 {
+		t.Errorf("unexpected header:\n%v", h)
+	}
+	if len(ds.Shapefile.Records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(ds.Shapefile.Records))
+	}
+	if _, ok := ds.Shapefile.Records[1].Content.(*Null); !ok {
+		t.Errorf("expected null shape, got %T", ds.Shapefile.Records[1].Content)
+	}
+	want := [][]interface{}{{"a       ", 1.5}, {"        ", nil}}
+	if !reflect.DeepEqual(ds.DBF.Entries, want) {
+		t.Errorf("unexpected attributes: %q", ds.DBF.Entries)
+	}
+}
+
+func TestWriterNoData(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "z.shp")
+	w, err := CreateShapefile(fn, POLY_LINE_Z, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nan := math.NaN()
+	lines := []*PolyLineZ{
+		{Parts: []int32{0}, Points: []Point{{0, 0}, {1, 0}, {2, 0}}, ZArray: []float64{5, 6, 7}, MArray: []float64{1, nan, 3}},
+		{Parts: []int32{0}, Points: []Point{{0, 1}, {1, 1}}, ZArray: []float64{5, 6}, MArray: []float64{nan, -2e38}},
+	}
+	for _, pl := range lines {
+		updateBox(pl)
+		if err = w.Write(pl, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(fn)
+	sentinel := make([]byte, 8)
+	L.PutUint64(sentinel, math.Float64bits(NoData))
+	if n := bytes.Count(raw, sentinel); n != 5 {
+		t.Errorf("expected 3 no data values and a no data range, found %d", n)
+	}
+
+	ds, err := OpenDataset(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := ds.Shapefile.Header; h.Mmin != 1 || h.Mmax != 3 {
+		t.Errorf("no data values in the header range: %v %v", h.Mmin, h.Mmax)
+	}
+	first := ds.Shapefile.Records[0].Content.(*PolyLineZ)
+	if first.MRange != (MRange{1, 3}) || first.MArray[0] != 1 || !math.IsNaN(first.MArray[1]) {
+		t.Errorf("unexpected M values: %v %v", first.MRange, first.MArray)
+	}
+	second := ds.Shapefile.Records[1].Content.(*PolyLineZ)
+	if !math.IsNaN(second.MRange.Mmin) || !math.IsNaN(second.MArray[1]) {
+		t.Errorf("expected no M values: %v %v", second.MRange, second.MArray)
+	}
+
+	// M values are optional
+	fn = filepath.Join(t.TempDir(), "m.shp")
+	ds = NewDataset(POLY_LINE_M, nil, nil)
+	pl := &PolyLineM{Parts: []int32{0}, Points: []Point{{0, 0}, {1, 1}}}
+	updateBox(pl)
+	ds.Add(pl, nil)
+	if err = ds.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	if ds, err = OpenDataset(fn); err != nil {
+		t.Fatal(err)
+	}
+	if got := ds.Shapefile.Records[0].Content.(*PolyLineM); !reflect.DeepEqual(got, pl) {
+		t.Errorf("expected no M values, got %v", got)
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, L, POINT_Z)
+	binary.Write(&buf, L, [3]float64{1, 2, 3})
+	p, err := RecordRecordContent(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pz := p.(*PointZ); pz.Z != 3 || !math.IsNaN(pz.M) {
+		t.Errorf("unexpected point: %v", pz)
+	}
+}
+
+func TestSaveDeleted(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "deleted.shp")
+	ds := NewDataset(POINT, []FieldDescriptor{NewFieldDescriptor("NAME", Character, 5, 0)}, nil)
+	for i, name := range []string{"Kiel", "Ulm", "Jena"} {
+		ds.Add(&Point{float64(i), 0}, []interface{}{name})
+	}
+	ds.DBF.Deleted[1] = true
+	if err := ds.Save(fn); err != nil {
+		t.Fatal(err)
+	}
+	back, err := OpenDataset(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	features := back.Features()
+	if len(features) != 2 || !reflect.DeepEqual(back.DBF.Deleted, []bool{false, false}) {
+		t.Fatalf("expected 2 live features, got %d %v", len(features), back.DBF.Deleted)
+	}
+	if formatValue(features[1].Attributes[0]) != "Jena" || features[1].Record.Header.RecordNumber != 2 || *features[1].Record.Content.(*Point) != (Point{2, 0}) {
+		t.Errorf("expected Jena as record 2, got %v", features[1].Attributes)
+	}
+}
+
+func TestInferFields(t *testing.T) {
+	names := []string{"id", "zip", "area", "name", "description_en", "description_de"}
+	rows := [][]string{
+		{"1", "01067", "12.5", "Dresden", "x", "y"},
+		{"-20", "80331", "3", "München", "", ""},
+		{"", "", "1e-3", "", "", ""},
+	}
+	fields, values := inferFields(names, rows)
+	expected := []FieldDescriptor{
+		NewFieldDescriptor("id", Number, 3, 0),
+		NewFieldDescriptor("zip", Character, 5, 0),
+		NewFieldDescriptor("area", Number, 6, 3),
+		NewFieldDescriptor("name", Character, 8, 0),
+		NewFieldDescriptor("descriptio", Character, 1, 0),
+		NewFieldDescriptor("descript_1", Character, 1, 0),
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected %v, got %v", expected, fields)
+	}
+	if !reflect.DeepEqual(values[1], []interface{}{int64(-20), "80331", 3.0, "München", nil, nil}) || values[2][0] != nil || values[2][2] != 0.001 {
+		t.Errorf("unexpected values %v", values)
+	}
+}